@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrorAggregator collapses repeated identical errors into a single summary
+// entry. The first occurrence of an error is logged immediately; further
+// occurrences within the window are counted and reported when the window
+// expires or Flush is called. A zero window aggregates until Flush.
+type ErrorAggregator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[errorKey]*aggregatedError
+	now     func() time.Time
+}
+
+type errorKey struct {
+	message string
+	source  string
+	err     string
+}
+
+type aggregatedError struct {
+	level      string
+	data       map[string]interface{}
+	firstSeen  time.Time
+	lastSeen   time.Time
+	suppressed int
+}
+
+// NewErrorAggregator creates an aggregator with the given suppression window.
+func NewErrorAggregator(window time.Duration) *ErrorAggregator {
+	return &ErrorAggregator{
+		window:  window,
+		entries: make(map[errorKey]*aggregatedError),
+		now:     time.Now,
+	}
+}
+
+// Log records an error originating from source (typically a metric name).
+// Identical errors (same message, source and error string) seen again within
+// the window are suppressed. The error string is added to data as "error".
+func (a *ErrorAggregator) Log(ctx context.Context, level, message, source string, err error, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["error"] = err.Error()
+
+	if a == nil {
+		logEvent(ctx, level, message, data)
+		return
+	}
+
+	key := errorKey{message: message, source: source, err: err.Error()}
+	now := a.now()
+
+	a.mu.Lock()
+	entry, ok := a.entries[key]
+	if ok && (a.window <= 0 || now.Sub(entry.firstSeen) < a.window) {
+		entry.suppressed++
+		entry.lastSeen = now
+		a.mu.Unlock()
+		return
+	}
+	var expired *aggregatedError
+	if ok && entry.suppressed > 0 {
+		expired = entry
+	}
+	a.entries[key] = &aggregatedError{level: level, data: data, firstSeen: now, lastSeen: now}
+	a.mu.Unlock()
+
+	if expired != nil {
+		logSummary(ctx, key, expired)
+	}
+	logEvent(ctx, level, message, data)
+}
+
+// Flush emits a summary for every error that was suppressed and resets the
+// aggregator. It should be called at the end of every collection cycle.
+func (a *ErrorAggregator) Flush(ctx context.Context) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	entries := a.entries
+	a.entries = make(map[errorKey]*aggregatedError)
+	a.mu.Unlock()
+
+	keys := make([]errorKey, 0, len(entries))
+	for key, entry := range entries {
+		if entry.suppressed > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return keys[i].message < keys[j].message
+	})
+
+	for _, key := range keys {
+		logSummary(ctx, key, entries[key])
+	}
+}
+
+// FlushExpired emits summaries for errors whose window has expired and forgets
+// them, keeping errors that are still within their window. It is meant for
+// daemon mode, where an error that stops recurring would otherwise only be
+// summarized at shutdown.
+func (a *ErrorAggregator) FlushExpired(ctx context.Context) {
+	if a == nil || a.window <= 0 {
+		return
+	}
+
+	now := a.now()
+	expired := map[errorKey]*aggregatedError{}
+	a.mu.Lock()
+	for key, entry := range a.entries {
+		if now.Sub(entry.firstSeen) >= a.window {
+			expired[key] = entry
+			delete(a.entries, key)
+		}
+	}
+	a.mu.Unlock()
+
+	for key, entry := range expired {
+		if entry.suppressed > 0 {
+			logSummary(ctx, key, entry)
+		}
+	}
+}
+
+func logSummary(ctx context.Context, key errorKey, entry *aggregatedError) {
+	data := make(map[string]interface{}, len(entry.data)+4)
+	for k, v := range entry.data {
+		data[k] = v
+	}
+	data["count"] = entry.suppressed + 1
+	data["suppressed"] = entry.suppressed
+	data["first_seen"] = entry.firstSeen.Format(time.RFC3339)
+	data["last_seen"] = entry.lastSeen.Format(time.RFC3339)
+
+	logEvent(ctx, entry.level, key.message+" (repeated)", data)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestErrorAggregator(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	agg := NewErrorAggregator(time.Minute)
+	agg.now = func() time.Time { return now }
+
+	errDown := errors.New("connection refused")
+	for i := 0; i < 5; i++ {
+		agg.Log(ctx, "error", "Error fetching metric from DB", "metric.a", errDown, nil)
+	}
+	agg.Log(ctx, "error", "Error fetching metric from DB", "metric.b", errDown, nil)
+
+	keyA := errorKey{message: "Error fetching metric from DB", source: "metric.a", err: errDown.Error()}
+	keyB := errorKey{message: "Error fetching metric from DB", source: "metric.b", err: errDown.Error()}
+	if got := agg.entries[keyA].suppressed; got != 4 {
+		t.Errorf("Expected 4 suppressed errors for metric.a, got %d", got)
+	}
+	if got := agg.entries[keyB].suppressed; got != 0 {
+		t.Errorf("Expected 0 suppressed errors for metric.b, got %d", got)
+	}
+
+	// Once the window expires the error is logged again and counting restarts
+	now = now.Add(2 * time.Minute)
+	agg.Log(ctx, "error", "Error fetching metric from DB", "metric.a", errDown, nil)
+	if got := agg.entries[keyA].suppressed; got != 0 {
+		t.Errorf("Expected suppressed count to reset after window, got %d", got)
+	}
+
+	agg.Flush(ctx)
+	if len(agg.entries) != 0 {
+		t.Errorf("Expected entries to be cleared after Flush, got %d", len(agg.entries))
+	}
+}
+
+func TestErrorAggregatorNil(t *testing.T) {
+	var agg *ErrorAggregator
+	// A nil aggregator logs directly and must not panic
+	agg.Log(context.Background(), "error", "Failed to send metric", "metric.a", errors.New("boom"), nil)
+	agg.Flush(context.Background())
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// aggregateFuncs are the client-side aggregations available for multi-row
+// results. Each returns a new accumulator for one group of rows.
+var aggregateFuncs = map[string]func() accumulator{
+	"avg":   func() accumulator { return &avgAccumulator{} },
+	"min":   func() accumulator { return &extremeAccumulator{keep: func(v, cur float64) bool { return v < cur }} },
+	"max":   func() accumulator { return &extremeAccumulator{keep: func(v, cur float64) bool { return v > cur }} },
+	"sum":   func() accumulator { return &sumAccumulator{} },
+	"count": func() accumulator { return &countAccumulator{} },
+	"p50":   func() accumulator { return &percentileAccumulator{p: 50} },
+	"p95":   func() accumulator { return &percentileAccumulator{p: 95} },
+	"p99":   func() accumulator { return &percentileAccumulator{p: 99} },
+}
+
+// accumulator folds the values of a group of rows into their aggregate as
+// the rows are read. Only the percentiles keep the values themselves.
+type accumulator interface {
+	add(value float64)
+	result() float64
+}
+
+type sumAccumulator struct{ total float64 }
+
+func (a *sumAccumulator) add(value float64) { a.total += value }
+func (a *sumAccumulator) result() float64   { return a.total }
+
+type avgAccumulator struct {
+	total float64
+	n     int
+}
+
+func (a *avgAccumulator) add(value float64) { a.total += value; a.n++ }
+func (a *avgAccumulator) result() float64   { return a.total / float64(a.n) }
+
+// extremeAccumulator keeps the minimum or maximum, as decided by keep.
+type extremeAccumulator struct {
+	keep  func(value, current float64) bool
+	value float64
+	set   bool
+}
+
+func (a *extremeAccumulator) add(value float64) {
+	if !a.set || a.keep(value, a.value) {
+		a.value, a.set = value, true
+	}
+}
+
+func (a *extremeAccumulator) result() float64 { return a.value }
+
+type countAccumulator struct{ n int }
+
+func (a *countAccumulator) add(float64)     { a.n++ }
+func (a *countAccumulator) result() float64 { return float64(a.n) }
+
+// percentileAccumulator keeps the values of the group to rank them.
+type percentileAccumulator struct {
+	p      float64
+	values []float64
+}
+
+func (a *percentileAccumulator) add(value float64) { a.values = append(a.values, value) }
+func (a *percentileAccumulator) result() float64   { return percentile(a.values, a.p) }
+
+// Aggregate reduces every row of a query result to a single gauge, e.g. the
+// p95 over a set of latencies, instead of requiring the SQL to do it.
+type Aggregate string
+
+// UnmarshalYAML accepts one of the names in aggregateFuncs.
+func (a *Aggregate) UnmarshalYAML(node *yaml.Node) error {
+	if _, ok := aggregateFuncs[node.Value]; !ok && node.Value != "" {
+		names := make([]string, 0, len(aggregateFuncs))
+		for name := range aggregateFuncs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("line %d: invalid aggregate %q (must be one of %s)", node.Line, node.Value, strings.Join(names, ", "))
+	}
+	*a = Aggregate(node.Value)
+	return nil
+}
+
+// aggregateSamples reduces samples to one per distinct name and tag set, in
+// order of first appearance. Rows without tag columns form a single group.
+func aggregateSamples(samples []sample, agg Aggregate) []sample {
+	a := newSampleAggregator(agg)
+	if a == nil {
+		return samples
+	}
+	for _, s := range samples {
+		a.add(s)
+	}
+	return a.samples()
+}
+
+// sampleAggregator aggregates samples as they are added, so a row mode query
+// with aggregate only holds one accumulator per series, not its rows.
+type sampleAggregator struct {
+	newAccumulator func() accumulator
+	groups         map[string]int
+	first          []sample
+	accumulators   []accumulator
+}
+
+// newSampleAggregator returns the aggregator of agg, or nil when agg is not
+// set.
+func newSampleAggregator(agg Aggregate) *sampleAggregator {
+	fn := aggregateFuncs[string(agg)]
+	if fn == nil {
+		return nil
+	}
+	return &sampleAggregator{newAccumulator: fn, groups: map[string]int{}}
+}
+
+// add folds s into the group of its name and tag set.
+func (a *sampleAggregator) add(s sample) {
+	key := sampleKey(s)
+	i, ok := a.groups[key]
+	if !ok {
+		i = len(a.first)
+		a.groups[key] = i
+		a.first = append(a.first, sample{Name: s.Name, Tags: s.Tags, Host: s.Host})
+		a.accumulators = append(a.accumulators, a.newAccumulator())
+	}
+	a.accumulators[i].add(s.Value)
+}
+
+// samples returns one sample per group, in order of first appearance.
+func (a *sampleAggregator) samples() []sample {
+	out := make([]sample, len(a.first))
+	for i, s := range a.first {
+		s.Value = a.accumulators[i].result()
+		out[i] = s
+	}
+	return out
+}
+
+// limitSeries keeps the samples of the first limit distinct series, in
+// order of first appearance, and returns the number of series dropped. A
+// limit of zero keeps every sample.
+func limitSeries(samples []sample, limit int) ([]sample, int) {
+	if limit <= 0 {
+		return samples, 0
+	}
+	kept := make(map[string]bool)
+	dropped := make(map[string]bool)
+	out := samples[:0:0]
+	for _, s := range samples {
+		key := sampleKey(s)
+		if !kept[key] && len(kept) >= limit {
+			dropped[key] = true
+			continue
+		}
+		kept[key] = true
+		out = append(out, s)
+	}
+	return out, len(dropped)
+}
+
+// sampleKey identifies the series a sample belongs to.
+func sampleKey(s sample) string {
+	return s.Host + "\x00" + s.Name + "\x00" + strings.Join(s.Tags, "\x00")
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
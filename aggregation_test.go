@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAggregateSamples(t *testing.T) {
+	values := []sample{{Value: 4}, {Value: 1}, {Value: 3}, {Value: 2}}
+
+	tests := []struct {
+		agg  Aggregate
+		want float64
+	}{
+		{agg: "avg", want: 2.5},
+		{agg: "min", want: 1},
+		{agg: "max", want: 4},
+		{agg: "sum", want: 10},
+		{agg: "count", want: 4},
+		{agg: "p50", want: 2.5},
+		{agg: "p95", want: 3.85},
+		{agg: "p99", want: 3.97},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(string(tc.agg), func(t *testing.T) {
+			got := aggregateSamples(values, tc.agg)
+			if len(got) != 1 {
+				t.Fatalf("Expected one sample, got %d", len(got))
+			}
+			if diff := got[0].Value - tc.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Expected %v, got %v", tc.want, got[0].Value)
+			}
+		})
+	}
+}
+
+func TestAggregateSamplesGroupsByTags(t *testing.T) {
+	samples := []sample{
+		{Value: 10, Tags: []string{"region:us"}},
+		{Value: 1, Tags: []string{"region:eu"}},
+		{Value: 20, Tags: []string{"region:us"}},
+	}
+	want := []sample{
+		{Value: 20, Tags: []string{"region:us"}},
+		{Value: 1, Tags: []string{"region:eu"}},
+	}
+	if got := aggregateSamples(samples, "max"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestAggregateSamplesGroupsByHost(t *testing.T) {
+	samples := []sample{
+		{Value: 10, Host: "web-1"},
+		{Value: 1, Host: "web-2"},
+		{Value: 20, Host: "web-1"},
+	}
+	want := []sample{
+		{Value: 30, Host: "web-1"},
+		{Value: 1, Host: "web-2"},
+	}
+	if got := aggregateSamples(samples, "sum"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestLimitSeries(t *testing.T) {
+	samples := []sample{
+		{Value: 1, Tags: []string{"region:us"}},
+		{Value: 2, Tags: []string{"region:eu"}},
+		{Value: 3, Tags: []string{"region:us"}},
+		{Value: 4, Tags: []string{"region:ap"}},
+		{Value: 5, Tags: []string{"region:sa"}},
+	}
+
+	tests := []struct {
+		name        string
+		limit       int
+		wantValues  []float64
+		wantDropped int
+	}{
+		{name: "Unlimited", limit: 0, wantValues: []float64{1, 2, 3, 4, 5}},
+		{name: "KeepsRowsOfKeptSeries", limit: 2, wantValues: []float64{1, 2, 3}, wantDropped: 2},
+		{name: "AboveCount", limit: 10, wantValues: []float64{1, 2, 3, 4, 5}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, dropped := limitSeries(samples, tc.limit)
+			var values []float64
+			for _, s := range got {
+				values = append(values, s.Value)
+			}
+			if !reflect.DeepEqual(values, tc.wantValues) || dropped != tc.wantDropped {
+				t.Errorf("Expected %v with %d dropped, got %v with %d dropped", tc.wantValues, tc.wantDropped, values, dropped)
+			}
+		})
+	}
+}
+
+func TestAggregateUnmarshal(t *testing.T) {
+	var metric MetricConfig
+	if err := yaml.Unmarshal([]byte("aggregate: p95"), &metric); err != nil || metric.Aggregate != "p95" {
+		t.Errorf("Expected p95, got %q (err %v)", metric.Aggregate, err)
+	}
+	if err := yaml.Unmarshal([]byte("aggregate: median"), &metric); err == nil {
+		t.Error("Expected error for unknown aggregate")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const datadogEventsPath = "/api/v1/events"
+
+// Alert levels. They double as Datadog event alert types, except critical
+// which is posted as "error".
+const (
+	alertOK       = "ok"
+	alertWarning  = "warning"
+	alertCritical = "critical"
+)
+
+// AlertConfig posts a Datadog event when a metric crosses a threshold, so
+// simple alerts work before monitors are configured.
+type AlertConfig struct {
+	WarnAbove     *float64 `yaml:"warn_above,omitempty"`
+	CriticalAbove *float64 `yaml:"critical_above,omitempty"`
+	WarnBelow     *float64 `yaml:"warn_below,omitempty"`
+	CriticalBelow *float64 `yaml:"critical_below,omitempty"`
+}
+
+// UnmarshalYAML decodes the rule and checks that the thresholds are consistent.
+func (a *AlertConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain AlertConfig
+	var rule plain
+	if err := node.Decode(&rule); err != nil {
+		return err
+	}
+	*a = AlertConfig(rule)
+	switch {
+	case a.WarnAbove == nil && a.CriticalAbove == nil && a.WarnBelow == nil && a.CriticalBelow == nil:
+		return fmt.Errorf("line %d: alert requires at least one threshold", node.Line)
+	case a.WarnAbove != nil && a.CriticalAbove != nil && *a.WarnAbove > *a.CriticalAbove:
+		return fmt.Errorf("line %d: warn_above must not be greater than critical_above", node.Line)
+	case a.WarnBelow != nil && a.CriticalBelow != nil && *a.WarnBelow < *a.CriticalBelow:
+		return fmt.Errorf("line %d: warn_below must not be less than critical_below", node.Line)
+	}
+	return nil
+}
+
+// evaluate returns the alert level of value and a description of the
+// threshold that was crossed.
+func (a *AlertConfig) evaluate(value float64) (string, string) {
+	switch {
+	case a.CriticalAbove != nil && value > *a.CriticalAbove:
+		return alertCritical, "above critical threshold " + formatValue(*a.CriticalAbove)
+	case a.CriticalBelow != nil && value < *a.CriticalBelow:
+		return alertCritical, "below critical threshold " + formatValue(*a.CriticalBelow)
+	case a.WarnAbove != nil && value > *a.WarnAbove:
+		return alertWarning, "above warning threshold " + formatValue(*a.WarnAbove)
+	case a.WarnBelow != nil && value < *a.WarnBelow:
+		return alertWarning, "below warning threshold " + formatValue(*a.WarnBelow)
+	}
+	return alertOK, "back within thresholds"
+}
+
+// Event is a Datadog event as accepted by the events API.
+type Event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	AlertType      string   `json:"alert_type,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Host           string   `json:"host,omitempty"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceTypeName string   `json:"source_type_name,omitempty"`
+}
+
+// EventSender is implemented by senders that can post Datadog events.
+type EventSender interface {
+	SendEvent(ctx context.Context, event Event) error
+}
+
+// SendEvent posts an event to the Datadog events API.
+func (d *DatadogClient) SendEvent(ctx context.Context, event Event) error {
+	if d.Debug {
+		logEvent(ctx, "debug", "Sending event to Datadog", map[string]interface{}{
+			"title": event.Title,
+			"tags":  event.Tags,
+			"url":   d.apiURL(datadogEventsPath),
+		})
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping actual event submission", map[string]interface{}{
+			"title":      event.Title,
+			"alert_type": event.AlertType,
+		})
+		return nil
+	}
+	if _, err := d.doAPI(ctx, http.MethodPost, datadogEventsPath, event, nil); err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	return nil
+}
+
+// alertTracker remembers the alert level of every series so events are only
+// posted when a threshold is crossed, not on every run.
+type alertTracker struct {
+	mu     sync.Mutex
+	levels map[string]string
+}
+
+// transition records level for key and reports whether it changed. A series
+// seen for the first time counts as previously OK.
+func (t *alertTracker) transition(key, level string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.levels == nil {
+		t.levels = make(map[string]string)
+	}
+	prev, ok := t.levels[key]
+	if !ok {
+		prev = alertOK
+	}
+	t.levels[key] = level
+	return prev, prev != level
+}
+
+// alertEvent builds the event posted when a series changes to level.
+func alertEvent(name string, value float64, level, reason string, tags []string, host string) Event {
+	alertType := level
+	title := fmt.Sprintf("[%s] %s %s", alertTitles[level], name, reason)
+	switch level {
+	case alertCritical:
+		alertType = "error"
+	case alertOK:
+		alertType = "success"
+		title = fmt.Sprintf("[Recovered] %s %s", name, reason)
+	}
+	return Event{
+		Title:          title,
+		Text:           fmt.Sprintf("%s is %s (%s).", name, formatValue(value), reason),
+		AlertType:      alertType,
+		Tags:           slices.Clone(tags),
+		Host:           host,
+		AggregationKey: name,
+		SourceTypeName: "sqlmetrics",
+	}
+}
+
+var alertTitles = map[string]string{
+	alertWarning:  "Warning",
+	alertCritical: "Critical",
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
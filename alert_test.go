@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// eventRecorder is a sender that records posted events.
+type eventRecorder struct {
+	MockMetricSender
+	Events []Event
+}
+
+func (e *eventRecorder) SendEvent(_ context.Context, event Event) error {
+	e.Events = append(e.Events, event)
+	return nil
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	var metric MetricConfig
+	input := "alert:\n  warn_above: 80\n  critical_above: 95\n  critical_below: 1\n"
+	if err := yaml.Unmarshal([]byte(input), &metric); err != nil {
+		t.Fatalf("Failed to parse alert: %v", err)
+	}
+
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 50, want: alertOK},
+		{value: 80, want: alertOK},
+		{value: 81, want: alertWarning},
+		{value: 96, want: alertCritical},
+		{value: 0, want: alertCritical},
+	}
+
+	for _, tc := range tests {
+		if got, _ := metric.Alert.evaluate(tc.value); got != tc.want {
+			t.Errorf("evaluate(%v): expected %s, got %s", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestAlertConfigValidation(t *testing.T) {
+	tests := []string{
+		"alert: {}",
+		"alert: {warn_above: 10, critical_above: 5}",
+		"alert: {warn_below: 1, critical_below: 5}",
+	}
+	for _, input := range tests {
+		var metric MetricConfig
+		if err := yaml.Unmarshal([]byte(input), &metric); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestCheckAlertsPostsOnTransitions(t *testing.T) {
+	sender := &eventRecorder{}
+	c := &Collector{Sender: sender}
+	critical := 100.0
+	metric := MetricConfig{Name: "queue.depth", Tags: []string{"env:test"}, Alert: &AlertConfig{CriticalAbove: &critical}}
+
+	for _, value := range []float64{10, 150, 200, 50} {
+		c.checkAlerts(context.Background(), metric, []sample{{Value: value}})
+	}
+
+	if len(sender.Events) != 2 {
+		t.Fatalf("Expected a critical and a recovery event, got %+v", sender.Events)
+	}
+	if sender.Events[0].AlertType != "error" || sender.Events[1].AlertType != "success" {
+		t.Errorf("Unexpected alert types %q, %q", sender.Events[0].AlertType, sender.Events[1].AlertType)
+	}
+	if sender.Events[0].Tags[0] != "env:test" {
+		t.Errorf("Expected metric tags on event, got %v", sender.Events[0].Tags)
+	}
+}
+
+func TestDatadogClientSendEvent(t *testing.T) {
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != datadogEventsPath {
+			t.Errorf("Expected events path, got %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "test-key", BaseURL: server.URL}
+	event := alertEvent("queue.depth", 150, alertCritical, "above critical threshold 100", []string{"env:test"}, "")
+	if err := client.SendEvent(context.Background(), event); err != nil {
+		t.Fatalf("SendEvent failed: %v", err)
+	}
+	if got.Title != "[Critical] queue.depth above critical threshold 100" || got.AlertType != "error" {
+		t.Errorf("Unexpected event %+v", got)
+	}
+}
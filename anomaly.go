@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+)
+
+// Anomaly defaults.
+const (
+	defaultAnomalyWindow     = 30
+	defaultAnomalyMinSamples = 5
+	defaultAnomalyThreshold  = 3
+)
+
+// anomalySuffix is appended to the series name of the anomaly score.
+const anomalySuffix = ".anomaly_score"
+
+// AnomalyConfig scores every new value of a metric against a rolling window
+// of its previous values in daemon mode, as a cheap pre-filter before
+// building Datadog monitors.
+type AnomalyConfig struct {
+	// Window is the number of previous values kept per series (default 30).
+	Window int `yaml:"window,omitempty"`
+	// MinSamples is the number of values needed before scoring (default 5).
+	MinSamples int `yaml:"min_samples,omitempty"`
+	// Threshold is the score above which the deviation is logged (default 3).
+	Threshold float64 `yaml:"threshold,omitempty"`
+}
+
+// window returns the configured window size.
+func (a *AnomalyConfig) window() int {
+	if a.Window > 0 {
+		return a.Window
+	}
+	return defaultAnomalyWindow
+}
+
+// minSamples returns the configured minimum, at most the window size.
+func (a *AnomalyConfig) minSamples() int {
+	if a.MinSamples > 0 {
+		return min(a.MinSamples, a.window())
+	}
+	return min(defaultAnomalyMinSamples, a.window())
+}
+
+// threshold returns the configured threshold.
+func (a *AnomalyConfig) threshold() float64 {
+	if a.Threshold > 0 {
+		return a.Threshold
+	}
+	return defaultAnomalyThreshold
+}
+
+// validate checks that the settings are not negative.
+func (a *AnomalyConfig) validate() error {
+	if a.Window < 0 || a.MinSamples < 0 || a.Threshold < 0 {
+		return errors.New("anomaly window, min_samples and threshold must not be negative")
+	}
+	return nil
+}
+
+// anomalyTracker keeps the rolling window of every series.
+type anomalyTracker struct {
+	mu      sync.Mutex
+	windows map[string][]float64
+}
+
+// score returns the absolute z-score of value against the window of key,
+// and whether there were enough values with any spread to compute it. With
+// record set, value is then added to the window, dropping the oldest value
+// beyond the window size.
+func (t *anomalyTracker) score(key string, value float64, config *AnomalyConfig, record bool) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.windows == nil {
+		t.windows = make(map[string][]float64)
+	}
+	window := t.windows[key]
+	score, ok := zScore(window, value, config.minSamples())
+	if record {
+		window = append(window, value)
+		if len(window) > config.window() {
+			window = window[len(window)-config.window():]
+		}
+		t.windows[key] = window
+	}
+	return score, ok
+}
+
+// zScore returns how many standard deviations value is from the mean of
+// window. It reports false for a window shorter than minSamples or without
+// spread, where any change would score infinitely.
+func zScore(window []float64, value float64, minSamples int) (float64, bool) {
+	if len(window) == 0 || len(window) < minSamples {
+		return 0, false
+	}
+	mean := sum(window) / float64(len(window))
+	var variance float64
+	for _, v := range window {
+		variance += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(window)))
+	if stddev == 0 {
+		return 0, false
+	}
+	return math.Abs(value-mean) / stddev, true
+}
+
+// checkAnomalies submits <series>.anomaly_score for every point of a metric
+// with anomaly scoring, and logs the points scoring above the threshold.
+// Cached results are scored but not added to the windows. Failures are only
+// logged; they do not fail the metric.
+func (c *Collector) checkAnomalies(ctx context.Context, telemetry *Telemetry, metric MetricConfig, points []sample, cached bool) {
+	if metric.Anomaly == nil {
+		return
+	}
+	sender := c.senderFor(metric)
+	for _, p := range points {
+		score, ok := c.anomalies.score(sampleKey(p), p.Value, metric.Anomaly, !cached)
+		if !ok {
+			continue
+		}
+		name, tags := seriesName(metric, p.Name), c.seriesTags(ctx, metric, p.Tags)
+		if score > metric.Anomaly.threshold() {
+			logEvent(ctx, "warn", "Metric value deviates from its rolling window", map[string]interface{}{
+				"metric":    name,
+				"value":     p.Value,
+				"score":     score,
+				"threshold": metric.Anomaly.threshold(),
+			})
+		}
+		err := c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+			return sender.SendMetric(ctx, name+anomalySuffix, score, tags, metric.sampleHost(p))
+		})
+		if err != nil {
+			logEvent(ctx, "warn", "Failed to send anomaly score", map[string]interface{}{
+				"metric": name + anomalySuffix,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
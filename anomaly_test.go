@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestZScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    []float64
+		value     float64
+		want      float64
+		wantValid bool
+	}{
+		{name: "Empty", window: nil, value: 1},
+		{name: "TooFewSamples", window: []float64{1, 2}, value: 3},
+		{name: "NoSpread", window: []float64{5, 5, 5}, value: 9},
+		{name: "AtMean", window: []float64{1, 3, 1, 3}, value: 2, want: 0, wantValid: true},
+		{name: "ThreeDeviations", window: []float64{1, 3, 1, 3}, value: 5, want: 3, wantValid: true},
+		{name: "Below", window: []float64{1, 3, 1, 3}, value: 0, want: 2, wantValid: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := zScore(tc.window, tc.value, 3)
+			if ok != tc.wantValid {
+				t.Fatalf("Expected valid %v, got %v", tc.wantValid, ok)
+			}
+			if math.Abs(got-tc.want) > 1e-9 {
+				t.Errorf("Expected score %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAnomalyTrackerWindow(t *testing.T) {
+	var tracker anomalyTracker
+	config := &AnomalyConfig{Window: 3, MinSamples: 2}
+	for _, v := range []float64{100, 1, 3, 1} {
+		tracker.score("k", v, config, true)
+	}
+	if got := tracker.windows["k"]; len(got) != 3 || got[0] != 1 {
+		t.Errorf("Expected the window to keep the last 3 values, got %v", got)
+	}
+	tracker.score("k", 50, config, false)
+	if got := len(tracker.windows["k"]); got != 3 {
+		t.Errorf("Expected an unrecorded value to leave the window, got %d values", got)
+	}
+}
+
+func TestCollectOnceAnomalyScore(t *testing.T) {
+	sender := &MockMetricSender{}
+	metric := MetricConfig{Name: "a", Source: "exec", Anomaly: &AnomalyConfig{MinSamples: 2}}
+	collector := &Collector{Config: &Config{}, Sender: sender}
+
+	var scores []float64
+	for _, value := range []string{"1", "3", "5"} {
+		metric.Command = []string{"echo", `{"samples":[{"value":` + value + `}]}`}
+		collector.Config.Metrics = []MetricConfig{metric}
+		sender.SentMetrics = nil
+		if summary := collector.CollectOnce(context.Background()); summary.Failed != 0 {
+			t.Fatalf("Expected no failures, got %+v", summary)
+		}
+		for _, s := range sender.SentMetrics {
+			if s.Metric == "a.anomaly_score" {
+				scores = append(scores, s.Points[0][1])
+			}
+		}
+	}
+	if len(scores) != 1 || scores[0] != 3 {
+		t.Errorf("Expected one anomaly score of 3, got %v", scores)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// Kinds of audited queries.
+const (
+	auditQuery   = "query"
+	auditExplain = "explain"
+)
+
+// AuditConfig enables the audit log, which records every query the
+// collector runs independently of the log level. Entries are JSON lines
+// appended to File, sent to syslog, or both.
+type AuditConfig struct {
+	// File is appended to; it is never truncated or rotated by the collector.
+	File string `yaml:"file,omitempty"`
+	// Syslog is "local" for the local syslog daemon, or a network address
+	// such as udp://syslog.internal:514.
+	Syslog string `yaml:"syslog,omitempty"`
+}
+
+// enabled reports whether an audit destination is configured.
+func (a AuditConfig) enabled() bool {
+	return a.File != "" || a.Syslog != ""
+}
+
+// auditIdentity is who runs the queries and against which database. It is
+// the same for every entry of a process.
+type auditIdentity struct {
+	DBType string `json:"db_type"`
+	DBHost string `json:"db_host,omitempty"`
+	DBName string `json:"db_name,omitempty"`
+	DBUser string `json:"db_user,omitempty"`
+	OSUser string `json:"os_user,omitempty"`
+	Host   string `json:"host,omitempty"`
+	RunID  string `json:"run_id"`
+}
+
+// auditEntry is one line of the audit log. The query is identified by its
+// fingerprint only, so literals never reach the audit log.
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	auditIdentity
+	Kind        string  `json:"kind"`
+	Metric      string  `json:"metric"`
+	Fingerprint string  `json:"fingerprint"`
+	DurationMs  float64 `json:"duration_ms"`
+	Rows        int     `json:"rows"`
+	Status      string  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// auditLog writes audit entries. It is safe for concurrent use; a nil
+// *auditLog records nothing.
+type auditLog struct {
+	identity auditIdentity
+
+	mu      sync.Mutex
+	writers []io.WriteCloser
+}
+
+// openAuditLog opens the destinations of config, or returns nil when the
+// audit log is disabled. dbURL is only used to identify the database.
+func openAuditLog(config AuditConfig, dbType, dbURL string) (*auditLog, error) {
+	if !config.enabled() {
+		return nil, nil
+	}
+	a := &auditLog{identity: newAuditIdentity(dbType, dbURL)}
+	if config.File != "" {
+		f, err := os.OpenFile(config.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		a.writers = append(a.writers, f)
+	}
+	if config.Syslog != "" {
+		w, err := dialAuditSyslog(config.Syslog)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		a.writers = append(a.writers, w)
+	}
+	return a, nil
+}
+
+// newAuditIdentity describes the database of dbURL and the process.
+func newAuditIdentity(dbType, dbURL string) auditIdentity {
+	identity := auditIdentity{DBType: dbType, RunID: runID}
+	identity.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		identity.OSUser = u.Username
+	}
+	identity.DBHost, identity.DBName, identity.DBUser = databaseLocation(dbType, dbURL)
+	return identity
+}
+
+// Record writes an entry for a query of the metric. A failure to write is
+// logged but does not fail the query.
+func (a *auditLog) Record(ctx context.Context, kind string, metric MetricConfig, rows int, duration time.Duration, err error) {
+	if a == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:          time.Now().UTC(),
+		auditIdentity: a.identity,
+		Kind:          kind,
+		Metric:        metric.Name,
+		Fingerprint:   queryFingerprint(metric.Query),
+		DurationMs:    float64(duration.Microseconds()) / 1000.0,
+		Rows:          rows,
+		Status:        "ok",
+	}
+	if err != nil && !isEmptyResult(err) {
+		entry.Status = "error"
+		entry.Error = logRedactor.RedactString(err.Error())
+	}
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, w := range a.writers {
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			logEvent(ctx, "warn", "Failed to write audit log entry", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+// Close closes the destinations.
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var errs []error
+	for _, w := range a.writers {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// dialAuditSyslog is not supported on this platform.
+func dialAuditSyslog(string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+)
+
+// dialAuditSyslog connects to the syslog daemon named by addr: "local" or a
+// URL such as udp://host:514.
+func dialAuditSyslog(addr string) (io.WriteCloser, error) {
+	const priority = syslog.LOG_INFO | syslog.LOG_AUTH
+	if addr == "local" {
+		return syslog.New(priority, programName)
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q (must be local or network://host:port)", addr)
+	}
+	return syslog.Dial(u.Scheme, u.Host, priority, programName)
+}
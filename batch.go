@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+)
+
+// Limits of one series payload accepted by the Datadog API.
+const (
+	maxPayloadSeries = 500
+	maxPayloadBytes  = 5_000_000
+)
+
+var expvarPayloadChunks = expvar.NewInt("payload_chunks")
+
+// payloadChunk is one encoded request of a batch.
+type payloadChunk struct {
+	series  int
+	payload []byte
+}
+
+// chunkSeries encodes series into payloads of at most maxSeries series and
+// maxBytes bytes, splitting a payload over the size limit in halves. A
+// single series over the limit is still sent on its own, for the API to
+// reject.
+func (d *DatadogClient) chunkSeries(series []DataSeries, maxSeries, maxBytes int) ([]payloadChunk, error) {
+	var chunks []payloadChunk
+	var split func(part []DataSeries) error
+	split = func(part []DataSeries) error {
+		payload, err := d.encodePayload(Metric{Series: part})
+		if err != nil {
+			return err
+		}
+		if len(payload) > maxBytes && len(part) > 1 {
+			half := len(part) / 2
+			if err := split(part[:half]); err != nil {
+				return err
+			}
+			return split(part[half:])
+		}
+		chunks = append(chunks, payloadChunk{series: len(part), payload: payload})
+		return nil
+	}
+	for start := 0; start < len(series); start += maxSeries {
+		if err := split(series[start:min(start+maxSeries, len(series))]); err != nil {
+			return nil, fmt.Errorf("failed to encode JSON: %w", err)
+		}
+	}
+	return chunks, nil
+}
+
+// Flush submits the series buffered in batch mode, in as many requests as
+// the payload limits require.
+func (d *DatadogClient) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	chunks, err := d.chunkSeries(pending, maxPayloadSeries, maxPayloadBytes)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	stats := flushStats{Chunks: len(chunks)}
+	for _, chunk := range chunks {
+		stats.Bytes += len(chunk.payload)
+		if _, err := d.submit(ctx, d.seriesURL(), chunk.payload); err != nil {
+			errs = append(errs, fmt.Errorf("failed to submit %d series: %w", chunk.series, err))
+		}
+	}
+	expvarPayloadChunks.Add(int64(len(chunks)))
+	d.mu.Lock()
+	d.lastFlush = stats
+	d.mu.Unlock()
+
+	logEvent(ctx, "info", "Batch sent", map[string]interface{}{
+		"series": len(pending),
+		"chunks": stats.Chunks,
+		"bytes":  stats.Bytes,
+		"failed": len(errs),
+	})
+	return errors.Join(errs...)
+}
+
+// Close submits any series still buffered.
+func (d *DatadogClient) Close(ctx context.Context) error {
+	return d.Flush(ctx)
+}
+
+// flushStats describes the requests of a flushed batch.
+type flushStats struct {
+	Chunks int
+	Bytes  int
+}
+
+// LastFlush returns the requests of the last flushed batch, and false when
+// batching is disabled.
+func (d *DatadogClient) LastFlush() (flushStats, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lastFlush, d.Batch
+}
+
+// flushStatsSender is implemented by senders that batch series, so the
+// collector can report how its batches were chunked.
+type flushStatsSender interface {
+	LastFlush() (flushStats, bool)
+}
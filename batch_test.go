@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestChunkSeries(t *testing.T) {
+	series := func(n int, tagLen int) []DataSeries {
+		out := make([]DataSeries, n)
+		for i := range out {
+			out[i] = DataSeries{Metric: "test.metric", Points: [][]float64{{1, 1}}, Tags: []string{strings.Repeat("x", tagLen)}, Type: "gauge"}
+		}
+		return out
+	}
+	client := &DatadogClient{}
+	one, err := client.encodePayload(Metric{Series: series(1, 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		series    []DataSeries
+		maxSeries int
+		maxBytes  int
+		want      []int
+	}{
+		{name: "Empty", series: nil, maxSeries: 500, maxBytes: maxPayloadBytes, want: nil},
+		{name: "Within limits", series: series(3, 100), maxSeries: 500, maxBytes: maxPayloadBytes, want: []int{3}},
+		{name: "Series limit", series: series(5, 100), maxSeries: 2, maxBytes: maxPayloadBytes, want: []int{2, 2, 1}},
+		{name: "Size limit", series: series(4, 100), maxSeries: 500, maxBytes: 2*len(one) + 10, want: []int{2, 2}},
+		{name: "Oversized series sent alone", series: series(2, 100), maxSeries: 500, maxBytes: 10, want: []int{1, 1}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			chunks, err := client.chunkSeries(tc.series, tc.maxSeries, tc.maxBytes)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var got []int
+			for _, chunk := range chunks {
+				got = append(got, chunk.series)
+				var payload Metric
+				if err := json.Unmarshal(chunk.payload, &payload); err != nil {
+					t.Fatalf("Expected valid JSON, got %v", err)
+				}
+				if len(payload.Series) != chunk.series {
+					t.Errorf("Expected %d series in the payload, got %d", chunk.series, len(payload.Series))
+				}
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("Expected chunks %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("Expected chunks %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDatadogClientBatch(t *testing.T) {
+	var mu sync.Mutex
+	var requests []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Metric
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Expected valid JSON, got %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, len(payload.Series))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := newDatadogClient("test-key", DatadogConfig{URL: server.URL, Batch: true})
+	ctx := context.Background()
+	for i := 0; i < maxPayloadSeries+1; i++ {
+		if err := client.SendMetric(ctx, "test.metric", float64(i), nil, ""); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Fatalf("Expected no request before the flush, got %d", len(requests))
+	}
+	if err := client.Flush(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(requests) != 2 || requests[0] != maxPayloadSeries || requests[1] != 1 {
+		t.Errorf("Expected requests of %d and 1 series, got %v", maxPayloadSeries, requests)
+	}
+	stats, batch := client.LastFlush()
+	if !batch || stats.Chunks != 2 || stats.Bytes == 0 {
+		t.Errorf("Expected 2 chunks in batch mode, got %+v (batch %v)", stats, batch)
+	}
+
+	if err := client.Flush(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Expected an empty flush to send nothing, got %d requests", len(requests))
+	}
+}
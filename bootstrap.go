@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// bootstrapMetric is the temporary metric submitted by the bootstrap command.
+const bootstrapMetric = "datadog_sql_metrics.bootstrap"
+
+// bootstrapStep is the outcome of one bootstrap check.
+type bootstrapStep struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// runBootstrap verifies the end-to-end flow for a new installation: credentials,
+// database access, one configured query and a metric round trip through Datadog.
+func runBootstrap(ctx context.Context, opts *options, _ []string) error {
+	var steps []bootstrapStep
+	record := func(name string, err error, detail string) bool {
+		step := bootstrapStep{Name: name, Passed: err == nil, Detail: detail}
+		if err != nil {
+			step.Detail = logRedactor.RedactString(err.Error())
+		}
+		steps = append(steps, step)
+		return err == nil
+	}
+	defer func() { writeBootstrapReport(os.Stdout, steps) }()
+
+	apiKey := os.Getenv("DATADOG_API_KEY")
+	appKey := os.Getenv("DATADOG_APP_KEY")
+	logRedactor.AddSecret(apiKey)
+	logRedactor.AddSecret(appKey)
+	var errKeys error
+	switch {
+	case apiKey == "":
+		errKeys = errors.New("DATADOG_API_KEY is not set")
+	case appKey == "":
+		errKeys = errors.New("DATADOG_APP_KEY is not set (required to read the metric back)")
+	}
+	keysOK := record("Datadog credentials", errKeys, "DATADOG_API_KEY and DATADOG_APP_KEY are set")
+
+	config, err := loadConfigFor(opts)
+	configOK := record("Configuration", err, fmt.Sprintf("%s loaded", opts.configFile))
+
+	urlEnv := defaultDatabaseURLEnv
+	var dbConfig DatabaseConfig
+	if configOK {
+		urlEnv, dbConfig = config.databaseURLEnv(), config.Database
+	}
+	db, err := openDB(ctx, urlEnv, dbConfig)
+	if record("Database connection", err, "connected") {
+		defer func() {
+			if closeErr := db.Close(); closeErr != nil {
+				logEvent(ctx, "warn", "Failed to close database connection", map[string]interface{}{"error": closeErr.Error()})
+			}
+		}()
+
+		if configOK {
+			if len(config.Metrics) == 0 {
+				record("Sample query", errors.New("no metrics configured"), "")
+			} else {
+				metric := config.Metrics[0]
+				value, err := func() (float64, error) {
+					if err := validateMetricQuery(metric); err != nil {
+						return 0, err
+					}
+					return (&SQLDB{DB: db}).QueryMetric(ctx, metric)
+				}()
+				record("Sample query", err, fmt.Sprintf("%s = %v", metric.Name, value))
+			}
+		}
+	}
+
+	if !keysOK {
+		return bootstrapResult(steps)
+	}
+
+	var ddConfig DatadogConfig
+	if configOK {
+		ddConfig = config.Datadog
+	}
+	client := bootstrapClient(apiKey, appKey, ddConfig)
+	client.Debug = opts.debug
+
+	runID := randomID()
+	tag := "bootstrap_id:" + runID
+	start := time.Now().Add(-time.Minute)
+	err = client.SendMetric(ctx, bootstrapMetric, 1, []string{tag}, "")
+	if !record("Metric submission", err, fmt.Sprintf("%s{%s} submitted", bootstrapMetric, tag)) {
+		return bootstrapResult(steps)
+	}
+
+	query := fmt.Sprintf("max:%s{%s}", bootstrapMetric, tag)
+	err = waitForPoints(ctx, client, query, start, 10*time.Second)
+	record("Metric query", err, "metric is queryable via the Datadog API")
+
+	return bootstrapResult(steps)
+}
+
+// bootstrapClient creates the client of the bootstrap round trip from cfg.
+// Batching is turned off so the bootstrap point is submitted, and its error
+// reported, by SendMetric itself.
+func bootstrapClient(apiKey, appKey string, cfg DatadogConfig) *DatadogClient {
+	cfg.Batch = false
+	client := newDatadogClient(apiKey, cfg)
+	client.AppKey = appKey
+	return client
+}
+
+// waitForPoints polls the Datadog query API until query returns at least one
+// point or ctx is done.
+func waitForPoints(ctx context.Context, client *DatadogClient, query string, from time.Time, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		points, err := client.QueryPoints(ctx, query, from, time.Now().Add(time.Minute))
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if points > 0 {
+			return nil
+		}
+
+		logEvent(ctx, "info", "Waiting for bootstrap metric to become queryable", map[string]interface{}{"query": query})
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("metric not queryable before timeout: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func bootstrapResult(steps []bootstrapStep) error {
+	failed := 0
+	for _, step := range steps {
+		if !step.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("bootstrap failed: %d of %d checks did not pass", failed, len(steps))
+	}
+	return nil
+}
+
+func writeBootstrapReport(w io.Writer, steps []bootstrapStep) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAIL")
+	for _, step := range steps {
+		result := "PASS"
+		if !step.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", step.Name, result, step.Detail)
+	}
+	_ = tw.Flush()
+}
+
+// randomID returns a random 16 character hex identifier.
+func randomID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
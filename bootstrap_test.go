@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForPoints(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("DD-APPLICATION-KEY") != "app-key" {
+			t.Errorf("Expected application key header")
+		}
+		calls++
+		if calls < 2 {
+			_, _ = w.Write([]byte(`{"status":"ok","series":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok","series":[{"pointlist":[[1700000000000,1]]}]}`))
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "api-key", AppKey: "app-key", BaseURL: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := waitForPoints(ctx, client, "max:test{*}", time.Now(), 10*time.Millisecond); err != nil {
+		t.Fatalf("waitForPoints failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 query calls, got %d", calls)
+	}
+}
+
+func TestBootstrapClientSubmitsWithBatch(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := bootstrapClient("api-key", "app-key", DatadogConfig{URL: server.URL, Batch: true})
+	if err := client.SendMetric(context.Background(), bootstrapMetric, 1, []string{"bootstrap_id:test"}, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the bootstrap point to be submitted by SendMetric, got %d requests", requests)
+	}
+	if client.AppKey != "app-key" {
+		t.Errorf("Expected application key app-key, got %q", client.AppKey)
+	}
+}
+
+func TestWriteBootstrapReport(t *testing.T) {
+	steps := []bootstrapStep{
+		{Name: "Configuration", Passed: true, Detail: "config.yaml loaded"},
+		{Name: "Database connection", Passed: false, Detail: "connection refused"},
+	}
+
+	var buf bytes.Buffer
+	writeBootstrapReport(&buf, steps)
+	if !strings.Contains(buf.String(), "PASS") || !strings.Contains(buf.String(), "FAIL") {
+		t.Errorf("Expected PASS and FAIL in report, got:\n%s", buf.String())
+	}
+	if err := bootstrapResult(steps); err == nil {
+		t.Error("Expected bootstrap to fail when a step failed")
+	}
+}
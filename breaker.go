@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Circuit breaker states.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+const defaultBreakerOpenDuration = time.Minute
+
+// CircuitBreakerConfig configures the per-database circuit breaker. It is
+// disabled unless FailureThreshold is positive.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive connection-level failures
+	// after which the database is skipped.
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	// OpenDuration is how long the database is skipped before a single probe
+	// query is allowed through (half-open state).
+	OpenDuration time.Duration `yaml:"open_duration,omitempty"`
+}
+
+// errCircuitOpen is returned for queries skipped because the breaker is open.
+var errCircuitOpen = errors.New("circuit breaker open: database skipped after repeated failures")
+
+// CircuitBreaker stops querying a database that keeps failing, so a down
+// database doesn't stall every collection cycle on connection timeouts.
+// A nil *CircuitBreaker always allows queries.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// NewCircuitBreaker returns a breaker for cfg, or nil when it is disabled.
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	openFor := cfg.OpenDuration
+	if openFor <= 0 {
+		openFor = defaultBreakerOpenDuration
+	}
+	return &CircuitBreaker{threshold: cfg.FailureThreshold, openFor: openFor, state: breakerClosed, now: time.Now}
+}
+
+// Allow reports whether a query may be executed. In the half-open state only
+// one probe is allowed at a time.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openFor {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record updates the breaker with the outcome of a query. Only errors that
+// indicate the database itself is unavailable count as failures.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		// The run was interrupted; the outcome says nothing about the database.
+		b.probing = false
+		return
+	}
+	if err == nil || !isDatabaseUnavailable(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// State returns the current state: closed, open or half_open.
+func (b *CircuitBreaker) State() string {
+	if b == nil {
+		return breakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerStateValue maps a breaker state to a gauge value for self-telemetry.
+func breakerStateValue(state string) float64 {
+	switch state {
+	case breakerOpen:
+		return 1
+	case breakerHalfOpen:
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// isDatabaseUnavailable reports whether err means the database could not be
+// reached or stopped responding, as opposed to a problem with one query.
+func isDatabaseUnavailable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "57P")
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 2006 || myErr.Number == 2013
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute})
+	b.now = func() time.Time { return now }
+	down := fmt.Errorf("query: %w", context.DeadlineExceeded)
+
+	b.Record(down)
+	if !b.Allow() || b.State() != breakerClosed {
+		t.Fatalf("Expected breaker to stay closed after one failure, got %s", b.State())
+	}
+	b.Record(down)
+	if b.Allow() || b.State() != breakerOpen {
+		t.Fatalf("Expected breaker to open after threshold, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() || b.State() != breakerHalfOpen {
+		t.Fatalf("Expected a half-open probe after open duration, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("Expected only one concurrent probe in half-open state")
+	}
+	b.Record(down)
+	if b.State() != breakerOpen {
+		t.Fatalf("Expected failed probe to reopen breaker, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Record(nil)
+	if b.State() != breakerClosed || !b.Allow() {
+		t.Fatalf("Expected successful probe to close breaker, got %s", b.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresQueryErrors(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1})
+	b.Record(&pq.Error{Code: "42P01"})
+	if b.State() != breakerClosed {
+		t.Errorf("Expected query errors not to open breaker, got %s", b.State())
+	}
+	b.Record(context.Canceled)
+	if b.State() != breakerClosed {
+		t.Errorf("Expected cancellation not to open breaker, got %s", b.State())
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerConfig{})
+	if b != nil {
+		t.Fatal("Expected nil breaker when failure_threshold is not set")
+	}
+	b.Record(context.DeadlineExceeded)
+	if !b.Allow() || b.State() != breakerClosed {
+		t.Error("Expected nil breaker to always allow queries")
+	}
+}
+
+func TestIsDatabaseUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Timeout", err: context.DeadlineExceeded, want: true},
+		{name: "Postgres connection failure", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "Postgres admin shutdown", err: &pq.Error{Code: "57P01"}, want: true},
+		{name: "Postgres undefined table", err: &pq.Error{Code: "42P01"}, want: false},
+		{name: "Generic error", err: errors.New("boom"), want: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isDatabaseUnavailable(tc.err); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// valueCache keeps query results of metrics with a cache_ttl across daemon
+// cycles, so expensive queries are not re-run on every interval. It is safe
+// for concurrent use.
+type valueCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedValue
+}
+
+type cachedValue struct {
+	samples []sample
+	fetched time.Time
+}
+
+func newValueCache() *valueCache {
+	return &valueCache{entries: make(map[string]cachedValue)}
+}
+
+// cacheKey identifies a metric's cached value. The query is part of the key so
+// a metric whose query changed on reload is not served a stale result.
+func cacheKey(metric MetricConfig) string {
+	return metric.Name + "\x00" + metric.Query
+}
+
+// get returns the cached samples for key if they were fetched less than ttl ago.
+func (c *valueCache) get(key string, ttl time.Duration, now time.Time) ([]sample, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.Sub(entry.fetched) >= ttl {
+		return nil, false
+	}
+	return entry.samples, true
+}
+
+// put stores freshly fetched samples.
+func (c *valueCache) put(key string, samples []sample, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedValue{samples: samples, fetched: now}
+}
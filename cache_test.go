@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValueCache(t *testing.T) {
+	cache := newValueCache()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metric := MetricConfig{Name: "warehouse.orders", Query: "SELECT count(*) FROM orders"}
+	key := cacheKey(metric)
+
+	if _, ok := cache.get(key, time.Minute, now); ok {
+		t.Fatal("Expected empty cache to miss")
+	}
+
+	cache.put(key, []sample{{Value: 42}}, now)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		wantHit bool
+	}{
+		{name: "Fresh value", elapsed: 30 * time.Second, wantHit: true},
+		{name: "Expired at TTL", elapsed: time.Minute, wantHit: false},
+		{name: "Expired after TTL", elapsed: 2 * time.Minute, wantHit: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			samples, ok := cache.get(key, time.Minute, now.Add(tc.elapsed))
+			if ok != tc.wantHit {
+				t.Fatalf("Expected hit=%v, got %v", tc.wantHit, ok)
+			}
+			if ok && samples[0].Value != 42 {
+				t.Errorf("Expected cached value 42, got %v", samples[0].Value)
+			}
+		})
+	}
+
+	changed := metric
+	changed.Query = "SELECT count(*) FROM orders WHERE paid"
+	if _, ok := cache.get(cacheKey(changed), time.Minute, now); ok {
+		t.Error("Expected a changed query not to hit the cache")
+	}
+}
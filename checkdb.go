@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// dbDiagnosticQueries are the queries of check-db for one database type:
+// the server version, whether the session is encrypted and whether the
+// account holds the read-only monitoring role.
+type dbDiagnosticQueries struct {
+	Version string
+	SSL     string
+	Role    string
+	// RoleName is the role or privilege checked by Role.
+	RoleName string
+}
+
+var dbDiagnostics = map[string]dbDiagnosticQueries{
+	"postgres": {
+		Version:  "SHOW server_version",
+		SSL:      "SELECT COALESCE((SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()), false)",
+		Role:     "SELECT pg_has_role(current_user, 'pg_monitor', 'USAGE')",
+		RoleName: "pg_monitor",
+	},
+	"mysql": {
+		Version:  "SELECT VERSION()",
+		SSL:      "SELECT COUNT(*) > 0 FROM performance_schema.session_status WHERE VARIABLE_NAME = 'Ssl_cipher' AND VARIABLE_VALUE <> ''",
+		Role:     "SELECT COUNT(*) > 0 FROM information_schema.USER_PRIVILEGES WHERE PRIVILEGE_TYPE = 'PROCESS'",
+		RoleName: "PROCESS",
+	},
+}
+
+// dbTarget is a database checked by check-db. Only the database of the
+// selected environment is required; those of the other environments are
+// checked when their DSN variable is set.
+type dbTarget struct {
+	name     string
+	urlEnv   string
+	required bool
+}
+
+// dbTargets returns the databases of config: the active one first, then
+// those of the environments using another DSN variable.
+func dbTargets(config *Config, env string) []dbTarget {
+	name := env
+	if name == "" {
+		name = "default"
+	}
+	targets := []dbTarget{{name: name, urlEnv: config.databaseURLEnv(), required: true}}
+	seen := map[string]bool{config.databaseURLEnv(): true}
+	for _, envName := range config.environmentNames() {
+		urlEnv := config.Environments[envName].DatabaseURLEnv
+		if urlEnv == "" || seen[urlEnv] {
+			continue
+		}
+		seen[urlEnv] = true
+		targets = append(targets, dbTarget{name: envName, urlEnv: urlEnv})
+	}
+	return targets
+}
+
+// dbCheck is the outcome of checking one database.
+type dbCheck struct {
+	Name      string
+	URLEnv    string
+	Required  bool
+	Reachable bool
+	Skipped   bool
+	Latency   time.Duration
+	Version   string
+	SSL       string
+	Role      string
+	Detail    string
+}
+
+// checkDatabase connects to target and collects its diagnostics. Diagnostics
+// that cannot be read are reported as unknown.
+func checkDatabase(ctx context.Context, target dbTarget, dbType string) dbCheck {
+	check := dbCheck{Name: target.name, URLEnv: target.urlEnv, Required: target.required, Version: "-", SSL: "-", Role: "-"}
+	if os.Getenv(target.urlEnv) == "" && !target.required {
+		check.Skipped = true
+		check.Detail = target.urlEnv + " is not set"
+		return check
+	}
+	db, err := openDB(ctx, target.urlEnv, DatabaseConfig{})
+	if err != nil {
+		check.Detail = logRedactor.RedactString(err.Error())
+		return check
+	}
+	defer db.Close()
+
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		check.Detail = logRedactor.RedactString(err.Error())
+		return check
+	}
+	check.Latency = time.Since(start)
+	check.Reachable = true
+
+	queries, ok := dbDiagnostics[dbType]
+	if !ok {
+		check.Detail = "no diagnostics for database type " + dbType
+		return check
+	}
+	check.Version = diagnosticValue(ctx, db, queries.Version)
+	check.SSL = onOff(diagnosticValue(ctx, db, queries.SSL), "on", "off")
+	check.Role = onOff(diagnosticValue(ctx, db, queries.Role), queries.RoleName, "missing "+queries.RoleName)
+	return check
+}
+
+// diagnosticValue returns the single value of query as text, or "unknown".
+func diagnosticValue(ctx context.Context, db *sql.DB, query string) string {
+	var value sql.NullString
+	if err := db.QueryRowContext(ctx, query).Scan(&value); err != nil || !value.Valid {
+		return "unknown"
+	}
+	return value.String
+}
+
+// onOff maps a boolean diagnostic to on or off, keeping "unknown".
+func onOff(value, on, off string) string {
+	switch strings.ToLower(value) {
+	case "true", "t", "1":
+		return on
+	case "false", "f", "0":
+		return off
+	}
+	return value
+}
+
+// writeDBReport prints the checks as a table.
+func writeDBReport(w io.Writer, checks []dbCheck) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATABASE\tDSN\tRESULT\tLATENCY\tVERSION\tSSL\tROLE\tDETAIL")
+	for _, check := range checks {
+		result, latency := "PASS", "-"
+		switch {
+		case check.Skipped:
+			result = "SKIP"
+		case !check.Reachable && check.Required:
+			result = "FAIL"
+		case !check.Reachable:
+			result = "WARN"
+		default:
+			latency = fmt.Sprintf("%.1fms", float64(check.Latency.Microseconds())/1000.0)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", check.Name, check.URLEnv, result, latency, check.Version, check.SSL, check.Role, check.Detail)
+	}
+	_ = tw.Flush()
+}
+
+// runCheckDB pings every configured database, prints its diagnostics and
+// fails when a required database is unreachable.
+func runCheckDB(ctx context.Context, opts *options, _ []string) error {
+	config := &Config{}
+	if _, err := os.Stat(opts.configFile); !errors.Is(err, fs.ErrNotExist) {
+		loaded, err := loadConfigFor(opts)
+		if err != nil {
+			return configError("failed to load config: %w", err)
+		}
+		config = loaded
+	}
+
+	dbType := databaseType()
+	var checks []dbCheck
+	failed := 0
+	for _, target := range dbTargets(config, opts.env) {
+		check := checkDatabase(ctx, target, dbType)
+		if check.Required && !check.Reachable {
+			failed++
+		}
+		checks = append(checks, check)
+	}
+	writeDBReport(os.Stdout, checks)
+	if failed > 0 {
+		return fmt.Errorf("%d required database(s) unreachable", failed)
+	}
+	return nil
+}
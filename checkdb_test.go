@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDBTargets(t *testing.T) {
+	config := &Config{
+		DatabaseURLEnv: "PROD_DATABASE_URL",
+		Environments: map[string]EnvironmentConfig{
+			"prod":    {DatabaseURLEnv: "PROD_DATABASE_URL"},
+			"staging": {DatabaseURLEnv: "STAGING_DATABASE_URL"},
+			"dev":     {},
+		},
+	}
+	targets := dbTargets(config, "prod")
+	want := []dbTarget{
+		{name: "prod", urlEnv: "PROD_DATABASE_URL", required: true},
+		{name: "staging", urlEnv: "STAGING_DATABASE_URL"},
+	}
+	if len(targets) != len(want) {
+		t.Fatalf("Expected %d targets, got %+v", len(want), targets)
+	}
+	for i := range want {
+		if targets[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], targets[i])
+		}
+	}
+
+	if targets := dbTargets(&Config{}, ""); len(targets) != 1 || targets[0].name != "default" || targets[0].urlEnv != defaultDatabaseURLEnv {
+		t.Errorf("Expected the default database, got %+v", targets)
+	}
+}
+
+func TestCheckDatabaseUnset(t *testing.T) {
+	t.Setenv("CHECK_DB_URL", "")
+
+	check := checkDatabase(context.Background(), dbTarget{name: "staging", urlEnv: "CHECK_DB_URL"}, "postgres")
+	if !check.Skipped || check.Reachable {
+		t.Errorf("Expected an optional database without DSN to be skipped, got %+v", check)
+	}
+	check = checkDatabase(context.Background(), dbTarget{name: "default", urlEnv: "CHECK_DB_URL", required: true}, "postgres")
+	if check.Skipped || check.Reachable || !strings.Contains(check.Detail, "CHECK_DB_URL is not set") {
+		t.Errorf("Expected a required database without DSN to fail, got %+v", check)
+	}
+}
+
+func TestWriteDBReport(t *testing.T) {
+	checks := []dbCheck{
+		{Name: "default", URLEnv: "DATABASE_URL", Required: true, Reachable: true, Latency: 1500 * time.Microsecond, Version: "16.2", SSL: "on", Role: "pg_monitor"},
+		{Name: "prod", URLEnv: "PROD_URL", Required: true, Detail: "failed to connect to DB"},
+		{Name: "staging", URLEnv: "STAGING_URL", Detail: "failed to connect to DB"},
+		{Name: "dev", URLEnv: "DEV_URL", Skipped: true, Detail: "DEV_URL is not set"},
+	}
+	var buf bytes.Buffer
+	writeDBReport(&buf, checks)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got:\n%s", buf.String())
+	}
+	for i, want := range []string{"PASS 1.5ms 16.2 on pg_monitor", "FAIL", "WARN", "SKIP"} {
+		if got := strings.Join(strings.Fields(lines[i+1]), " "); !strings.Contains(got, want) {
+			t.Errorf("Expected line %q to contain %q", got, want)
+		}
+	}
+}
+
+func TestOnOff(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "true", want: "on"},
+		{value: "t", want: "on"},
+		{value: "1", want: "on"},
+		{value: "false", want: "off"},
+		{value: "0", want: "off"},
+		{value: "unknown", want: "unknown"},
+	}
+	for _, tc := range tests {
+		if got := onOff(tc.value, "on", "off"); got != tc.want {
+			t.Errorf("Expected %q for %q, got %q", tc.want, tc.value, got)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+// datadogValidatePath is the endpoint checking an API key.
+const datadogValidatePath = "/api/v1/validate"
+
+// ValidateKey reports whether the API key is accepted by the site of the
+// client. A rejected key is not an error; failing to ask is.
+func (d *DatadogClient) ValidateKey(ctx context.Context) (bool, error) {
+	var out struct {
+		Valid bool `json:"valid"`
+	}
+	status, err := d.doAPI(ctx, http.MethodGet, datadogValidatePath, nil, &out)
+	if status == http.StatusForbidden || status == http.StatusUnauthorized {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return out.Valid, nil
+}
+
+// keyTarget is an API key to check: the default one or a destination's.
+type keyTarget struct {
+	name   string
+	keyEnv string
+	client *DatadogClient
+}
+
+// keyTargets returns the API keys the configuration submits with.
+func keyTargets(config *Config) []keyTarget {
+	if len(config.Datadog.Destinations) == 0 {
+		return []keyTarget{{
+			name:   "default",
+			keyEnv: "DATADOG_API_KEY",
+			client: newDatadogClient(os.Getenv("DATADOG_API_KEY"), config.Datadog),
+		}}
+	}
+	var targets []keyTarget
+	for _, dest := range config.Datadog.Destinations {
+		keyEnv := dest.APIKeyEnv
+		if keyEnv == "" {
+			keyEnv = "DATADOG_API_KEY"
+		}
+		client := newDatadogClient(os.Getenv(keyEnv), config.Datadog)
+		if dest.Site != "" {
+			client.BaseURL = "https://api." + dest.Site
+		}
+		targets = append(targets, keyTarget{name: dest.Name, keyEnv: keyEnv, client: client})
+	}
+	return targets
+}
+
+// keyCheck is the outcome of checking one API key.
+type keyCheck struct {
+	Name   string
+	Site   string
+	Valid  bool
+	Detail string
+}
+
+// checkKeys validates every target's key against its site.
+func checkKeys(ctx context.Context, targets []keyTarget) []keyCheck {
+	checks := make([]keyCheck, 0, len(targets))
+	for _, target := range targets {
+		check := keyCheck{Name: target.name, Site: target.client.apiURL("")}
+		if u, err := url.Parse(check.Site); err == nil {
+			check.Site = u.Host
+		}
+		logRedactor.AddSecret(target.client.APIKey)
+
+		if target.client.APIKey == "" {
+			check.Detail = target.keyEnv + " is not set"
+			checks = append(checks, check)
+			continue
+		}
+		switch valid, err := target.client.ValidateKey(ctx); {
+		case err != nil:
+			check.Detail = logRedactor.RedactString(err.Error())
+		case !valid:
+			check.Detail = "API key from " + target.keyEnv + " was rejected"
+		default:
+			check.Valid = true
+			check.Detail = "API key from " + target.keyEnv + " is valid"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// writeKeyReport prints the checks as a table.
+func writeKeyReport(w io.Writer, checks []keyCheck) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DESTINATION\tSITE\tRESULT\tDETAIL")
+	for _, check := range checks {
+		result := "PASS"
+		if !check.Valid {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", check.Name, check.Site, result, check.Detail)
+	}
+	_ = tw.Flush()
+}
+
+// runCheckKey validates the configured Datadog API keys and fails when any
+// of them is missing or rejected. The configuration file is optional.
+func runCheckKey(ctx context.Context, opts *options, _ []string) error {
+	config := &Config{}
+	if _, err := os.Stat(opts.configFile); !errors.Is(err, fs.ErrNotExist) {
+		loaded, err := loadConfigFor(opts)
+		if err != nil {
+			return configError("failed to load config: %w", err)
+		}
+		config = loaded
+	}
+
+	checks := checkKeys(ctx, keyTargets(config))
+	writeKeyReport(os.Stdout, checks)
+	failed := 0
+	for _, check := range checks {
+		if !check.Valid {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d API keys failed validation", failed, len(checks))
+	}
+	return nil
+}
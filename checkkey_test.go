@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckKeys(t *testing.T) {
+	mock := httptest.NewServer(newMockServer(nil).handler())
+	defer mock.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string][]string{"errors": {"Forbidden"}})
+	}))
+	defer rejecting.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	client := func(key, baseURL string) *DatadogClient {
+		return &DatadogClient{APIKey: key, BaseURL: baseURL}
+	}
+	targets := []keyTarget{
+		{name: "valid", keyEnv: "KEY_A", client: client("key-a", mock.URL)},
+		{name: "missing", keyEnv: "KEY_B", client: client("", mock.URL)},
+		{name: "rejected", keyEnv: "KEY_C", client: client("key-c", rejecting.URL)},
+		{name: "unreachable", keyEnv: "KEY_D", client: client("key-d", failing.URL)},
+	}
+	checks := checkKeys(context.Background(), targets)
+
+	tests := []struct {
+		valid  bool
+		detail string
+	}{
+		{valid: true, detail: "API key from KEY_A is valid"},
+		{detail: "KEY_B is not set"},
+		{detail: "API key from KEY_C was rejected"},
+		{detail: "500"},
+	}
+	for i, tc := range tests {
+		if checks[i].Valid != tc.valid || !strings.Contains(checks[i].Detail, tc.detail) {
+			t.Errorf("%s: expected valid=%v and detail containing %q, got %+v", targets[i].name, tc.valid, tc.detail, checks[i])
+		}
+	}
+	if checks[0].Site != strings.TrimPrefix(mock.URL, "http://") {
+		t.Errorf("Expected site %s, got %s", mock.URL, checks[0].Site)
+	}
+
+	var buf bytes.Buffer
+	writeKeyReport(&buf, checks)
+	for _, want := range []string{"DESTINATION", "valid", "PASS", "FAIL"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected report to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestKeyTargets(t *testing.T) {
+	t.Setenv("DATADOG_API_KEY", "default-key")
+	t.Setenv("EU_API_KEY", "eu-key")
+
+	targets := keyTargets(&Config{})
+	if len(targets) != 1 || targets[0].client.APIKey != "default-key" || targets[0].client.apiURL("") != datadogBaseURL {
+		t.Errorf("Expected the default key and site, got %+v", targets)
+	}
+
+	config := &Config{Datadog: DatadogConfig{Destinations: []DestinationConfig{
+		{Name: "us"},
+		{Name: "eu", APIKeyEnv: "EU_API_KEY", Site: "datadoghq.eu"},
+	}}}
+	targets = keyTargets(config)
+	if len(targets) != 2 {
+		t.Fatalf("Expected 2 targets, got %d", len(targets))
+	}
+	if targets[1].client.APIKey != "eu-key" || targets[1].client.apiURL("") != "https://api.datadoghq.eu" {
+		t.Errorf("Expected the eu key and site, got %+v", targets[1].client)
+	}
+}
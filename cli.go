@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// programName is used in usage messages and completion scripts.
+const programName = "datadog-sql-metrics"
+
+// envPrefix is prepended to the upper-cased flag name to form its environment
+// variable equivalent, e.g. -log-level can be set with DDSM_LOG_LEVEL.
+const envPrefix = "DDSM_"
+
+// options holds the values of command line flags. Only the flags registered
+// for the selected subcommand are populated; the rest keep their defaults.
+type options struct {
+	configFile    string
+	env           string
+	configFormat  string
+	debug         bool
+	dryRun        bool
+	dryRunFormat  string
+	version       bool
+	timeout       time.Duration
+	errorWindow   time.Duration
+	interval      time.Duration
+	shutdownWait  time.Duration
+	healthAddr    string
+	debugAddr     string
+	summaryFormat string
+	failOn        string
+	failFast      bool
+	shardIndex    int
+	shardCount    int
+	shardTotal    int // deprecated alias of shardCount, 0 when unset
+	sink          string
+	record        string
+	replay        string
+	logLevel      string
+	logFormat     string
+	logOutput     string
+	// dashboardTitle and create are used by the dashboard command.
+	dashboardTitle string
+	create         bool
+	// force is used by the init command.
+	force bool
+	// limit is used by the discover command.
+	limit int
+	// selection narrows the metrics of the commands that collect them.
+	selection metricSelection
+	// mockAddr and mockRecord are used by the mock-server command.
+	mockAddr   string
+	mockRecord string
+	// printer is created on first use by dryRunPrinter.
+	printer *dryRunPrinter
+}
+
+// command describes a subcommand of the CLI.
+type command struct {
+	name        string
+	description string
+	// args is the usage string for positional arguments. Commands without it
+	// reject any positional argument.
+	args  string
+	flags func(fs *flag.FlagSet, opts *options)
+	run   func(ctx context.Context, opts *options, args []string) error
+	// noCommon disables the shared config/logging/timeout flags.
+	noCommon bool
+	// timeout overrides the default of the -timeout flag.
+	timeout time.Duration
+	// ownTimeout means the command applies -timeout itself (e.g. per
+	// collection cycle) instead of to the whole invocation.
+	ownTimeout bool
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:        "run",
+			description: "Execute the configured queries and send the results to Datadog (default)",
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.BoolVar(&opts.dryRun, "dry-run", false, "Dry run mode - don't actually send metrics to Datadog")
+				fs.StringVar(&opts.dryRunFormat, "dry-run-format", dryRunLog, "Output of -dry-run for Datadog submissions: log, json (payloads), table or curl")
+				fs.DurationVar(&opts.errorWindow, "error-window", 0, "Window for collapsing repeated identical errors into one summary (0 = whole run)")
+				fs.BoolVar(&opts.version, "version", false, "Print the version information")
+				fs.DurationVar(&opts.interval, "interval", 0, "Run continuously, collecting every interval (daemon mode); 0 runs once")
+				fs.DurationVar(&opts.shutdownWait, "shutdown-timeout", defaultShutdownTimeout, "In daemon mode, how long to wait for the running cycle to finish on SIGTERM before cancelling it")
+				fs.StringVar(&opts.healthAddr, "health-addr", "", "Bind address for /healthz and /readyz endpoints, e.g. :8080 (disabled when empty)")
+				fs.StringVar(&opts.summaryFormat, "summary-format", "none", "Print a run summary at the end of every run: table, json or none")
+				fs.StringVar(&opts.failOn, "fail-on", "all", "Exit with an error when any, all or none of the metrics failed")
+				fs.BoolVar(&opts.failFast, "fail-fast", false, "Abort the run at the first failed metric and exit with an error")
+				fs.StringVar(&opts.debugAddr, "debug-addr", "", "Bind address for pprof and expvar endpoints, e.g. localhost:6060 (disabled when empty)")
+				fs.IntVar(&opts.shardIndex, "shard-index", 0, "Index of this replica when splitting metrics across replicas (0-based)")
+				fs.IntVar(&opts.shardCount, "shard-count", 1, "Number of replicas the metrics are split across")
+				fs.IntVar(&opts.shardTotal, "shard-total", 0, "Deprecated: use -shard-count")
+				fs.StringVar(&opts.sink, "sink", sinkDatadog, "Destination of the collected values: "+strings.Join(sinkNames(), ", "))
+				fs.StringVar(&opts.record, "record", "", "Save the query results of every metric to this JSON file")
+				fs.StringVar(&opts.replay, "replay", "", "Send the query results saved with -record instead of querying the database")
+				selectionFlags(fs, opts)
+			},
+			ownTimeout: true,
+			run: func(ctx context.Context, opts *options, _ []string) error {
+				if opts.version {
+					_version()
+					return nil
+				}
+				return runCollect(ctx, opts)
+			},
+		},
+		{
+			name:        "init",
+			description: "Interactively write a starter configuration file",
+			timeout:     initProbeTimeout,
+			ownTimeout:  true,
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.BoolVar(&opts.force, "force", false, "Overwrite an existing configuration file")
+			},
+			run: runInit,
+		},
+		{
+			name:        "discover",
+			description: "Suggest row-count and size metrics for the largest tables as YAML",
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.IntVar(&opts.limit, "limit", defaultDiscoverLimit, "Number of tables to suggest metrics for")
+			},
+			run: runDiscover,
+		},
+		{
+			name:        "validate",
+			description: "Validate the configuration file and every query without connecting anywhere",
+			flags:       selectionFlags,
+			run:         runValidate,
+		},
+		{
+			name:        "test",
+			description: "Execute the configured queries and print the results without sending them",
+			flags:       selectionFlags,
+			run:         runTest,
+		},
+		{
+			name:        "list",
+			description: "List the metrics defined in the configuration file",
+			flags:       selectionFlags,
+			run:         runList,
+		},
+		{
+			name:        "bootstrap",
+			description: "Verify credentials, database access and a metric round trip through Datadog",
+			timeout:     3 * time.Minute,
+			run:         runBootstrap,
+		},
+		{
+			name:        "check-key",
+			description: "Check that the Datadog API keys are valid for their sites",
+			run:         runCheckKey,
+		},
+		{
+			name:        "check-db",
+			description: "Ping every configured database and report its version, latency, SSL and role",
+			run:         runCheckDB,
+		},
+		{
+			name:        "sync-metadata",
+			description: "Push unit, description and short name of every metric to Datadog",
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.BoolVar(&opts.dryRun, "dry-run", false, "Print what would be updated without calling the API")
+			},
+			run: runSyncMetadata,
+		},
+		{
+			name:        "monitors",
+			description: "Create or update the Datadog monitors defined next to the metrics",
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.BoolVar(&opts.dryRun, "dry-run", false, "Print the monitors as JSON without calling the API")
+			},
+			run: runMonitors,
+		},
+		{
+			name:        "dashboard",
+			description: "Generate a Datadog dashboard with one widget per metric",
+			args:        "generate",
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.StringVar(&opts.dashboardTitle, "title", defaultDashboardTitle, "Title of the generated dashboard")
+				fs.BoolVar(&opts.create, "create", false, "Create the dashboard through the API instead of printing its JSON")
+			},
+			run: runDashboard,
+		},
+		{
+			name:        "config",
+			description: "Print the JSON Schema of the configuration file",
+			args:        "schema",
+			noCommon:    true,
+			run:         runConfig,
+		},
+		{
+			name:        "mock-server",
+			description: "Serve an emulation of the Datadog submission API for end-to-end tests",
+			noCommon:    true,
+			flags: func(fs *flag.FlagSet, opts *options) {
+				fs.StringVar(&opts.mockAddr, "addr", defaultMockServerAddr, "Listen address of the mock API")
+				fs.StringVar(&opts.mockRecord, "record", "", "Append every accepted submission to this file as JSON lines")
+			},
+			run: runMockServer,
+		},
+		{
+			name:        "version",
+			description: "Print the version information",
+			noCommon:    true,
+			run: func(context.Context, *options, []string) error {
+				_version()
+				return nil
+			},
+		},
+		{
+			name:        "completion",
+			description: "Generate a shell completion script",
+			args:        "bash|zsh|fish",
+			noCommon:    true,
+			run: func(_ context.Context, _ *options, args []string) error {
+				if len(args) != 1 {
+					return errors.New("completion requires exactly one shell argument: bash, zsh or fish")
+				}
+				return writeCompletion(os.Stdout, args[0])
+			},
+		},
+	}
+}
+
+// selectionFlags registers the flags selecting a subset of the metrics.
+func selectionFlags(fs *flag.FlagSet, opts *options) {
+	fs.Var((*stringList)(&opts.selection.names), "metric", "Only use the metric with this name (repeatable)")
+	fs.Var((*stringList)(&opts.selection.filters), "filter", "Only use metrics with this tag, as tag=value (repeatable)")
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// newFlagSet builds the flag set for cmd, binding the flags to opts.
+func newFlagSet(cmd *command, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	if !cmd.noCommon {
+		fs.StringVar(&opts.configFile, "config", "config.yaml", "Path to the YAML configuration file")
+		fs.StringVar(&opts.configFormat, "config-format", formatAuto, "Format of the configuration file: auto (by extension), yaml, json or toml")
+		fs.StringVar(&opts.env, "env", "", "Environment overlay of the configuration to apply, e.g. staging")
+		fs.BoolVar(&opts.debug, "debug", false, "Enable debug mode")
+		timeout := 30 * time.Second
+		if cmd.timeout > 0 {
+			timeout = cmd.timeout
+		}
+		fs.DurationVar(&opts.timeout, "timeout", timeout, "Global timeout for operations like DB query and API call")
+		fs.StringVar(&opts.logLevel, "log-level", "info", "Log level: debug, info, warn, error")
+		fs.StringVar(&opts.logFormat, "log-format", "json", "Log format: json or text")
+		fs.StringVar(&opts.logOutput, "log-output", "stderr", "Log destination: stderr, stdout or a file path")
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", programName, cmd.name, cmd.args, cmd.description)
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\nEvery flag can also be set with an environment variable, e.g. -log-level as %sLOG_LEVEL.\n", envPrefix)
+	}
+	return fs
+}
+
+// envName returns the environment variable equivalent of a flag name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag that was not given on the command line from its
+// environment variable equivalent, if present. Command line flags win.
+func applyEnv(fs *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if explicit[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, envName(f.Name), err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.description)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command. Without a command, 'run' is assumed.\n", programName)
+}
+
+// run parses args (without the program name), selects the subcommand and executes it.
+func run(ctx context.Context, args []string) (err error) {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	cmd := findCommand(name)
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return configError("unknown command %q", name)
+	}
+
+	opts := &options{}
+	fs := newFlagSet(cmd, opts)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if err := applyEnv(fs); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if cmd.args == "" && fs.NArg() > 0 {
+		return configError("unexpected argument %q for command %q", fs.Arg(0), cmd.name)
+	}
+
+	if !cmd.noCommon {
+		if opts.debug {
+			opts.logLevel = "debug"
+		}
+		closeLog, logErr := setupLogger(opts.logLevel, opts.logFormat, opts.logOutput)
+		if logErr != nil {
+			return configError("failed to set up logger: %w", logErr)
+		}
+		defer func() {
+			// The error is logged before a log file is closed.
+			if err != nil {
+				logFatal(err)
+				err = &loggedError{err}
+			}
+			if closeErr := closeLog(); closeErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to close log file: %v\n", closeErr)
+			}
+		}()
+		if strings.EqualFold(opts.logLevel, "debug") {
+			opts.debug = true
+		}
+
+		if opts.timeout > 0 && !cmd.ownTimeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+			defer cancel()
+		}
+	}
+
+	return cmd.run(ctx, opts, fs.Args())
+}
+
+// runValidate checks the configuration and every query in it.
+func runValidate(_ context.Context, opts *options, _ []string) error {
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+
+	invalid := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, metric := range config.Metrics {
+		if err := validateMetricQuery(metric); err != nil {
+			invalid++
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", metric.Name, err)
+			continue
+		}
+		fmt.Fprintf(tw, "OK\t%s\n", metric.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if invalid > 0 {
+		return configError("%d of %d metrics are invalid", invalid, len(config.Metrics))
+	}
+	return nil
+}
+
+// runTest executes every query and prints the results without sending them.
+func runTest(ctx context.Context, opts *options, _ []string) error {
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+
+	db, err := openDB(ctx, config.databaseURLEnv(), config.Database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			logEvent(ctx, "warn", "Failed to close database connection", map[string]interface{}{"error": closeErr.Error()})
+		}
+	}()
+	audit, err := openAuditLog(config.Audit, databaseType(), config.databaseURL())
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+	dbClient := &SQLDB{DB: db, Guard: newQueryGuard(config.Guards, databaseType()), Audit: audit}
+	metrics, err := filterEnabled(ctx, config.Metrics, newCapabilities(db, databaseType()))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tVALUE\tERROR")
+	window := newQueryWindow(time.Now(), time.Time{}, initialWindow(config, 0))
+	for _, metric := range metrics {
+		metric, err := metric.withWindow(window)
+		if err == nil {
+			err = validateMetricQuery(metric)
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t%v\n", metric.Name, err)
+			continue
+		}
+		if metric.recordMode() {
+			records, err := dbClient.Records(ctx, metric)
+			if err != nil {
+				failed++
+				fmt.Fprintf(tw, "%s\t-\t%v\n", metric.Name, logRedactor.RedactString(err.Error()))
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%d rows (%s)\t\n", metric.Name, len(records), metric.Mode)
+			continue
+		}
+		samples, err := fetchSamples(ctx, dbClient, metric)
+		if isEmptyResult(err) {
+			var value float64
+			var skip bool
+			if value, skip, err = resolveEmptyResult(metric, err); skip {
+				fmt.Fprintf(tw, "%s\t-\tskipped (empty result)\n", metric.Name)
+				continue
+			}
+			samples = []sample{{Value: value}}
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t%v\n", metric.Name, logRedactor.RedactString(err.Error()))
+			continue
+		}
+		now := time.Now()
+		for _, s := range samples {
+			name := seriesName(metric, s.Name)
+			if len(s.Tags) > 0 {
+				name += "{" + strings.Join(s.Tags, ",") + "}"
+			}
+			fmt.Fprintf(tw, "%s\t%v\t\n", name, applyTransforms(metric.TimeValue.apply(s.Value, now), metric.Transform))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d metrics failed", failed, len(config.Metrics))
+	}
+	return nil
+}
+
+// runList prints the metrics defined in the configuration file.
+func runList(_ context.Context, opts *options, _ []string) error {
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tHOST\tTAGS")
+	for _, metric := range config.Metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", metric.Name, metric.Host, strings.Join(metric.Tags, ","))
+	}
+	return tw.Flush()
+}
+
+// writeCompletion writes a completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	names := make([]string, 0, len(commands))
+	flagsByCmd := map[string][]*flag.Flag{}
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		fs := newFlagSet(cmd, &options{})
+		fs.VisitAll(func(f *flag.Flag) { flagsByCmd[cmd.name] = append(flagsByCmd[cmd.name], f) })
+	}
+	fn := "_" + strings.ReplaceAll(programName, "-", "_")
+
+	switch shell {
+	case "bash", "zsh":
+		if shell == "zsh" {
+			fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+		}
+		fmt.Fprintf(w, "%s() {\n", fn)
+		fmt.Fprintln(w, `  local cur="${COMP_WORDS[COMP_CWORD]}"`)
+		fmt.Fprintln(w, `  if [ "$COMP_CWORD" -eq 1 ]; then`)
+		fmt.Fprintf(w, "    COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") )\n", strings.Join(names, " "))
+		fmt.Fprintln(w, "    return")
+		fmt.Fprintln(w, "  fi")
+		fmt.Fprintln(w, `  case "${COMP_WORDS[1]}" in`)
+		for _, name := range names {
+			flags := make([]string, 0, len(flagsByCmd[name]))
+			for _, f := range flagsByCmd[name] {
+				flags = append(flags, "-"+f.Name)
+			}
+			fmt.Fprintf(w, "    %s) COMPREPLY=( $(compgen -W \"%s\" -- \"$cur\") ) ;;\n", name, strings.Join(flags, " "))
+		}
+		fmt.Fprintln(w, "  esac")
+		fmt.Fprintln(w, "}")
+		fmt.Fprintf(w, "complete -F %s %s\n", fn, programName)
+	case "fish":
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "complete -c %s -f -n '__fish_use_subcommand' -a %s -d %q\n", programName, cmd.name, cmd.description)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, f := range flagsByCmd[name] {
+				fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from %s' -l %s -d %q\n", programName, name, f.Name, f.Usage)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported shell %q (must be bash, zsh or fish)", shell)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	if got := envName("log-level"); got != "DDSM_LOG_LEVEL" {
+		t.Errorf("Expected DDSM_LOG_LEVEL, got %s", got)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("DDSM_TIMEOUT", "5s")
+	t.Setenv("DDSM_CONFIG", "from-env.yaml")
+
+	opts := &options{}
+	fs := newFlagSet(findCommand("run"), opts)
+	if err := fs.Parse([]string{"-config", "from-flag.yaml"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := applyEnv(fs); err != nil {
+		t.Fatalf("applyEnv failed: %v", err)
+	}
+
+	if opts.timeout != 5*time.Second {
+		t.Errorf("Expected timeout from environment, got %v", opts.timeout)
+	}
+	if opts.configFile != "from-flag.yaml" {
+		t.Errorf("Expected command line flag to take precedence, got %q", opts.configFile)
+	}
+}
+
+func TestApplyEnvInvalidValue(t *testing.T) {
+	t.Setenv("DDSM_TIMEOUT", "soon")
+
+	fs := newFlagSet(findCommand("run"), &options{})
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := applyEnv(fs); err == nil || !strings.Contains(err.Error(), "DDSM_TIMEOUT") {
+		t.Errorf("Expected error mentioning DDSM_TIMEOUT, got %v", err)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	err := run(context.Background(), []string{"frobnicate"})
+	if err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Expected unknown command error, got %v", err)
+	}
+}
+
+func TestRunRejectsUnexpectedArguments(t *testing.T) {
+	err := run(context.Background(), []string{"list", "extra"})
+	if err == nil || !strings.Contains(err.Error(), "unexpected argument") {
+		t.Errorf("Expected unexpected argument error, got %v", err)
+	}
+}
+
+func TestRunLogsErrorBeforeClosingLogFile(t *testing.T) {
+	orig := logger
+	defer func() { logger = orig }()
+	logFile := filepath.Join(t.TempDir(), "collector.log")
+
+	err := run(context.Background(), []string{"validate", "-log-output", logFile, "-config", filepath.Join(t.TempDir(), "missing.yaml")})
+	if err == nil {
+		t.Fatal("Expected error for a missing config file")
+	}
+	var logged *loggedError
+	if !errors.As(err, &logged) {
+		t.Errorf("Expected the error to be marked as logged, got %T", err)
+	}
+	if exitCode(err) != exitConfigInvalid {
+		t.Errorf("Expected exit code %d, got %d", exitConfigInvalid, exitCode(err))
+	}
+	data, readErr := os.ReadFile(logFile)
+	if readErr != nil {
+		t.Fatalf("Failed to read log file: %v", readErr)
+	}
+	if !strings.Contains(string(data), "Execution error") {
+		t.Errorf("Expected the execution error in the log file, got %q", data)
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, shell); err != nil {
+			t.Fatalf("writeCompletion(%s) failed: %v", shell, err)
+		}
+		for _, want := range []string{"validate", "config"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Expected %s completion to mention %q", shell, want)
+			}
+		}
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Error("Expected error for unsupported shell")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+const (
+	defaultCloudWatchNamespace = "SQLMetrics"
+	// Limits of the PutMetricData API.
+	cloudWatchMaxDatums     = 1000
+	cloudWatchMaxDimensions = 30
+	cloudWatchMaxValues     = 150
+)
+
+// CloudWatchConfig configures the cloudwatch sink. Credentials are taken from
+// the default AWS chain (environment, shared config, instance or Lambda role).
+type CloudWatchConfig struct {
+	Namespace string `yaml:"namespace,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	// HostDimension is the dimension name of the metric host (default "Host").
+	HostDimension string `yaml:"host_dimension,omitempty"`
+}
+
+// cloudWatchAPI is the subset of the CloudWatch client used by the sink.
+type cloudWatchAPI interface {
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+// CloudWatchSender buffers points as CloudWatch metric data and submits them
+// with PutMetricData when the collection cycle is flushed.
+type CloudWatchSender struct {
+	client        cloudWatchAPI
+	namespace     string
+	hostDimension string
+
+	mu      sync.Mutex
+	pending []types.MetricDatum
+}
+
+// newCloudWatchSink creates the cloudwatch sink from the `cloudwatch:` block.
+func newCloudWatchSink(ctx context.Context, config *Config, _ *options) (MetricSender, error) {
+	cfg := config.CloudWatch
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, configError("failed to load AWS configuration: %w", err)
+	}
+	return newCloudWatchSender(cloudwatch.NewFromConfig(awsCfg), cfg), nil
+}
+
+// newCloudWatchSender creates a sender submitting through client.
+func newCloudWatchSender(client cloudWatchAPI, cfg CloudWatchConfig) *CloudWatchSender {
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = defaultCloudWatchNamespace
+	}
+	hostDimension := cfg.HostDimension
+	if hostDimension == "" {
+		hostDimension = "Host"
+	}
+	return &CloudWatchSender{client: client, namespace: namespace, hostDimension: hostDimension}
+}
+
+// dimensions maps "key:value" tags and the host to CloudWatch dimensions.
+// Tags without a value use "true", as empty dimension values are rejected.
+func (c *CloudWatchSender) dimensions(tags []string, host string) ([]types.Dimension, error) {
+	dims := make([]types.Dimension, 0, len(tags)+1)
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		if value == "" {
+			value = "true"
+		}
+		dims = append(dims, types.Dimension{Name: aws.String(key), Value: aws.String(value)})
+	}
+	if host != "" {
+		dims = append(dims, types.Dimension{Name: aws.String(c.hostDimension), Value: aws.String(host)})
+	}
+	if len(dims) > cloudWatchMaxDimensions {
+		return nil, fmt.Errorf("%d dimensions, CloudWatch allows at most %d", len(dims), cloudWatchMaxDimensions)
+	}
+	return dims, nil
+}
+
+func (c *CloudWatchSender) add(datums ...types.MetricDatum) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, datums...)
+}
+
+// SendMetric buffers one value until the next Flush.
+func (c *CloudWatchSender) SendMetric(_ context.Context, metricName string, value float64, tags []string, host string) error {
+	dims, err := c.dimensions(tags, host)
+	if err != nil {
+		return err
+	}
+	c.add(types.MetricDatum{
+		MetricName: aws.String(metricName),
+		Dimensions: dims,
+		Timestamp:  aws.Time(time.Now()),
+		Value:      aws.Float64(value),
+		Unit:       types.StandardUnitNone,
+	})
+	return nil
+}
+
+// SendDistribution implements DistributionSender with value arrays.
+func (c *CloudWatchSender) SendDistribution(_ context.Context, metricName string, values []float64, tags []string, host string) error {
+	dims, err := c.dimensions(tags, host)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for start := 0; start < len(values); start += cloudWatchMaxValues {
+		end := min(start+cloudWatchMaxValues, len(values))
+		c.add(types.MetricDatum{
+			MetricName: aws.String(metricName),
+			Dimensions: dims,
+			Timestamp:  aws.Time(now),
+			Values:     values[start:end],
+			Unit:       types.StandardUnitNone,
+		})
+	}
+	return nil
+}
+
+// Flush submits the buffered points in batches of up to 1000.
+func (c *CloudWatchSender) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for start := 0; start < len(pending); start += cloudWatchMaxDatums {
+		end := min(start+cloudWatchMaxDatums, len(pending))
+		_, err := c.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(c.namespace),
+			MetricData: pending[start:end],
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("PutMetricData failed for %d points: %w", end-start, err))
+			continue
+		}
+		expvarPayloadsSent.Add(1)
+	}
+	return errors.Join(errs...)
+}
+
+// Close submits any points still buffered.
+func (c *CloudWatchSender) Close(ctx context.Context) error {
+	return c.Flush(ctx)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+)
+
+type fakeCloudWatch struct {
+	inputs []*cloudwatch.PutMetricDataInput
+	err    error
+}
+
+func (f *fakeCloudWatch) PutMetricData(_ context.Context, params *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &cloudwatch.PutMetricDataOutput{}, f.err
+}
+
+func TestCloudWatchSenderFlush(t *testing.T) {
+	client := &fakeCloudWatch{}
+	sender := newCloudWatchSender(client, CloudWatchConfig{Namespace: "Team/SQL"})
+	ctx := context.Background()
+
+	for i := 0; i < cloudWatchMaxDatums+1; i++ {
+		if err := sender.SendMetric(ctx, "db.users", float64(i), []string{"env:prod", "canary"}, "db-01"); err != nil {
+			t.Fatalf("SendMetric failed: %v", err)
+		}
+	}
+	if len(client.inputs) != 0 {
+		t.Fatal("Expected points to be buffered until Flush")
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if len(client.inputs) != 2 {
+		t.Fatalf("Expected 2 batches, got %d", len(client.inputs))
+	}
+	if aws.ToString(client.inputs[0].Namespace) != "Team/SQL" {
+		t.Errorf("Unexpected namespace %q", aws.ToString(client.inputs[0].Namespace))
+	}
+	if len(client.inputs[0].MetricData) != cloudWatchMaxDatums || len(client.inputs[1].MetricData) != 1 {
+		t.Errorf("Unexpected batch sizes %d and %d", len(client.inputs[0].MetricData), len(client.inputs[1].MetricData))
+	}
+
+	dims := map[string]string{}
+	for _, d := range client.inputs[0].MetricData[0].Dimensions {
+		dims[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	want := map[string]string{"env": "prod", "canary": "true", "Host": "db-01"}
+	for name, value := range want {
+		if dims[name] != value {
+			t.Errorf("Expected dimension %s=%s, got %v", name, value, dims)
+		}
+	}
+
+	if err := sender.Flush(ctx); err != nil || len(client.inputs) != 2 {
+		t.Errorf("Expected an empty flush to send nothing, got %d calls, err %v", len(client.inputs), err)
+	}
+}
+
+func TestCloudWatchSenderErrors(t *testing.T) {
+	client := &fakeCloudWatch{err: errors.New("throttled")}
+	sender := newCloudWatchSender(client, CloudWatchConfig{})
+	ctx := context.Background()
+
+	tags := make([]string, cloudWatchMaxDimensions+1)
+	for i := range tags {
+		tags[i] = "tag"
+	}
+	if err := sender.SendMetric(ctx, "db.users", 1, tags, ""); err == nil {
+		t.Error("Expected error for too many dimensions")
+	}
+
+	if err := sender.SendDistribution(ctx, "db.latency", []float64{1, 2}, nil, ""); err != nil {
+		t.Fatalf("SendDistribution failed: %v", err)
+	}
+	if err := sender.Flush(ctx); err == nil {
+		t.Error("Expected PutMetricData error to be returned")
+	}
+	if got := client.inputs[0].MetricData[0].Values; len(got) != 2 {
+		t.Errorf("Expected distribution values, got %v", got)
+	}
+	if aws.ToString(client.inputs[0].Namespace) != defaultCloudWatchNamespace {
+		t.Errorf("Expected default namespace, got %q", aws.ToString(client.inputs[0].Namespace))
+	}
+}
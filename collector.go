@@ -0,0 +1,752 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Collector executes the configured metrics and submits the results.
+type Collector struct {
+	Config     *Config
+	ConfigFile string
+	DB         *sql.DB
+	Sender     MetricSender
+	Errors     *ErrorAggregator
+	Health     *HealthState
+	Hostname   string
+	Debug      bool
+	// FailFast aborts the cycle at the first failed metric; the remaining
+	// metrics are reported as skipped.
+	FailFast bool
+	// Breaker skips the database after repeated connection failures. It is
+	// kept across cycles in daemon mode; nil disables it.
+	Breaker *CircuitBreaker
+	// DBTags identify the database in service checks.
+	DBTags []string
+	// Host is set on the metrics without a host; nil leaves them unset.
+	Host *hostInfo
+	// MetricTags are added to every metric, e.g. the database identity.
+	MetricTags []string
+	// Fallback switches to the fallback DSNs of the database; nil when there
+	// are none.
+	Fallback *fallbackConnector
+	// Sinks holds the senders of metrics routed to a specific sink, keyed by
+	// sink name. Metrics without a sink use Sender.
+	Sinks map[string]MetricSender
+	// State keeps the last run of templated queries; Window is the length of
+	// their first window.
+	State  *runState
+	Window time.Duration
+	// Record keeps the query output of every metric; Replay re-sends the
+	// outputs of such a snapshot instead of querying the sources.
+	Record *resultSnapshot
+	Replay *resultSnapshot
+	// Audit records every query run against the database; nil disables it.
+	Audit *auditLog
+	// Stop is closed when a shutdown is requested. The running cycle then
+	// finishes its current metric and skips the rest.
+	Stop <-chan struct{}
+	// Daemon is set in daemon mode, where metrics with a schedule wait for
+	// their next scheduled time. Single runs always collect them.
+	Daemon bool
+	// Pipeline queues the points for a pool of senders; nil sends them
+	// during collection.
+	Pipeline *sendPipeline
+
+	// sends tracks the points the running cycle queued on Pipeline.
+	sends *sendTracker
+
+	stateOnce sync.Once
+	cacheOnce sync.Once
+	guardOnce sync.Once
+	collected map[string]time.Time
+	checked   map[string]time.Time
+	tagWarned map[string]bool
+	poolStats sql.DBStats
+	cache     *valueCache
+	guard     *queryGuard
+	alerts    alertTracker
+	stale     staleTracker
+	anomalies anomalyTracker
+	metadata  metadataSync
+}
+
+// CollectOnce runs one collection cycle over every configured metric and
+// returns a summary of the results.
+func (c *Collector) CollectOnce(ctx context.Context) *RunSummary {
+	ctx, span := tracer.Start(ctx, "collection_cycle", trace.WithAttributes(attribute.Int("metrics.count", len(c.Config.Metrics))))
+	defer span.End()
+
+	summary := &RunSummary{Started: time.Now()}
+	telemetry := NewTelemetry()
+	pool := startPoolSampler(c.DB, poolSampleInterval)
+	dbClient := &SQLDB{DB: c.DB, Errors: c.Errors, Telemetry: telemetry, Guard: c.queryGuard(), Audit: c.Audit}
+	c.sends = nil
+	if c.Pipeline != nil {
+		c.sends = newSendTracker()
+	}
+
+	metrics := make([]collector.Metric, len(c.Config.Metrics))
+	for i, metric := range c.Config.Metrics {
+		metrics[i] = engineMetric(metric)
+	}
+	c.engine(summary, dbClient, telemetry).CollectOnce(ctx, metrics)
+
+	c.awaitSends(ctx, summary)
+	c.correlateStatements(ctx, telemetry, summary)
+	for _, result := range summary.Metrics {
+		if result.Status == statusSent {
+			c.Health.RecordSuccess(result.Metric, time.Now())
+		}
+	}
+
+	if summary.Failed == 0 {
+		if err := sendHeartbeat(ctx, c.Sender, c.Config.Heartbeat, c.ConfigFile, c.Hostname); err != nil {
+			logEvent(ctx, "warn", "Failed to send heartbeat", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	c.sendServiceCheck(ctx)
+
+	if c.Breaker != nil {
+		telemetry.SetGauge("circuit_breaker.state", breakerStateValue(c.Breaker.State()))
+	}
+	if stats, ok := pool.Stop(); ok {
+		telemetry.RecordPoolStats(stats, c.poolStats)
+		c.poolStats = stats
+	}
+	if sender, ok := c.Sender.(flushStatsSender); ok {
+		// Batches are flushed after telemetry, so these describe the
+		// previous cycle.
+		if stats, batch := sender.LastFlush(); batch {
+			telemetry.SetGauge("payload.chunks", float64(stats.Chunks))
+			telemetry.SetGauge("payload.bytes", float64(stats.Bytes))
+		}
+	}
+	if err := telemetry.Submit(ctx, c.Sender, c.Config.Telemetry, c.Hostname); err != nil {
+		logEvent(ctx, "warn", "Failed to send self-telemetry", map[string]interface{}{"error": err.Error()})
+	}
+	c.flushSender(ctx)
+	if err := c.runState().Save(); err != nil {
+		logEvent(ctx, "warn", "Failed to save state", map[string]interface{}{"error": err.Error()})
+	}
+	if c.Record != nil {
+		if err := c.Record.Save(); err != nil {
+			logEvent(ctx, "warn", "Failed to save snapshot", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
+	summary.DurationMs = float64(time.Since(summary.Started).Microseconds()) / 1000.0
+	c.Health.RecordCycle(time.Now(), summary.Failed)
+	return summary
+}
+
+// engine returns the collection loop of a cycle, which collects every metric
+// with collectMetric and adds its result to summary.
+func (c *Collector) engine(summary *RunSummary, dbClient *SQLDB, telemetry *Telemetry) *collector.Engine {
+	stopLogged := false
+	return &collector.Engine{
+		Stop:     c.Stop,
+		FailFast: c.FailFast,
+		CollectMetric: func(ctx context.Context, m collector.Metric) (collector.Result, bool) {
+			metric := m.Spec.(MetricConfig)
+			if !c.due(metric, summary.Started) {
+				return collector.Result{}, false
+			}
+			metric = c.Host.apply(metric)
+			if len(c.MetricTags) > 0 {
+				metric.Tags = slices.Concat(metric.Tags, c.MetricTags)
+			}
+			if c.Config.Database.TagRole {
+				metric.Tags = slices.Concat(metric.Tags, []string{"source_role:" + c.Fallback.Role()})
+			}
+			if !c.waitJitter(ctx, metric) {
+				summary.add(MetricResult{Metric: metric.Name, Status: statusSkipped})
+				return collector.Result{Metric: metric.Name, Err: collector.ErrStopped, Skipped: true}, true
+			}
+
+			metricCtx, span := tracer.Start(ctx, "collect_metric", trace.WithAttributes(attribute.String("metric.name", metric.Name)))
+			result := c.collectMetric(metricCtx, dbClient, telemetry, metric)
+			endMetricSpan(span, result)
+			summary.add(result)
+			if result.Status != statusSent && c.FailFast {
+				logEvent(ctx, "warn", "Aborting collection cycle after first failure (fail-fast)", map[string]interface{}{
+					"metric": metric.Name,
+				})
+			}
+			return result.engineResult(), true
+		},
+		OnSkip: func(ctx context.Context, m collector.Metric, err error) {
+			if errors.Is(err, collector.ErrStopped) && !stopLogged {
+				stopLogged = true
+				logEvent(ctx, "info", "Shutdown requested - skipping the remaining metrics of the cycle", map[string]interface{}{
+					"metric": m.Name,
+				})
+			}
+			summary.add(MetricResult{Metric: m.Name, Status: statusSkipped})
+		},
+	}
+}
+
+// engineMetric returns the engine's view of metric, carrying the metric
+// itself for collectMetric.
+func engineMetric(metric MetricConfig) collector.Metric {
+	return collector.Metric{
+		Name:       metric.Name,
+		Query:      metric.Query,
+		Tags:       metric.Tags,
+		Host:       metric.Host,
+		TagColumns: metric.TagColumns,
+		Spec:       metric,
+	}
+}
+
+// collectMetric queries and submits a single metric. Errors are logged here
+// and reported in the returned result.
+func (c *Collector) collectMetric(ctx context.Context, dbClient *SQLDB, telemetry *Telemetry, metric MetricConfig) MetricResult {
+	result := MetricResult{Metric: metric.Name}
+	fail := func(status string, err error) MetricResult {
+		result.Status = status
+		result.Error = logRedactor.RedactString(err.Error())
+		return result
+	}
+
+	windowEnd := time.Now()
+	templated := isQueryTemplate(metric.Query)
+	if templated {
+		window := newQueryWindow(windowEnd, c.runState().LastRun(metric.Name), c.Window)
+		rendered, err := metric.withWindow(window)
+		if err != nil {
+			logEvent(ctx, "error", "Invalid query template in config", map[string]interface{}{
+				"metric": metric.Name,
+				"error":  err.Error(),
+			})
+			return fail(statusInvalid, err)
+		}
+		metric = rendered
+	}
+	if metric.Query != "" {
+		result.Fingerprint = queryFingerprint(metric.Query)
+		result.query = metric.Query
+	}
+
+	if err := validateMetricQuery(metric); err != nil {
+		logEvent(ctx, "error", "Invalid query in config", map[string]interface{}{
+			"metric": metric.Name,
+			"query":  normalizeQuery(metric.Query),
+			"error":  err.Error(),
+		})
+		return fail(statusInvalid, err)
+	}
+
+	samples := []sample{{}}
+	if cached, ok := c.cachedSamples(metric); ok {
+		samples = cached
+		result.Cached = true
+		if c.Debug {
+			logEvent(ctx, "debug", "Using cached query result", map[string]interface{}{
+				"metric":    metric.Name,
+				"points":    len(samples),
+				"cache_ttl": metric.CacheTTL.String(),
+			})
+		}
+	} else if metric.Query != "" || metric.execSource() {
+		if c.Debug {
+			logEvent(ctx, "debug", "Executing SQL query", map[string]interface{}{
+				"metric":      metric.Name,
+				"query":       normalizeQuery(metric.Query),
+				"fingerprint": result.Fingerprint,
+			})
+		}
+
+		if !metric.execSource() && !c.Breaker.Allow() {
+			return fail(statusCircuitOpen, errCircuitOpen)
+		}
+		if metric.AllowUnsafe && !metric.execSource() {
+			logEvent(ctx, "warn", "AUDIT: running unvalidated query (allow_unsafe)", map[string]interface{}{
+				"audit":       true,
+				"metric":      metric.Name,
+				"fingerprint": result.Fingerprint,
+			})
+			telemetry.RecordUnsafe(metric.Name)
+		}
+
+		if metric.recordMode() {
+			result = c.collectRecords(ctx, dbClient, telemetry, metric, result)
+			if templated && result.Status == statusSent {
+				c.runState().SetLastRun(metric.Name, windowEnd)
+			}
+			return result
+		}
+
+		fetchCtx, cancel := withOptionalTimeout(ctx, metric.Timeout)
+		start := time.Now()
+		fetched, errDb := withRetry(fetchCtx, metric.Retries, metric.RetryDelay, func(attempt int, delay time.Duration, err error) {
+			logEvent(ctx, "warn", "Retrying query after transient error", map[string]interface{}{
+				"metric":  metric.Name,
+				"attempt": attempt,
+				"delay":   delay.String(),
+				"error":   err.Error(),
+			})
+		}, func() ([]sample, error) {
+			return c.fetch(fetchCtx, dbClient, metric)
+		})
+		cancel()
+		result.QueryTimeMs = float64(time.Since(start).Microseconds()) / 1000.0
+		if !metric.execSource() {
+			c.recordBreaker(ctx, errDb)
+		}
+
+		if isEmptyResult(errDb) {
+			emptyValue, skip, errEmpty := resolveEmptyResult(metric, errDb)
+			if skip {
+				logEvent(ctx, "debug", "Skipping metric with empty query result", map[string]interface{}{
+					"metric": metric.Name,
+					"reason": errDb.Error(),
+				})
+				result.Status = statusSkipped
+				return result
+			}
+			fetched, errDb = []sample{{Value: emptyValue}}, errEmpty
+		}
+
+		if errDb != nil {
+			c.Errors.Log(ctx, "error", "Error fetching metric from DB", metric.Name, errDb, map[string]interface{}{
+				"metric": metric.Name,
+			})
+			return fail(statusQueryFailed, errDb)
+		}
+		samples = fetched
+		if metric.EmitQueryStats {
+			c.sendQueryStats(ctx, telemetry, metric, result.QueryTimeMs, len(samples))
+		}
+		if metric.CacheTTL > 0 {
+			c.valueCache().put(cacheKey(metric), samples, time.Now())
+		}
+
+		if c.Debug {
+			logEvent(ctx, "debug", "SQL query result", map[string]interface{}{
+				"metric": metric.Name,
+				"points": len(samples),
+			})
+		}
+	}
+
+	now := time.Now()
+	points := make([]sample, len(samples))
+	for i, s := range samples {
+		points[i] = s
+		points[i].Value = applyTransforms(metric.TimeValue.apply(s.Value, now), metric.Transform)
+	}
+	points, dropped := limitSeries(points, metric.MaxSeries)
+	if dropped > 0 {
+		logEvent(ctx, "warn", "Metric exceeds max_series - dropping the remaining series", map[string]interface{}{
+			"metric":     metric.Name,
+			"max_series": metric.MaxSeries,
+			"dropped":    dropped,
+		})
+		telemetry.RecordDroppedSeries(dropped)
+	}
+
+	var total int
+	var sendErrs []error
+	if metric.Type == metricTypeDistribution {
+		total, sendErrs = c.sendDistributions(ctx, telemetry, metric, points)
+		result.Series = total
+	} else {
+		total, sendErrs = c.sendGauges(ctx, telemetry, metric, points)
+		c.checkAlerts(ctx, metric, points)
+		c.checkStale(ctx, telemetry, metric, samples, result.Cached)
+		c.checkAnomalies(ctx, telemetry, metric, points, result.Cached)
+		if total == 1 {
+			result.Value = &points[0].Value
+		} else {
+			result.Series = total
+		}
+	}
+	if len(sendErrs) > 0 {
+		errSend := sendErrs[0]
+		if total > 1 {
+			errSend = fmt.Errorf("%d of %d series failed: %w", len(sendErrs), total, sendErrs[0])
+		}
+		c.Errors.Log(ctx, "error", "Failed to send metric", metric.Name, errSend, map[string]interface{}{
+			"metric": metric.Name,
+		})
+		return fail(statusSendFailed, errSend)
+	}
+	c.syncMetadata(ctx, metric, points)
+	if templated {
+		c.runState().SetLastRun(metric.Name, windowEnd)
+	}
+
+	result.Status = statusSent
+	return result
+}
+
+// fetch reads the metric's samples from its source, or from the replayed
+// snapshot, and records them when recording.
+func (c *Collector) fetch(ctx context.Context, dbClient *SQLDB, metric MetricConfig) ([]sample, error) {
+	if c.Replay != nil {
+		return c.Replay.Samples(metric.Name)
+	}
+	samples, err := fetchSamples(ctx, dbClient, metric)
+	if c.Record != nil {
+		c.Record.Record(metric.Name, samples, err)
+	}
+	return samples, err
+}
+
+// sendGauges submits every point as a gauge and returns the number of series
+// together with the submission errors.
+func (c *Collector) sendGauges(ctx context.Context, telemetry *Telemetry, metric MetricConfig, points []sample) (int, []error) {
+	ctx = withSinkOptions(ctx, metric.SinkOptions)
+	sender := c.senderFor(metric)
+	var errs []error
+	for _, p := range points {
+		name, value, tags, host := seriesName(metric, p.Name), p.Value, c.seriesTags(ctx, metric, p.Tags), metric.sampleHost(p)
+		err := c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+			return sender.SendMetric(ctx, name, value, tags, host)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(points), errs
+}
+
+// sendDistributions submits the points as one distribution per name and tag
+// set and returns the number of series together with the submission errors.
+func (c *Collector) sendDistributions(ctx context.Context, telemetry *Telemetry, metric MetricConfig, points []sample) (int, []error) {
+	sender, ok := c.senderFor(metric).(DistributionSender)
+	if !ok {
+		return 1, []error{errors.New("the configured sender does not support distribution metrics")}
+	}
+
+	groups := groupDistribution(points)
+	var errs []error
+	for _, g := range groups {
+		name, values, tags, host := seriesName(metric, g.Name), g.Values, c.seriesTags(ctx, metric, g.Tags), metric.sampleHost(sample{Host: g.Host})
+		err := c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+			return sender.SendDistribution(ctx, name, values, tags, host)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(groups), errs
+}
+
+// sendQueryStats submits the duration of the metric's query and the number
+// of points it returned as companion metrics. Failures are only logged; they
+// do not fail the metric.
+func (c *Collector) sendQueryStats(ctx context.Context, telemetry *Telemetry, metric MetricConfig, queryTimeMs float64, rows int) {
+	sender := c.senderFor(metric)
+	tags := c.seriesTags(ctx, metric, nil)
+	for _, stat := range []struct {
+		suffix string
+		value  float64
+	}{
+		{".query_time_ms", queryTimeMs},
+		{".rows", float64(rows)},
+	} {
+		name, value := metric.Name+stat.suffix, stat.value
+		// Keyed by the stat, so its failure does not fail the metric.
+		err := c.submit(ctx, telemetry, name, func(ctx context.Context) error {
+			return sender.SendMetric(ctx, name, value, tags, metric.Host)
+		})
+		if err != nil {
+			logEvent(ctx, "warn", "Failed to send query stats", map[string]interface{}{
+				"metric": name,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// submit sends one point, or queues it when the send pipeline is enabled.
+// The outcome of a queued point is reported by awaitSends at the end of the
+// cycle.
+func (c *Collector) submit(ctx context.Context, telemetry *Telemetry, metric string, send func(context.Context) error) error {
+	if c.Pipeline != nil {
+		err := c.Pipeline.Enqueue(ctx, c.sends, metric, telemetry, send)
+		if err != nil {
+			telemetry.RecordSend(err)
+		}
+		return err
+	}
+	err := send(ctx)
+	telemetry.RecordSend(err)
+	return err
+}
+
+// awaitSends waits for the pipeline to send the points the cycle queued and
+// reports the metrics with a failed point as send_failed, so the summary,
+// heartbeat and self-telemetry only count points that were submitted. The
+// queries of the cycle never wait for the sinks; only its end does.
+func (c *Collector) awaitSends(ctx context.Context, summary *RunSummary) {
+	outcomes := c.sends.Wait(ctx)
+	for i := range summary.Metrics {
+		result := &summary.Metrics[i]
+		outcome := outcomes[result.Metric]
+		if result.Status != statusSent || len(outcome.Errors) == 0 {
+			continue
+		}
+		errSend := outcome.Errors[0]
+		if outcome.Points > 1 {
+			errSend = fmt.Errorf("%d of %d queued points failed: %w", len(outcome.Errors), outcome.Points, errSend)
+		}
+		c.Errors.Log(ctx, "error", "Failed to send metric", result.Metric, errSend, map[string]interface{}{
+			"metric": result.Metric,
+		})
+		result.Status = statusSendFailed
+		result.Error = logRedactor.RedactString(errSend.Error())
+		summary.Succeeded--
+		summary.Failed++
+	}
+}
+
+// checkAlerts posts an event for every point whose alert level changed since
+// the previous run.
+func (c *Collector) checkAlerts(ctx context.Context, metric MetricConfig, points []sample) {
+	if metric.Alert == nil {
+		return
+	}
+	sender, ok := c.senderFor(metric).(EventSender)
+	if !ok {
+		return
+	}
+	for _, p := range points {
+		name := seriesName(metric, p.Name)
+		level, reason := metric.Alert.evaluate(p.Value)
+		if _, changed := c.alerts.transition(sampleKey(sample{Name: name, Tags: p.Tags, Host: p.Host}), level); !changed {
+			continue
+		}
+		tags := c.seriesTags(ctx, metric, p.Tags)
+		if err := sender.SendEvent(ctx, alertEvent(name, p.Value, level, reason, tags, metric.sampleHost(p))); err != nil {
+			logEvent(ctx, "warn", "Failed to post alert event", map[string]interface{}{
+				"metric": name,
+				"level":  level,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// syncMetadata pushes the metric's metadata the first time each series name
+// is submitted successfully.
+func (c *Collector) syncMetadata(ctx context.Context, metric MetricConfig, points []sample) {
+	meta, ok := metadataFor(metric)
+	if !ok {
+		return
+	}
+	sender, ok := c.senderFor(metric).(MetadataSender)
+	if !ok {
+		return
+	}
+	for _, p := range points {
+		name := seriesName(metric, p.Name)
+		if !c.metadata.needsSync(name) {
+			continue
+		}
+		if err := sender.UpdateMetadata(ctx, name, meta); err != nil {
+			logEvent(ctx, "warn", "Failed to update metric metadata", map[string]interface{}{
+				"metric": name,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// seriesName returns the rendered name of a row, or the metric name.
+func seriesName(metric MetricConfig, rendered string) string {
+	if rendered != "" {
+		return rendered
+	}
+	return metric.Name
+}
+
+// senderFor returns the sender of the sinks metric is routed to.
+func (c *Collector) senderFor(metric MetricConfig) MetricSender {
+	names := metric.routedSinks()
+	switch len(names) {
+	case 0:
+		return c.Sender
+	case 1:
+		if sender, ok := c.Sinks[names[0]]; ok {
+			return sender
+		}
+		return c.Sender
+	}
+	multi := &multiSink{}
+	for _, name := range names {
+		if sender, ok := c.Sinks[name]; ok {
+			multi.names = append(multi.names, name)
+			multi.senders = append(multi.senders, sender)
+		}
+	}
+	return multi
+}
+
+// stopping reports whether a shutdown was requested.
+func (c *Collector) stopping() bool {
+	select {
+	case <-c.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// flushSender exports the points buffered by senders that submit
+// asynchronously. Like telemetry it is not cut short by a timed out cycle.
+// With the send pipeline, the senders are flushed in the background once
+// the points of the cycle have been sent.
+func (c *Collector) flushSender(ctx context.Context) {
+	if c.Pipeline != nil {
+		ctx = context.WithoutCancel(ctx)
+		c.Pipeline.Flush(func() { c.flushSenders(ctx) })
+		return
+	}
+	c.flushSenders(ctx)
+}
+
+// flushSenders flushes every sender that buffers points.
+func (c *Collector) flushSenders(ctx context.Context) {
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	senders := []MetricSender{c.Sender}
+	for _, sender := range c.Sinks {
+		if !slices.Contains(senders, sender) {
+			senders = append(senders, sender)
+		}
+	}
+	for _, sender := range senders {
+		flusher, ok := sender.(FlushSender)
+		if !ok {
+			continue
+		}
+		if err := flusher.Flush(flushCtx); err != nil {
+			logEvent(ctx, "error", "Failed to flush metrics", map[string]interface{}{"error": err.Error()})
+		}
+	}
+}
+
+// sendServiceCheck reports database availability when service checks are enabled.
+func (c *Collector) sendServiceCheck(ctx context.Context) {
+	if !c.Config.ServiceCheck.Enabled || c.DB == nil {
+		return
+	}
+	sender, ok := c.Sender.(ServiceCheckSender)
+	if !ok {
+		return
+	}
+	// Like telemetry, the check is still delivered after the run timed out.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	check := databaseServiceCheck(sendCtx, c.DB, c.Breaker, c.Config.ServiceCheck, c.DBTags, c.Hostname)
+	if err := sender.SendServiceCheck(sendCtx, check); err != nil {
+		logEvent(ctx, "warn", "Failed to send service check", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// recordBreaker feeds a query outcome to the circuit breaker and logs state changes.
+func (c *Collector) recordBreaker(ctx context.Context, err error) {
+	if c.Breaker == nil {
+		return
+	}
+	before := c.Breaker.State()
+	c.Breaker.Record(err)
+	if after := c.Breaker.State(); after != before {
+		level := "info"
+		if after == breakerOpen {
+			level = "warn"
+		}
+		logEvent(ctx, level, "Circuit breaker state changed", map[string]interface{}{
+			"from": before,
+			"to":   after,
+		})
+	}
+}
+
+// intervalSlack absorbs the drift of daemon cycles, so a metric with an
+// interval of two cycles is not postponed to the third.
+const intervalSlack = time.Second
+
+// due reports whether a metric with an interval or a schedule is to be
+// collected in the cycle started at now, and records the collection if so.
+func (c *Collector) due(metric MetricConfig, now time.Time) bool {
+	if metric.Schedule != "" {
+		return c.scheduleDue(metric, now)
+	}
+	if metric.Interval <= 0 {
+		return true
+	}
+	if last, ok := c.collected[metric.Name]; ok && now.Add(intervalSlack).Sub(last) < metric.Interval {
+		return false
+	}
+	if c.collected == nil {
+		c.collected = make(map[string]time.Time)
+	}
+	c.collected[metric.Name] = now
+	return true
+}
+
+// scheduleDue reports whether a scheduled time of the metric passed since
+// the previous cycle. The first daemon cycle only starts the clock, so a
+// restart does not collect a metric outside its schedule.
+func (c *Collector) scheduleDue(metric MetricConfig, now time.Time) bool {
+	schedule, err := parseCron(metric.Schedule)
+	if err != nil {
+		return false
+	}
+	if c.checked == nil {
+		c.checked = make(map[string]time.Time)
+	}
+	last, ok := c.checked[metric.Name]
+	c.checked[metric.Name] = now
+	if !ok {
+		return !c.Daemon
+	}
+	next := schedule.next(last)
+	return !next.IsZero() && !next.After(now)
+}
+
+func (c *Collector) runState() *runState {
+	c.stateOnce.Do(func() {
+		if c.State == nil {
+			c.State, _ = loadRunState("")
+		}
+	})
+	return c.State
+}
+
+// valueCache returns the collector's query result cache, creating it on first use.
+func (c *Collector) valueCache() *valueCache {
+	c.cacheOnce.Do(func() { c.cache = newValueCache() })
+	return c.cache
+}
+
+// queryGuard returns the guard of the configuration, kept across cycles so
+// query plans are reused.
+func (c *Collector) queryGuard() *queryGuard {
+	c.guardOnce.Do(func() { c.guard = newQueryGuard(c.Config.Guards, databaseType()) })
+	return c.guard
+}
+
+// cachedSamples returns a still-valid cached result for metric, if any.
+func (c *Collector) cachedSamples(metric MetricConfig) ([]sample, bool) {
+	if metric.CacheTTL <= 0 || metric.Query == "" {
+		return nil, false
+	}
+	return c.valueCache().get(cacheKey(metric), metric.CacheTTL, time.Now())
+}
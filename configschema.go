@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jsonSchemaDialect is the JSON Schema version of the generated schema.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations accepted by time.ParseDuration.
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// jsonSchema is a JSON Schema object.
+type jsonSchema map[string]interface{}
+
+// customSchemas describes the types decoded by their own UnmarshalYAML,
+// whose YAML form differs from their Go fields.
+var customSchemas = map[reflect.Type]jsonSchema{
+	reflect.TypeOf(Aggregate("")): {
+		"type": "string",
+		"enum": sortedKeys(aggregateFuncs),
+	},
+	reflect.TypeOf(MetricType("")): {
+		"type": "string",
+		"enum": []string{metricTypeGauge, metricTypeDistribution},
+	},
+	reflect.TypeOf(MetricMode("")): {
+		"type": "string",
+		"enum": []string{modeMetrics, modeLogs, modeEvents},
+	},
+	reflect.TypeOf(TimeValue("")): {
+		"type": "string",
+		"enum": []string{timeValueEpoch, timeValueAge},
+	},
+	reflect.TypeOf(Enabled{}): {
+		"description": "A boolean or an expression such as env.REGION == \"eu\"",
+		"type":        []string{"boolean", "string"},
+	},
+	reflect.TypeOf(EmptyPolicy{}): {
+		"oneOf": []jsonSchema{
+			{"type": "string", "pattern": `^(error|skip|zero|default:.+)$`},
+			{
+				"type":                 "object",
+				"properties":           jsonSchema{emptyDefault: jsonSchema{"type": "number"}},
+				"required":             []string{emptyDefault},
+				"additionalProperties": false,
+			},
+		},
+	},
+	reflect.TypeOf(QueryParam{}): {
+		"oneOf": []jsonSchema{
+			{"type": []string{"string", "number", "boolean", "null"}},
+			{
+				"type": "object",
+				"properties": jsonSchema{
+					"env":     jsonSchema{"type": "string"},
+					"default": jsonSchema{"type": "string"},
+				},
+				"required":             []string{"env"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	reflect.TypeOf(time.Duration(0)): {
+		"type":    "string",
+		"pattern": durationPattern,
+	},
+	reflect.TypeOf(yaml.Node{}): {},
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// schemaBuilder derives a JSON Schema from the yaml tags of the
+// configuration structs, so new fields are described without extra code.
+// Structs are emitted once under $defs and referenced by name.
+type schemaBuilder struct {
+	defs map[string]jsonSchema
+}
+
+// configSchema returns the JSON Schema of the configuration file.
+func configSchema() jsonSchema {
+	b := &schemaBuilder{defs: make(map[string]jsonSchema)}
+	root := b.object(reflect.TypeOf(Config{}))
+	// Every metric needs a name; templates and defaults do not.
+	root["properties"].(jsonSchema)["metrics"] = jsonSchema{
+		"type": "array",
+		"items": jsonSchema{
+			"allOf": []jsonSchema{b.schema(reflect.TypeOf(MetricConfig{})), {"required": []string{"name"}}},
+		},
+	}
+	root["$schema"] = jsonSchemaDialect
+	root["title"] = programName + " configuration"
+	root["$defs"] = b.defs
+	return root
+}
+
+// schema returns the schema of a value of type t.
+func (b *schemaBuilder) schema(t reflect.Type) jsonSchema {
+	if s, ok := customSchemas[t]; ok {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return jsonSchema{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return jsonSchema{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := b.defs[name]; !ok {
+			b.defs[name] = jsonSchema{} // placeholder for recursive types
+			b.defs[name] = b.object(t)
+		}
+		return jsonSchema{"$ref": "#/$defs/" + name}
+	}
+	return jsonSchema{}
+}
+
+// object returns the schema of the struct t. Unknown keys are rejected, as
+// when loading, unless an inline map collects them.
+func (b *schemaBuilder) object(t reflect.Type) jsonSchema {
+	s := jsonSchema{"type": "object", "properties": jsonSchema{}, "additionalProperties": false}
+	b.addFields(s, t)
+	return s
+}
+
+func (b *schemaBuilder) addFields(s jsonSchema, t reflect.Type) {
+	properties := s["properties"].(jsonSchema)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if slices.Contains(strings.Split(flags, ","), "inline") {
+			switch field.Type.Kind() {
+			case reflect.Map:
+				s["additionalProperties"] = b.schema(field.Type.Elem())
+			case reflect.Struct:
+				b.addFields(s, field.Type)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+// writeConfigSchema writes the configuration schema as indented JSON.
+func writeConfigSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(configSchema())
+}
+
+func runConfig(_ context.Context, _ *options, args []string) error {
+	if len(args) != 1 || args[0] != "schema" {
+		return withExitCode(exitConfigInvalid, errors.New("usage: config schema"))
+	}
+	return writeConfigSchema(os.Stdout)
+}
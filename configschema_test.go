@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigSchemaCoversFields(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeConfigSchema(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Schema     string                     `json:"$schema"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if schema.Schema != jsonSchemaDialect {
+		t.Errorf("Expected $schema %q, got %q", jsonSchemaDialect, schema.Schema)
+	}
+
+	tests := []struct {
+		name       string
+		typ        reflect.Type
+		properties map[string]json.RawMessage
+	}{
+		{name: "Config", typ: reflect.TypeOf(Config{}), properties: schema.Properties},
+		{name: "MetricConfig", typ: reflect.TypeOf(MetricConfig{}), properties: schema.Defs["MetricConfig"].Properties},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < tc.typ.NumField(); i++ {
+				name, flags, _ := strings.Cut(tc.typ.Field(i).Tag.Get("yaml"), ",")
+				if !tc.typ.Field(i).IsExported() || strings.Contains(flags, "inline") {
+					continue
+				}
+				if _, ok := tc.properties[name]; !ok {
+					t.Errorf("Expected property %q in the schema", name)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigSchemaCustomTypes(t *testing.T) {
+	schema := configSchema()
+	metric := schema["$defs"].(map[string]jsonSchema)["MetricConfig"]["properties"].(jsonSchema)
+
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{property: "enabled", want: `{"description":"A boolean or an expression such as env.REGION == \"eu\"","type":["boolean","string"]}`},
+		{property: "type", want: `{"enum":["gauge","distribution"],"type":"string"}`},
+		{property: "timeout", want: `{"pattern":"^-?([0-9]+(\\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$","type":"string"}`},
+		{property: "monitor", want: `{"$ref":"#/$defs/MonitorConfig"}`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.property, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(metric[tc.property]); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(buf.String()); got != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Every field is a bit set of the values it
+// matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a * day field. As in cron, when both day
+	// fields are restricted a day matching either of them matches.
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+// cronMacros are the shorthands accepted in place of the five fields.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the range and names of one field.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parseCron parses a cron expression such as "0 6 * * 1-5" or "@daily".
+// Fields accept *, values, ranges, lists and steps; months and days of week
+// also accept their three-letter names, and 7 is Sunday like 0. A leading
+// CRON_TZ=<zone> evaluates the expression in that time zone instead of the
+// local one.
+func parseCron(spec string) (*cronSchedule, error) {
+	s := &cronSchedule{loc: time.Local}
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "CRON_TZ="); ok {
+		zone, expr, _ := strings.Cut(rest, " ")
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", zone, err)
+		}
+		s.loc, spec = loc, strings.TrimSpace(expr)
+	}
+	if expanded, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	s.minute, s.hour, s.dom, s.month = sets[0], sets[1], sets[2], sets[3]
+	// Sunday may be written 0 or 7.
+	s.dow = sets[4] | sets[4]>>7&1
+	s.domAny, s.dowAny = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the bit set of the values matched by field.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			loText, hiText, _ := strings.Cut(expr, "-")
+			var err error
+			if lo, err = cronValue(loText, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(hiText, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q in %s field", expr, f.name)
+			}
+		default:
+			v, err := cronValue(expr, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// cronValue parses a number or name of the field.
+func cronValue(text string, f cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field (%d-%d)", text, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// next returns the first time after t matched by the schedule, or the zero
+// time when there is none within five years (e.g. for February 30).
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies the day of month and day of week fields to t.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// validateMetricSchedules checks the schedule of every metric. A metric is
+// scheduled either by interval or by schedule, not both.
+func validateMetricSchedules(metrics []MetricConfig) error {
+	for _, metric := range metrics {
+		if metric.Schedule == "" {
+			continue
+		}
+		if metric.Interval > 0 {
+			return fmt.Errorf("metric %q: interval and schedule cannot both be set", metric.Name)
+		}
+		schedule, err := parseCron(metric.Schedule)
+		if err != nil {
+			return fmt.Errorf("metric %q: invalid schedule %q: %w", metric.Name, metric.Schedule, err)
+		}
+		if schedule.next(time.Now()).IsZero() {
+			return fmt.Errorf("metric %q: schedule %q never matches", metric.Name, metric.Schedule)
+		}
+	}
+	return nil
+}
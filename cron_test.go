@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2024-05-03 is a Friday.
+	from := time.Date(2024, 5, 3, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{name: "EveryMinute", spec: "* * * * *", want: time.Date(2024, 5, 3, 10, 18, 0, 0, time.UTC)},
+		{name: "Step", spec: "*/15 * * * *", want: time.Date(2024, 5, 3, 10, 30, 0, 0, time.UTC)},
+		{name: "WeekdayMorning", spec: "0 6 * * 1-5", want: time.Date(2024, 5, 6, 6, 0, 0, 0, time.UTC)},
+		{name: "Names", spec: "30 8 * jun mon", want: time.Date(2024, 6, 3, 8, 30, 0, 0, time.UTC)},
+		{name: "SundaySeven", spec: "0 0 * * 7", want: time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "List", spec: "0 9,17 * * *", want: time.Date(2024, 5, 3, 17, 0, 0, 0, time.UTC)},
+		{name: "DayOfMonthOrWeek", spec: "0 0 10 * 6", want: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)},
+		{name: "Macro", spec: "@monthly", want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "LeapDay", spec: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "TimeZone", spec: "CRON_TZ=Asia/Tokyo 0 9 * * *", want: time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			schedule, err := parseCron(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := schedule.next(from); !got.Equal(tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "0 6 * *", wantErr: "expected 5 fields"},
+		{spec: "60 * * * *", wantErr: "invalid value \"60\" in minute field"},
+		{spec: "0 6-2 * * *", wantErr: "invalid range"},
+		{spec: "*/0 * * * *", wantErr: "invalid step"},
+		{spec: "0 0 * foo *", wantErr: "in month field"},
+		{spec: "CRON_TZ=Nowhere/City 0 0 * * *", wantErr: "invalid time zone"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := parseCron(tc.spec)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateMetricSchedules(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  MetricConfig
+		wantErr string
+	}{
+		{name: "Valid", metric: MetricConfig{Name: "a", Schedule: "0 6 * * 1-5"}},
+		{name: "WithInterval", metric: MetricConfig{Name: "a", Schedule: "@daily", Interval: time.Hour}, wantErr: "cannot both be set"},
+		{name: "Invalid", metric: MetricConfig{Name: "a", Schedule: "daily"}, wantErr: "invalid schedule"},
+		{name: "Never", metric: MetricConfig{Name: "a", Schedule: "0 0 30 2 *"}, wantErr: "never matches"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMetricSchedules([]MetricConfig{tc.metric})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCollectorScheduleDue(t *testing.T) {
+	metric := MetricConfig{Name: "sales.daily", Schedule: "CRON_TZ=UTC 0 6 * * 1-5"}
+	start := time.Date(2024, 5, 3, 5, 50, 0, 0, time.UTC)
+
+	c := &Collector{Daemon: true}
+	steps := []struct {
+		at   time.Duration
+		want bool
+	}{
+		{at: 0, want: false},
+		{at: 5 * time.Minute, want: false},
+		{at: 10*time.Minute + 200*time.Millisecond, want: true},
+		{at: 15 * time.Minute, want: false},
+		// Saturday 06:00 is not scheduled.
+		{at: 24*time.Hour + 10*time.Minute, want: false},
+	}
+	for _, step := range steps {
+		if got := c.due(metric, start.Add(step.at)); got != step.want {
+			t.Errorf("At %v: expected due %v, got %v", step.at, step.want, got)
+		}
+	}
+
+	if !(&Collector{}).due(metric, start) {
+		t.Error("Expected single runs to collect scheduled metrics")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultDashboardTitle = "SQL Metrics"
+
+// Dashboard is a Datadog dashboard as accepted by the dashboards API.
+type Dashboard struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	LayoutType  string   `json:"layout_type"`
+	Widgets     []Widget `json:"widgets"`
+}
+
+// Widget is a dashboard widget. Only timeseries widgets are generated.
+type Widget struct {
+	Definition WidgetDefinition `json:"definition"`
+}
+
+type WidgetDefinition struct {
+	Type     string          `json:"type"`
+	Title    string          `json:"title"`
+	Requests []WidgetRequest `json:"requests"`
+}
+
+type WidgetRequest struct {
+	Q           string `json:"q"`
+	DisplayType string `json:"display_type"`
+}
+
+// buildDashboard creates one timeseries widget per metric, scoped to the
+// metric's tags and grouped by its tag columns. Metrics with templated names
+// are skipped as their series names are only known at run time.
+func buildDashboard(config *Config, title string) (Dashboard, []string) {
+	if title == "" {
+		title = defaultDashboardTitle
+	}
+	dash := Dashboard{
+		Title:       title,
+		Description: "Generated by " + programName,
+		LayoutType:  "ordered",
+		Widgets:     []Widget{},
+	}
+
+	var skipped []string
+	seen := map[string]bool{}
+	for _, metric := range config.Metrics {
+		if isNameTemplate(metric.Name) {
+			skipped = append(skipped, metric.Name)
+			continue
+		}
+		query := dashboardQuery(metric)
+		if seen[query] {
+			continue
+		}
+		seen[query] = true
+
+		widgetTitle := metric.Name
+		if metric.ShortName != "" {
+			widgetTitle = metric.ShortName
+		}
+		dash.Widgets = append(dash.Widgets, Widget{Definition: WidgetDefinition{
+			Type:     "timeseries",
+			Title:    widgetTitle,
+			Requests: []WidgetRequest{{Q: query, DisplayType: "line"}},
+		}})
+	}
+	return dash, skipped
+}
+
+// dashboardQuery returns the widget query of a metric, e.g.
+// avg:custom.metric.accounts{env:prod} by {region,plan}.
+func dashboardQuery(metric MetricConfig) string {
+	scope := "*"
+	if len(metric.Tags) > 0 {
+		scope = strings.Join(metric.Tags, ",")
+	}
+	query := fmt.Sprintf("avg:%s{%s}", metric.Name, scope)
+	if len(metric.TagColumns) > 0 {
+		query += " by {" + strings.Join(metric.TagColumns, ",") + "}"
+	}
+	return query
+}
+
+// runDashboard implements `dashboard generate`: it prints the dashboard JSON
+// or, with -create, creates the dashboard through the API.
+func runDashboard(ctx context.Context, opts *options, args []string) error {
+	if len(args) != 1 || args[0] != "generate" {
+		return withExitCode(exitConfigInvalid, errors.New("usage: dashboard generate [-title TITLE] [-create]"))
+	}
+
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+	dash, skipped := buildDashboard(config, opts.dashboardTitle)
+	for _, name := range skipped {
+		logEvent(ctx, "warn", "Skipping metric with templated name in dashboard", map[string]interface{}{"metric": name})
+	}
+
+	if !opts.create {
+		return writeDashboard(os.Stdout, dash)
+	}
+
+	apiKey := os.Getenv("DATADOG_API_KEY")
+	appKey := os.Getenv("DATADOG_APP_KEY")
+	logRedactor.AddSecret(apiKey)
+	logRedactor.AddSecret(appKey)
+	if apiKey == "" || appKey == "" {
+		return errors.New("DATADOG_API_KEY and DATADOG_APP_KEY must be set")
+	}
+	client := newDatadogClient(apiKey, config.Datadog)
+	client.AppKey = appKey
+	client.Debug = opts.debug
+
+	var created struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if _, err := client.doAPI(ctx, http.MethodPost, "/api/v1/dashboard", dash, &created); err != nil {
+		return fmt.Errorf("failed to create dashboard: %w", err)
+	}
+	fmt.Printf("Created dashboard %s: %s\n", created.ID, created.URL)
+	return nil
+}
+
+func writeDashboard(w io.Writer, dash Dashboard) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dash)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildDashboard(t *testing.T) {
+	config := &Config{Metrics: []MetricConfig{
+		{Name: "custom.metric.accounts", Tags: []string{"env:prod"}, TagColumns: []string{"region", "plan"}},
+		{Name: "custom.metric.db_size", ShortName: "DB size"},
+		{Name: "db.table.rows.{{.table_name}}"},
+		{Name: "custom.metric.db_size"},
+	}}
+
+	dash, skipped := buildDashboard(config, "")
+	if dash.Title != defaultDashboardTitle {
+		t.Errorf("Expected default title, got %q", dash.Title)
+	}
+	if len(skipped) != 1 || skipped[0] != "db.table.rows.{{.table_name}}" {
+		t.Errorf("Expected templated metric to be skipped, got %v", skipped)
+	}
+	if len(dash.Widgets) != 2 {
+		t.Fatalf("Expected 2 widgets (duplicates removed), got %d", len(dash.Widgets))
+	}
+
+	want := "avg:custom.metric.accounts{env:prod} by {region,plan}"
+	if got := dash.Widgets[0].Definition.Requests[0].Q; got != want {
+		t.Errorf("Expected query %q, got %q", want, got)
+	}
+	if got := dash.Widgets[1].Definition.Title; got != "DB size" {
+		t.Errorf("Expected short name as widget title, got %q", got)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDashboard(&buf, dash); err != nil {
+		t.Fatalf("writeDashboard failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded["layout_type"] != "ordered" {
+		t.Errorf("Expected valid dashboard JSON, got %s", buf.String())
+	}
+}
+
+func TestRunDashboardRequiresGenerate(t *testing.T) {
+	err := runDashboard(context.Background(), &options{}, []string{"delete"})
+	if exitCode(err) != exitConfigInvalid {
+		t.Errorf("Expected config invalid exit code, got %v", err)
+	}
+}
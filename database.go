@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DatabaseConfig configures how the database is connected to.
+type DatabaseConfig struct {
+	// PoolerCompat makes queries work behind transaction-pooling proxies
+	// such as PgBouncer and ProxySQL, where consecutive statements may run
+	// on different server connections. Query parameters are then sent
+	// without a separate prepare step and nothing relies on session state.
+	PoolerCompat bool `yaml:"pooler_compat,omitempty"`
+	// ConnectRetries is the number of retries of a connection failing with
+	// a network error, at startup and when a daemon reconnects.
+	ConnectRetries int `yaml:"connect_retries,omitempty"`
+	// ConnectRetryDelay is the delay before the first retry, doubled on
+	// every further one up to 30s (default 500ms).
+	ConnectRetryDelay time.Duration `yaml:"connect_retry_delay,omitempty"`
+	// FallbackURLEnvs name the environment variables of replica DSNs, in
+	// priority order, connected to while the primary is unreachable.
+	FallbackURLEnvs []string `yaml:"fallback_url_envs,omitempty"`
+	// TagRole adds source_role:primary or source_role:replica to every
+	// metric, after the DSN the database was last connected to.
+	TagRole bool `yaml:"tag_role,omitempty"`
+}
+
+// pingDB checks that db is reachable, retrying connection failures as
+// configured.
+func pingDB(ctx context.Context, db *sql.DB, cfg DatabaseConfig) error {
+	_, err := withRetryIf(ctx, cfg.ConnectRetries, cfg.ConnectRetryDelay, isDatabaseUnavailable,
+		func(attempt int, delay time.Duration, err error) {
+			logEvent(ctx, "warn", "Retrying database connection", map[string]interface{}{
+				"attempt": attempt,
+				"delay":   delay.String(),
+				"error":   logRedactor.RedactString(err.Error()),
+			})
+		},
+		func() (struct{}, error) {
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			return struct{}{}, db.PingContext(pingCtx)
+		})
+	return err
+}
+
+// validate checks the settings that need a session of their own, which a
+// transaction pooler does not keep.
+func (d DatabaseConfig) validate(config *Config) error {
+	if d.PoolerCompat && config.LeaderElection.Enabled {
+		return errors.New("database: leader_election holds a session-level lock and cannot be used with pooler_compat")
+	}
+	seen := map[string]bool{config.databaseURLEnv(): true}
+	for _, env := range d.FallbackURLEnvs {
+		if env == "" || seen[env] {
+			return fmt.Errorf("database: fallback_url_envs must be set and differ from the other DSNs, got %q", env)
+		}
+		seen[env] = true
+	}
+	return nil
+}
+
+// poolerDSN returns dsn with the driver options of the pooler compatibility
+// mode: binary_parameters for lib/pq, which binds and executes an unnamed
+// statement in a single round trip, and interpolateParams for MySQL, which
+// substitutes parameters client-side instead of preparing statements.
+// Options already set in dsn are kept.
+func poolerDSN(dbType, dsn string) (string, error) {
+	if dbType == "mysql" {
+		if strings.Contains(dsn, "interpolateParams=") {
+			return dsn, nil
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "interpolateParams=true", nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid database URL: %w", err)
+	}
+	query := u.Query()
+	if !query.Has("binary_parameters") {
+		query.Set("binary_parameters", "yes")
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// defaultMaxIdleConns is the database/sql default restored after a pool
+// reset.
+const defaultMaxIdleConns = 2
+
+// connectionMonitor checks the database before every daemon cycle. When it
+// is unreachable, e.g. during a failover, the idle connections of the pool
+// are closed so the next ones are dialed again, resolving the new primary.
+// A nil *connectionMonitor checks nothing.
+//
+// While connected to a fallback DSN, the idle connections are closed before
+// every cycle as well, so the next ones go back to the primary once it is
+// reachable again.
+type connectionMonitor struct {
+	db        *sql.DB
+	cfg       DatabaseConfig
+	fallback  *fallbackConnector
+	downSince time.Time
+	now       func() time.Time
+}
+
+// newConnectionMonitor returns a monitor of db, or nil without a database.
+func newConnectionMonitor(db *sql.DB, cfg DatabaseConfig, fallback *fallbackConnector) *connectionMonitor {
+	if db == nil {
+		return nil
+	}
+	return &connectionMonitor{db: db, cfg: cfg, fallback: fallback, now: time.Now}
+}
+
+// Check pings the database and, when that fails, resets the pool and
+// reconnects with the configured retries. The cycle runs either way; a
+// database still down is left to the circuit breaker.
+func (m *connectionMonitor) Check(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	if m.fallback.Role() != rolePrimary {
+		resetPool(m.db)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err := m.db.PingContext(pingCtx)
+	cancel()
+	if err != nil {
+		if m.downSince.IsZero() {
+			m.downSince = m.now()
+			logEvent(ctx, "warn", "Lost the database connection - reconnecting", map[string]interface{}{
+				"error": logRedactor.RedactString(err.Error()),
+			})
+		}
+		resetPool(m.db)
+		err = pingDB(ctx, m.db, m.cfg)
+	}
+	if err != nil {
+		logEvent(ctx, "warn", "Database still unreachable", map[string]interface{}{
+			"down_for": m.now().Sub(m.downSince).Round(time.Second).String(),
+			"error":    logRedactor.RedactString(err.Error()),
+		})
+		return
+	}
+	if !m.downSince.IsZero() {
+		logEvent(ctx, "info", "Reconnected to the database", map[string]interface{}{
+			"down_for": m.now().Sub(m.downSince).Round(time.Second).String(),
+		})
+		m.downSince = time.Time{}
+	}
+}
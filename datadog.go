@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	datadogBaseURL      = "https://api.datadoghq.com"
+	datadogSeriesPath   = "/api/v1/series"
+	datadogSeriesV2Path = "/api/v2/series"
+)
+
+// Metric intake types of the v2 series API.
+const (
+	seriesV2TypeUnspecified = 0
+	seriesV2TypeCount       = 1
+	seriesV2TypeRate        = 2
+	seriesV2TypeGauge       = 3
+)
+
+// DatadogConfig configures submission to the Datadog API (or an intake proxy in front of it).
+type DatadogConfig struct {
+	// URL overrides the series endpoint, e.g. for an internal observability gateway.
+	URL string `yaml:"url,omitempty"`
+	// AcceptedStatusCodes lists the HTTP status codes treated as a successful
+	// submission. Defaults to 202, which is what the Datadog API returns.
+	AcceptedStatusCodes []int `yaml:"accepted_status_codes,omitempty"`
+	// Headers are static HTTP headers added to every request, e.g. a cost-center
+	// header required by an internal gateway.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// PayloadFields are extra top-level JSON fields added to every payload.
+	PayloadFields map[string]interface{} `yaml:"payload_fields,omitempty"`
+	// SeriesFields are extra JSON fields added to every series in a payload.
+	// Built-in series fields (metric, points, tags, ...) are never overridden.
+	SeriesFields map[string]interface{} `yaml:"series_fields,omitempty"`
+	// Destinations fans every submission out to several Datadog organizations.
+	// When empty, DATADOG_API_KEY and the settings above are used.
+	Destinations []DestinationConfig `yaml:"destinations,omitempty"`
+	// HTTP tunes the timeouts and connection reuse of the API client.
+	HTTP HTTPClientConfig `yaml:"http,omitempty"`
+	// RateLimit caps the requests per second sent to the API.
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+	// Batch buffers the gauges of a cycle and submits them together at its
+	// end, split into requests within the API payload limits.
+	Batch bool `yaml:"batch,omitempty"`
+}
+
+// newDatadogClient creates a client for apiKey configured from cfg.
+func newDatadogClient(apiKey string, cfg DatadogConfig) *DatadogClient {
+	return &DatadogClient{
+		APIKey:              apiKey,
+		URL:                 cfg.URL,
+		AcceptedStatusCodes: cfg.AcceptedStatusCodes,
+		Headers:             cfg.Headers,
+		PayloadFields:       cfg.PayloadFields,
+		SeriesFields:        cfg.SeriesFields,
+		HTTPClient:          newHTTPClient(cfg.HTTP),
+		Limiter:             newRateLimiter(cfg.RateLimit),
+		Batch:               cfg.Batch,
+	}
+}
+
+type DatadogClient struct {
+	APIKey string
+	// AppKey is only required for read APIs such as metric queries.
+	AppKey              string
+	BaseURL             string
+	Debug               bool
+	DryRun              bool
+	URL                 string
+	AcceptedStatusCodes []int
+	Headers             map[string]string
+	PayloadFields       map[string]interface{}
+	SeriesFields        map[string]interface{}
+	// V2 submits to the v2 series API (feature flag v2_api).
+	V2 bool
+	// DryRunPrinter prints the payloads skipped in dry run mode instead of
+	// logging them. APIKeyEnv names the variable of the API key for it.
+	DryRunPrinter *dryRunPrinter
+	APIKeyEnv     string
+	// HTTPClient is reused for every request; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+	// Limiter delays requests over the rate limit; nil sends them at once.
+	Limiter *rateLimiter
+	// Batch buffers gauges until Flush.
+	Batch bool
+
+	mu        sync.Mutex
+	pending   []DataSeries
+	lastFlush flushStats
+}
+
+// httpClient returns the client requests are sent with.
+func (d *DatadogClient) httpClient() *http.Client {
+	if d.HTTPClient != nil {
+		return d.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// setHeaders applies the configured static headers followed by the standard
+// ones, so custom headers can never replace authentication or content type.
+func (d *DatadogClient) setHeaders(req *http.Request, contentType bool) {
+	for name, value := range d.Headers {
+		req.Header.Set(name, value)
+	}
+	if contentType {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("DD-API-KEY", d.APIKey)
+	if d.AppKey != "" {
+		req.Header.Set("DD-APPLICATION-KEY", d.AppKey)
+	}
+}
+
+// encodePayload serializes a series payload in the v1 or v2 format, injecting
+// the configured extra payload and series fields.
+func (d *DatadogClient) encodePayload(m Metric) ([]byte, error) {
+	if d.V2 {
+		return d.encodeWithFields(toMetricV2(m))
+	}
+	return d.encodeWithFields(m)
+}
+
+// encodeWithFields serializes a payload with a top-level "series" list,
+// injecting the configured extra payload and series fields.
+func (d *DatadogClient) encodeWithFields(body interface{}) ([]byte, error) {
+	if len(d.PayloadFields) == 0 && len(d.SeriesFields) == 0 {
+		return json.Marshal(body)
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var decoded struct {
+		Series []map[string]interface{} `json:"series"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	for _, obj := range decoded.Series {
+		for k, v := range d.SeriesFields {
+			if _, exists := obj[k]; !exists {
+				obj[k] = v
+			}
+		}
+	}
+
+	payload := make(map[string]interface{}, len(d.PayloadFields)+1)
+	for k, v := range d.PayloadFields {
+		payload[k] = v
+	}
+	payload["series"] = decoded.Series
+	return json.Marshal(payload)
+}
+
+// seriesURL returns the endpoint metrics are posted to.
+func (d *DatadogClient) seriesURL() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	if d.V2 {
+		return d.apiURL(datadogSeriesV2Path)
+	}
+	return d.apiURL(datadogSeriesPath)
+}
+
+// apiURL returns the absolute URL of a Datadog API path such as "/api/v1/query".
+func (d *DatadogClient) apiURL(path string) string {
+	base := d.BaseURL
+	if base == "" {
+		base = datadogBaseURL
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// doAPI sends a JSON request to a Datadog API path and decodes the JSON
+// response into out when it is non-nil. body may be nil. Responses outside
+// the 2xx range are returned as errors together with the status code.
+func (d *DatadogClient) doAPI(ctx context.Context, method, path string, body, out interface{}) (status int, err error) {
+	if err := d.Limiter.Wait(ctx); err != nil {
+		return 0, fmt.Errorf("rate limit wait: %w", err)
+	}
+	ctx, span := startHTTPSpan(ctx, method, d.apiURL(path))
+	defer func() { endSpan(span, status, err) }()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, d.apiURL(path), reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	d.setHeaders(req, body != nil)
+
+	resp, err := d.httpClient().Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		drainBody(resp.Body)
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logEvent(ctx, "warn", "Failed to close response body", map[string]interface{}{"error": closeErr.Error()})
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, statusError(resp.StatusCode, resp.Body)
+	}
+	if out != nil {
+		data, err := readLimitedBody(resp.Body, maxResponseBodyBytes, responseReadTimeout)
+		if err != nil {
+			return resp.StatusCode, err
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// QueryPoints runs a metric query against the Datadog query API over the
+// given time range and returns the number of points found. It requires AppKey.
+func (d *DatadogClient) QueryPoints(ctx context.Context, query string, from, to time.Time) (int, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("from", strconv.FormatInt(from.Unix(), 10))
+	params.Set("to", strconv.FormatInt(to.Unix(), 10))
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Series []struct {
+			Pointlist [][]*float64 `json:"pointlist"`
+		} `json:"series"`
+	}
+	if _, err := d.doAPI(ctx, http.MethodGet, "/api/v1/query?"+params.Encode(), nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Status == "error" {
+		return 0, fmt.Errorf("query failed: %s", result.Error)
+	}
+
+	points := 0
+	for _, series := range result.Series {
+		points += len(series.Pointlist)
+	}
+	return points, nil
+}
+
+// accepted reports whether status indicates a successful submission.
+func (d *DatadogClient) accepted(status int) bool {
+	if len(d.AcceptedStatusCodes) == 0 {
+		return status == http.StatusAccepted
+	}
+	for _, code := range d.AcceptedStatusCodes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+type Metric struct {
+	Series []DataSeries `json:"series"`
+}
+
+type DataSeries struct {
+	Metric   string      `json:"metric"`
+	Points   [][]float64 `json:"points"`
+	Tags     []string    `json:"tags,omitempty"`
+	Host     string      `json:"host,omitempty"`
+	Type     string      `json:"type,omitempty"`
+	Interval int64       `json:"interval,omitempty"`
+	// Resources are only part of the v2 payload.
+	Resources []ResourceV2 `json:"-"`
+}
+
+// MetricV2 is a payload for the v2 series API.
+type MetricV2 struct {
+	Series []DataSeriesV2 `json:"series"`
+}
+
+type DataSeriesV2 struct {
+	Metric    string       `json:"metric"`
+	Type      int          `json:"type"`
+	Points    []PointV2    `json:"points"`
+	Tags      []string     `json:"tags,omitempty"`
+	Resources []ResourceV2 `json:"resources,omitempty"`
+	Interval  int64        `json:"interval,omitempty"`
+}
+
+type PointV2 struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type ResourceV2 struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// toMetricV2 converts a v1 payload to the v2 format. The host becomes a host
+// resource, before the series' other resources.
+func toMetricV2(m Metric) MetricV2 {
+	out := MetricV2{Series: make([]DataSeriesV2, 0, len(m.Series))}
+	for _, s := range m.Series {
+		series := DataSeriesV2{Metric: s.Metric, Type: seriesV2Type(s.Type), Tags: s.Tags, Interval: s.Interval}
+		for _, p := range s.Points {
+			series.Points = append(series.Points, PointV2{Timestamp: int64(p[0]), Value: p[1]})
+		}
+		if s.Host != "" {
+			series.Resources = []ResourceV2{{Name: s.Host, Type: "host"}}
+		}
+		series.Resources = append(series.Resources, s.Resources...)
+		out.Series = append(out.Series, series)
+	}
+	return out
+}
+
+// seriesV2Type maps a v1 metric type name to its v2 intake type.
+func seriesV2Type(name string) int {
+	switch name {
+	case "gauge":
+		return seriesV2TypeGauge
+	case "count":
+		return seriesV2TypeCount
+	case "rate":
+		return seriesV2TypeRate
+	default:
+		return seriesV2TypeUnspecified
+	}
+}
+
+func (d *DatadogClient) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	timestamp := float64(time.Now().Unix())
+
+	options := sinkOptionsFrom(ctx).Datadog
+	series := DataSeries{
+		Metric:   metricName,
+		Points:   [][]float64{{timestamp, value}},
+		Tags:     tags,
+		Host:     host,
+		Type:     "gauge",
+		Interval: options.Interval,
+	}
+	for _, r := range options.Resources {
+		series.Resources = append(series.Resources, ResourceV2{Name: r.Name, Type: r.Type})
+	}
+	if d.Batch && !d.DryRun {
+		d.mu.Lock()
+		d.pending = append(d.pending, series)
+		d.mu.Unlock()
+		return nil
+	}
+	metricData := Metric{Series: []DataSeries{series}}
+
+	payload, err := d.encodePayload(metricData)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	if d.Debug {
+		logEvent(ctx, "debug", "Sending metric to Datadog", map[string]interface{}{
+			"metric":  metricName,
+			"value":   value,
+			"tags":    tags,
+			"host":    host,
+			"url":     d.seriesURL(),
+			"payload": string(payload),
+		})
+	}
+
+	if d.DryRun && d.DryRunPrinter != nil {
+		return d.DryRunPrinter.print(dryRunSubmission{
+			URL:       d.seriesURL(),
+			Payload:   payload,
+			Headers:   d.Headers,
+			APIKeyEnv: d.APIKeyEnv,
+			Metric:    metricName,
+			Value:     formatValue(value),
+			Tags:      tags,
+			Host:      host,
+		})
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping actual metric submission", map[string]interface{}{
+			"metric": metricName,
+			"value":  value,
+			"tags":   tags,
+			"host":   host,
+		})
+		return nil
+	}
+
+	status, err := d.submit(ctx, d.seriesURL(), payload)
+	if err != nil {
+		return err
+	}
+
+	logEvent(ctx, "info", "Metric sent successfully", map[string]interface{}{
+		"metric": metricName,
+		"status": status,
+	})
+
+	return nil
+}
+
+// submit posts an encoded payload and checks the response status.
+func (d *DatadogClient) submit(ctx context.Context, url string, payload []byte) (status int, err error) {
+	if err := d.Limiter.Wait(ctx); err != nil {
+		return 0, fmt.Errorf("rate limit wait: %w", err)
+	}
+	ctx, span := startHTTPSpan(ctx, http.MethodPost, url)
+	defer func() { endSpan(span, status, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	d.setHeaders(req, true)
+
+	resp, err := d.httpClient().Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			logEvent(ctx, "warn", "Datadog request cancelled or timed out", map[string]interface{}{"error": err.Error()})
+			return 0, fmt.Errorf("datadog request failed due to context: %w", err)
+		}
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() {
+		drainBody(resp.Body)
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			logEvent(ctx, "warn", "Failed to close response body", map[string]interface{}{"error": closeErr.Error()})
+		}
+	}()
+
+	if !d.accepted(resp.StatusCode) {
+		return resp.StatusCode, statusError(resp.StatusCode, resp.Body)
+	}
+
+	expvarPayloadsSent.Add(1)
+	expvarBytesSent.Add(int64(len(payload)))
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDatadogClientAcceptedStatusCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DD-API-KEY") != "test-key" {
+			t.Errorf("Expected API key header, got %q", r.Header.Get("DD-API-KEY"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		accepted []int
+		wantErr  bool
+	}{
+		{name: "Default expects 202", accepted: nil, wantErr: true},
+		{name: "Proxy returning 200", accepted: []int{200, 202}, wantErr: false},
+		{name: "Only 204 accepted", accepted: []int{204}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client := &DatadogClient{APIKey: "test-key", URL: server.URL, AcceptedStatusCodes: tc.accepted}
+			err := client.SendMetric(context.Background(), "test.metric", 1, nil, "")
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected error but got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDatadogClientCustomHeadersAndFields(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Cost-Center") != "sre-42" {
+			t.Errorf("Expected custom header, got %q", r.Header.Get("X-Cost-Center"))
+		}
+		if r.Header.Get("DD-API-KEY") != "real-key" {
+			t.Errorf("Custom headers must not override the API key, got %q", r.Header.Get("DD-API-KEY"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := newDatadogClient("real-key", DatadogConfig{
+		URL:           server.URL,
+		Headers:       map[string]string{"X-Cost-Center": "sre-42", "DD-API-KEY": "override"},
+		PayloadFields: map[string]interface{}{"pipeline": "sql"},
+		SeriesFields:  map[string]interface{}{"source_type_name": "sqlmetrics", "metric": "ignored"},
+	})
+	if err := client.SendMetric(context.Background(), "test.metric", 1, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+
+	if got["pipeline"] != "sql" {
+		t.Errorf("Expected payload field, got %v", got)
+	}
+	series := got["series"].([]interface{})[0].(map[string]interface{})
+	if series["source_type_name"] != "sqlmetrics" {
+		t.Errorf("Expected series field, got %v", series)
+	}
+	if series["metric"] != "test.metric" {
+		t.Errorf("Series fields must not override built-in fields, got %v", series["metric"])
+	}
+}
+
+func TestDatadogClientV2Payload(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != datadogSeriesV2Path {
+			t.Errorf("Expected v2 series path, got %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "test-key", BaseURL: server.URL, V2: true}
+	if err := client.SendMetric(context.Background(), "test.metric", 42, []string{"env:test"}, "db-01"); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+
+	series := got["series"].([]interface{})[0].(map[string]interface{})
+	if series["type"] != float64(seriesV2TypeGauge) {
+		t.Errorf("Expected gauge type, got %v", series["type"])
+	}
+	point := series["points"].([]interface{})[0].(map[string]interface{})
+	if point["value"] != 42.0 {
+		t.Errorf("Expected point value 42, got %v", point["value"])
+	}
+	resource := series["resources"].([]interface{})[0].(map[string]interface{})
+	if resource["name"] != "db-01" || resource["type"] != "host" {
+		t.Errorf("Expected host resource, got %v", resource)
+	}
+}
+
+func TestDatadogClientSinkOptions(t *testing.T) {
+	for _, v2 := range []bool{false, true} {
+		var got map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Failed to decode payload: %v", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		client := &DatadogClient{APIKey: "test-key", BaseURL: server.URL, V2: v2}
+		ctx := withSinkOptions(context.Background(), SinkOptions{Datadog: DatadogSinkOptions{
+			Interval:  60,
+			Resources: []SeriesResource{{Name: "orders", Type: "database"}},
+		}})
+		if err := client.SendMetric(ctx, "test.metric", 42, nil, "db-01"); err != nil {
+			t.Fatalf("SendMetric failed: %v", err)
+		}
+		server.Close()
+
+		series := got["series"].([]interface{})[0].(map[string]interface{})
+		if series["interval"] != 60.0 {
+			t.Errorf("v2=%v: expected interval 60, got %v", v2, series["interval"])
+		}
+		resources, _ := series["resources"].([]interface{})
+		if v2 && len(resources) != 2 {
+			t.Errorf("Expected host and database resources, got %v", resources)
+		}
+		if !v2 && resources != nil {
+			t.Errorf("Expected no resources in a v1 payload, got %v", resources)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+)
+
+// reServerVersion matches the version number at the start of a server
+// version string such as "16.2 (Debian 16.2-1.pgdg120+2)" or "8.0.36-log".
+var reServerVersion = regexp.MustCompile(`^\d+(?:\.\d+)*`)
+
+// identityTags returns the tags identifying the database, queried once at
+// startup: db_type, db_host, db_name and db_version. The version is left
+// out when it cannot be read.
+func identityTags(ctx context.Context, db *sql.DB, dbType, dbURL string) []string {
+	tags := databaseTags(dbType, dbURL)
+	if db == nil {
+		return tags
+	}
+	queries, ok := dbDiagnostics[dbType]
+	if !ok {
+		return tags
+	}
+	if version := reServerVersion.FindString(diagnosticValue(ctx, db, queries.Version)); version != "" {
+		tags = append(tags, "db_version:"+version)
+	}
+	return tags
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestServerVersion(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "16.2 (Debian 16.2-1.pgdg120+2)", want: "16.2"},
+		{value: "8.0.36-0ubuntu0.22.04.1", want: "8.0.36"},
+		{value: "10.11.6-MariaDB-log", want: "10.11.6"},
+		{value: "unknown", want: ""},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.value, func(t *testing.T) {
+			if got := reServerVersion.FindString(tc.value); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIdentityTagsWithoutDatabase(t *testing.T) {
+	got := identityTags(context.Background(), nil, "postgres", "postgres://collector@db-01:5432/orders")
+	want := []string{"db_type:postgres", "db_host:db-01", "db_name:orders"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// Process-wide counters published on /debug/vars.
+var (
+	expvarQueriesExecuted = expvar.NewInt("queries_executed")
+	expvarQueryErrors     = expvar.NewInt("query_errors")
+	expvarPayloadsSent    = expvar.NewInt("payloads_sent")
+	expvarBytesSent       = expvar.NewInt("bytes_sent")
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+}
+
+// debugHandler serves net/http/pprof under /debug/pprof/ and expvar under /debug/vars.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// startDebugServer serves the debug endpoints on addr until ctx is done.
+// Profiling data is sensitive, so a warning is logged when addr is not a
+// loopback address.
+func startDebugServer(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on debug address: %w", err)
+	}
+
+	if tcpAddr, ok := ln.Addr().(*net.TCPAddr); ok && !tcpAddr.IP.IsLoopback() {
+		logEvent(ctx, "warn", "Debug server is listening on a non-loopback address", map[string]interface{}{"addr": ln.Addr().String()})
+	}
+
+	srv := &http.Server{Handler: debugHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logEvent(ctx, "error", "Debug server failed", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logEvent(ctx, "info", "Debug server listening", map[string]interface{}{"addr": ln.Addr().String()})
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandlerVars(t *testing.T) {
+	expvarQueriesExecuted.Add(1)
+
+	rec := httptest.NewRecorder()
+	debugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var vars map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("Failed to decode vars: %v", err)
+	}
+	for _, key := range []string{"queries_executed", "bytes_sent", "goroutines"} {
+		if _, ok := vars[key]; !ok {
+			t.Errorf("Expected %q in /debug/vars", key)
+		}
+	}
+}
+
+func TestDebugHandlerPprof(t *testing.T) {
+	rec := httptest.NewRecorder()
+	debugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from pprof index, got %d", rec.Code)
+	}
+}
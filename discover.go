@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultDiscoverLimit is the number of tables suggested by discover.
+const defaultDiscoverLimit = 10
+
+// discoverQueries list the largest tables of the current database as
+// schema, name, total size in bytes and estimated row count.
+var discoverQueries = map[string]string{
+	"postgres": `SELECT n.nspname, c.relname, pg_total_relation_size(c.oid), GREATEST(c.reltuples, 0)::bigint
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'p') AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+ORDER BY 3 DESC LIMIT $1`,
+	"mysql": `SELECT table_schema, table_name, COALESCE(data_length + index_length, 0), COALESCE(table_rows, 0)
+FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+ORDER BY 3 DESC LIMIT ?`,
+}
+
+// tableInfo describes a discovered table.
+type tableInfo struct {
+	Schema string
+	Name   string
+	Bytes  int64
+	Rows   int64
+}
+
+// qualifiedName returns schema.name.
+func (t tableInfo) qualifiedName() string {
+	return t.Schema + "." + t.Name
+}
+
+// discoverTables returns the limit largest tables of the database.
+func discoverTables(ctx context.Context, db *sql.DB, dbType string, limit int) ([]tableInfo, error) {
+	query, ok := discoverQueries[dbType]
+	if !ok {
+		return nil, fmt.Errorf("discover does not support database type %q (must be postgres or mysql)", dbType)
+	}
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []tableInfo
+	for rows.Next() {
+		var t tableInfo
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Bytes, &t.Rows); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// sqlString quotes s as an SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// suggestMetrics returns a row-count and a table-size metric covering
+// tables, tagged with table_name:<schema>.<table>. Row counts come from the
+// statistics instead of count(*), so they stay cheap on large tables.
+func suggestMetrics(dbType string, tables []tableInfo) []presetMetric {
+	if len(tables) == 0 {
+		return nil
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = sqlString(t.qualifiedName())
+	}
+	list := strings.Join(names, ", ")
+
+	var rows, size string
+	switch dbType {
+	case "postgres":
+		const name = "schemaname || '.' || relname"
+		rows = "SELECT n_live_tup, " + name + " AS table_name FROM pg_stat_user_tables WHERE " + name + " IN (" + list + ")"
+		size = "SELECT pg_total_relation_size(relid), " + name + " AS table_name FROM pg_stat_user_tables WHERE " + name + " IN (" + list + ")"
+	case "mysql":
+		const name = "CONCAT(table_schema, '.', table_name)"
+		rows = "SELECT table_rows, " + name + " AS table_name FROM information_schema.tables WHERE " + name + " IN (" + list + ")"
+		size = "SELECT data_length + index_length, " + name + " AS table_name FROM information_schema.tables WHERE " + name + " IN (" + list + ")"
+	default:
+		return nil
+	}
+	return []presetMetric{
+		{Name: "sql.table.rows", Query: rows, TagColumns: []string{"table_name"}, Unit: "row", Description: "Estimated rows of the table"},
+		{Name: "sql.table.size", Query: size, TagColumns: []string{"table_name"}, Unit: "byte", Description: "Size of the table including indexes"},
+	}
+}
+
+// writeDiscovery writes the suggested metrics as YAML, preceded by a
+// comment listing the discovered tables.
+func writeDiscovery(w io.Writer, tables []tableInfo, metrics []presetMetric) error {
+	if len(tables) == 0 {
+		_, err := fmt.Fprintln(w, "# No tables found.")
+		return err
+	}
+	var listing strings.Builder
+	tw := tabwriter.NewWriter(&listing, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tSIZE (BYTES)\tROWS (ESTIMATED)")
+	for _, t := range tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", t.qualifiedName(), t.Bytes, t.Rows)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimRight(listing.String(), "\n"), "\n") {
+		fmt.Fprintln(w, "# "+line)
+	}
+
+	data, err := yaml.Marshal(initConfig{Metrics: metrics})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// runDiscover suggests metrics for the largest tables of the database. The
+// configuration file is optional; it only names the DSN variable.
+func runDiscover(ctx context.Context, opts *options, _ []string) error {
+	if opts.limit <= 0 {
+		return withExitCode(exitConfigInvalid, errors.New("-limit must be positive"))
+	}
+	urlEnv := defaultDatabaseURLEnv
+	var dbConfig DatabaseConfig
+	if _, err := os.Stat(opts.configFile); !errors.Is(err, fs.ErrNotExist) {
+		config, err := loadConfigFor(opts)
+		if err != nil {
+			return configError("failed to load config: %w", err)
+		}
+		urlEnv, dbConfig = config.databaseURLEnv(), config.Database
+	}
+
+	db, err := openDB(ctx, urlEnv, dbConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	dbType := databaseType()
+	tables, err := discoverTables(ctx, db, dbType, opts.limit)
+	if err != nil {
+		return err
+	}
+	return writeDiscovery(os.Stdout, tables, suggestMetrics(dbType, tables))
+}
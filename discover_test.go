@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSuggestMetrics(t *testing.T) {
+	tables := []tableInfo{
+		{Schema: "public", Name: "orders", Bytes: 1 << 30, Rows: 1000000},
+		{Schema: "public", Name: "o'brien", Bytes: 1 << 20, Rows: 10},
+	}
+	tests := []struct {
+		dbType   string
+		wantRows string
+	}{
+		{dbType: "postgres", wantRows: "SELECT n_live_tup, schemaname || '.' || relname AS table_name FROM pg_stat_user_tables WHERE schemaname || '.' || relname IN ('public.orders', 'public.o''brien')"},
+		{dbType: "mysql", wantRows: "SELECT table_rows, CONCAT(table_schema, '.', table_name) AS table_name FROM information_schema.tables WHERE CONCAT(table_schema, '.', table_name) IN ('public.orders', 'public.o''brien')"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.dbType, func(t *testing.T) {
+			metrics := suggestMetrics(tc.dbType, tables)
+			if len(metrics) != 2 {
+				t.Fatalf("Expected 2 metrics, got %d", len(metrics))
+			}
+			if metrics[0].Query != tc.wantRows {
+				t.Errorf("Expected query %q, got %q", tc.wantRows, metrics[0].Query)
+			}
+			for _, m := range metrics {
+				metric := MetricConfig{Name: m.Name, Query: m.Query, TagColumns: m.TagColumns}
+				if err := validateMetricQuery(metric); err != nil {
+					t.Errorf("Expected valid query for %s, got %v", m.Name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDiscovery(t *testing.T) {
+	tables := []tableInfo{{Schema: "public", Name: "orders", Bytes: 2048, Rows: 12}}
+	var buf bytes.Buffer
+	if err := writeDiscovery(&buf, tables, suggestMetrics("postgres", tables)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "# public.orders  2048") {
+		t.Errorf("Expected the table listing as a comment, got %s", buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected the output to load, got %v", err)
+	}
+	if len(config.Metrics) != 2 || config.Metrics[1].Name != "sql.table.size" {
+		t.Errorf("Expected the rows and size metrics, got %+v", config.Metrics)
+	}
+}
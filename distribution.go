@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+)
+
+const datadogDistributionPath = "/api/v1/distribution_points"
+
+// Metric types for the `type` option.
+const (
+	metricTypeGauge        = "gauge"
+	metricTypeDistribution = "distribution"
+)
+
+// MetricType selects how a metric is submitted: as a gauge (the default) or as
+// a distribution of every row's value.
+type MetricType string
+
+// UnmarshalYAML accepts gauge or distribution.
+func (t *MetricType) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Value {
+	case "", metricTypeGauge, metricTypeDistribution:
+		*t = MetricType(node.Value)
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid type %q (must be gauge or distribution)", node.Line, node.Value)
+}
+
+// DistributionSender is implemented by senders that can submit raw sample sets
+// as Datadog distributions, keeping full percentile fidelity server-side.
+type DistributionSender = sink.DistributionSender
+
+// DistributionPayload is the body of the distribution points API.
+type DistributionPayload struct {
+	Series []DistributionSeries `json:"series"`
+}
+
+// DistributionSeries holds points of [timestamp, [values...]].
+type DistributionSeries struct {
+	Metric string          `json:"metric"`
+	Points [][]interface{} `json:"points"`
+	Tags   []string        `json:"tags,omitempty"`
+	Host   string          `json:"host,omitempty"`
+}
+
+// SendDistribution submits values as a single distribution point.
+func (d *DatadogClient) SendDistribution(ctx context.Context, metricName string, values []float64, tags []string, host string) error {
+	body := DistributionPayload{
+		Series: []DistributionSeries{
+			{
+				Metric: metricName,
+				Points: [][]interface{}{{time.Now().Unix(), values}},
+				Tags:   tags,
+				Host:   host,
+			},
+		},
+	}
+
+	payload, err := d.encodeWithFields(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	url := d.apiURL(datadogDistributionPath)
+	if d.Debug {
+		logEvent(ctx, "debug", "Sending distribution to Datadog", map[string]interface{}{
+			"metric":  metricName,
+			"values":  len(values),
+			"tags":    tags,
+			"host":    host,
+			"url":     url,
+			"payload": string(payload),
+		})
+	}
+
+	if d.DryRun && d.DryRunPrinter != nil {
+		return d.DryRunPrinter.print(dryRunSubmission{
+			URL:       url,
+			Payload:   payload,
+			Headers:   d.Headers,
+			APIKeyEnv: d.APIKeyEnv,
+			Metric:    metricName,
+			Value:     fmt.Sprintf("%d values", len(values)),
+			Tags:      tags,
+			Host:      host,
+		})
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping actual distribution submission", map[string]interface{}{
+			"metric": metricName,
+			"values": len(values),
+			"tags":   tags,
+			"host":   host,
+		})
+		return nil
+	}
+
+	status, err := d.submit(ctx, url, payload)
+	if err != nil {
+		return err
+	}
+
+	logEvent(ctx, "info", "Distribution sent successfully", map[string]interface{}{
+		"metric": metricName,
+		"values": len(values),
+		"status": status,
+	})
+	return nil
+}
+
+// distributionGroup is the set of values submitted as one distribution point.
+type distributionGroup struct {
+	Name   string
+	Tags   []string
+	Host   string
+	Values []float64
+}
+
+// groupDistribution groups samples by name, tag set and host, in order of
+// first appearance.
+func groupDistribution(samples []sample) []distributionGroup {
+	var groups []distributionGroup
+	index := map[string]int{}
+	for _, s := range samples {
+		key := sampleKey(s)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, distributionGroup{Name: s.Name, Tags: s.Tags, Host: s.Host})
+		}
+		groups[i].Values = append(groups[i].Values, s.Value)
+	}
+	return groups
+}
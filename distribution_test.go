@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDatadogClientSendDistribution(t *testing.T) {
+	var got DistributionPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != datadogDistributionPath {
+			t.Errorf("Expected distribution path, got %q", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "test-key", BaseURL: server.URL}
+	if err := client.SendDistribution(context.Background(), "job.duration", []float64{1, 2.5, 4}, []string{"env:test"}, ""); err != nil {
+		t.Fatalf("SendDistribution failed: %v", err)
+	}
+
+	if len(got.Series) != 1 || got.Series[0].Metric != "job.duration" {
+		t.Fatalf("Unexpected payload %+v", got)
+	}
+	point := got.Series[0].Points[0]
+	if values := point[1].([]interface{}); len(values) != 3 || values[1] != 2.5 {
+		t.Errorf("Expected all values in one point, got %v", point)
+	}
+}
+
+func TestGroupDistribution(t *testing.T) {
+	samples := []sample{
+		{Value: 1, Tags: []string{"queue:a"}},
+		{Value: 2, Tags: []string{"queue:b"}},
+		{Value: 3, Tags: []string{"queue:a"}},
+	}
+	want := []distributionGroup{
+		{Tags: []string{"queue:a"}, Values: []float64{1, 3}},
+		{Tags: []string{"queue:b"}, Values: []float64{2}},
+	}
+	if got := groupDistribution(samples); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDistributionValidation(t *testing.T) {
+	var metric MetricConfig
+	if err := yaml.Unmarshal([]byte("type: histogram"), &metric); err == nil {
+		t.Error("Expected error for unknown type")
+	}
+
+	metric = MetricConfig{Type: metricTypeDistribution, Aggregate: "p95", Query: "SELECT duration FROM jobs"}
+	if err := validateMetricQuery(metric); err == nil {
+		t.Error("Expected error for aggregate with distribution")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Output formats of -dry-run-format.
+const (
+	dryRunLog   = "log"
+	dryRunJSON  = "json"
+	dryRunTable = "table"
+	dryRunCurl  = "curl"
+)
+
+// validateDryRunFormat checks the -dry-run-format value.
+func validateDryRunFormat(format string, dryRun bool) error {
+	switch format {
+	case "", dryRunLog:
+		return nil
+	case dryRunJSON, dryRunTable, dryRunCurl:
+		if !dryRun {
+			return errors.New("-dry-run-format requires -dry-run")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown dry run format %q (must be log, json, table or curl)", format)
+	}
+}
+
+// dryRunSubmission is a Datadog request skipped by a dry run.
+type dryRunSubmission struct {
+	URL     string
+	Payload []byte
+	Headers map[string]string
+	// APIKeyEnv is the variable the API key is read from, referenced by the
+	// curl command instead of the key itself.
+	APIKeyEnv string
+
+	Metric string
+	Value  string
+	Tags   []string
+	Host   string
+}
+
+// dryRunPrinter writes the submissions of a dry run to out: the serialized
+// payload as one JSON line, a table row or an equivalent curl command. It is
+// safe for concurrent use.
+type dryRunPrinter struct {
+	format string
+	out    io.Writer
+
+	mu     sync.Mutex
+	header bool
+}
+
+func newDryRunPrinter(format string, out io.Writer) *dryRunPrinter {
+	return &dryRunPrinter{format: format, out: out}
+}
+
+// print writes one submission.
+func (p *dryRunPrinter) print(s dryRunSubmission) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	switch p.format {
+	case dryRunJSON:
+		_, err = fmt.Fprintf(p.out, "%s\n", s.Payload)
+	case dryRunTable:
+		if !p.header {
+			p.header = true
+			if _, err = fmt.Fprintf(p.out, "%-40s %14s  %-20s %s\n", "METRIC", "VALUE", "HOST", "TAGS"); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(p.out, "%-40s %14s  %-20s %s\n", s.Metric, s.Value, s.Host, strings.Join(s.Tags, ","))
+	case dryRunCurl:
+		_, err = io.WriteString(p.out, curlCommand(s)+"\n")
+	}
+	return err
+}
+
+// curlCommand returns a shell command posting the submission. The API key
+// is referenced through its environment variable so it is never printed.
+func curlCommand(s dryRunSubmission) string {
+	names := make([]string, 0, len(s.Headers))
+	for name := range s.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keyEnv := s.APIKeyEnv
+	if keyEnv == "" {
+		keyEnv = "DATADOG_API_KEY"
+	}
+	lines := []string{"curl -X POST " + shellQuote(s.URL)}
+	for _, name := range names {
+		lines = append(lines, "-H "+shellQuote(name+": "+s.Headers[name]))
+	}
+	lines = append(lines,
+		"-H 'Content-Type: application/json'",
+		`-H "DD-API-KEY: $`+keyEnv+`"`,
+		"-d "+shellQuote(string(s.Payload)),
+	)
+	return strings.Join(lines, " \\\n  ")
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dryRunPrinter returns the printer selected with -dry-run-format, shared by
+// every Datadog client of the run, or nil to log skipped submissions.
+func (o *options) dryRunPrinter() *dryRunPrinter {
+	if !o.dryRun || o.dryRunFormat == "" || o.dryRunFormat == dryRunLog {
+		return nil
+	}
+	if o.printer == nil {
+		o.printer = newDryRunPrinter(o.dryRunFormat, os.Stdout)
+	}
+	return o.printer
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDryRunPrinter(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{format: dryRunJSON, want: []string{`{"series":[{"metric":"app.orders","points":[[`, `"tags":["env:prod"]`}},
+		{format: dryRunTable, want: []string{"METRIC", "app.orders", "42", "db-1", "env:prod"}},
+		{format: dryRunCurl, want: []string{
+			"curl -X POST 'https://api.datadoghq.com/api/v1/series'",
+			"-H 'X-Team: o'\\''brien'",
+			`-H "DD-API-KEY: $DATADOG_API_KEY"`,
+			`-d '{"series":[{"metric":"app.orders"`,
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			var out bytes.Buffer
+			client := &DatadogClient{
+				APIKey:        "secret",
+				DryRun:        true,
+				Headers:       map[string]string{"X-Team": "o'brien"},
+				DryRunPrinter: newDryRunPrinter(tc.format, &out),
+			}
+			if err := client.SendMetric(context.Background(), "app.orders", 42, []string{"env:prod"}, "db-1"); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Expected output containing %q, got %s", want, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "secret") {
+				t.Errorf("Expected the API key to be omitted, got %s", out.String())
+			}
+		})
+	}
+}
+
+func TestValidateDryRunFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		dryRun  bool
+		wantErr bool
+	}{
+		{format: dryRunLog},
+		{format: dryRunTable, dryRun: true},
+		{format: dryRunCurl, wantErr: true},
+		{format: "yaml", dryRun: true, wantErr: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			err := validateDryRunFormat(tc.format, tc.dryRun)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
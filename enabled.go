@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Enabled decides whether a metric is collected. In YAML it is a boolean or
+// an expression such as
+//
+//	env.REGION == "eu" && extension("pg_stat_statements")
+//
+// Operands are env.NAME (the environment variable), db.type (the
+// DATABASE_TYPE driver) and string literals; they can be compared with ==
+// and != or used alone, when any value other than "", "0" and "false" is
+// true. extension("name") reports whether a PostgreSQL extension is
+// installed. Terms combine with !, && and || and parentheses.
+type Enabled struct {
+	Expr string
+	eval condition
+}
+
+// condition evaluates an enabled expression against the capabilities of
+// the connected database.
+type condition func(ctx context.Context, caps *capabilities) (bool, error)
+
+// UnmarshalYAML accepts a boolean or an expression.
+func (e *Enabled) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: enabled must be a boolean or an expression", node.Line)
+	}
+	if node.Tag == "!!bool" {
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		*e = Enabled{Expr: node.Value, eval: constCondition(value)}
+		return nil
+	}
+	eval, err := parseCondition(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid enabled expression %q: %w", node.Line, node.Value, err)
+	}
+	*e = Enabled{Expr: node.Value, eval: eval}
+	return nil
+}
+
+func constCondition(value bool) condition {
+	return func(context.Context, *capabilities) (bool, error) { return value, nil }
+}
+
+// capabilities answers the questions of enabled expressions about the
+// database, probing it at most once per question.
+type capabilities struct {
+	db         *sql.DB
+	dbType     string
+	extensions map[string]bool
+}
+
+func newCapabilities(db *sql.DB, dbType string) *capabilities {
+	return &capabilities{db: db, dbType: dbType, extensions: make(map[string]bool)}
+}
+
+// extension reports whether the PostgreSQL extension name is installed.
+// Other databases have no extensions.
+func (c *capabilities) extension(ctx context.Context, name string) (bool, error) {
+	if installed, ok := c.extensions[name]; ok {
+		return installed, nil
+	}
+	if c.dbType != "postgres" || c.db == nil {
+		return false, nil
+	}
+	var count int
+	if err := c.db.QueryRowContext(ctx, "SELECT count(*) FROM pg_extension WHERE extname = $1", name).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to probe extension %s: %w", name, err)
+	}
+	c.extensions[name] = count > 0
+	return count > 0, nil
+}
+
+// filterEnabled returns the metrics whose enabled expression is true.
+func filterEnabled(ctx context.Context, metrics []MetricConfig, caps *capabilities) ([]MetricConfig, error) {
+	enabled := make([]MetricConfig, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.Enabled == nil || metric.Enabled.eval == nil {
+			enabled = append(enabled, metric)
+			continue
+		}
+		ok, err := metric.Enabled.eval(ctx, caps)
+		if err != nil {
+			return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+		}
+		if !ok {
+			logEvent(ctx, "debug", "Metric disabled", map[string]interface{}{
+				"metric":  metric.Name,
+				"enabled": metric.Enabled.Expr,
+			})
+			continue
+		}
+		enabled = append(enabled, metric)
+	}
+	return enabled, nil
+}
+
+// truthy reports whether an operand used alone counts as true.
+func truthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false":
+		return false
+	}
+	return true
+}
+
+// conditionParser is a recursive descent parser of enabled expressions:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | primary
+//	primary = "(" or ")" | "true" | "false" | "extension" "(" string ")"
+//	        | operand [ ("==" | "!=") operand ]
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+// operand yields the string value of an operand.
+type operand func(caps *capabilities) string
+
+func parseCondition(expr string) (condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &conditionParser{tokens: tokens}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return cond, nil
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of expression", token)
+		}
+		return fmt.Errorf("expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ctx context.Context, caps *capabilities) (bool, error) {
+			if ok, err := l(ctx, caps); ok || err != nil {
+				return ok, err
+			}
+			return right(ctx, caps)
+		}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) and() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ctx context.Context, caps *capabilities) (bool, error) {
+			if ok, err := l(ctx, caps); !ok || err != nil {
+				return false, err
+			}
+			return right(ctx, caps)
+		}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) unary() (condition, error) {
+	if p.peek() != "!" {
+		return p.primary()
+	}
+	p.next()
+	inner, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, caps *capabilities) (bool, error) {
+		ok, err := inner(ctx, caps)
+		return !ok, err
+	}, nil
+}
+
+func (p *conditionParser) primary() (condition, error) {
+	switch token := p.peek(); {
+	case token == "(":
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case token == "true" || token == "false":
+		p.next()
+		return constCondition(token == "true"), nil
+	case token == "extension":
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		name, ok := unquote(p.next())
+		if !ok {
+			return nil, fmt.Errorf("extension() requires a string argument")
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, caps *capabilities) (bool, error) {
+			return caps.extension(ctx, name)
+		}, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	if op != "==" && op != "!=" {
+		return func(_ context.Context, caps *capabilities) (bool, error) {
+			return truthy(left(caps)), nil
+		}, nil
+	}
+	p.next()
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return func(_ context.Context, caps *capabilities) (bool, error) {
+		return (left(caps) == right(caps)) == (op == "=="), nil
+	}, nil
+}
+
+func (p *conditionParser) operand() (operand, error) {
+	token := p.next()
+	if text, ok := unquote(token); ok {
+		return func(*capabilities) string { return text }, nil
+	}
+	if name, ok := strings.CutPrefix(token, "env."); ok && name != "" {
+		return func(*capabilities) string { return os.Getenv(name) }, nil
+	}
+	if token == "db.type" {
+		return func(caps *capabilities) string { return caps.dbType }, nil
+	}
+	if token == "" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unknown operand %q (must be env.NAME, db.type or a string)", token)
+}
+
+// unquote returns the content of a single or double quoted token.
+func unquote(token string) (string, bool) {
+	if len(token) >= 2 && (token[0] == '"' || token[0] == '\'') && token[len(token)-1] == token[0] {
+		return token[1 : len(token)-1], true
+	}
+	return "", false
+}
+
+// tokenizeCondition splits an expression into operators, parentheses,
+// quoted strings and identifiers.
+func tokenizeCondition(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||") ||
+			strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || expr[i] == '.' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
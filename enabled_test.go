@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnabledExpressions(t *testing.T) {
+	t.Setenv("DDSM_TEST_REGION", "eu")
+	t.Setenv("DDSM_TEST_FLAG", "false")
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "true", want: true},
+		{expr: "false", want: false},
+		{expr: `env.DDSM_TEST_REGION == "eu"`, want: true},
+		{expr: `env.DDSM_TEST_REGION != 'eu'`, want: false},
+		{expr: "env.DDSM_TEST_REGION", want: true},
+		{expr: "env.DDSM_TEST_FLAG", want: false},
+		{expr: "env.DDSM_TEST_UNSET", want: false},
+		{expr: "!env.DDSM_TEST_UNSET", want: true},
+		{expr: `db.type == "mysql"`, want: true},
+		{expr: `db.type == "postgres" || env.DDSM_TEST_REGION == "eu"`, want: true},
+		{expr: `db.type == "postgres" && env.DDSM_TEST_REGION == "eu"`, want: false},
+		{expr: `!(db.type == "postgres" || env.DDSM_TEST_FLAG) && env.DDSM_TEST_REGION`, want: true},
+		// Extensions only exist on PostgreSQL, so no probe is needed here.
+		{expr: `extension("pg_stat_statements")`, want: false},
+	}
+
+	caps := newCapabilities(nil, "mysql")
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			cond, err := parseCondition(tc.expr)
+			if err != nil {
+				t.Fatalf("parseCondition failed: %v", err)
+			}
+			got, err := cond(context.Background(), caps)
+			if err != nil {
+				t.Fatalf("Evaluation failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEnabledSyntaxErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"env.",
+		"region == 'eu'",
+		`env.A == `,
+		`(env.A`,
+		`env.A && `,
+		`extension(pg_stat_statements)`,
+		`"unterminated`,
+		`env.A = "b"`,
+		`env.A env.B`,
+	} {
+		if _, err := parseCondition(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestFilterEnabled(t *testing.T) {
+	var metrics []MetricConfig
+	data := `
+- name: always
+- name: never
+  enabled: false
+- name: mysql_only
+  enabled: db.type == "mysql"
+- name: postgres_only
+  enabled: "db.type == 'postgres'"
+`
+	if err := yaml.Unmarshal([]byte(data), &metrics); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	enabled, err := filterEnabled(context.Background(), metrics, newCapabilities(nil, "postgres"))
+	if err != nil {
+		t.Fatalf("filterEnabled failed: %v", err)
+	}
+	var names []string
+	for _, metric := range enabled {
+		names = append(names, metric.Name)
+	}
+	if len(names) != 2 || names[0] != "always" || names[1] != "postgres_only" {
+		t.Errorf("Expected always and postgres_only, got %v", names)
+	}
+
+	if err := yaml.Unmarshal([]byte("- name: bad\n  enabled: \"env.A ==\"\n"), &metrics); err == nil {
+		t.Error("Expected a syntax error when loading")
+	}
+}
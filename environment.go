@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+const defaultDatabaseURLEnv = "DATABASE_URL"
+
+// EnvironmentConfig is an overlay selected with -env that patches the
+// configuration for one deployment, e.g. staging or prod.
+type EnvironmentConfig struct {
+	// DatabaseURLEnv names the environment variable holding the DSN.
+	DatabaseURLEnv string `yaml:"database_url_env,omitempty"`
+	// Tags are added to every metric.
+	Tags []string `yaml:"tags,omitempty"`
+	// Interval replaces the default daemon interval.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Metrics patches metrics by name. Fields set here win; tags are added.
+	Metrics map[string]MetricConfig `yaml:"metrics,omitempty"`
+}
+
+// environmentNames returns the names of the configured environments in
+// sorted order.
+func (c *Config) environmentNames() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyEnvironment patches config with the overlay of the named
+// environment. An empty name leaves config unchanged.
+func applyEnvironment(config *Config, name string) error {
+	if name == "" {
+		return nil
+	}
+	env, ok := config.Environments[name]
+	if !ok {
+		return fmt.Errorf("unknown environment %q (must be one of %v)", name, config.environmentNames())
+	}
+
+	if env.DatabaseURLEnv != "" {
+		config.DatabaseURLEnv = env.DatabaseURLEnv
+	}
+	if env.Interval > 0 {
+		config.Interval = env.Interval
+	}
+	for metricName := range env.Metrics {
+		if !slices.ContainsFunc(config.Metrics, func(m MetricConfig) bool { return m.Name == metricName }) {
+			return fmt.Errorf("environment %q: unknown metric %q", name, metricName)
+		}
+	}
+	for i, metric := range config.Metrics {
+		if patch, ok := env.Metrics[metric.Name]; ok {
+			metric = mergeMetric(metric, patch)
+		}
+		metric.Tags = slices.Concat(metric.Tags, env.Tags)
+		config.Metrics[i] = metric
+	}
+	return nil
+}
+
+// databaseURLEnv returns the environment variable holding the DSN.
+func (c *Config) databaseURLEnv() string {
+	if c.DatabaseURLEnv != "" {
+		return c.DatabaseURLEnv
+	}
+	return defaultDatabaseURLEnv
+}
+
+// databaseURL returns the DSN of the configured database.
+func (c *Config) databaseURL() string {
+	return os.Getenv(c.databaseURLEnv())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const environmentsConfig = `interval: 1m
+environments:
+  staging:
+    database_url_env: STAGING_DATABASE_URL
+    tags: ["env:staging"]
+    interval: 5m
+  prod:
+    tags: ["env:prod"]
+    metrics:
+      orders.pending:
+        timeout: 1m
+        tags: ["tier:critical"]
+metrics:
+  - name: orders.pending
+    query: "SELECT count(*) FROM orders WHERE state = 'pending'"
+    tags: ["team:orders"]
+  - name: orders.total
+    query: "SELECT count(*) FROM orders"
+`
+
+func TestLoadConfigEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(environmentsConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := loadConfigFile(path, "", formatAuto)
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	if base.databaseURLEnv() != "DATABASE_URL" || base.Interval != time.Minute {
+		t.Errorf("Expected the base configuration, got %s and %v", base.databaseURLEnv(), base.Interval)
+	}
+
+	staging, err := loadConfigFile(path, "staging", formatAuto)
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	if staging.databaseURLEnv() != "STAGING_DATABASE_URL" || staging.Interval != 5*time.Minute {
+		t.Errorf("Expected the staging DSN and interval, got %s and %v", staging.databaseURLEnv(), staging.Interval)
+	}
+	if want := []string{"team:orders", "env:staging"}; !reflect.DeepEqual(staging.Metrics[0].Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, staging.Metrics[0].Tags)
+	}
+
+	prod, err := loadConfigFile(path, "prod", formatAuto)
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	pending := prod.Metrics[0]
+	if want := []string{"team:orders", "tier:critical", "env:prod"}; !reflect.DeepEqual(pending.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, pending.Tags)
+	}
+	if pending.Timeout != time.Minute || prod.Metrics[1].Timeout != 0 {
+		t.Errorf("Expected only the patched metric to get a timeout, got %v and %v", pending.Timeout, prod.Metrics[1].Timeout)
+	}
+}
+
+func TestApplyEnvironmentErrors(t *testing.T) {
+	config := &Config{
+		Environments: map[string]EnvironmentConfig{
+			"prod": {Metrics: map[string]MetricConfig{"missing": {Timeout: time.Second}}},
+		},
+		Metrics: []MetricConfig{{Name: "orders.total"}},
+	}
+	if err := applyEnvironment(config, "dev"); err == nil || !strings.Contains(err.Error(), "unknown environment") {
+		t.Errorf("Expected unknown environment error, got %v", err)
+	}
+	if err := applyEnvironment(config, "prod"); err == nil || !strings.Contains(err.Error(), "unknown metric") {
+		t.Errorf("Expected unknown metric error, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Event alert types accepted in events mode.
+var eventAlertTypes = []string{"info", "success", "warning", "error"}
+
+// EventsConfig builds the Datadog event posted for every row of a metric in
+// events mode. Title, Text and AggregationKey are Go templates over the row
+// columns, e.g. `Migration {{.version}} applied`.
+type EventsConfig struct {
+	Title string `yaml:"title,omitempty"`
+	Text  string `yaml:"text,omitempty"`
+	// AlertType is info (the default), success, warning or error.
+	AlertType      string `yaml:"alert_type,omitempty"`
+	AggregationKey string `yaml:"aggregation_key,omitempty"`
+}
+
+// validate checks that a title is set, the templates parse and the alert
+// type is known.
+func (e EventsConfig) validate() error {
+	if e.Title == "" {
+		return errors.New("events mode requires events.title")
+	}
+	if _, err := e.templates(); err != nil {
+		return err
+	}
+	if e.AlertType != "" && !slices.Contains(eventAlertTypes, e.AlertType) {
+		return fmt.Errorf("invalid events.alert_type %q (must be %s)", e.AlertType, strings.Join(eventAlertTypes, ", "))
+	}
+	return nil
+}
+
+// templates parses the title, text and aggregation key templates. Columns
+// the query does not return are an error when they are rendered.
+func (e EventsConfig) templates() ([3]*template.Template, error) {
+	var tmpls [3]*template.Template
+	for i, field := range []struct{ name, text string }{
+		{"title", e.Title},
+		{"text", e.Text},
+		{"aggregation_key", e.AggregationKey},
+	} {
+		tmpl, err := template.New(field.name).Option("missingkey=error").Parse(field.text)
+		if err != nil {
+			return tmpls, fmt.Errorf("invalid events.%s template: %w", field.name, err)
+		}
+		tmpls[i] = tmpl
+	}
+	return tmpls, nil
+}
+
+// recordFields returns the columns of a row as template data, by their name
+// and lowercased name. NULL renders empty.
+func recordFields(record map[string]interface{}) map[string]string {
+	fields := make(map[string]string, 2*len(record))
+	for column, value := range record {
+		text := ""
+		if value != nil {
+			text = tagValue(value)
+		}
+		fields[column] = text
+		fields[strings.ToLower(column)] = text
+	}
+	return fields
+}
+
+// rowEvents builds the event of every row of metric.
+func rowEvents(metric MetricConfig, records []map[string]interface{}, tags []string) ([]Event, error) {
+	tmpls, err := metric.Events.templates()
+	if err != nil {
+		return nil, err
+	}
+	alertType := metric.Events.AlertType
+	if alertType == "" {
+		alertType = "info"
+	}
+	events := make([]Event, 0, len(records))
+	for _, record := range records {
+		fields := recordFields(record)
+		var rendered [3]string
+		for i, tmpl := range tmpls {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, fields); err != nil {
+				return nil, fmt.Errorf("failed to render event: %w", err)
+			}
+			rendered[i] = b.String()
+		}
+		events = append(events, Event{
+			Title:          rendered[0],
+			Text:           rendered[1],
+			AlertType:      alertType,
+			Tags:           slices.Clone(tags),
+			Host:           recordHost(metric, record),
+			AggregationKey: rendered[2],
+			SourceTypeName: "sqlmetrics",
+		})
+	}
+	return events, nil
+}
+
+// forwardEvents posts an event per row of a metric in events mode. Every
+// event is posted even when one fails; the first error is returned with the
+// number of failures.
+func (c *Collector) forwardEvents(ctx context.Context, telemetry *Telemetry, metric MetricConfig, records []map[string]interface{}) error {
+	sender, ok := c.senderFor(metric).(EventSender)
+	if !ok {
+		return errRecordsUnsupported
+	}
+	events, err := rowEvents(metric, records, c.seriesTags(ctx, metric, nil))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, event := range events {
+		err := c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+			return sender.SendEvent(ctx, event)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d events failed: %w", len(errs), len(events), errs[0])
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestRowEvents(t *testing.T) {
+	metric := MetricConfig{
+		Name: "migrations",
+		Host: "db-1",
+		Events: EventsConfig{
+			Title:          "Migration {{.version}} applied",
+			Text:           "{{.Name}} by {{.applied_by}}",
+			AggregationKey: "migration-{{.version}}",
+		},
+	}
+	records := []map[string]interface{}{
+		{"version": int64(42), "Name": "add_index", "applied_by": nil},
+	}
+
+	events, err := rowEvents(metric, records, []string{"env:prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events))
+	}
+	got := events[0]
+	if got.Title != "Migration 42 applied" || got.Text != "add_index by " || got.AggregationKey != "migration-42" {
+		t.Errorf("Unexpected event %+v", got)
+	}
+	if got.AlertType != "info" || got.Host != "db-1" || strings.Join(got.Tags, ",") != "env:prod" {
+		t.Errorf("Unexpected event attributes %+v", got)
+	}
+
+	metric.Events.Title = "{{.missing}}"
+	if _, err := rowEvents(metric, records, nil); err == nil {
+		t.Error("Expected an error for a column missing from the result")
+	}
+}
+
+func TestEventsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EventsConfig
+		wantErr string
+	}{
+		{name: "Valid", config: EventsConfig{Title: "{{.name}}", AlertType: "warning"}},
+		{name: "NoTitle", config: EventsConfig{Text: "x"}, wantErr: "requires events.title"},
+		{name: "BadTemplate", config: EventsConfig{Title: "{{.name"}, wantErr: "invalid events.title template"},
+		{name: "BadAlertType", config: EventsConfig{Title: "x", AlertType: "critical"}, wantErr: "invalid events.alert_type"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCollectOnceEvents(t *testing.T) {
+	db, err := sql.Open("series", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sender := &eventRecorder{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "rows", Mode: modeEvents, Query: "2", AllowUnsafe: true, Events: EventsConfig{Title: "Row {{.value}}"}},
+		}},
+		DB:     db,
+		Sender: sender,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Failed != 0 {
+		t.Fatalf("Expected no failures, got %+v", summary)
+	}
+	if len(sender.Events) != 2 || sender.Events[1].Title != "Row 2" {
+		t.Errorf("Expected events for rows 1 and 2, got %+v", sender.Events)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+)
+
+// Metric sources selectable with `source:`.
+const (
+	sourceSQL  = "sql"
+	sourceExec = "exec"
+)
+
+// ExecConfig configures the exec sink, which hands the points of every cycle
+// as JSON to a user-provided binary.
+type ExecConfig struct {
+	// Command is the plugin binary followed by its arguments.
+	Command []string `yaml:"command"`
+	// Env sets additional environment variables of the plugin process.
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+// newExecSink creates the exec sink from the `exec:` block.
+func newExecSink(_ context.Context, config *Config, _ *options) (MetricSender, error) {
+	if len(config.Exec.Command) == 0 {
+		return nil, configError("exec sink requires a command")
+	}
+	return &sink.Exec{Command: config.Exec.Command, Env: envList(config.Exec.Env)}, nil
+}
+
+// envList converts env to sorted "KEY=value" entries.
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// execSource reports whether the metric is read by an exec plugin rather
+// than a SQL query.
+func (m MetricConfig) execSource() bool {
+	return m.Source == sourceExec
+}
+
+// validateMetricSources checks the source of every metric.
+func validateMetricSources(metrics []MetricConfig) error {
+	for _, metric := range metrics {
+		switch metric.Source {
+		case "", sourceSQL:
+			if len(metric.Command) > 0 {
+				return fmt.Errorf("metric %q: command requires source: exec", metric.Name)
+			}
+		case sourceExec:
+			if len(metric.Command) == 0 {
+				return fmt.Errorf("metric %q: source exec requires a command", metric.Name)
+			}
+		default:
+			return fmt.Errorf("metric %q: unknown source %q (must be sql or exec)", metric.Name, metric.Source)
+		}
+	}
+	return nil
+}
+
+// fetchSamples reads the metric's points from its source: the exec plugin
+// of the metric or the database.
+func fetchSamples(ctx context.Context, dbClient *SQLDB, metric MetricConfig) ([]sample, error) {
+	if !metric.execSource() {
+		return dbClient.Samples(ctx, metric)
+	}
+	plugin := &source.Exec{Command: metric.Command}
+	return plugin.Samples(ctx, source.Query{Metric: metric.Name, Text: metric.Query})
+}
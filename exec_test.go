@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateMetricSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  MetricConfig
+		wantErr string
+	}{
+		{name: "Default", metric: MetricConfig{Name: "a", Query: "SELECT 1"}},
+		{name: "SQL", metric: MetricConfig{Name: "a", Source: "sql", Query: "SELECT 1"}},
+		{name: "Exec", metric: MetricConfig{Name: "a", Source: "exec", Command: []string{"/bin/plugin"}}},
+		{name: "ExecWithoutCommand", metric: MetricConfig{Name: "a", Source: "exec"}, wantErr: "requires a command"},
+		{name: "CommandWithoutExec", metric: MetricConfig{Name: "a", Command: []string{"/bin/plugin"}}, wantErr: "requires source: exec"},
+		{name: "Unknown", metric: MetricConfig{Name: "a", Source: "redis"}, wantErr: "unknown source"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMetricSources([]MetricConfig{tc.metric})
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCollectExecSource(t *testing.T) {
+	sender := &MockMetricSender{}
+	collector := &Collector{Sender: sender}
+	metric := MetricConfig{
+		Name:    "queue.depth",
+		Tags:    []string{"env:test"},
+		Source:  "exec",
+		Command: []string{"sh", "-c", `echo '{"samples":[{"value":7,"tags":["queue:mail"]}]}'`},
+	}
+
+	result := collector.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), metric)
+	if result.Status != statusSent {
+		t.Fatalf("Expected the metric to be sent, got %+v", result)
+	}
+	if len(sender.SentMetrics) != 1 {
+		t.Fatalf("Expected one point, got %+v", sender.SentMetrics)
+	}
+	got := sender.SentMetrics[0]
+	if got.Points[0][1] != 7 || !slices.Contains(got.Tags, "queue:mail") || !slices.Contains(got.Tags, "env:test") {
+		t.Errorf("Unexpected point %+v", got)
+	}
+}
+
+func TestNewExecSink(t *testing.T) {
+	if _, err := newExecSink(context.Background(), &Config{}, &options{}); err == nil {
+		t.Error("Expected error without a command")
+	}
+	sender, err := newExecSink(context.Background(), &Config{Exec: ExecConfig{Command: []string{"plugin"}, Env: map[string]string{"B": "2", "A": "1"}}}, &options{})
+	if err != nil {
+		t.Fatalf("newExecSink failed: %v", err)
+	}
+	if _, ok := sender.(FlushSender); !ok {
+		t.Error("Expected the exec sink to buffer points until Flush")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Process exit codes, so cron and Kubernetes can tell failure modes apart.
+const (
+	exitOK             = 0
+	exitError          = 1 // setup or runtime error (DB unreachable, missing credentials, ...)
+	exitConfigInvalid  = 2 // configuration or command line could not be loaded or is invalid
+	exitPartialFailure = 3 // some metrics failed
+	exitAllFailed      = 4 // every metric failed
+)
+
+// ExitError carries the exit code the process should terminate with.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// withExitCode wraps err so that the process exits with code.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// configError marks err as a configuration error (exit code 2).
+func configError(format string, args ...interface{}) error {
+	return withExitCode(exitConfigInvalid, fmt.Errorf(format, args...))
+}
+
+// exitCode returns the process exit code for err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return exitError
+}
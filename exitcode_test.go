@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: exitOK},
+		{name: "plain error", err: errors.New("boom"), want: exitError},
+		{name: "config error", err: configError("bad %s", "config"), want: exitConfigInvalid},
+		{name: "wrapped exit error", err: fmt.Errorf("run: %w", withExitCode(exitAllFailed, errors.New("all failed"))), want: exitAllFailed},
+		{name: "partial failure policy", err: checkFailPolicy(newTestSummary(statusSent, statusQueryFailed), "any"), want: exitPartialFailure},
+		{name: "all failed policy", err: checkFailPolicy(newTestSummary(statusQueryFailed), "all"), want: exitAllFailed},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("Expected exit code %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Roles of the database DSNs.
+const (
+	rolePrimary = "primary"
+	roleReplica = "replica"
+)
+
+// dbSource is one DSN of the database.
+type dbSource struct {
+	urlEnv    string
+	connector driver.Connector
+}
+
+// fallbackConnector opens every connection of the pool on the first
+// reachable DSN in priority order: the primary, then the fallbacks. Other
+// connection errors, such as a rejected password, are returned without
+// trying the next DSN. A nil *fallbackConnector has the primary role.
+type fallbackConnector struct {
+	driver  driver.Driver
+	sources []dbSource
+
+	mu     sync.Mutex
+	active int
+}
+
+// newFallbackConnector returns a connector for the DSNs held in urlEnvs,
+// with their values in dsns.
+func newFallbackConnector(dbType string, urlEnvs, dsns []string) (*fallbackConnector, error) {
+	c := &fallbackConnector{}
+	for i, dsn := range dsns {
+		connector, err := driverConnector(dbType, dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", urlEnvs[i], err)
+		}
+		c.driver = connector.Driver()
+		c.sources = append(c.sources, dbSource{urlEnv: urlEnvs[i], connector: connector})
+	}
+	return c, nil
+}
+
+// driverConnector returns a connector of dsn for the driver dbType.
+func driverConnector(dbType, dsn string) (driver.Connector, error) {
+	switch dbType {
+	case "postgres":
+		return pq.NewConnector(dsn)
+	case "mysql":
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return mysql.NewConnector(cfg)
+	}
+	return nil, fmt.Errorf("fallback DSNs are not supported for database type %q", dbType)
+}
+
+// Connect implements driver.Connector.
+func (c *fallbackConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var errs []error
+	for i, source := range c.sources {
+		conn, err := source.connector.Connect(ctx)
+		if err == nil {
+			c.setActive(ctx, i)
+			return conn, nil
+		}
+		if !isDatabaseUnavailable(err) {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", source.urlEnv, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Driver implements driver.Connector.
+func (c *fallbackConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// setActive records the DSN of the last connection and logs switches.
+func (c *fallbackConnector) setActive(ctx context.Context, i int) {
+	c.mu.Lock()
+	previous := c.active
+	c.active = i
+	c.mu.Unlock()
+	switch {
+	case i == previous:
+	case i == 0:
+		logEvent(ctx, "info", "Connected to the primary database again", map[string]interface{}{
+			"url_env": c.sources[0].urlEnv,
+		})
+	default:
+		logEvent(ctx, "warn", "Primary database unreachable - connected to a fallback", map[string]interface{}{
+			"url_env": c.sources[i].urlEnv,
+		})
+	}
+}
+
+// Role returns the role of the DSN of the last connection.
+func (c *fallbackConnector) Role() string {
+	if c == nil {
+		return rolePrimary
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active > 0 {
+		return roleReplica
+	}
+	return rolePrimary
+}
+
+// resetPool closes the idle connections of db, so the next queries open new
+// ones through the connector.
+func resetPool(db *sql.DB) {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(defaultMaxIdleConns)
+}
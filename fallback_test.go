@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+// fakeConnector connects, or fails with err.
+type fakeConnector struct {
+	err   error
+	calls int
+}
+
+type fakeConn struct{ driver.Conn }
+
+func (f *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeConn{}, nil
+}
+
+func (f *fakeConnector) Driver() driver.Driver { return nil }
+
+func TestFallbackConnector(t *testing.T) {
+	refused := syscall.ECONNREFUSED
+	denied := errors.New("password authentication failed")
+	tests := []struct {
+		name     string
+		errs     []error
+		wantErr  bool
+		wantRole string
+		// wantCalls are the connection attempts of every source.
+		wantCalls []int
+	}{
+		{name: "Primary", errs: []error{nil, nil}, wantRole: rolePrimary, wantCalls: []int{1, 0}},
+		{name: "Primary unreachable", errs: []error{refused, nil}, wantRole: roleReplica, wantCalls: []int{1, 1}},
+		{name: "Second fallback", errs: []error{refused, refused, nil}, wantRole: roleReplica, wantCalls: []int{1, 1, 1}},
+		{name: "All unreachable", errs: []error{refused, refused}, wantErr: true, wantRole: rolePrimary, wantCalls: []int{1, 1}},
+		{name: "Rejected without fallback", errs: []error{denied, nil}, wantErr: true, wantRole: rolePrimary, wantCalls: []int{1, 0}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fallbackConnector{}
+			var fakes []*fakeConnector
+			for i, err := range tc.errs {
+				fake := &fakeConnector{err: err}
+				fakes = append(fakes, fake)
+				c.sources = append(c.sources, dbSource{urlEnv: []string{"DATABASE_URL", "REPLICA_URL", "REPLICA2_URL"}[i], connector: fake})
+			}
+
+			_, err := c.Connect(context.Background())
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected error but got nil")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := c.Role(); got != tc.wantRole {
+				t.Errorf("Expected role %q, got %q", tc.wantRole, got)
+			}
+			for i, fake := range fakes {
+				if fake.calls != tc.wantCalls[i] {
+					t.Errorf("Source %d: expected %d attempts, got %d", i, tc.wantCalls[i], fake.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackConnectorFailsBack(t *testing.T) {
+	primary := &fakeConnector{err: syscall.ECONNREFUSED}
+	c := &fallbackConnector{sources: []dbSource{
+		{urlEnv: "DATABASE_URL", connector: primary},
+		{urlEnv: "REPLICA_URL", connector: &fakeConnector{}},
+	}}
+	if _, err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if c.Role() != roleReplica {
+		t.Fatalf("Expected role %q, got %q", roleReplica, c.Role())
+	}
+
+	primary.err = nil
+	if _, err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if c.Role() != rolePrimary {
+		t.Errorf("Expected role %q, got %q", rolePrimary, c.Role())
+	}
+
+	var none *fallbackConnector
+	if none.Role() != rolePrimary {
+		t.Errorf("Expected role %q without fallbacks, got %q", rolePrimary, none.Role())
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// destinationRetryDelay is the base backoff between retries of one destination.
+const destinationRetryDelay = 500 * time.Millisecond
+
+// Per-destination counters published on /debug/vars.
+var (
+	expvarDestinationSent   = expvar.NewMap("destination_sent")
+	expvarDestinationErrors = expvar.NewMap("destination_errors")
+)
+
+// DestinationConfig is one Datadog organization metrics are sent to.
+type DestinationConfig struct {
+	Name string `yaml:"name"`
+	// APIKeyEnv names the environment variable holding the API key
+	// (default DATADOG_API_KEY).
+	APIKeyEnv string `yaml:"api_key_env,omitempty"`
+	// AppKeyEnv names the environment variable holding the application key,
+	// needed for metadata updates only.
+	AppKeyEnv string `yaml:"app_key_env,omitempty"`
+	// Site is the Datadog site, e.g. datadoghq.eu or us5.datadoghq.com.
+	Site string `yaml:"site,omitempty"`
+	// URL overrides the series endpoint of this destination.
+	URL string `yaml:"url,omitempty"`
+	// Prefix is prepended to every metric name sent to this destination.
+	Prefix string `yaml:"prefix,omitempty"`
+	// Retries is the number of retries of a failed submission (5xx, 429 or
+	// network errors).
+	Retries int `yaml:"retries,omitempty"`
+}
+
+// validateDestinations checks destination names are set and unique.
+func validateDestinations(destinations []DestinationConfig) error {
+	seen := make(map[string]bool, len(destinations))
+	for i, dest := range destinations {
+		if dest.Name == "" {
+			return fmt.Errorf("datadog destination %d: name is required", i+1)
+		}
+		if seen[dest.Name] {
+			return fmt.Errorf("datadog destination %q is defined more than once", dest.Name)
+		}
+		seen[dest.Name] = true
+		if dest.Retries < 0 {
+			return fmt.Errorf("datadog destination %q: retries must not be negative", dest.Name)
+		}
+		if strings.Contains(dest.Site, "/") {
+			return fmt.Errorf("datadog destination %q: site must be a host name such as datadoghq.eu", dest.Name)
+		}
+	}
+	return nil
+}
+
+// destination is a client for one Datadog organization.
+type destination struct {
+	name    string
+	client  *DatadogClient
+	prefix  string
+	retries int
+}
+
+// metricName applies the destination prefix to name.
+func (d *destination) metricName(name string) string {
+	if d.prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(d.prefix, ".") + "." + name
+}
+
+// FanoutSender sends every submission to all destinations. Each destination
+// is retried and accounted for independently, so one failing organization
+// never prevents delivery to the others.
+type FanoutSender struct {
+	destinations []*destination
+}
+
+// newFanoutSender creates a client per destination from the shared settings
+// in cfg, reading API keys from the environment.
+func newFanoutSender(cfg DatadogConfig, debug, dryRun, v2 bool) (*FanoutSender, error) {
+	fanout := &FanoutSender{}
+	for _, dest := range cfg.Destinations {
+		keyEnv := dest.APIKeyEnv
+		if keyEnv == "" {
+			keyEnv = "DATADOG_API_KEY"
+		}
+		apiKey := os.Getenv(keyEnv)
+		if apiKey == "" && !dryRun {
+			return nil, fmt.Errorf("datadog destination %q: %s is not set", dest.Name, keyEnv)
+		}
+		logRedactor.AddSecret(apiKey)
+
+		shared := cfg
+		shared.URL = dest.URL
+		client := newDatadogClient(apiKey, shared)
+		client.Debug = debug
+		client.DryRun = dryRun
+		client.V2 = v2
+		client.APIKeyEnv = keyEnv
+		if dest.Site != "" {
+			client.BaseURL = "https://api." + dest.Site
+		}
+		if dest.AppKeyEnv != "" {
+			client.AppKey = os.Getenv(dest.AppKeyEnv)
+			logRedactor.AddSecret(client.AppKey)
+		}
+		fanout.destinations = append(fanout.destinations, &destination{
+			name:    dest.Name,
+			client:  client,
+			prefix:  dest.Prefix,
+			retries: dest.Retries,
+		})
+	}
+	return fanout, nil
+}
+
+// isRetryableSendError reports whether a failed submission is worth retrying:
+// server errors, rate limiting and network failures.
+func isRetryableSendError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status >= 500 || statusErr.Status == http.StatusTooManyRequests
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// each calls send for every destination, retrying and counting each one on
+// its own. The errors of all failed destinations are joined.
+func (f *FanoutSender) each(ctx context.Context, what string, send func(dest *destination) error) error {
+	var errs []error
+	for _, dest := range f.destinations {
+		_, err := withRetryIf(ctx, dest.retries, destinationRetryDelay, isRetryableSendError,
+			func(attempt int, delay time.Duration, err error) {
+				logEvent(ctx, "warn", "Retrying Datadog submission", map[string]interface{}{
+					"destination": dest.name,
+					"kind":        what,
+					"attempt":     attempt,
+					"delay":       delay.String(),
+					"error":       err.Error(),
+				})
+			},
+			func() (struct{}, error) { return struct{}{}, send(dest) })
+		if err != nil {
+			expvarDestinationErrors.Add(dest.name, 1)
+			errs = append(errs, fmt.Errorf("destination %s: %w", dest.name, err))
+			continue
+		}
+		expvarDestinationSent.Add(dest.name, 1)
+	}
+	return errors.Join(errs...)
+}
+
+// SendMetric implements MetricSender.
+func (f *FanoutSender) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	return f.each(ctx, "metric", func(dest *destination) error {
+		return dest.client.SendMetric(ctx, dest.metricName(metricName), value, tags, host)
+	})
+}
+
+// SendDistribution implements DistributionSender.
+func (f *FanoutSender) SendDistribution(ctx context.Context, metricName string, values []float64, tags []string, host string) error {
+	return f.each(ctx, "distribution", func(dest *destination) error {
+		return dest.client.SendDistribution(ctx, dest.metricName(metricName), values, tags, host)
+	})
+}
+
+// SendEvent implements EventSender.
+func (f *FanoutSender) SendEvent(ctx context.Context, event Event) error {
+	return f.each(ctx, "event", func(dest *destination) error {
+		return dest.client.SendEvent(ctx, event)
+	})
+}
+
+// SendLogs implements LogSender.
+func (f *FanoutSender) SendLogs(ctx context.Context, logs []LogEntry) error {
+	return f.each(ctx, "logs", func(dest *destination) error {
+		return dest.client.SendLogs(ctx, logs)
+	})
+}
+
+// SendServiceCheck implements ServiceCheckSender.
+func (f *FanoutSender) SendServiceCheck(ctx context.Context, check ServiceCheck) error {
+	return f.each(ctx, "service_check", func(dest *destination) error {
+		return dest.client.SendServiceCheck(ctx, check)
+	})
+}
+
+// UpdateMetadata implements MetadataSender. Destinations without an
+// application key are skipped.
+func (f *FanoutSender) UpdateMetadata(ctx context.Context, metricName string, meta MetricMetadata) error {
+	return f.each(ctx, "metadata", func(dest *destination) error {
+		if dest.client.AppKey == "" {
+			return nil
+		}
+		return dest.client.UpdateMetadata(ctx, dest.metricName(metricName), meta)
+	})
+}
+
+// Flush submits the series each destination buffered in batch mode.
+// Batches are not retried; a failing destination never blocks the others.
+func (f *FanoutSender) Flush(ctx context.Context) error {
+	var errs []error
+	for _, dest := range f.destinations {
+		if err := dest.client.Flush(ctx); err != nil {
+			expvarDestinationErrors.Add(dest.name, 1)
+			errs = append(errs, fmt.Errorf("destination %s: %w", dest.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close submits any series still buffered.
+func (f *FanoutSender) Close(ctx context.Context) error {
+	return f.Flush(ctx)
+}
+
+// LastFlush implements flushStatsSender, adding up the destinations.
+func (f *FanoutSender) LastFlush() (flushStats, bool) {
+	var total flushStats
+	batch := false
+	for _, dest := range f.destinations {
+		stats, ok := dest.client.LastFlush()
+		total.Chunks += stats.Chunks
+		total.Bytes += stats.Bytes
+		batch = batch || ok
+	}
+	return total, batch
+}
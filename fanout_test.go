@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFanoutSenderIndependentDestinations(t *testing.T) {
+	var primaryCalls, mirrorCalls int32
+	var mirrorMetric string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mirrorCalls, 1)
+		if r.Header.Get("DD-API-KEY") != "mirror-key" {
+			t.Errorf("Expected mirror API key, got %q", r.Header.Get("DD-API-KEY"))
+		}
+		var payload Metric
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		mirrorMetric = payload.Series[0].Metric
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer mirror.Close()
+
+	t.Setenv("PRIMARY_KEY", "primary-key")
+	t.Setenv("MIRROR_KEY", "mirror-key")
+	sender, err := newFanoutSender(DatadogConfig{Destinations: []DestinationConfig{
+		{Name: "primary", APIKeyEnv: "PRIMARY_KEY", URL: primary.URL, Retries: 1},
+		{Name: "mirror", APIKeyEnv: "MIRROR_KEY", URL: mirror.URL, Prefix: "legacy."},
+	}}, false, false, false)
+	if err != nil {
+		t.Fatalf("newFanoutSender failed: %v", err)
+	}
+
+	err = sender.SendMetric(context.Background(), "db.users", 1, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "destination primary") {
+		t.Fatalf("Expected primary destination error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "destination mirror") {
+		t.Errorf("Mirror destination must succeed, got %v", err)
+	}
+	if got := atomic.LoadInt32(&primaryCalls); got != 2 {
+		t.Errorf("Expected primary to be tried twice, got %d", got)
+	}
+	if got := atomic.LoadInt32(&mirrorCalls); got != 1 {
+		t.Errorf("Expected mirror to be called once, got %d", got)
+	}
+	if mirrorMetric != "legacy.db.users" {
+		t.Errorf("Expected prefixed metric name, got %q", mirrorMetric)
+	}
+}
+
+func TestNewFanoutSenderMissingKey(t *testing.T) {
+	t.Setenv("MISSING_KEY", "")
+	cfg := DatadogConfig{Destinations: []DestinationConfig{{Name: "eu", APIKeyEnv: "MISSING_KEY", Site: "datadoghq.eu"}}}
+	if _, err := newFanoutSender(cfg, false, false, false); err == nil {
+		t.Fatal("Expected error for missing API key")
+	}
+	sender, err := newFanoutSender(cfg, false, true, false)
+	if err != nil {
+		t.Fatalf("Dry run must not require an API key: %v", err)
+	}
+	if got := sender.destinations[0].client.seriesURL(); got != "https://api.datadoghq.eu/api/v1/series" {
+		t.Errorf("Expected site series URL, got %q", got)
+	}
+}
+
+func TestValidateDestinations(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations []DestinationConfig
+		wantErr      bool
+	}{
+		{name: "None", destinations: nil},
+		{name: "Valid", destinations: []DestinationConfig{{Name: "us1"}, {Name: "eu", Site: "datadoghq.eu"}}},
+		{name: "Missing name", destinations: []DestinationConfig{{Site: "datadoghq.eu"}}, wantErr: true},
+		{name: "Duplicate name", destinations: []DestinationConfig{{Name: "us1"}, {Name: "us1"}}, wantErr: true},
+		{name: "Negative retries", destinations: []DestinationConfig{{Name: "us1", Retries: -1}}, wantErr: true},
+		{name: "Site is a URL", destinations: []DestinationConfig{{Name: "eu", Site: "https://datadoghq.eu/"}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDestinations(tc.destinations)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("validateDestinations() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsRetryableSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Server error", err: &HTTPStatusError{Status: 503}, want: true},
+		{name: "Rate limited", err: &HTTPStatusError{Status: 429}, want: true},
+		{name: "Forbidden", err: &HTTPStatusError{Status: 403}, want: false},
+		{name: "Cancelled", err: context.Canceled, want: false},
+		{name: "Other", err: errors.New("failed to encode JSON"), want: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableSendError(tc.err); got != tc.want {
+				t.Errorf("isRetryableSendError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Feature flag names. Every flag gates a behavior that changes what is sent or
+// how it is validated, so it can be adopted per deployment and rolled back by
+// editing the configuration instead of downgrading the binary.
+const (
+	featureV2API       = "v2_api"
+	featureBatching    = "batching"
+	featureQueryParser = "query_parser"
+)
+
+// featureFlag describes a known feature flag and its default.
+type featureFlag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// knownFeatures lists every supported flag. Unknown flags are rejected so a
+// typo can't silently leave a rollback ineffective.
+var knownFeatures = []featureFlag{
+	{Name: featureV2API, Description: "Submit metrics to the Datadog v2 series API"},
+	{Name: featureBatching, Description: "Buffer gauges per cycle when datadog.batch is set"},
+	{Name: featureQueryParser, Description: "Accept WITH clauses and UNION in validated queries"},
+}
+
+// Features holds the `features:` block of the configuration.
+type Features map[string]bool
+
+// Enabled reports whether the named flag is on, falling back to its default.
+func (f Features) Enabled(name string) bool {
+	if enabled, ok := f[name]; ok {
+		return enabled
+	}
+	for _, flag := range knownFeatures {
+		if flag.Name == name {
+			return flag.Default
+		}
+	}
+	return false
+}
+
+// Validate rejects flags that are not known to this version.
+func (f Features) Validate() error {
+	var unknown []string
+	for name := range f {
+		if !isKnownFeature(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown feature flags: %s", strings.Join(unknown, ", "))
+}
+
+// EnabledNames returns the sorted names of all enabled flags.
+func (f Features) EnabledNames() []string {
+	var names []string
+	for _, flag := range knownFeatures {
+		if f.Enabled(flag.Name) {
+			names = append(names, flag.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isKnownFeature(name string) bool {
+	for _, flag := range knownFeatures {
+		if flag.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeaturesEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		features Features
+		flag     string
+		want     bool
+	}{
+		{name: "Default when unset", features: nil, flag: featureV2API, want: false},
+		{name: "Explicitly enabled", features: Features{featureV2API: true}, flag: featureV2API, want: true},
+		{name: "Explicitly disabled", features: Features{featureV2API: false}, flag: featureV2API, want: false},
+		{name: "Unknown flag", features: nil, flag: "nope", want: false},
+		{name: "Batching off by default", features: nil, flag: featureBatching, want: false},
+		{name: "Query parser off by default", features: nil, flag: featureQueryParser, want: false},
+		{name: "Query parser enabled", features: Features{featureQueryParser: true}, flag: featureQueryParser, want: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.features.Enabled(tc.flag); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsUnknownFeatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "features:\n  v2_api: true\n  batchng: true\nmetrics: []\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "batchng") {
+		t.Fatalf("Expected unknown feature error, got %v", err)
+	}
+}
+
+func TestBatchingFeature(t *testing.T) {
+	tests := []struct {
+		name     string
+		features Features
+		want     bool
+	}{
+		{name: "Default", want: false},
+		{name: "Enabled", features: Features{featureBatching: true}, want: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{Datadog: DatadogConfig{Batch: true}, Features: tc.features}
+			sender, err := newSink(context.Background(), "", config, &options{dryRun: true})
+			if err != nil {
+				t.Fatalf("newSink failed: %v", err)
+			}
+			if got := sender.(*DatadogClient).Batch; got != tc.want {
+				t.Errorf("Expected batch %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestQueryParserFeature(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "WITH rejected by default",
+			content: "metrics:\n  - name: a\n    query: \"WITH t AS (SELECT 1 AS n) SELECT n FROM t\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "WITH accepted when enabled",
+			content: "features:\n  query_parser: true\nmetrics:\n  - name: a\n    query: \"WITH t AS (SELECT 1 AS n) SELECT n FROM t\"\n",
+		},
+		{
+			name:    "UNION accepted when enabled",
+			content: "features:\n  query_parser: true\nmetrics:\n  - name: a\n    query: \"SELECT 1 FROM a UNION ALL SELECT 2 FROM b\"\n",
+		},
+		{
+			name:    "WITH rejected when disabled",
+			content: "features:\n  query_parser: false\nmetrics:\n  - name: a\n    query: \"WITH t AS (SELECT 1 AS n) SELECT n FROM t\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "UNION rejected when disabled",
+			content: "features:\n  query_parser: false\nmetrics:\n  - name: a\n    query: \"SELECT 1 FROM a UNION ALL SELECT 2 FROM b\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "Single select accepted when disabled",
+			content: "features:\n  query_parser: false\nmetrics:\n  - name: a\n    query: \"SELECT count(*) FROM (SELECT 1 FROM a UNION SELECT 2 FROM b) u\"\n",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadConfig(path)
+			if tc.wantErr && (err == nil || !strings.Contains(err.Error(), featureQueryParser)) {
+				t.Fatalf("Expected query_parser error, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// reInList collapses lists of placeholders such as "IN (?, ?, ?)" to "(?)" so
+// queries differing only in list length share a fingerprint.
+var reInList = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+// normalizeQuery returns a dialect-agnostic normalized form of query:
+// comments are removed, string/numeric literals and bind placeholders
+// ($1, ?, :name) are replaced with "?", identifier quoting is dropped,
+// whitespace is collapsed and everything is lowercased.
+func normalizeQuery(query string) string {
+	src := []rune(query)
+	var b strings.Builder
+	b.Grow(len(query))
+
+	pendingSpace := false
+	emit := func(s string) {
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			pendingSpace = true
+
+		case r == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			pendingSpace = true
+
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				i++
+			}
+			i++
+			pendingSpace = true
+
+		case r == '\'':
+			// String literal; '' and \' are escapes
+			i++
+			for i < len(src) {
+				if src[i] == '\\' {
+					i += 2
+					continue
+				}
+				if src[i] == '\'' {
+					if i+1 < len(src) && src[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			emit("?")
+
+		case r == '"' || r == '`':
+			// Quoted identifier; keep the name, drop the quotes
+			j := i + 1
+			for j < len(src) && src[j] != r {
+				j++
+			}
+			emit(strings.ToLower(string(src[i+1 : min(j, len(src))])))
+			i = j
+
+		case r == '$' && i+1 < len(src) && unicode.IsDigit(src[i+1]):
+			// Postgres positional parameter
+			i++
+			for i+1 < len(src) && unicode.IsDigit(src[i+1]) {
+				i++
+			}
+			emit("?")
+
+		case r == '$':
+			// Postgres dollar-quoted string: $$...$$ or $tag$...$tag$
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(src[j]) || unicode.IsDigit(src[j])) {
+				j++
+			}
+			if j < len(src) && src[j] == '$' {
+				tag := string(src[i : j+1])
+				rest := string(src[j+1:])
+				if end := strings.Index(rest, tag); end >= 0 {
+					i = j + len([]rune(rest[:end])) + len([]rune(tag))
+					emit("?")
+					continue
+				}
+			}
+			emit("$")
+
+		case r == ':' && i+1 < len(src) && (unicode.IsLetter(src[i+1]) || src[i+1] == '_') && (i == 0 || src[i-1] != ':'):
+			// Named bind parameter (:name), but not a Postgres cast (::type)
+			i++
+			for i+1 < len(src) && (src[i+1] == '_' || unicode.IsLetter(src[i+1]) || unicode.IsDigit(src[i+1])) {
+				i++
+			}
+			emit("?")
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			// Numeric literal; identifiers such as "table1" are consumed below
+			for i+1 < len(src) && (isIdentRune(src[i+1]) || src[i+1] == '.') {
+				i++
+			}
+			emit("?")
+
+		case isIdentRune(r):
+			j := i
+			for j < len(src) && isIdentRune(src[j]) {
+				j++
+			}
+			emit(strings.ToLower(string(src[i:j])))
+			i = j - 1
+
+		default:
+			emit(string(r))
+		}
+	}
+
+	normalized := strings.TrimSpace(b.String())
+	normalized = strings.TrimRight(normalized, "; ")
+	normalized = strings.ReplaceAll(normalized, "( ", "(")
+	normalized = strings.ReplaceAll(normalized, " )", ")")
+	normalized = strings.ReplaceAll(normalized, " ,", ",")
+	return reInList.ReplaceAllString(normalized, "(?)")
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// queryFingerprint returns a short stable hash of the normalized query, so
+// the same statement produces the same fingerprint regardless of literals,
+// formatting or driver placeholder style.
+func queryFingerprint(query string) string {
+	sum := sha256.Sum256([]byte(normalizeQuery(query)))
+	return hex.EncodeToString(sum[:8])
+}
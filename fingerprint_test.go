@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "String and numeric literals",
+			query: "SELECT count(*) FROM orders WHERE status = 'paid' AND amount > 100.5",
+			want:  "select count(*) from orders where status = ? and amount > ?",
+		},
+		{
+			name:  "Comments and whitespace",
+			query: "SELECT age\n  FROM users -- comment\n /* block */ LIMIT 1;",
+			want:  "select age from users limit ?",
+		},
+		{
+			name:  "Postgres placeholders and casts",
+			query: "SELECT count(*)::float FROM t WHERE id = $1",
+			want:  "select count(*)::float from t where id = ?",
+		},
+		{
+			name:  "IN list collapsed",
+			query: "SELECT 1 FROM t WHERE id IN (1, 2, 3)",
+			want:  "select ? from t where id in (?)",
+		},
+		{
+			name:  "Quoted identifiers",
+			query: "SELECT \"user\".\"age\" FROM `users`",
+			want:  "select user.age from users",
+		},
+		{
+			name:  "Dollar quoted string",
+			query: "SELECT $$it's$$ FROM t",
+			want:  "select ? from t",
+		},
+		{
+			name:  "Identifiers with digits are kept",
+			query: "SELECT col1 FROM table2",
+			want:  "select col1 from table2",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeQuery(tc.query); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestQueryFingerprint(t *testing.T) {
+	a := queryFingerprint("SELECT count(*) FROM orders WHERE region = 'eu'")
+	b := queryFingerprint("select COUNT(*)\nfrom orders where region = $1;")
+	c := queryFingerprint("SELECT count(*) FROM users")
+
+	if a != b {
+		t.Errorf("Expected equivalent queries to share a fingerprint, got %q and %q", a, b)
+	}
+	if a == c {
+		t.Errorf("Expected different queries to have different fingerprints, both got %q", a)
+	}
+	if len(a) != 16 {
+		t.Errorf("Expected 16 character fingerprint, got %q", a)
+	}
+}
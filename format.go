@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration file formats accepted by -config-format.
+const (
+	formatAuto = "auto"
+	formatYAML = "yaml"
+	formatJSON = "json"
+	formatTOML = "toml"
+)
+
+// configFormat returns the format of filename: format itself unless it is
+// auto or empty, otherwise the one matching the extension (YAML by default).
+func configFormat(filename, format string) (string, error) {
+	switch format {
+	case formatYAML, formatJSON, formatTOML:
+		return format, nil
+	case "", formatAuto:
+	default:
+		return "", fmt.Errorf("unknown config format %q (must be auto, yaml, json or toml)", format)
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return formatJSON, nil
+	case ".toml":
+		return formatTOML, nil
+	default:
+		return formatYAML, nil
+	}
+}
+
+// configYAML converts configuration data to YAML, so every format is decoded
+// by the same YAML unmarshalers and validated identically.
+func configYAML(data []byte, format string) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case formatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		doc = jsonNumbers(doc)
+	case formatTOML:
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse TOML: %w", err)
+		}
+	default:
+		return data, nil
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s configuration: %w", format, err)
+	}
+	return out, nil
+}
+
+// jsonNumbers replaces the json.Number values of a decoded document with
+// integers where possible and floats otherwise.
+func jsonNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			t[key] = jsonNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range t {
+			t[i] = jsonNumbers(value)
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
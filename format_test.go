@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `metric_prefix: "app."
+metrics:
+  - name: orders.pending
+    query: "SELECT count(*) FROM orders WHERE state = 'pending'"
+    tags: ["env:prod"]
+    retries: 2
+    cache_ttl: 5m
+    on_null:
+      default: 1.5
+`,
+		"config.json": `{
+	"metric_prefix": "app.",
+	"metrics": [
+		{
+			"name": "orders.pending",
+			"query": "SELECT count(*) FROM orders WHERE state = 'pending'",
+			"tags": ["env:prod"],
+			"retries": 2,
+			"cache_ttl": "5m",
+			"on_null": {"default": 1.5}
+		}
+	]
+}
+`,
+		"config.toml": `metric_prefix = "app."
+
+[[metrics]]
+name = "orders.pending"
+query = "SELECT count(*) FROM orders WHERE state = 'pending'"
+tags = ["env:prod"]
+retries = 2
+cache_ttl = "5m"
+on_null = { default = 1.5 }
+`,
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+
+	want, err := loadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("loadConfig failed for YAML: %v", err)
+	}
+	for _, name := range []string{"config.json", "config.toml"} {
+		got, err := loadConfig(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("loadConfig failed for %s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got.Metrics, want.Metrics) {
+			t.Errorf("%s: expected %+v, got %+v", name, want.Metrics, got.Metrics)
+		}
+	}
+}
+
+func TestLoadConfigFormatOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.conf")
+	if err := os.WriteFile(path, []byte(`{"metrics": [{"name": "a", "query": "SELECT 1 FROM t"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfigFile(path, "", formatJSON)
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	if len(config.Metrics) != 1 || config.Metrics[0].Name != "a" {
+		t.Errorf("Unexpected metrics %+v", config.Metrics)
+	}
+
+	if _, err := loadConfigFile(path, "", "ini"); err == nil || !strings.Contains(err.Error(), "unknown config format") {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+}
+
+func TestLoadConfigFormatErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bad.json":     `{"metrics": [`,
+		"bad.toml":     "metrics = [",
+		"invalid.toml": "[[metrics]]\nname = \"a\"\nsink = \"nope\"\n",
+		"invalid.yaml": "metrics:\n  - name: a\n    sink: nope\n",
+	})
+
+	for _, name := range []string{"bad.json", "bad.toml"} {
+		if _, err := loadConfig(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected parse error for %s", name)
+		}
+	}
+
+	// Validation errors do not depend on the format.
+	_, errTOML := loadConfig(filepath.Join(dir, "invalid.toml"))
+	_, errYAML := loadConfig(filepath.Join(dir, "invalid.yaml"))
+	if errTOML == nil || errYAML == nil || errTOML.Error() != errYAML.Error() {
+		t.Errorf("Expected identical validation errors, got %v and %v", errTOML, errYAML)
+	}
+}
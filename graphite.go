@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphiteConfig configures the graphite sink, which writes the plaintext
+// protocol over TCP.
+type GraphiteConfig struct {
+	// Address is the host:port of the carbon plaintext listener, usually port 2003.
+	Address string `yaml:"address"`
+	// Prefix is prepended to every metric path.
+	Prefix string `yaml:"prefix,omitempty"`
+	// Untagged drops tags instead of sending Graphite 1.1 tagged series
+	// (name;key=value), for carbon versions without tag support.
+	Untagged bool `yaml:"untagged,omitempty"`
+}
+
+// GraphiteSender buffers points as plaintext lines and writes them over one
+// connection when the collection cycle is flushed.
+type GraphiteSender struct {
+	cfg GraphiteConfig
+
+	mu    sync.Mutex
+	lines bytes.Buffer
+}
+
+// newGraphiteSink creates the graphite sink from the `graphite:` block.
+func newGraphiteSink(_ context.Context, config *Config, _ *options) (MetricSender, error) {
+	if config.Graphite.Address == "" {
+		return nil, configError("graphite sink requires an address")
+	}
+	return &GraphiteSender{cfg: config.Graphite}, nil
+}
+
+// graphiteReplacer removes characters that separate fields of the plaintext
+// protocol or tags of a tagged series.
+var graphiteReplacer = strings.NewReplacer(" ", "_", ";", "_", "\n", "_", "=", "_", "~", "_")
+
+// graphiteLine formats one point in the plaintext protocol.
+func (g *GraphiteSender) graphiteLine(metricName string, value float64, tags []string, host string, ts time.Time) string {
+	var b strings.Builder
+	if g.cfg.Prefix != "" {
+		b.WriteString(strings.TrimSuffix(g.cfg.Prefix, ".") + ".")
+	}
+	b.WriteString(graphiteReplacer.Replace(metricName))
+	if !g.cfg.Untagged {
+		for _, tag := range tags {
+			key, val, _ := strings.Cut(tag, ":")
+			if val == "" {
+				val = "true"
+			}
+			b.WriteString(";" + graphiteReplacer.Replace(key) + "=" + graphiteReplacer.Replace(val))
+		}
+		if host != "" {
+			b.WriteString(";host=" + graphiteReplacer.Replace(host))
+		}
+	}
+	b.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteString(" " + strconv.FormatInt(ts.Unix(), 10))
+	return b.String()
+}
+
+// SendMetric buffers one point until the next Flush.
+func (g *GraphiteSender) SendMetric(_ context.Context, metricName string, value float64, tags []string, host string) error {
+	line := g.graphiteLine(metricName, value, tags, host, time.Now())
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lines.WriteString(line + "\n")
+	return nil
+}
+
+// Flush writes the buffered points over a new TCP connection.
+func (g *GraphiteSender) Flush(ctx context.Context) error {
+	g.mu.Lock()
+	payload := bytes.Clone(g.lines.Bytes())
+	g.lines.Reset()
+	g.mu.Unlock()
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", g.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Graphite: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("failed to write to Graphite: %w", err)
+	}
+	expvarPayloadsSent.Add(1)
+	expvarBytesSent.Add(int64(len(payload)))
+	return nil
+}
+
+// Close writes any points still buffered.
+func (g *GraphiteSender) Close(ctx context.Context) error {
+	return g.Flush(ctx)
+}
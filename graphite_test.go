@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteLine(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		cfg  GraphiteConfig
+		tags []string
+		host string
+		want string
+	}{
+		{name: "Plain", want: "db.users 42 1700000000"},
+		{name: "Tagged", tags: []string{"env:prod", "canary"}, host: "db-01", want: "db.users;env=prod;canary=true;host=db-01 42 1700000000"},
+		{name: "Untagged with prefix", cfg: GraphiteConfig{Prefix: "sql", Untagged: true}, tags: []string{"env:prod"}, want: "sql.db.users 42 1700000000"},
+		{name: "Separators replaced", tags: []string{"table:a b;c"}, want: "db.users;table=a_b_c 42 1700000000"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &GraphiteSender{cfg: tc.cfg}
+			if got := sender.graphiteLine("db.users", 42, tc.tags, tc.host, ts); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGraphiteSenderFlush(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	sender := &GraphiteSender{cfg: GraphiteConfig{Address: listener.Addr().String()}}
+	ctx := context.Background()
+	if err := sender.SendMetric(ctx, "db.users", 1, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.SendMetric(ctx, "db.orders", 2, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(<-received), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "db.users 1 ") || !strings.HasPrefix(lines[1], "db.orders 2 ") {
+		t.Errorf("Unexpected lines %q", lines)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// planTTL is how long an EXPLAIN estimate is reused before the query is
+// explained again, so plans follow the table statistics.
+const planTTL = time.Hour
+
+// GuardConfig protects the database from expensive metric queries. Queries
+// are explained before their first run and rejected when the planner's
+// estimate exceeds a threshold.
+type GuardConfig struct {
+	// MaxCost is the highest estimated planner cost allowed, in the units
+	// of the database (Total Cost on PostgreSQL, query_cost on MySQL).
+	MaxCost float64 `yaml:"max_cost,omitempty"`
+	// MaxEstimatedRows is the highest number of rows the planner may expect
+	// the query to read or return.
+	MaxEstimatedRows float64 `yaml:"max_estimated_rows,omitempty"`
+	// AutoLimit appends LIMIT 1 to the queries of single-value metrics that
+	// have no LIMIT, since only their first row is read.
+	AutoLimit bool `yaml:"auto_limit,omitempty"`
+}
+
+// enabled reports whether any guard is configured.
+func (g GuardConfig) enabled() bool {
+	return g.MaxCost > 0 || g.MaxEstimatedRows > 0 || g.AutoLimit
+}
+
+// queryPlan is the planner's estimate for a query.
+type queryPlan struct {
+	Query    string
+	Cost     float64
+	Rows     float64
+	Explains time.Time
+}
+
+// queryGuard applies a GuardConfig. Plans are cached per metric. It is safe
+// for concurrent use; a nil *queryGuard lets every query through.
+type queryGuard struct {
+	config GuardConfig
+	dbType string
+
+	mu    sync.Mutex
+	plans map[string]queryPlan
+}
+
+// newQueryGuard returns a guard for config, or nil when no guard is set.
+func newQueryGuard(config GuardConfig, dbType string) *queryGuard {
+	if !config.enabled() {
+		return nil
+	}
+	return &queryGuard{config: config, dbType: dbType, plans: make(map[string]queryPlan)}
+}
+
+// apply returns the metric with its query limited as configured, or an error
+// when the query's plan exceeds the thresholds. allow_unsafe queries may not
+// be explainable and are let through unchanged.
+func (g *queryGuard) apply(ctx context.Context, dbClient *SQLDB, metric MetricConfig) (MetricConfig, error) {
+	if g == nil || metric.AllowUnsafe {
+		return metric, nil
+	}
+	if g.config.AutoLimit && !metric.rowMode() {
+		metric.Query = withAutoLimit(metric.Query)
+	}
+	if g.config.MaxCost <= 0 && g.config.MaxEstimatedRows <= 0 {
+		return metric, nil
+	}
+
+	plan, ok := g.cachedPlan(metric)
+	if !ok {
+		args, err := metric.queryArgs()
+		if err != nil {
+			return metric, err
+		}
+		start := time.Now()
+		plan, err = explainQuery(ctx, dbClient.DB, g.dbType, metric.Query, args)
+		dbClient.Audit.Record(ctx, auditExplain, metric, 1, time.Since(start), err)
+		if err != nil {
+			return metric, err
+		}
+		g.mu.Lock()
+		g.plans[metric.Name] = plan
+		g.mu.Unlock()
+	}
+	return metric, g.check(plan)
+}
+
+// cachedPlan returns the recent plan of the metric's current query, if any.
+func (g *queryGuard) cachedPlan(metric MetricConfig) (queryPlan, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	plan, ok := g.plans[metric.Name]
+	if !ok || plan.Query != metric.Query || time.Since(plan.Explains) > planTTL {
+		return queryPlan{}, false
+	}
+	return plan, true
+}
+
+// check compares plan with the thresholds.
+func (g *queryGuard) check(plan queryPlan) error {
+	if g.config.MaxCost > 0 && plan.Cost > g.config.MaxCost {
+		return fmt.Errorf("query rejected by guard: estimated cost %s exceeds max_cost %s", formatValue(plan.Cost), formatValue(g.config.MaxCost))
+	}
+	if g.config.MaxEstimatedRows > 0 && plan.Rows > g.config.MaxEstimatedRows {
+		return fmt.Errorf("query rejected by guard: estimated rows %s exceed max_estimated_rows %s", formatValue(plan.Rows), formatValue(g.config.MaxEstimatedRows))
+	}
+	return nil
+}
+
+// explainQuery asks the database for the plan of query.
+func explainQuery(ctx context.Context, db *sql.DB, dbType, query string, args []interface{}) (queryPlan, error) {
+	explain := "EXPLAIN (FORMAT JSON) "
+	if dbType == "mysql" {
+		explain = "EXPLAIN FORMAT=JSON "
+	}
+	var out string
+	if err := db.QueryRowContext(ctx, explain+query, args...).Scan(&out); err != nil {
+		return queryPlan{}, fmt.Errorf("failed to explain query: %w", err)
+	}
+	plan, err := parsePlan(dbType, []byte(out))
+	if err != nil {
+		return queryPlan{}, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	plan.Query = query
+	plan.Explains = time.Now()
+	return plan, nil
+}
+
+// pgPlanNode is a node of a PostgreSQL JSON plan.
+type pgPlanNode struct {
+	NodeType  string       `json:"Node Type"`
+	TotalCost float64      `json:"Total Cost"`
+	PlanRows  float64      `json:"Plan Rows"`
+	Plans     []pgPlanNode `json:"Plans"`
+}
+
+// scanRows returns the largest row estimate of the scan nodes under n, and
+// whether there are any. The top node only estimates the rows returned,
+// e.g. 1 for a count(*) over a table of millions.
+func (n pgPlanNode) scanRows() (float64, bool) {
+	rows, found := 0.0, false
+	if strings.HasSuffix(n.NodeType, "Scan") {
+		rows, found = n.PlanRows, true
+	}
+	for _, child := range n.Plans {
+		if childRows, ok := child.scanRows(); ok {
+			rows, found = max(rows, childRows), true
+		}
+	}
+	return rows, found
+}
+
+// parsePlan reads the cost and row estimates of a JSON plan. PostgreSQL
+// reports the cost on the top plan node and the rows of every scan node,
+// of which the largest is kept; plans without a scan use the rows of the
+// top node. MySQL reports the query cost and the rows examined per table,
+// of which the largest is kept.
+func parsePlan(dbType string, data []byte) (queryPlan, error) {
+	if dbType != "mysql" {
+		var plans []struct {
+			Plan pgPlanNode `json:"Plan"`
+		}
+		if err := json.Unmarshal(data, &plans); err != nil {
+			return queryPlan{}, err
+		}
+		if len(plans) == 0 {
+			return queryPlan{}, fmt.Errorf("empty plan")
+		}
+		top := plans[0].Plan
+		rows, ok := top.scanRows()
+		if !ok {
+			rows = top.PlanRows
+		}
+		return queryPlan{Cost: top.TotalCost, Rows: rows}, nil
+	}
+
+	var plan struct {
+		QueryBlock map[string]interface{} `json:"query_block"`
+	}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return queryPlan{}, err
+	}
+	if plan.QueryBlock == nil {
+		return queryPlan{}, fmt.Errorf("missing query_block")
+	}
+	var result queryPlan
+	if info, ok := plan.QueryBlock["cost_info"].(map[string]interface{}); ok {
+		result.Cost = jsonNumber(info["query_cost"])
+	}
+	walkJSON(plan.QueryBlock, func(key string, value interface{}) {
+		if key == "rows_examined_per_scan" {
+			result.Rows = max(result.Rows, jsonNumber(value))
+		}
+	})
+	return result, nil
+}
+
+// jsonNumber converts a JSON number or numeric string, as MySQL uses for
+// costs, to a float64.
+func jsonNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+// walkJSON calls fn for every key of the objects nested in v.
+func walkJSON(v interface{}, fn func(key string, value interface{})) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			fn(key, value)
+			walkJSON(value, fn)
+		}
+	case []interface{}:
+		for _, value := range v {
+			walkJSON(value, fn)
+		}
+	}
+}
+
+var reLimit = regexp.MustCompile(`\b(?:limit|fetch)\b`)
+
+// withAutoLimit appends LIMIT 1 to query unless it already limits its rows
+// at the top level. The limit goes on its own line, after any trailing
+// comment.
+func withAutoLimit(query string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if reLimit.MatchString(maskNested(strings.ToLower(query))) {
+		return query
+	}
+	return query + "\nLIMIT 1"
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWithAutoLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "NoLimit", query: "SELECT count(*) FROM users", want: "SELECT count(*) FROM users\nLIMIT 1"},
+		{name: "TrailingSemicolon", query: "SELECT count(*) FROM users; ", want: "SELECT count(*) FROM users\nLIMIT 1"},
+		{name: "TrailingComment", query: "SELECT age FROM users -- newest", want: "SELECT age FROM users -- newest\nLIMIT 1"},
+		{name: "HasLimit", query: "SELECT age FROM users ORDER BY id DESC LIMIT 5", want: "SELECT age FROM users ORDER BY id DESC LIMIT 5"},
+		{name: "HasFetch", query: "SELECT age FROM users FETCH FIRST 1 ROWS ONLY", want: "SELECT age FROM users FETCH FIRST 1 ROWS ONLY"},
+		{name: "NestedLimit", query: "SELECT max(age) FROM (SELECT age FROM users LIMIT 10) t", want: "SELECT max(age) FROM (SELECT age FROM users LIMIT 10) t\nLIMIT 1"},
+		{name: "LimitInString", query: "SELECT count(*) FROM t WHERE note = 'limit'", want: "SELECT count(*) FROM t WHERE note = 'limit'\nLIMIT 1"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := withAutoLimit(tc.query); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbType   string
+		plan     string
+		wantCost float64
+		wantRows float64
+		wantErr  bool
+	}{
+		{
+			name:     "Postgres",
+			dbType:   "postgres",
+			plan:     `[{"Plan": {"Node Type": "Aggregate", "Total Cost": 1834.5, "Plan Rows": 1, "Plans": [{"Node Type": "Seq Scan", "Total Cost": 1600, "Plan Rows": 94000}]}}]`,
+			wantCost: 1834.5,
+			wantRows: 94000,
+		},
+		{
+			name:   "PostgresAggregateOverJoin",
+			dbType: "postgres",
+			plan: `[{"Plan": {"Node Type": "Aggregate", "Total Cost": 250000, "Plan Rows": 1, "Plans": [
+				{"Node Type": "Hash Join", "Total Cost": 240000, "Plan Rows": 300, "Plans": [
+					{"Node Type": "Seq Scan", "Total Cost": 180000, "Plan Rows": 12000000},
+					{"Node Type": "Hash", "Total Cost": 20, "Plan Rows": 300, "Plans": [
+						{"Node Type": "Index Scan", "Total Cost": 20, "Plan Rows": 300}
+					]}
+				]}
+			]}}]`,
+			wantCost: 250000,
+			wantRows: 12000000,
+		},
+		{
+			name:     "PostgresWithoutScan",
+			dbType:   "postgres",
+			plan:     `[{"Plan": {"Node Type": "Result", "Total Cost": 0.01, "Plan Rows": 1}}]`,
+			wantCost: 0.01,
+			wantRows: 1,
+		},
+		{
+			name:     "MySQL",
+			dbType:   "mysql",
+			plan:     `{"query_block": {"cost_info": {"query_cost": "2051.25"}, "nested_loop": [{"table": {"rows_examined_per_scan": 20000}}, {"table": {"rows_examined_per_scan": 3}}]}}`,
+			wantCost: 2051.25,
+			wantRows: 20000,
+		},
+		{name: "PostgresEmpty", dbType: "postgres", plan: `[]`, wantErr: true},
+		{name: "MySQLMissingBlock", dbType: "mysql", plan: `{}`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			plan, err := parsePlan(tc.dbType, []byte(tc.plan))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Cost != tc.wantCost || plan.Rows != tc.wantRows {
+				t.Errorf("Expected cost %v and rows %v, got %v and %v", tc.wantCost, tc.wantRows, plan.Cost, plan.Rows)
+			}
+		})
+	}
+}
+
+func TestQueryGuardCheck(t *testing.T) {
+	guard := newQueryGuard(GuardConfig{MaxCost: 1000, MaxEstimatedRows: 50000}, "postgres")
+	tests := []struct {
+		name    string
+		plan    queryPlan
+		wantErr string
+	}{
+		{name: "Cheap", plan: queryPlan{Cost: 10, Rows: 1}},
+		{name: "Costly", plan: queryPlan{Cost: 1834.5, Rows: 1}, wantErr: "estimated cost 1834.5 exceeds max_cost 1000"},
+		{name: "ManyRows", plan: queryPlan{Cost: 10, Rows: 94000}, wantErr: "estimated rows 94000 exceed max_estimated_rows 50000"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := guard.check(tc.plan)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestQueryGuardAutoLimit(t *testing.T) {
+	guard := newQueryGuard(GuardConfig{AutoLimit: true}, "postgres")
+	tests := []struct {
+		name   string
+		metric MetricConfig
+		want   string
+	}{
+		{name: "SingleValue", metric: MetricConfig{Query: "SELECT age FROM users"}, want: "SELECT age FROM users\nLIMIT 1"},
+		{name: "RowMode", metric: MetricConfig{Query: "SELECT count(*), region FROM users GROUP BY region", TagColumns: []string{"region"}}, want: "SELECT count(*), region FROM users GROUP BY region"},
+		{name: "Unsafe", metric: MetricConfig{Query: "SELECT jobs_pending()", AllowUnsafe: true}, want: "SELECT jobs_pending()"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			metric, err := guard.apply(context.Background(), nil, tc.metric)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if metric.Query != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, metric.Query)
+			}
+		})
+	}
+
+	if newQueryGuard(GuardConfig{}, "postgres") != nil {
+		t.Error("Expected no guard without configuration")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthState tracks what the health and readiness endpoints report.
+// It is safe for concurrent use; a nil *HealthState records nothing.
+type HealthState struct {
+	mu          sync.RWMutex
+	configFile  string
+	interval    time.Duration
+	configErr   error
+	configAt    time.Time
+	started     time.Time
+	lastCycle   time.Time
+	lastFailed  int
+	lastSuccess map[string]time.Time
+}
+
+// NewHealthState creates the state for a collector running every interval
+// (0 for a single run).
+func NewHealthState(configFile string, interval time.Duration) *HealthState {
+	return &HealthState{
+		configFile:  configFile,
+		interval:    interval,
+		started:     time.Now(),
+		lastSuccess: make(map[string]time.Time),
+	}
+}
+
+// SetConfig records the result of loading the configuration.
+func (h *HealthState) SetConfig(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.configErr = err
+	h.configAt = time.Now()
+}
+
+// RecordSuccess records a successful collection of metric.
+func (h *HealthState) RecordSuccess(metric string, at time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSuccess[metric] = at
+}
+
+// RecordCycle records the completion of a collection cycle.
+func (h *HealthState) RecordCycle(at time.Time, failed int) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCycle = at
+	h.lastFailed = failed
+}
+
+// healthReport is the JSON body returned by the health endpoints.
+type healthReport struct {
+	Status      string            `json:"status"`
+	Config      componentStatus   `json:"config"`
+	Database    *componentStatus  `json:"database,omitempty"`
+	LastCycle   string            `json:"last_cycle,omitempty"`
+	LastFailed  int               `json:"last_cycle_failed"`
+	LastSuccess map[string]string `json:"last_success"`
+}
+
+type componentStatus struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// stalled reports whether no cycle has completed for three intervals, which
+// means the collection loop is stuck.
+func (h *HealthState) stalled(now time.Time) bool {
+	if h.interval <= 0 {
+		return false
+	}
+	last := h.lastCycle
+	if last.IsZero() {
+		last = h.started
+	}
+	return now.Sub(last) > 3*h.interval
+}
+
+func (h *HealthState) report(now time.Time) healthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r := healthReport{
+		Status:      "ok",
+		Config:      componentStatus{OK: h.configErr == nil && !h.configAt.IsZero()},
+		LastFailed:  h.lastFailed,
+		LastSuccess: make(map[string]string, len(h.lastSuccess)),
+	}
+	if h.configErr != nil {
+		r.Config.Error = h.configErr.Error()
+	}
+	if !h.lastCycle.IsZero() {
+		r.LastCycle = h.lastCycle.Format(time.RFC3339)
+	}
+	for metric, at := range h.lastSuccess {
+		r.LastSuccess[metric] = at.Format(time.RFC3339)
+	}
+	if h.stalled(now) {
+		r.Status = "stalled"
+	}
+	return r
+}
+
+// healthHandler serves /healthz (liveness) and /readyz (readiness). Liveness
+// fails only when the collection loop has stalled; readiness additionally
+// requires a loaded configuration and a reachable database.
+func healthHandler(h *HealthState, db *sql.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		report := h.report(time.Now())
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := h.report(time.Now())
+		ready := report.Status == "ok" && report.Config.OK
+
+		if db != nil {
+			ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+			defer cancel()
+			dbStatus := componentStatus{OK: true}
+			if err := db.PingContext(ctx); err != nil {
+				dbStatus = componentStatus{OK: false, Error: logRedactor.RedactString(err.Error())}
+				ready = false
+			}
+			report.Database = &dbStatus
+		}
+
+		status := http.StatusOK
+		if !ready {
+			report.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// startHealthServer serves the health endpoints on addr until ctx is done.
+func startHealthServer(ctx context.Context, addr string, h *HealthState, db *sql.DB) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on health address: %w", err)
+	}
+
+	srv := &http.Server{Handler: healthHandler(h, db), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logEvent(ctx, "error", "Health server failed", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logEvent(ctx, "info", "Health server listening", map[string]interface{}{"addr": ln.Addr().String()})
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	state := NewHealthState("config.yaml", time.Minute)
+	handler := healthHandler(state, nil)
+
+	// Config not loaded yet: alive but not ready
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /healthz 200, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 before config load, got %d", rec.Code)
+	}
+
+	state.SetConfig(nil)
+	state.RecordSuccess("metric.a", time.Now())
+	state.RecordCycle(time.Now(), 0)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after config load, got %d", rec.Code)
+	}
+
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if _, ok := report.LastSuccess["metric.a"]; !ok {
+		t.Errorf("Expected last success for metric.a, got %v", report.LastSuccess)
+	}
+}
+
+func TestHealthConfigError(t *testing.T) {
+	state := NewHealthState("config.yaml", 0)
+	state.SetConfig(errors.New("failed to parse YAML"))
+
+	rec := httptest.NewRecorder()
+	healthHandler(state, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 with config error, got %d", rec.Code)
+	}
+}
+
+func TestHealthStalled(t *testing.T) {
+	state := NewHealthState("config.yaml", time.Second)
+	state.RecordCycle(time.Now().Add(-time.Minute), 0)
+
+	if !state.stalled(time.Now()) {
+		t.Error("Expected state to be stalled after three missed intervals")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHeartbeatMetric is the metric name used when no name is configured.
+const defaultHeartbeatMetric = "sqlmetrics.heartbeat"
+
+// HeartbeatConfig enables a gauge sent at the end of every successful run, so a
+// Datadog "no data" monitor can detect a collector that stopped running.
+type HeartbeatConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Metric  string   `yaml:"metric,omitempty"`
+	Host    string   `yaml:"host,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+}
+
+// configName derives a short name for a configuration file, e.g.
+// "/etc/ddsm/orders.yaml" becomes "orders".
+func configName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// sendHeartbeat submits the heartbeat gauge (value 1) tagged with the config
+// name. host defaults to the machine's hostname when not configured.
+func sendHeartbeat(ctx context.Context, sender MetricSender, cfg HeartbeatConfig, configFile, host string) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	metric := cfg.Metric
+	if metric == "" {
+		metric = defaultHeartbeatMetric
+	}
+	if cfg.Host != "" {
+		host = cfg.Host
+	}
+
+	tags := append([]string{"config:" + configName(configFile)}, cfg.Tags...)
+	return sender.SendMetric(ctx, metric, 1, tags, host)
+}
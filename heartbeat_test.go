@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSendHeartbeat(t *testing.T) {
+	sender := &MockMetricSender{}
+	cfg := HeartbeatConfig{Enabled: true, Tags: []string{"env:test"}}
+
+	if err := sendHeartbeat(context.Background(), sender, cfg, "/etc/ddsm/orders.yaml", "host-a"); err != nil {
+		t.Fatalf("sendHeartbeat failed: %v", err)
+	}
+	if len(sender.SentMetrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %d", len(sender.SentMetrics))
+	}
+
+	sent := sender.SentMetrics[0]
+	if sent.Metric != defaultHeartbeatMetric {
+		t.Errorf("Expected metric %q, got %q", defaultHeartbeatMetric, sent.Metric)
+	}
+	if sent.Points[0][1] != 1 {
+		t.Errorf("Expected value 1, got %v", sent.Points[0][1])
+	}
+	if sent.Host != "host-a" {
+		t.Errorf("Expected host 'host-a', got %q", sent.Host)
+	}
+	if len(sent.Tags) != 2 || sent.Tags[0] != "config:orders" || sent.Tags[1] != "env:test" {
+		t.Errorf("Unexpected tags: %v", sent.Tags)
+	}
+}
+
+func TestSendHeartbeatDisabled(t *testing.T) {
+	sender := &MockMetricSender{}
+	if err := sendHeartbeat(context.Background(), sender, HeartbeatConfig{}, "config.yaml", "host-a"); err != nil {
+		t.Fatalf("sendHeartbeat failed: %v", err)
+	}
+	if len(sender.SentMetrics) != 0 {
+		t.Errorf("Expected no heartbeat when disabled, got %d", len(sender.SentMetrics))
+	}
+}
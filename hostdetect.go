@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Host detection sources.
+const (
+	hostDetectHostname = "hostname"
+	hostDetectEC2      = "ec2"
+	hostDetectGCE      = "gce"
+	hostDetectCloud    = "cloud"
+)
+
+// Metadata endpoints of the cloud providers; variables so tests can point
+// them to a local server.
+var (
+	ec2MetadataURL = "http://169.254.169.254"
+	gceMetadataURL = "http://metadata.google.internal"
+)
+
+// metadataTimeout bounds each metadata request, so detection outside the
+// cloud does not delay the start.
+const metadataTimeout = 2 * time.Second
+
+// HostConfig fills in the host of metrics that do not set one, so their
+// series line up with the Datadog infrastructure hosts.
+type HostConfig struct {
+	// Detect is hostname (the OS hostname), ec2 or gce (the instance ID from
+	// the metadata endpoint), or cloud, which tries EC2 then GCE and falls
+	// back to the hostname. Empty leaves the host unset.
+	Detect string `yaml:"detect,omitempty"`
+	// CloudTags adds availability_zone, instance_type and region tags when
+	// the host was read from cloud metadata.
+	CloudTags bool `yaml:"cloud_tags,omitempty"`
+}
+
+// validate checks the detection source.
+func (h HostConfig) validate() error {
+	switch h.Detect {
+	case "", hostDetectHostname, hostDetectEC2, hostDetectGCE, hostDetectCloud:
+		return nil
+	}
+	return fmt.Errorf("host: unknown detect %q (valid: hostname, ec2, gce, cloud)", h.Detect)
+}
+
+// hostInfo is the detected host of the collector. A nil *hostInfo leaves
+// metrics unchanged.
+type hostInfo struct {
+	Name string
+	// Tags are the cloud metadata tags, if enabled.
+	Tags []string
+}
+
+// apply sets the detected host on a metric without one and adds the cloud
+// tags.
+func (h *hostInfo) apply(metric MetricConfig) MetricConfig {
+	if h == nil || metric.Host != "" {
+		return metric
+	}
+	metric.Host = h.Name
+	metric.Tags = slices.Concat(metric.Tags, h.Tags)
+	return metric
+}
+
+// detectHost finds the host as configured, or returns nil when detection is
+// disabled. Cloud metadata failing to answer is an error for ec2 and gce.
+func detectHost(ctx context.Context, config HostConfig) (*hostInfo, error) {
+	var sources []func(context.Context) (*hostInfo, error)
+	switch config.Detect {
+	case "":
+		return nil, nil
+	case hostDetectEC2:
+		sources = append(sources, detectEC2)
+	case hostDetectGCE:
+		sources = append(sources, detectGCE)
+	case hostDetectCloud:
+		sources = append(sources, detectEC2, detectGCE)
+	}
+
+	var errs []string
+	for _, detect := range sources {
+		host, err := detect(ctx)
+		if err == nil {
+			if !config.CloudTags {
+				host.Tags = nil
+			}
+			return host, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if config.Detect != hostDetectHostname && config.Detect != hostDetectCloud {
+		return nil, fmt.Errorf("failed to detect host: %s", strings.Join(errs, "; "))
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect host: %w", err)
+	}
+	return &hostInfo{Name: name}, nil
+}
+
+// detectEC2 reads the instance identity from the EC2 instance metadata
+// service, using an IMDSv2 session token.
+func detectEC2(ctx context.Context) (*hostInfo, error) {
+	token, err := metadataRequest(ctx, http.MethodPut, ec2MetadataURL+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ec2: %w", err)
+	}
+	get := func(key string) (string, error) {
+		return metadataRequest(ctx, http.MethodGet, ec2MetadataURL+"/latest/meta-data/"+key, map[string]string{
+			"X-aws-ec2-metadata-token": token,
+		})
+	}
+	id, err := get("instance-id")
+	if err != nil {
+		return nil, fmt.Errorf("ec2: %w", err)
+	}
+	host := &hostInfo{Name: id}
+	zone, _ := get("placement/availability-zone")
+	instanceType, _ := get("instance-type")
+	region, _ := get("placement/region")
+	host.Tags = cloudTags(zone, instanceType, region)
+	return host, nil
+}
+
+// detectGCE reads the instance identity from the GCE metadata server. Zone
+// and machine type are returned as resource paths.
+func detectGCE(ctx context.Context) (*hostInfo, error) {
+	get := func(key string) (string, error) {
+		return metadataRequest(ctx, http.MethodGet, gceMetadataURL+"/computeMetadata/v1/instance/"+key, map[string]string{
+			"Metadata-Flavor": "Google",
+		})
+	}
+	id, err := get("id")
+	if err != nil {
+		return nil, fmt.Errorf("gce: %w", err)
+	}
+	host := &hostInfo{Name: id}
+	zone, _ := get("zone")
+	machineType, _ := get("machine-type")
+	zone, machineType = path.Base(zone), path.Base(machineType)
+	region := ""
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	host.Tags = cloudTags(zone, machineType, region)
+	return host, nil
+}
+
+// cloudTags returns the tags of the non-empty metadata values.
+func cloudTags(zone, instanceType, region string) []string {
+	var tags []string
+	for _, tag := range []struct{ key, value string }{
+		{"availability_zone", zone},
+		{"instance_type", instanceType},
+		{"region", region},
+	} {
+		if tag.value != "" && tag.value != "." {
+			tags = append(tags, tag.key+":"+tag.value)
+		}
+	}
+	return tags
+}
+
+// metadataRequest returns the body of a metadata endpoint.
+func metadataRequest(ctx context.Context, method, url string, headers map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newMetadataServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ec2 := map[string]string{
+		"instance-id":                 "i-0abc123",
+		"placement/availability-zone": "us-east-1a",
+		"instance-type":               "m5.large",
+		"placement/region":            "us-east-1",
+	}
+	gce := map[string]string{
+		"id":           "4520031799277581759",
+		"zone":         "projects/123/zones/europe-west1-b",
+		"machine-type": "projects/123/machineTypes/e2-medium",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /ec2/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("token"))
+	})
+	mux.HandleFunc("GET /ec2/latest/meta-data/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		value, ok := ec2[r.PathValue("key")]
+		if !ok || r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	})
+	mux.HandleFunc("GET /gce/computeMetadata/v1/instance/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		value, ok := gce[r.PathValue("key")]
+		if !ok || r.Header.Get("Metadata-Flavor") != "Google" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(value))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDetectHost(t *testing.T) {
+	server := newMetadataServer(t)
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		name    string
+		config  HostConfig
+		ec2     string
+		gce     string
+		want    *hostInfo
+		wantErr bool
+	}{
+		{name: "Disabled", config: HostConfig{}},
+		{name: "Hostname", config: HostConfig{Detect: "hostname"}, want: &hostInfo{Name: hostname}},
+		{
+			name:   "EC2",
+			config: HostConfig{Detect: "ec2", CloudTags: true},
+			ec2:    "/ec2",
+			want:   &hostInfo{Name: "i-0abc123", Tags: []string{"availability_zone:us-east-1a", "instance_type:m5.large", "region:us-east-1"}},
+		},
+		{name: "EC2WithoutTags", config: HostConfig{Detect: "ec2"}, ec2: "/ec2", want: &hostInfo{Name: "i-0abc123"}},
+		{name: "EC2Unavailable", config: HostConfig{Detect: "ec2"}, ec2: "/none", wantErr: true},
+		{
+			name:   "CloudGCE",
+			config: HostConfig{Detect: "cloud", CloudTags: true},
+			ec2:    "/none",
+			gce:    "/gce",
+			want:   &hostInfo{Name: "4520031799277581759", Tags: []string{"availability_zone:europe-west1-b", "instance_type:e2-medium", "region:europe-west1"}},
+		},
+		{name: "CloudFallback", config: HostConfig{Detect: "cloud"}, ec2: "/none", gce: "/none", want: &hostInfo{Name: hostname}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(ec2, gce string) { ec2MetadataURL, gceMetadataURL = ec2, gce }(ec2MetadataURL, gceMetadataURL)
+			ec2MetadataURL, gceMetadataURL = server.URL+tc.ec2, server.URL+tc.gce
+
+			got, err := detectHost(context.Background(), tc.config)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHostInfoApply(t *testing.T) {
+	host := &hostInfo{Name: "i-0abc123", Tags: []string{"region:us-east-1"}}
+
+	got := host.apply(MetricConfig{Name: "a", Tags: []string{"env:prod"}})
+	if got.Host != "i-0abc123" || !reflect.DeepEqual(got.Tags, []string{"env:prod", "region:us-east-1"}) {
+		t.Errorf("Expected the detected host and tags, got %+v", got)
+	}
+	if got := host.apply(MetricConfig{Name: "b", Host: "db-1"}); got.Host != "db-1" || len(got.Tags) != 0 {
+		t.Errorf("Expected an explicit host to be kept, got %+v", got)
+	}
+	if got := (*hostInfo)(nil).apply(MetricConfig{Name: "c"}); got.Host != "" {
+		t.Errorf("Expected no host, got %q", got.Host)
+	}
+	if err := (HostConfig{Detect: "azure"}).validate(); err == nil {
+		t.Error("Expected error for an unknown detect source")
+	}
+}
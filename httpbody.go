@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// maxResponseBodyBytes caps how much of a successful response body is read.
+	maxResponseBodyBytes = 10 << 20
+	// maxErrorBodyBytes caps how much of an error response body is read.
+	maxErrorBodyBytes = 64 << 10
+	// maxErrorDetailLength caps the error detail included in returned errors.
+	maxErrorDetailLength = 512
+	// responseReadTimeout bounds the time spent reading a response body, so
+	// a proxy streaming an endless body cannot hang a collection cycle.
+	responseReadTimeout = 10 * time.Second
+)
+
+// errBodyTooLarge is returned when a response body exceeds its size cap.
+var errBodyTooLarge = errors.New("response body too large")
+
+// readLimitedBody reads at most limit bytes from body within timeout. On
+// timeout the body is closed to unblock the pending read.
+func readLimitedBody(body io.ReadCloser, limit int64, timeout time.Duration) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(io.LimitReader(body, limit+1))
+		done <- result{data: data, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.data, fmt.Errorf("failed to read response body: %w", r.err)
+		}
+		if int64(len(r.data)) > limit {
+			return r.data[:limit], fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, limit)
+		}
+		return r.data, nil
+	case <-timer.C:
+		_ = body.Close()
+		return nil, fmt.Errorf("timed out reading response body after %s", timeout)
+	}
+}
+
+// errorDetail extracts a short human readable message from an error response
+// body. Datadog's {"errors": [...]} format is recognized; other bodies are
+// returned as trimmed, truncated text.
+func errorDetail(body []byte) string {
+	var apiErr struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err == nil && len(apiErr.Errors) > 0 {
+		return truncate(strings.Join(apiErr.Errors, "; "), maxErrorDetailLength)
+	}
+	return truncate(strings.TrimSpace(string(body)), maxErrorDetailLength)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// statusError builds the error returned for an unexpected response status,
+// including details from the (size and time limited) body.
+func statusError(status int, body io.ReadCloser) error {
+	data, err := readLimitedBody(body, maxErrorBodyBytes, responseReadTimeout)
+	detail := errorDetail(data)
+	if detail == "" && err != nil {
+		detail = err.Error()
+	}
+	return &HTTPStatusError{Status: status, Detail: detail}
+}
+
+// HTTPStatusError reports an unexpected HTTP response status.
+type HTTPStatusError struct {
+	Status int
+	Detail string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("unexpected response code: %d", e.Status)
+	}
+	return fmt.Sprintf("unexpected response code: %d: %s", e.Status, e.Detail)
+}
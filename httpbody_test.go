@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingBody never returns data until it is closed.
+type blockingBody struct{ closed chan struct{} }
+
+func (b *blockingBody) Read(p []byte) (int, error) {
+	<-b.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (b *blockingBody) Close() error {
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+	return nil
+}
+
+func TestReadLimitedBodyTimeout(t *testing.T) {
+	body := &blockingBody{closed: make(chan struct{})}
+	start := time.Now()
+	_, err := readLimitedBody(body, 1024, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected read to give up quickly, took %v", time.Since(start))
+	}
+}
+
+func TestReadLimitedBodySizeCap(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(strings.Repeat("x", 100)))
+	data, err := readLimitedBody(body, 10, time.Second)
+	if !errors.Is(err, errBodyTooLarge) {
+		t.Fatalf("Expected errBodyTooLarge, got %v", err)
+	}
+	if len(data) != 10 {
+		t.Errorf("Expected 10 bytes, got %d", len(data))
+	}
+}
+
+func TestErrorDetail(t *testing.T) {
+	if got := errorDetail([]byte(`{"errors":["Forbidden","API key invalid"]}`)); got != "Forbidden; API key invalid" {
+		t.Errorf("Unexpected detail for Datadog error: %q", got)
+	}
+	if got := errorDetail([]byte("  bad gateway\n")); got != "bad gateway" {
+		t.Errorf("Unexpected detail for text body: %q", got)
+	}
+	if got := errorDetail([]byte(strings.Repeat("a", 1000))); len(got) != maxErrorDetailLength+3 {
+		t.Errorf("Expected truncated detail, got length %d", len(got))
+	}
+}
+
+func TestSendMetricIncludesErrorDetail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["Forbidden"]}`))
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "key", URL: server.URL}
+	err := client.SendMetric(context.Background(), "test.metric", 1, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "403: Forbidden") {
+		t.Errorf("Expected error with detail, got %v", err)
+	}
+}
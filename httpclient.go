@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Defaults of HTTPClientConfig.
+const (
+	defaultDialTimeout           = 10 * time.Second
+	defaultTLSHandshakeTimeout   = 10 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+	defaultIdleConnTimeout       = 90 * time.Second
+	defaultMaxIdleConnsPerHost   = 4
+)
+
+// HTTPClientConfig tunes the HTTP client of the Datadog API. The client is
+// created once and keeps its connections alive between requests, so daemon
+// cycles do not pay a TCP and TLS handshake per submission.
+type HTTPClientConfig struct {
+	// Timeout bounds a whole request including the response body; zero
+	// leaves it to the context of the run.
+	Timeout               time.Duration `yaml:"timeout,omitempty"`
+	DialTimeout           time.Duration `yaml:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty"`
+	// IdleConnTimeout closes connections unused for that long.
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout,omitempty"`
+	// MaxIdleConnsPerHost is the number of idle connections kept per host.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host,omitempty"`
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool `yaml:"disable_keep_alives,omitempty"`
+}
+
+// newHTTPClient returns a client configured from cfg, with the defaults for
+// the unset timeouts.
+func newHTTPClient(cfg HTTPClientConfig) *http.Client {
+	orDefault := func(d, def time.Duration) time.Duration {
+		if d > 0 {
+			return d
+		}
+		return def
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   orDefault(cfg.DialTimeout, defaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = orDefault(cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	transport.ResponseHeaderTimeout = orDefault(cfg.ResponseHeaderTimeout, defaultResponseHeaderTimeout)
+	transport.IdleConnTimeout = orDefault(cfg.IdleConnTimeout, defaultIdleConnTimeout)
+	transport.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}
+}
+
+// drainBody discards what is left of a response body, up to a limit, so its
+// connection can be reused.
+func drainBody(body io.Reader) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxErrorBodyBytes))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      HTTPClientConfig
+		timeout     time.Duration
+		tlsTimeout  time.Duration
+		headerWait  time.Duration
+		idleTimeout time.Duration
+		idlePerHost int
+	}{
+		{
+			name:        "Defaults",
+			tlsTimeout:  defaultTLSHandshakeTimeout,
+			headerWait:  defaultResponseHeaderTimeout,
+			idleTimeout: defaultIdleConnTimeout,
+			idlePerHost: defaultMaxIdleConnsPerHost,
+		},
+		{
+			name: "Overrides",
+			config: HTTPClientConfig{
+				Timeout:               time.Minute,
+				TLSHandshakeTimeout:   time.Second,
+				ResponseHeaderTimeout: 5 * time.Second,
+				IdleConnTimeout:       time.Minute,
+				MaxIdleConnsPerHost:   8,
+			},
+			timeout:     time.Minute,
+			tlsTimeout:  time.Second,
+			headerWait:  5 * time.Second,
+			idleTimeout: time.Minute,
+			idlePerHost: 8,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client := newHTTPClient(tc.config)
+			transport := client.Transport.(*http.Transport)
+			if client.Timeout != tc.timeout {
+				t.Errorf("Expected timeout %v, got %v", tc.timeout, client.Timeout)
+			}
+			if transport.TLSHandshakeTimeout != tc.tlsTimeout {
+				t.Errorf("Expected TLS handshake timeout %v, got %v", tc.tlsTimeout, transport.TLSHandshakeTimeout)
+			}
+			if transport.ResponseHeaderTimeout != tc.headerWait {
+				t.Errorf("Expected response header timeout %v, got %v", tc.headerWait, transport.ResponseHeaderTimeout)
+			}
+			if transport.IdleConnTimeout != tc.idleTimeout {
+				t.Errorf("Expected idle timeout %v, got %v", tc.idleTimeout, transport.IdleConnTimeout)
+			}
+			if transport.MaxIdleConnsPerHost != tc.idlePerHost {
+				t.Errorf("Expected %d idle connections per host, got %d", tc.idlePerHost, transport.MaxIdleConnsPerHost)
+			}
+		})
+	}
+}
+
+func TestDatadogClientReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := newDatadogClient("test-key", DatadogConfig{URL: server.URL})
+	for i := 0; i < 3; i++ {
+		if err := client.SendMetric(context.Background(), "test.metric", 1, nil, ""); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("Expected 1 connection, got %d", conns)
+	}
+}
+
+func TestDatadogClientResponseHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := newDatadogClient("test-key", DatadogConfig{
+		URL:  server.URL,
+		HTTP: HTTPClientConfig{ResponseHeaderTimeout: 20 * time.Millisecond},
+	})
+	if err := client.SendMetric(context.Background(), "test.metric", 1, nil, ""); err == nil {
+		t.Fatal("Expected a timeout error but got nil")
+	}
+}
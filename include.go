@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includeFile is the content of a file pulled in with include: more metrics,
+// shared queries and templates, and possibly further includes.
+type includeFile struct {
+	Include   []string                `yaml:"include,omitempty"`
+	Queries   map[string]string       `yaml:"queries,omitempty"`
+	Templates map[string]MetricConfig `yaml:"templates,omitempty"`
+	Metrics   []MetricConfig          `yaml:"metrics,omitempty"`
+}
+
+// resolveIncludes merges the files listed under include into config. Paths
+// are relative to the including file and may be glob patterns, matched in
+// sorted order. Included metrics are appended after the including file's.
+func resolveIncludes(config *Config, filename string) error {
+	seen := map[string]bool{absPath(filename): true}
+	return includeAll(config, filepath.Dir(filename), config.Include, seen)
+}
+
+func includeAll(config *Config, dir string, patterns []string, seen map[string]bool) error {
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		if patternDir := filepath.Dir(pattern); !strings.ContainsAny(patternDir, `*?[\`) {
+			// Files added later to the directory must be seen too.
+			config.addWatchDir(patternDir)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("include %q matched no files", pattern)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if seen[absPath(path)] {
+				return fmt.Errorf("include cycle: %s is included more than once", path)
+			}
+			seen[absPath(path)] = true
+			if err := includeOne(config, path, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func includeOne(config *Config, path string, seen map[string]bool) error {
+	format, err := configFormat(path, formatAuto)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read include: %w", err)
+	}
+	if data, err = configYAML(data, format); err != nil {
+		return fmt.Errorf("include %s: %w", path, err)
+	}
+
+	var file includeFile
+	if err := decodeStrict(data, &file); err != nil {
+		return fmt.Errorf("failed to parse include %s: %w", path, err)
+	}
+	_, positions := configPositions(data, path, format)
+	config.addSource(path, data)
+	for name, query := range file.Queries {
+		if _, ok := config.Queries[name]; ok {
+			return fmt.Errorf("include %s: query %q is already defined", path, name)
+		}
+		if config.Queries == nil {
+			config.Queries = make(map[string]string)
+		}
+		config.Queries[name] = query
+	}
+	for name, tmpl := range file.Templates {
+		if _, ok := config.Templates[name]; ok {
+			return fmt.Errorf("include %s: template %q is already defined", path, name)
+		}
+		if config.Templates == nil {
+			config.Templates = make(map[string]MetricConfig)
+		}
+		config.Templates[name] = tmpl
+	}
+	config.Metrics = append(config.Metrics, file.Metrics...)
+	config.metricPositions = append(config.metricPositions, positions...)
+	return includeAll(config, filepath.Dir(path), file.Include, seen)
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// resolveQueryRefs replaces the query_ref of every metric with the query of
+// that name in the queries library.
+func resolveQueryRefs(config *Config) error {
+	for i := range config.Metrics {
+		metric := &config.Metrics[i]
+		if metric.QueryRef == "" {
+			continue
+		}
+		if metric.Query != "" {
+			return fmt.Errorf("metric %q: query and query_ref cannot be used together", metric.Name)
+		}
+		query, ok := config.Queries[metric.QueryRef]
+		if !ok {
+			return fmt.Errorf("metric %q: unknown query_ref %q", metric.Name, metric.QueryRef)
+		}
+		metric.Query = query
+	}
+	return nil
+}
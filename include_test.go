@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: ["shared/queries.yaml", "teams/*.yaml"]
+metrics:
+  - name: db.connections
+    query_ref: active_connections
+`,
+		"shared/queries.yaml": `queries:
+  active_connections: "SELECT count(*) FROM pg_stat_activity WHERE state = 'active'"
+`,
+		"teams/billing.yaml": `metrics:
+  - name: billing.invoices
+    query: "SELECT count(*) FROM invoices"
+`,
+		"teams/orders.yaml": `include: ["../shared/orders.yaml"]
+metrics:
+  - name: orders.connections
+    query_ref: active_connections
+    tags: ["team:orders"]
+`,
+		"shared/orders.yaml": `queries:
+  pending_orders: "SELECT count(*) FROM orders WHERE state = 'pending'"
+metrics:
+  - name: orders.pending
+    query_ref: pending_orders
+`,
+	})
+
+	config, err := loadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	var names []string
+	for _, metric := range config.Metrics {
+		names = append(names, metric.Name)
+		if metric.Query == "" {
+			t.Errorf("Metric %s has no query", metric.Name)
+		}
+	}
+	want := "db.connections,billing.invoices,orders.connections,orders.pending"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("Expected metrics %s, got %s", want, got)
+	}
+}
+
+func TestLoadConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "NoMatch",
+			files:   map[string]string{"config.yaml": "include: [\"missing/*.yaml\"]\nmetrics: []\n"},
+			wantErr: "matched no files",
+		},
+		{
+			name: "Cycle",
+			files: map[string]string{
+				"config.yaml": "include: [\"a.yaml\"]\nmetrics: []\n",
+				"a.yaml":      "include: [\"config.yaml\"]\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "UnknownKey",
+			files: map[string]string{
+				"config.yaml": "include: [\"a.yaml\"]\nmetrics: []\n",
+				"a.yaml":      "datadog:\n  site: datadoghq.eu\n",
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "DuplicateQuery",
+			files: map[string]string{
+				"config.yaml": "include: [\"a.yaml\"]\nqueries:\n  q: \"SELECT 1 FROM t\"\nmetrics: []\n",
+				"a.yaml":      "queries:\n  q: \"SELECT 2 FROM t\"\n",
+			},
+			wantErr: "already defined",
+		},
+		{
+			name:    "UnknownRef",
+			files:   map[string]string{"config.yaml": "metrics:\n  - name: a\n    query_ref: nope\n"},
+			wantErr: "unknown query_ref",
+		},
+		{
+			name:    "QueryAndRef",
+			files:   map[string]string{"config.yaml": "queries:\n  q: \"SELECT 1 FROM t\"\nmetrics:\n  - name: a\n    query: \"SELECT 2 FROM t\"\n    query_ref: q\n"},
+			wantErr: "cannot be used together",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			_, err := loadConfig(filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
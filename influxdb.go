@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultInfluxTokenEnv = "INFLUX_TOKEN"
+
+// InfluxDBConfig configures the influxdb sink, which writes line protocol to
+// the InfluxDB v2 write API.
+type InfluxDBConfig struct {
+	// URL is the InfluxDB base URL, e.g. "http://influxdb:8086".
+	URL    string `yaml:"url"`
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	// TokenEnv names the environment variable holding the API token
+	// (default INFLUX_TOKEN).
+	TokenEnv string `yaml:"token_env,omitempty"`
+}
+
+// InfluxDBSender buffers points as line protocol and writes them when the
+// collection cycle is flushed.
+type InfluxDBSender struct {
+	writeURL string
+	token    string
+
+	mu    sync.Mutex
+	lines bytes.Buffer
+}
+
+// newInfluxDBSink creates the influxdb sink from the `influxdb:` block.
+func newInfluxDBSink(_ context.Context, config *Config, _ *options) (MetricSender, error) {
+	cfg := config.InfluxDB
+	if cfg.URL == "" || cfg.Bucket == "" {
+		return nil, configError("influxdb sink requires url and bucket")
+	}
+	tokenEnv := cfg.TokenEnv
+	if tokenEnv == "" {
+		tokenEnv = defaultInfluxTokenEnv
+	}
+	token := os.Getenv(tokenEnv)
+	logRedactor.AddSecret(token)
+	return newInfluxDBSender(cfg, token), nil
+}
+
+// newInfluxDBSender creates a sender writing to the bucket in cfg.
+func newInfluxDBSender(cfg InfluxDBConfig, token string) *InfluxDBSender {
+	params := url.Values{}
+	params.Set("org", cfg.Org)
+	params.Set("bucket", cfg.Bucket)
+	params.Set("precision", "s")
+	return &InfluxDBSender{
+		writeURL: strings.TrimRight(cfg.URL, "/") + "/api/v2/write?" + params.Encode(),
+		token:    token,
+	}
+}
+
+// influxEscaper escapes measurement names, tag keys and tag values.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxLine formats one point as line protocol with a single "value" field.
+// Tags without a value are written as "key=true", since empty tag values are
+// not allowed.
+func influxLine(metricName string, value float64, tags []string, host string, ts time.Time) string {
+	var b strings.Builder
+	b.WriteString(influxEscaper.Replace(metricName))
+	for _, tag := range tags {
+		key, val, _ := strings.Cut(tag, ":")
+		if val == "" {
+			val = "true"
+		}
+		b.WriteString("," + influxEscaper.Replace(key) + "=" + influxEscaper.Replace(val))
+	}
+	if host != "" {
+		b.WriteString(",host=" + influxEscaper.Replace(host))
+	}
+	b.WriteString(" value=" + strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteString(" " + strconv.FormatInt(ts.Unix(), 10))
+	return b.String()
+}
+
+// SendMetric buffers one point until the next Flush.
+func (s *InfluxDBSender) SendMetric(_ context.Context, metricName string, value float64, tags []string, host string) error {
+	line := influxLine(metricName, value, tags, host, time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines.WriteString(line + "\n")
+	return nil
+}
+
+// Flush writes the buffered points in one request.
+func (s *InfluxDBSender) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	payload := bytes.Clone(s.lines.Bytes())
+	s.lines.Reset()
+	s.mu.Unlock()
+	if len(payload) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode, resp.Body)
+	}
+	expvarPayloadsSent.Add(1)
+	expvarBytesSent.Add(int64(len(payload)))
+	return nil
+}
+
+// Close writes any points still buffered.
+func (s *InfluxDBSender) Close(ctx context.Context) error {
+	return s.Flush(ctx)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		metric string
+		tags   []string
+		host   string
+		want   string
+	}{
+		{name: "Plain", metric: "db.users", want: "db.users value=42 1700000000"},
+		{name: "Tags and host", metric: "db.users", tags: []string{"env:prod", "canary"}, host: "db-01", want: "db.users,env=prod,canary=true,host=db-01 value=42 1700000000"},
+		{name: "Escaping", metric: "db users", tags: []string{"table:a,b=c"}, want: `db\ users,table=a\,b\=c value=42 1700000000`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := influxLine(tc.metric, 42, tc.tags, tc.host, ts); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInfluxDBSenderFlush(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "sql" || r.URL.Query().Get("org") != "sre" {
+			t.Errorf("Unexpected write URL %s", r.URL)
+		}
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Expected token authorization, got %q", r.Header.Get("Authorization"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender := newInfluxDBSender(InfluxDBConfig{URL: server.URL + "/", Org: "sre", Bucket: "sql"}, "secret")
+	ctx := context.Background()
+	for _, name := range []string{"db.users", "db.orders"} {
+		if err := sender.SendMetric(ctx, name, 1, nil, ""); err != nil {
+			t.Fatalf("SendMetric failed: %v", err)
+		}
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(body), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 lines in one write, got %q", body)
+	}
+}
+
+func TestInfluxDBSenderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"unauthorized access"}`))
+	}))
+	defer server.Close()
+
+	sender := newInfluxDBSender(InfluxDBConfig{URL: server.URL, Bucket: "sql"}, "")
+	if err := sender.SendMetric(context.Background(), "db.users", 1, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected 401 error, got %v", err)
+	}
+}
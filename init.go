@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// initProbeTimeout is the default -timeout of the init command, which bounds
+// the connection test only.
+const initProbeTimeout = 10 * time.Second
+
+// presetMetric is a metric of a built-in preset or suggested by discover.
+type presetMetric struct {
+	Name        string   `yaml:"name"`
+	Query       string   `yaml:"query"`
+	TagColumns  []string `yaml:"tag_columns,omitempty"`
+	Unit        string   `yaml:"unit,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	OnNull      string   `yaml:"on_null,omitempty"`
+	OnNoRows    string   `yaml:"on_no_rows,omitempty"`
+}
+
+// preset is a set of metrics offered by the init command.
+type preset struct {
+	Name        string
+	Description string
+	// Optional presets are offered disabled, as they need an extension or
+	// settings most databases do not have.
+	Optional bool
+	Metrics  []presetMetric
+}
+
+// presetTopN is the number of statements or tables reported by the top-N
+// presets.
+const presetTopN = 20
+
+// pgStatementsQuery returns the query of a top statements metric reporting
+// column. Statements are ranked by total execution time, and the rows of a
+// queryid run by several users are summed. The queryid is rendered in hex,
+// which turns negative ids into stable unsigned tags.
+func pgStatementsQuery(column string) string {
+	return fmt.Sprintf("WITH top AS (SELECT queryid, sum(calls) AS calls, sum(total_exec_time) AS total_time, sum(rows) AS rows"+
+		" FROM pg_stat_statements WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database()) AND queryid IS NOT NULL"+
+		" GROUP BY queryid ORDER BY total_time DESC LIMIT %d) SELECT %s, to_hex(queryid) AS queryid FROM top", presetTopN, column)
+}
+
+// The lock presets group the waiting sessions by the relation they wait
+// for, and skip the grouped metrics when nothing waits. Row lock waits are
+// on a transaction ID rather than a relation; they are reported under the
+// lock type.
+const (
+	pgLockRelation = "COALESCE(l.relation::regclass::text, l.locktype)"
+	pgLockWaits    = " FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid WHERE NOT l.granted AND a.datname = current_database() GROUP BY 2"
+
+	mysqlLockRelation = "COALESCE(CONCAT(l.OBJECT_SCHEMA, '.', l.OBJECT_NAME), 'unknown')"
+	mysqlLockWaits    = " FROM information_schema.innodb_trx t LEFT JOIN performance_schema.data_locks l ON l.ENGINE_TRANSACTION_ID = t.trx_id AND l.LOCK_STATUS = 'WAITING' WHERE t.trx_state = 'LOCK WAIT' GROUP BY relation"
+)
+
+// pgTablesQuery returns the query of a tables preset metric reporting column
+// for the largest tables, tagged with their schema and name.
+func pgTablesQuery(column string) string {
+	return fmt.Sprintf("WITH top AS (SELECT relid, schemaname, relname, n_dead_tup FROM pg_stat_user_tables ORDER BY pg_total_relation_size(relid) DESC LIMIT %d)"+
+		" SELECT %s, schemaname AS schema, relname AS \"table\" FROM top", presetTopN, column)
+}
+
+// pgVacuumQuery returns the query of a vacuum preset metric reporting column
+// for the tables with the most dead rows. Tables never autovacuumed have no
+// age and are skipped.
+func pgVacuumQuery(column string) string {
+	return fmt.Sprintf("WITH top AS (SELECT schemaname, relname, n_live_tup, n_dead_tup, last_autovacuum FROM pg_stat_user_tables ORDER BY n_dead_tup DESC LIMIT %d)"+
+		" SELECT %s, schemaname AS schema, relname AS \"table\" FROM top", presetTopN, column)
+}
+
+// mysqlTablesQuery is pgTablesQuery for MySQL, leaving out the system schemas.
+func mysqlTablesQuery(column string) string {
+	return fmt.Sprintf("SELECT %s, table_schema AS `schema`, table_name AS `table` FROM information_schema.tables"+
+		" WHERE table_type = 'BASE TABLE' AND table_schema NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')"+
+		" ORDER BY data_length + index_length DESC LIMIT %d", column, presetTopN)
+}
+
+// pgRecovery is the FROM clause of the replication presets, which return
+// the replica's own lag on a replica and the lag of every standby on a
+// primary. A primary without standbys has no rows and is skipped. An idle
+// replica that replayed all it received is not lagging, however old its
+// last replayed transaction is.
+const pgRecovery = "(SELECT pg_is_in_recovery() AS in_recovery) recovery"
+
+// presets lists the built-in presets of every supported database type.
+var presets = map[string][]preset{
+	"postgres": {
+		{
+			Name:        "connections",
+			Description: "Open and active connections",
+			Metrics: []presetMetric{
+				{Name: "sql.connections.total", Query: "SELECT count(*) FROM pg_stat_activity", Unit: "connection", Description: "Open connections"},
+				{Name: "sql.connections.active", Query: "SELECT count(*) FROM pg_stat_activity WHERE state = 'active'", Unit: "connection", Description: "Connections running a query"},
+			},
+		},
+		{
+			Name:        "size",
+			Description: "Size of the current database",
+			Metrics: []presetMetric{
+				{Name: "sql.database.size", Query: "SELECT pg_database_size(datname) FROM pg_database WHERE datname = current_database()", Unit: "byte", Description: "Size of the database"},
+			},
+		},
+		{
+			Name:        "transactions",
+			Description: "Deadlocks and the age of the longest running transaction",
+			Metrics: []presetMetric{
+				{Name: "sql.deadlocks", Query: "SELECT deadlocks FROM pg_stat_database WHERE datname = current_database()", Description: "Deadlocks since the statistics were reset"},
+				{Name: "sql.transactions.longest", Query: "SELECT COALESCE(EXTRACT(EPOCH FROM max(now() - xact_start)), 0) FROM pg_stat_activity WHERE state <> 'idle'", Unit: "second", Description: "Age of the longest running transaction"},
+			},
+		},
+		{
+			Name:        "locks",
+			Description: "Sessions blocked on locks and the longest lock wait, by relation",
+			Metrics: []presetMetric{
+				{Name: "sql.locks.blocked", Query: "SELECT count(*) FROM pg_stat_activity WHERE datname = current_database() AND wait_event_type = 'Lock'", Unit: "session", Description: "Sessions waiting on a lock"},
+				{Name: "sql.locks.blocked_by_relation", Query: "SELECT count(DISTINCT a.pid), " + pgLockRelation + " AS relation" + pgLockWaits, TagColumns: []string{"relation"}, Unit: "session", Description: "Sessions waiting on a lock of the relation", OnNoRows: emptySkip},
+				{Name: "sql.locks.wait_max", Query: "SELECT COALESCE(EXTRACT(EPOCH FROM max(now() - a.query_start)), 0), " + pgLockRelation + " AS relation" + pgLockWaits, TagColumns: []string{"relation"}, Unit: "second", Description: "Longest lock wait on the relation, from the start of the waiting statement", OnNoRows: emptySkip},
+			},
+		},
+		{
+			Name:        "replication",
+			Description: "Replication lag, from the replica or per standby of the primary",
+			Metrics: []presetMetric{
+				{Name: "sql.replication.is_replica", Query: "SELECT in_recovery::int FROM " + pgRecovery, Description: "1 on a replica, 0 on a primary"},
+				{Name: "sql.replication.lag", Query: "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END, 'replica' AS role, NULL AS standby FROM " + pgRecovery + " WHERE in_recovery" +
+					" UNION ALL SELECT COALESCE(EXTRACT(EPOCH FROM replay_lag), 0), 'primary' AS role, application_name AS standby FROM pg_stat_replication WHERE NOT pg_is_in_recovery()", TagColumns: []string{"role", "standby"}, Unit: "second", Description: "Time the replica is behind the primary", OnNoRows: emptySkip},
+				{Name: "sql.replication.lag_bytes", Query: "SELECT pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()), 'replica' AS role, NULL AS standby FROM " + pgRecovery + " WHERE in_recovery" +
+					" UNION ALL SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn), 'primary' AS role, application_name AS standby FROM pg_stat_replication WHERE NOT pg_is_in_recovery()", TagColumns: []string{"role", "standby"}, Unit: "byte", Description: "WAL the replica has yet to replay", OnNoRows: emptySkip},
+			},
+		},
+		{
+			Name:        "tables",
+			Description: "Size, index size and dead rows of the largest tables",
+			Metrics: []presetMetric{
+				{Name: "sql.table.total_size", Query: pgTablesQuery("pg_total_relation_size(relid)"), TagColumns: []string{"schema", "table"}, Unit: "byte", Description: "Size of the table including indexes and TOAST"},
+				{Name: "sql.table.index_size", Query: pgTablesQuery("pg_indexes_size(relid)"), TagColumns: []string{"schema", "table"}, Unit: "byte", Description: "Size of the indexes of the table"},
+				{Name: "sql.table.dead_tuples", Query: pgTablesQuery("n_dead_tup"), TagColumns: []string{"schema", "table"}, Unit: "row", Description: "Estimated dead rows of the table"},
+			},
+		},
+		{
+			Name:        "vacuum",
+			Description: "Autovacuum age and dead row ratio of the tables with the most dead rows, and running vacuums",
+			Metrics: []presetMetric{
+				{Name: "sql.vacuum.last_autovacuum_age", Query: pgVacuumQuery("EXTRACT(EPOCH FROM now() - last_autovacuum)"), TagColumns: []string{"schema", "table"}, Unit: "second", Description: "Time since the table was last autovacuumed", OnNull: emptySkip},
+				{Name: "sql.vacuum.dead_tuple_ratio", Query: pgVacuumQuery("COALESCE(n_dead_tup::float / NULLIF(n_live_tup + n_dead_tup, 0), 0)"), TagColumns: []string{"schema", "table"}, Unit: "fraction", Description: "Share of dead rows in the table"},
+				{Name: "sql.vacuum.running", Query: "SELECT count(*) FROM pg_stat_progress_vacuum WHERE datname = current_database()", Description: "Vacuums running in the database"},
+				{Name: "sql.vacuum.progress", Query: "SELECT COALESCE(p.heap_blks_vacuumed::float / NULLIF(p.heap_blks_total, 0), 0), n.nspname AS schema, c.relname AS \"table\", p.phase" +
+					" FROM pg_stat_progress_vacuum p JOIN pg_class c ON c.oid = p.relid JOIN pg_namespace n ON n.oid = c.relnamespace WHERE p.datname = current_database()",
+					TagColumns: []string{"schema", "table", "phase"}, Unit: "fraction", Description: "Share of the heap a running vacuum has vacuumed", OnNoRows: emptySkip},
+			},
+		},
+		{
+			Name:        "statements",
+			Description: "Calls, time and rows of the top statements (needs pg_stat_statements, PostgreSQL 13+)",
+			Optional:    true,
+			Metrics: []presetMetric{
+				{Name: "sql.statements.calls", Query: pgStatementsQuery("calls"), TagColumns: []string{"queryid"}, Unit: "execution", Description: "Executions of the statement since the statistics were reset"},
+				{Name: "sql.statements.total_time", Query: pgStatementsQuery("total_time"), TagColumns: []string{"queryid"}, Unit: "millisecond", Description: "Total execution time of the statement since the statistics were reset"},
+				{Name: "sql.statements.rows", Query: pgStatementsQuery("rows"), TagColumns: []string{"queryid"}, Unit: "row", Description: "Rows returned or affected by the statement since the statistics were reset"},
+			},
+		},
+	},
+	"mysql": {
+		{
+			Name:        "connections",
+			Description: "Open and running connections",
+			Metrics: []presetMetric{
+				{Name: "sql.connections.total", Query: "SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME = 'Threads_connected'", Unit: "connection", Description: "Open connections"},
+				{Name: "sql.connections.active", Query: "SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME = 'Threads_running'", Unit: "connection", Description: "Connections running a query"},
+			},
+		},
+		{
+			Name:        "size",
+			Description: "Size of the current schema",
+			Metrics: []presetMetric{
+				{Name: "sql.database.size", Query: "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()", Unit: "byte", Description: "Size of the schema"},
+			},
+		},
+		{
+			Name:        "locks",
+			Description: "Transactions waiting on locks and the longest lock wait, by table (MySQL 8.0+)",
+			Metrics: []presetMetric{
+				{Name: "sql.locks.blocked", Query: "SELECT COUNT(*) FROM information_schema.innodb_trx WHERE trx_state = 'LOCK WAIT'", Unit: "transaction", Description: "Transactions waiting on a lock"},
+				{Name: "sql.locks.blocked_by_relation", Query: "SELECT COUNT(DISTINCT t.trx_id), " + mysqlLockRelation + " AS relation" + mysqlLockWaits, TagColumns: []string{"relation"}, Unit: "transaction", Description: "Transactions waiting on a lock of the table", OnNoRows: emptySkip},
+				{Name: "sql.locks.wait_max", Query: "SELECT MAX(TIMESTAMPDIFF(SECOND, t.trx_wait_started, NOW())), " + mysqlLockRelation + " AS relation" + mysqlLockWaits, TagColumns: []string{"relation"}, Unit: "second", Description: "Longest lock wait on the table", OnNoRows: emptySkip},
+			},
+		},
+		{
+			Name:        "replication",
+			Description: "Replication lag per channel of a replica (MySQL 8.0+)",
+			Metrics: []presetMetric{
+				{Name: "sql.replication.is_replica", Query: "SELECT COUNT(*) > 0 FROM performance_schema.replication_connection_configuration", Description: "1 on a replica, 0 on a primary"},
+				{Name: "sql.replication.lag", Query: "SELECT COALESCE(MAX(CASE WHEN APPLYING_TRANSACTION <> '' THEN TIMESTAMPDIFF(MICROSECOND, APPLYING_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP, NOW(6)) END) / 1000000, 0), 'replica' AS role, NULLIF(CHANNEL_NAME, '') AS channel" +
+					" FROM performance_schema.replication_applier_status_by_worker GROUP BY CHANNEL_NAME", TagColumns: []string{"role", "channel"}, Unit: "second", Description: "Age of the oldest transaction the replica is applying", OnNoRows: emptySkip},
+			},
+		},
+		{
+			Name:        "tables",
+			Description: "Size and index size of the largest tables",
+			Metrics: []presetMetric{
+				{Name: "sql.table.total_size", Query: mysqlTablesQuery("data_length + index_length"), TagColumns: []string{"schema", "table"}, Unit: "byte", Description: "Size of the table including indexes"},
+				{Name: "sql.table.index_size", Query: mysqlTablesQuery("index_length"), TagColumns: []string{"schema", "table"}, Unit: "byte", Description: "Size of the indexes of the table"},
+			},
+		},
+		{
+			Name:        "queries",
+			Description: "Slow queries",
+			Metrics: []presetMetric{
+				{Name: "sql.queries.slow", Query: "SELECT VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME = 'Slow_queries'", Unit: "query", Description: "Queries slower than long_query_time since startup"},
+			},
+		},
+	},
+}
+
+// initConfig is the starter configuration written by the init command.
+type initConfig struct {
+	DatabaseURLEnv string         `yaml:"database_url_env,omitempty"`
+	Features       Features       `yaml:"features,omitempty"`
+	Metrics        []presetMetric `yaml:"metrics"`
+}
+
+// initWizard asks the questions of the init command. probe checks that a
+// DSN is reachable.
+type initWizard struct {
+	in    *bufio.Reader
+	out   io.Writer
+	probe func(ctx context.Context, dbType, dsn string) error
+}
+
+// ask prints question and returns the answer, or def when it is empty.
+func (w *initWizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// confirm asks a yes/no question.
+func (w *initWizard) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := w.ask(question+" ("+hint+")", "")
+	if err != nil || answer == "" {
+		return def, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+// run asks for the database, probes it and builds the configuration from
+// the chosen presets. It also returns the database type.
+func (w *initWizard) run(ctx context.Context) (*initConfig, string, error) {
+	dbType, err := w.ask("Database type (postgres or mysql)", databaseType())
+	if err != nil {
+		return nil, "", err
+	}
+	if _, ok := presets[dbType]; !ok {
+		return nil, "", fmt.Errorf("unsupported database type %q (must be postgres or mysql)", dbType)
+	}
+	urlEnv, err := w.ask("Environment variable holding the DSN", defaultDatabaseURLEnv)
+	if err != nil {
+		return nil, "", err
+	}
+	dsn, err := w.ask("DSN to test the connection with (not written to the file)", os.Getenv(urlEnv))
+	if err != nil {
+		return nil, "", err
+	}
+	logRedactor.AddDSN(dsn)
+
+	if dsn != "" {
+		if err := w.probe(ctx, dbType, dsn); err != nil {
+			fmt.Fprintf(w.out, "Connection failed: %s\n", logRedactor.RedactString(err.Error()))
+			ok, err := w.confirm("Write the configuration anyway?", false)
+			if err != nil {
+				return nil, "", err
+			}
+			if !ok {
+				return nil, "", errors.New("aborted")
+			}
+		} else {
+			fmt.Fprintln(w.out, "Connection OK")
+		}
+	}
+
+	config := &initConfig{}
+	if urlEnv != defaultDatabaseURLEnv {
+		config.DatabaseURLEnv = urlEnv
+	}
+	for _, p := range presets[dbType] {
+		ok, err := w.confirm(fmt.Sprintf("Enable %s preset: %s?", p.Name, p.Description), !p.Optional)
+		if err != nil {
+			return nil, "", err
+		}
+		if ok {
+			config.Metrics = append(config.Metrics, p.Metrics...)
+		}
+	}
+	for _, metric := range config.Metrics {
+		if compoundQuery(metric.Query) {
+			config.Features = Features{featureQueryParser: true}
+			break
+		}
+	}
+	return config, dbType, nil
+}
+
+// probeDB opens a connection to dsn and pings it.
+func probeDB(ctx context.Context, dbType, dsn string) error {
+	if err := validateDBURL(dbType, dsn); err != nil {
+		return err
+	}
+	db, err := sql.Open(dbType, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to initialize DB connection: %w", err)
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	return nil
+}
+
+// writeInitConfig writes config to path. An existing file is only replaced
+// with force.
+func writeInitConfig(path string, config *initConfig, force bool) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to overwrite it)", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runInit interactively writes a starter configuration.
+func runInit(ctx context.Context, opts *options, _ []string) error {
+	wizard := &initWizard{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+		probe: func(ctx context.Context, dbType, dsn string) error {
+			ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+			defer cancel()
+			return probeDB(ctx, dbType, dsn)
+		},
+	}
+	return initConfigFile(ctx, wizard, opts.configFile, opts.force)
+}
+
+// initConfigFile runs the wizard and writes its configuration to path.
+func initConfigFile(ctx context.Context, wizard *initWizard, path string, force bool) error {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return withExitCode(exitConfigInvalid, fmt.Errorf("%s already exists (use -force to overwrite it)", path))
+		}
+	}
+	config, dbType, err := wizard.run(ctx)
+	if err != nil {
+		return err
+	}
+	if err := writeInitConfig(path, config, force); err != nil {
+		return err
+	}
+
+	urlEnv := config.DatabaseURLEnv
+	if urlEnv == "" {
+		urlEnv = defaultDatabaseURLEnv
+	}
+	fmt.Fprintf(wizard.out, "\nWrote %s with %d metrics. Next steps:\n", path, len(config.Metrics))
+	if dbType != "postgres" {
+		fmt.Fprintf(wizard.out, "  export DATABASE_TYPE=%s\n", dbType)
+	}
+	fmt.Fprintf(wizard.out, "  export %s=<dsn> DATADOG_API_KEY=<key>\n", urlEnv)
+	fmt.Fprintf(wizard.out, "  %s test -config %s\n", programName, path)
+	return nil
+}
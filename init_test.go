@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitConfigFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		probeErr    error
+		wantMetrics []string
+		wantURLEnv  string
+		wantParser  bool
+		wantErr     string
+	}{
+		{
+			name:  "Defaults",
+			input: "\n\npostgres://u:p@localhost/db\n\n\n\n",
+			wantMetrics: []string{
+				"sql.connections.total", "sql.connections.active", "sql.database.size", "sql.deadlocks", "sql.transactions.longest",
+				"sql.locks.blocked", "sql.locks.blocked_by_relation", "sql.locks.wait_max",
+				"sql.replication.is_replica", "sql.replication.lag", "sql.replication.lag_bytes",
+				"sql.table.total_size", "sql.table.index_size", "sql.table.dead_tuples",
+				"sql.vacuum.last_autovacuum_age", "sql.vacuum.dead_tuple_ratio", "sql.vacuum.running", "sql.vacuum.progress",
+			},
+			wantParser: true,
+		},
+		{
+			name:        "OptionalPreset",
+			input:       "\n\n\nn\nn\nn\nn\nn\nn\nn\ny\n",
+			wantMetrics: []string{"sql.statements.calls", "sql.statements.total_time", "sql.statements.rows"},
+			wantParser:  true,
+		},
+		{
+			name:        "MySQLSomePresets",
+			input:       "mysql\nMYSQL_DSN\n\nn\ny\nn\nn\nn\nno\n",
+			wantMetrics: []string{"sql.database.size"},
+			wantURLEnv:  "MYSQL_DSN",
+		},
+		{
+			name:     "ProbeFailedAborted",
+			input:    "\n\npostgres://u:p@localhost/db\n\n",
+			probeErr: errors.New("connection refused"),
+			wantErr:  "aborted",
+		},
+		{
+			name:        "ProbeFailedContinued",
+			input:       "\n\npostgres://u:p@localhost/db\ny\nn\ny\nn\nn\nn\nn\nn\n",
+			probeErr:    errors.New("connection refused"),
+			wantMetrics: []string{"sql.database.size"},
+		},
+		{
+			name:    "UnsupportedType",
+			input:   "oracle\n",
+			wantErr: "unsupported database type",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DATABASE_TYPE", "")
+			t.Setenv("DATABASE_URL", "")
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			var out bytes.Buffer
+			wizard := &initWizard{
+				in:    bufio.NewReader(strings.NewReader(tc.input)),
+				out:   &out,
+				probe: func(context.Context, string, string) error { return tc.probeErr },
+			}
+			err := initConfigFile(context.Background(), wizard, path, false)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := loadConfig(path)
+			if err != nil {
+				t.Fatalf("Expected the written config to load, got %v", err)
+			}
+			var names []string
+			for _, metric := range config.Metrics {
+				names = append(names, metric.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tc.wantMetrics, ",") {
+				t.Errorf("Expected metrics %v, got %v", tc.wantMetrics, names)
+			}
+			if got := config.Features.Enabled(featureQueryParser); got != tc.wantParser {
+				t.Errorf("Expected query_parser %v, got %v", tc.wantParser, got)
+			}
+			if config.DatabaseURLEnv != tc.wantURLEnv {
+				t.Errorf("Expected database_url_env %q, got %q", tc.wantURLEnv, config.DatabaseURLEnv)
+			}
+		})
+	}
+}
+
+func TestInitConfigFileExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("metrics: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wizard := &initWizard{in: bufio.NewReader(strings.NewReader("")), out: &bytes.Buffer{}}
+	err := initConfigFile(context.Background(), wizard, path, false)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected already exists error, got %v", err)
+	}
+}
+
+func TestPresetQueriesValid(t *testing.T) {
+	for dbType, list := range presets {
+		for _, p := range list {
+			for _, metric := range p.Metrics {
+				if err := validateQueryColumns(metric.Query, 1+len(metric.TagColumns)); err != nil {
+					t.Errorf("Expected valid query for %s preset %s metric %s, got %v", dbType, p.Name, metric.Name, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package plugin runs the external binaries behind the exec source and sink.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxStderr bounds the plugin output quoted in errors.
+const maxStderr = 512
+
+// Run starts command with input on stdin and returns its stdout. env is
+// added to the environment of the process as "KEY=value" entries. The
+// process is killed when ctx is done; a non-zero exit status is an error
+// quoting the beginning of stderr.
+func Run(ctx context.Context, command []string, env []string, input []byte) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("plugin command is empty")
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		detail := strings.TrimSpace(stderr.String())
+		if len(detail) > maxStderr {
+			detail = detail[:maxStderr] + "..."
+		}
+		if detail != "" {
+			return nil, fmt.Errorf("plugin %s failed: %w: %s", command[0], err, detail)
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w", command[0], err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaConfig configures the kafka sink, which publishes every point as a
+// JSON message keyed by metric name.
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+}
+
+// kafkaWriter is the subset of *kafka.Writer used by the sink.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaPoint is the JSON message published for every point.
+type KafkaPoint struct {
+	Metric    string   `json:"metric"`
+	Value     float64  `json:"value"`
+	Tags      []string `json:"tags,omitempty"`
+	Host      string   `json:"host,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// KafkaSender buffers points as messages and publishes them in one batch
+// when the collection cycle is flushed.
+type KafkaSender struct {
+	writer kafkaWriter
+
+	mu      sync.Mutex
+	pending []kafka.Message
+}
+
+// newKafkaSink creates the kafka sink from the `kafka:` block. Messages with
+// the same key (metric name) always go to the same partition.
+func newKafkaSink(_ context.Context, config *Config, _ *options) (MetricSender, error) {
+	cfg := config.Kafka
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, configError("kafka sink requires brokers and a topic")
+	}
+	return &KafkaSender{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Topic:                  cfg.Topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: false,
+	}}, nil
+}
+
+// SendMetric buffers one point until the next Flush.
+func (k *KafkaSender) SendMetric(_ context.Context, metricName string, value float64, tags []string, host string) error {
+	now := time.Now()
+	payload, err := json.Marshal(KafkaPoint{
+		Metric:    metricName,
+		Value:     value,
+		Tags:      tags,
+		Host:      host,
+		Timestamp: now.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.pending = append(k.pending, kafka.Message{Key: []byte(metricName), Value: payload, Time: now})
+	return nil
+}
+
+// Flush publishes the buffered messages.
+func (k *KafkaSender) Flush(ctx context.Context) error {
+	k.mu.Lock()
+	pending := k.pending
+	k.pending = nil
+	k.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := k.writer.WriteMessages(ctx, pending...); err != nil {
+		return fmt.Errorf("failed to publish %d messages to Kafka: %w", len(pending), err)
+	}
+	expvarPayloadsSent.Add(1)
+	return nil
+}
+
+// Close publishes any messages still buffered and closes the writer.
+func (k *KafkaSender) Close(ctx context.Context) error {
+	flushErr := k.Flush(ctx)
+	if err := k.writer.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
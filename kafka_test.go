@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeKafkaWriter struct {
+	batches [][]kafka.Message
+	err     error
+	closed  bool
+}
+
+func (f *fakeKafkaWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.batches = append(f.batches, msgs)
+	return f.err
+}
+
+func (f *fakeKafkaWriter) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestKafkaSender(t *testing.T) {
+	writer := &fakeKafkaWriter{}
+	sender := &KafkaSender{writer: writer}
+	ctx := context.Background()
+
+	if err := sender.SendMetric(ctx, "db.users", 42, []string{"env:prod"}, "db-01"); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.SendMetric(ctx, "db.orders", 7, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if len(writer.batches) != 1 || len(writer.batches[0]) != 2 {
+		t.Fatalf("Expected one batch of 2 messages, got %v", writer.batches)
+	}
+	if !writer.closed {
+		t.Error("Expected the writer to be closed")
+	}
+	msg := writer.batches[0][0]
+	if string(msg.Key) != "db.users" {
+		t.Errorf("Expected metric name as key, got %q", msg.Key)
+	}
+	var point KafkaPoint
+	if err := json.Unmarshal(msg.Value, &point); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if point.Metric != "db.users" || point.Value != 42 || point.Host != "db-01" || len(point.Tags) != 1 || point.Timestamp == 0 {
+		t.Errorf("Unexpected message %+v", point)
+	}
+}
+
+func TestKafkaSenderFlushError(t *testing.T) {
+	writer := &fakeKafkaWriter{err: errors.New("leader not available")}
+	sender := &KafkaSender{writer: writer}
+	if err := sender.SendMetric(context.Background(), "db.users", 1, nil, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.Flush(context.Background()); err == nil {
+		t.Error("Expected publish error")
+	}
+	if err := sender.Flush(context.Background()); err != nil || len(writer.batches) != 1 {
+		t.Errorf("Expected failed messages not to be retried by the next flush, got %d batches, err %v", len(writer.batches), err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+)
+
+// LeaderElectionConfig lets several daemon replicas run for availability
+// while only one of them collects. The leader holds a database advisory lock
+// on a dedicated connection; when it stops or loses the connection, the lock
+// is released and a standby takes over at its next cycle.
+type LeaderElectionConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// LockName identifies the lock; replicas sharing it elect one leader
+	// (default datadog-sql-metrics).
+	LockName string `yaml:"lock_name,omitempty"`
+}
+
+// Leadership states.
+const (
+	leaderActive  = "leader"
+	leaderStandby = "standby"
+)
+
+// leaderElector takes and keeps the leader lock. A nil *leaderElector is
+// always the leader.
+type leaderElector struct {
+	db     *sql.DB
+	dbType string
+	name   string
+	conn   *sql.Conn
+	state  string
+}
+
+// newLeaderElector returns an elector for config, or nil when leader
+// election is disabled or there is no database to lock.
+func newLeaderElector(config LeaderElectionConfig, db *sql.DB, dbType string) *leaderElector {
+	if !config.Enabled || db == nil {
+		return nil
+	}
+	name := config.LockName
+	if name == "" {
+		name = programName
+	}
+	return &leaderElector{db: db, dbType: dbType, name: name}
+}
+
+// lockQueries returns the statements taking and releasing the lock. MySQL
+// locks are named; PostgreSQL advisory locks take a bigint, derived from the
+// name by hashing.
+func (l *leaderElector) lockQueries() (lock, unlock string, arg interface{}) {
+	if l.dbType == "mysql" {
+		return "SELECT GET_LOCK(?, 0)", "SELECT RELEASE_LOCK(?)", l.name
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(l.name))
+	return "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", int64(h.Sum64())
+}
+
+// Acquire reports whether this instance is the leader for the next cycle.
+// The leader checks that its lock connection is still alive; a standby
+// tries to take the lock without waiting.
+func (l *leaderElector) Acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true
+		}
+		// The session holding the lock is gone, and the lock with it.
+		_ = l.conn.Close()
+		l.conn = nil
+		logEvent(ctx, "warn", "Lost the leader lock connection", map[string]interface{}{"lock": l.name})
+	}
+
+	held := false
+	if conn, err := l.db.Conn(ctx); err != nil {
+		logEvent(ctx, "warn", "Failed to connect for leader election", map[string]interface{}{"error": logRedactor.RedactString(err.Error())})
+	} else {
+		lock, _, arg := l.lockQueries()
+		var ok sql.NullBool
+		if err := conn.QueryRowContext(ctx, lock, arg).Scan(&ok); err != nil {
+			logEvent(ctx, "warn", "Failed to take the leader lock", map[string]interface{}{"error": logRedactor.RedactString(err.Error())})
+		}
+		if held = ok.Valid && ok.Bool; held {
+			l.conn = conn
+		} else {
+			_ = conn.Close()
+		}
+	}
+	l.setState(ctx, held)
+	return held
+}
+
+// setState logs changes of leadership.
+func (l *leaderElector) setState(ctx context.Context, leader bool) {
+	state := leaderStandby
+	if leader {
+		state = leaderActive
+	}
+	if state == l.state {
+		return
+	}
+	l.state = state
+	msg := "Standing by - another instance holds the leader lock"
+	if leader {
+		msg = "Became the leader - collecting metrics"
+	}
+	logEvent(ctx, "info", msg, map[string]interface{}{"lock": l.name})
+}
+
+// Release gives up the lock, so a standby takes over without waiting for
+// the connection to time out.
+func (l *leaderElector) Release(ctx context.Context) {
+	if l == nil || l.conn == nil {
+		return
+	}
+	_, unlock, arg := l.lockQueries()
+	var released sql.NullBool
+	if err := l.conn.QueryRowContext(ctx, unlock, arg).Scan(&released); err != nil {
+		logEvent(ctx, "warn", "Failed to release the leader lock", map[string]interface{}{"error": logRedactor.RedactString(err.Error())})
+	}
+	_ = l.conn.Close()
+	l.conn = nil
+}
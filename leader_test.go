@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestNewLeaderElector(t *testing.T) {
+	db := &sql.DB{}
+	tests := []struct {
+		name     string
+		config   LeaderElectionConfig
+		db       *sql.DB
+		wantNil  bool
+		wantName string
+	}{
+		{name: "Disabled", config: LeaderElectionConfig{}, db: db, wantNil: true},
+		{name: "NoDatabase", config: LeaderElectionConfig{Enabled: true}, wantNil: true},
+		{name: "DefaultName", config: LeaderElectionConfig{Enabled: true}, db: db, wantName: programName},
+		{name: "LockName", config: LeaderElectionConfig{Enabled: true, LockName: "orders-collector"}, db: db, wantName: "orders-collector"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := newLeaderElector(tc.config, tc.db, "postgres")
+			if tc.wantNil {
+				if got != nil {
+					t.Errorf("Expected no elector, got %+v", got)
+				}
+				return
+			}
+			if got == nil || got.name != tc.wantName {
+				t.Errorf("Expected lock %q, got %+v", tc.wantName, got)
+			}
+		})
+	}
+}
+
+func TestLeaderLockQueries(t *testing.T) {
+	lock, unlock, arg := (&leaderElector{dbType: "mysql", name: "collector"}).lockQueries()
+	if lock != "SELECT GET_LOCK(?, 0)" || unlock != "SELECT RELEASE_LOCK(?)" || arg != "collector" {
+		t.Errorf("Unexpected MySQL lock queries: %s, %s, %v", lock, unlock, arg)
+	}
+
+	pg := &leaderElector{dbType: "postgres", name: "collector"}
+	lock, unlock, arg = pg.lockQueries()
+	if lock != "SELECT pg_try_advisory_lock($1)" || unlock != "SELECT pg_advisory_unlock($1)" {
+		t.Errorf("Unexpected PostgreSQL lock queries: %s, %s", lock, unlock)
+	}
+	if _, _, again := pg.lockQueries(); again != arg {
+		t.Errorf("Expected a stable lock key, got %v and %v", arg, again)
+	}
+	if _, _, other := (&leaderElector{dbType: "postgres", name: "other"}).lockQueries(); other == arg {
+		t.Errorf("Expected distinct lock keys per name, got %v", other)
+	}
+}
+
+func TestNilLeaderElector(t *testing.T) {
+	var l *leaderElector
+	if !l.Acquire(context.Background()) {
+		t.Error("Expected a nil elector to always lead")
+	}
+	l.Release(context.Background())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// LevelFatal is used for errors that terminate the process.
+const LevelFatal = slog.Level(12)
+
+// logger is the process-wide structured logger. It is replaced by setupLogger
+// once command line flags have been parsed.
+var logger = newLogger(os.Stderr, slog.LevelInfo, "json")
+
+// parseLogLevel converts a level name (debug, info, warn, error, fatal) to a slog level.
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level >= LevelFatal:
+		return "fatal"
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warn"
+	case level >= slog.LevelInfo:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// newLogger creates a logger writing to w in the given format ("json" or "text").
+// Attribute names match the historical log format: timestamp, level, message, data.
+// Every entry also carries the run_id of the process.
+func newLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.String("timestamp", a.Value.Time().Format(time.RFC3339))
+			case slog.LevelKey:
+				lvl, _ := a.Value.Any().(slog.Level)
+				return slog.String(slog.LevelKey, levelName(lvl))
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		},
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if format == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(handler).With(slog.String("run_id", runID))
+}
+
+// setupLogger configures the global logger from command line options. output
+// is "stdout", "stderr" or a file path that logs are appended to. The returned
+// function closes the log file, if any.
+func setupLogger(level, format, output string) (func() error, error) {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	if format != "json" && format != "text" {
+		return nil, fmt.Errorf("unknown log format %q (must be json or text)", format)
+	}
+
+	closeFn := func() error { return nil }
+	var w io.Writer
+	switch output {
+	case "stderr", "":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w = f
+		closeFn = f.Close
+	}
+
+	logger = newLogger(w, lvl, format)
+	return closeFn, nil
+}
+
+// loggedError is an error that logFatal already wrote to the log.
+type loggedError struct{ err error }
+
+func (e *loggedError) Error() string { return e.err.Error() }
+func (e *loggedError) Unwrap() error { return e.err }
+
+// logFatal logs the error that terminates the process.
+func logFatal(err error) {
+	logEvent(context.Background(), "fatal", "Execution error", map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// logEvent emits a log entry at the given level. Message and data are passed
+// through the redactor before they are written.
+func logEvent(ctx context.Context, level, message string, data interface{}) {
+	lvl, err := parseLogLevel(level)
+	if err != nil {
+		lvl = slog.LevelInfo
+	}
+	if !logger.Enabled(ctx, lvl) {
+		return
+	}
+
+	attrs := []slog.Attr{}
+	if data != nil {
+		attrs = append(attrs, slog.Any("data", logRedactor.Redact(data)))
+	}
+	logger.LogAttrs(ctx, lvl, logRedactor.RedactString(message), attrs...)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	datadogLogsIntakeURL = "https://http-intake.logs.datadoghq.com"
+	datadogLogsPath      = "/api/v2/logs"
+	// maxLogsPerPayload is the number of logs the intake accepts per request.
+	maxLogsPerPayload = 1000
+)
+
+// defaultLogsSource is the ddsource of forwarded rows without a source.
+const defaultLogsSource = "sqlmetrics"
+
+// LogsConfig sets the attributes of the logs forwarded by a metric in logs
+// mode.
+type LogsConfig struct {
+	Service string `yaml:"service,omitempty"`
+	// Source is the ddsource, which selects the log pipeline (default
+	// sqlmetrics).
+	Source string `yaml:"source,omitempty"`
+	// MessageColumn names the column holding the log message (default
+	// message). Rows without it are logged with the metric name as message.
+	MessageColumn string `yaml:"message_column,omitempty"`
+}
+
+// LogEntry is a log as accepted by the Datadog logs intake: the reserved
+// attributes (message, ddsource, service, ddtags, hostname) and any others.
+type LogEntry map[string]interface{}
+
+// LogSender is implemented by senders that can forward logs.
+type LogSender interface {
+	SendLogs(ctx context.Context, logs []LogEntry) error
+}
+
+// logEntries builds a log per row of metric. The columns become attributes;
+// the configured service, tags and host replace columns of the same name.
+func logEntries(metric MetricConfig, records []map[string]interface{}, tags []string) []LogEntry {
+	config := metric.Logs
+	messageColumn := config.MessageColumn
+	if messageColumn == "" {
+		messageColumn = "message"
+	}
+	source := config.Source
+	if source == "" {
+		source = defaultLogsSource
+	}
+
+	entries := make([]LogEntry, 0, len(records))
+	for _, record := range records {
+		entry := make(LogEntry, len(record)+5)
+		for column, value := range record {
+			entry[column] = value
+		}
+		entry["message"] = metric.Name
+		if message, ok := recordColumn(record, messageColumn); ok && message != nil {
+			entry["message"] = fmt.Sprint(message)
+		}
+		entry["ddsource"] = source
+		if config.Service != "" {
+			entry["service"] = config.Service
+		}
+		if len(tags) > 0 {
+			entry["ddtags"] = strings.Join(tags, ",")
+		}
+		if host := recordHost(metric, record); host != "" {
+			entry["hostname"] = host
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// forwardLogs sends the rows of a metric in logs mode.
+func (c *Collector) forwardLogs(ctx context.Context, telemetry *Telemetry, metric MetricConfig, records []map[string]interface{}) error {
+	sender, ok := c.senderFor(metric).(LogSender)
+	if !ok {
+		return errRecordsUnsupported
+	}
+	entries := logEntries(metric, records, c.seriesTags(ctx, metric, nil))
+	return c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+		return sender.SendLogs(ctx, entries)
+	})
+}
+
+// logsURL returns the logs intake of the client's site. A base URL other
+// than an API host of a site, e.g. a mock server, receives the logs itself.
+func (d *DatadogClient) logsURL() string {
+	base := strings.TrimRight(d.BaseURL, "/")
+	switch {
+	case base == "":
+		base = datadogLogsIntakeURL
+	case strings.HasPrefix(base, "https://api."):
+		base = "https://http-intake.logs." + strings.TrimPrefix(base, "https://api.")
+	}
+	return base + datadogLogsPath
+}
+
+// SendLogs forwards logs to the Datadog logs intake, in requests of at most
+// 1000 logs.
+func (d *DatadogClient) SendLogs(ctx context.Context, logs []LogEntry) error {
+	if d.Debug {
+		logEvent(ctx, "debug", "Sending logs to Datadog", map[string]interface{}{
+			"logs": len(logs),
+			"url":  d.logsURL(),
+		})
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping actual log submission", map[string]interface{}{
+			"logs": len(logs),
+		})
+		return nil
+	}
+	for start := 0; start < len(logs); start += maxLogsPerPayload {
+		payload, err := json.Marshal(logs[start:min(start+maxLogsPerPayload, len(logs))])
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		if _, err := d.submit(ctx, d.logsURL(), payload); err != nil {
+			return fmt.Errorf("failed to send logs: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// logRecorder is a sender that records forwarded logs.
+type logRecorder struct {
+	MockMetricSender
+	Logs []LogEntry
+}
+
+func (l *logRecorder) SendLogs(_ context.Context, logs []LogEntry) error {
+	l.Logs = append(l.Logs, logs...)
+	return nil
+}
+
+func TestLogEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric MetricConfig
+		record map[string]interface{}
+		tags   []string
+		want   LogEntry
+	}{
+		{
+			name:   "Defaults",
+			metric: MetricConfig{Name: "jobs.failed"},
+			record: map[string]interface{}{"id": int64(7)},
+			want:   LogEntry{"id": int64(7), "message": "jobs.failed", "ddsource": "sqlmetrics"},
+		},
+		{
+			name:   "MessageColumn",
+			metric: MetricConfig{Name: "jobs.failed", Host: "db-1", Logs: LogsConfig{Service: "billing", Source: "postgres", MessageColumn: "error"}},
+			record: map[string]interface{}{"error": "timeout", "service": "other"},
+			tags:   []string{"env:prod", "team:sre"},
+			want: LogEntry{
+				"error": "timeout", "message": "timeout", "ddsource": "postgres", "service": "billing",
+				"ddtags": "env:prod,team:sre", "hostname": "db-1",
+			},
+		},
+		{
+			name:   "HostColumn",
+			metric: MetricConfig{Name: "jobs.failed", Host: "db-1", HostColumn: "server"},
+			record: map[string]interface{}{"Server": "web-3"},
+			want:   LogEntry{"Server": "web-3", "message": "jobs.failed", "ddsource": "sqlmetrics", "hostname": "web-3"},
+		},
+		{
+			name:   "MixedCaseColumns",
+			metric: MetricConfig{Name: "jobs.failed", Host: "db-1", HostColumn: "worker_host", Logs: LogsConfig{MessageColumn: "error_message"}},
+			record: map[string]interface{}{"ERROR_MESSAGE": "timeout", "Worker_Host": "web-2"},
+			want: LogEntry{
+				"ERROR_MESSAGE": "timeout", "Worker_Host": "web-2", "message": "timeout", "ddsource": "sqlmetrics", "hostname": "web-2",
+			},
+		},
+		{
+			name:   "NullMessage",
+			metric: MetricConfig{Name: "jobs.failed"},
+			record: map[string]interface{}{"message": nil},
+			want:   LogEntry{"message": "jobs.failed", "ddsource": "sqlmetrics"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := logEntries(tc.metric, []map[string]interface{}{tc.record}, tc.tags)
+			if len(got) != 1 {
+				t.Fatalf("Expected 1 log, got %d", len(got))
+			}
+			gotJSON, _ := json.Marshal(got[0])
+			wantJSON, _ := json.Marshal(tc.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("Expected %s, got %s", wantJSON, gotJSON)
+			}
+		})
+	}
+}
+
+func TestLogsURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: "", want: "https://http-intake.logs.datadoghq.com/api/v2/logs"},
+		{baseURL: "https://api.datadoghq.eu", want: "https://http-intake.logs.datadoghq.eu/api/v2/logs"},
+		{baseURL: "http://127.0.0.1:8080/", want: "http://127.0.0.1:8080/api/v2/logs"},
+	}
+	for _, tc := range tests {
+		if got := (&DatadogClient{BaseURL: tc.baseURL}).logsURL(); got != tc.want {
+			t.Errorf("logsURL(%q): expected %s, got %s", tc.baseURL, tc.want, got)
+		}
+	}
+}
+
+func TestDatadogClientSendLogs(t *testing.T) {
+	var sizes []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != datadogLogsPath {
+			t.Errorf("Expected logs path, got %q", r.URL.Path)
+		}
+		if r.Header.Get("DD-API-KEY") != "test-key" {
+			t.Errorf("Expected the API key header, got %q", r.Header.Get("DD-API-KEY"))
+		}
+		var logs []LogEntry
+		if err := json.NewDecoder(r.Body).Decode(&logs); err != nil {
+			t.Errorf("Failed to decode logs: %v", err)
+		}
+		sizes = append(sizes, len(logs))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	logs := make([]LogEntry, 1500)
+	for i := range logs {
+		logs[i] = LogEntry{"message": "row"}
+	}
+	client := &DatadogClient{APIKey: "test-key", BaseURL: server.URL}
+	if err := client.SendLogs(context.Background(), logs); err != nil {
+		t.Fatalf("SendLogs failed: %v", err)
+	}
+	if len(sizes) != 2 || sizes[0] != 1000 || sizes[1] != 500 {
+		t.Errorf("Expected requests of 1000 and 500 logs, got %v", sizes)
+	}
+}
+
+func TestValidateRecordMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  MetricConfig
+		wantErr string
+	}{
+		{name: "Valid", metric: MetricConfig{Name: "a", Mode: modeLogs, Query: "SELECT id, name, error FROM jobs"}},
+		{name: "Exec", metric: MetricConfig{Name: "a", Mode: modeLogs, Source: "exec", Command: []string{"true"}}, wantErr: "cannot be used with source exec"},
+		{name: "NoQuery", metric: MetricConfig{Name: "a", Mode: modeLogs}, wantErr: "requires a query"},
+		{name: "HostColumn", metric: MetricConfig{Name: "a", Mode: modeLogs, Query: "SELECT id, server FROM jobs", HostColumn: "server"}},
+		{name: "TagColumns", metric: MetricConfig{Name: "a", Mode: modeLogs, Query: "SELECT id, name FROM jobs", TagColumns: []string{"name"}}, wantErr: "cannot be combined"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateMetricQuery(tc.metric)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCollectOnceLogs(t *testing.T) {
+	db, err := sql.Open("series", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sender := &logRecorder{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "rows", Mode: modeLogs, Query: "3", AllowUnsafe: true, Tags: []string{"env:test"}, Logs: LogsConfig{Service: "app"}},
+			{Name: "empty", Mode: modeLogs, Query: "0", AllowUnsafe: true},
+		}},
+		DB:     db,
+		Sender: sender,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Failed != 0 {
+		t.Fatalf("Expected no failures, got %+v", summary)
+	}
+	if len(sender.Logs) != 3 {
+		t.Fatalf("Expected 3 logs, got %d", len(sender.Logs))
+	}
+	if got := sender.Logs[2]; got["value"] != int64(3) || got["service"] != "app" || got["ddtags"] != "env:test" {
+		t.Errorf("Unexpected log %v", got)
+	}
+	if len(sender.SentMetrics) != 0 {
+		t.Errorf("Expected no metrics in logs mode, got %+v", sender.SentMetrics)
+	}
+}
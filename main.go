@@ -1,385 +1,803 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	"gopkg.in/yaml.v3"
-)
-
-const datadogAPI = "https://api.datadoghq.com/api/v1/series"
 
-type MetricSender interface {
-	SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error
-}
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+)
 
-type DatadogClient struct {
-	APIKey string
-	Debug  bool
-	DryRun bool
-}
+// MetricSender submits a single metric value. Custom implementations can be
+// registered with the pkg/sink registry.
+type MetricSender = sink.Sender
 
 type Config struct {
-	Metrics []MetricConfig `yaml:"metrics"`
+	// Include pulls in the metrics and queries of other files or globs.
+	Include []string `yaml:"include,omitempty"`
+	// Presets enables built-in metric sets by name, e.g. statements, for the
+	// database type being monitored.
+	Presets []string `yaml:"presets,omitempty"`
+	// Queries is a library of named queries referenced with query_ref.
+	Queries map[string]string `yaml:"queries,omitempty"`
+	// MetricDefaults applies to every metric; Templates are applied to the
+	// metrics extending them.
+	MetricDefaults MetricConfig            `yaml:"metric_defaults,omitempty"`
+	Templates      map[string]MetricConfig `yaml:"templates,omitempty"`
+	// DatabaseURLEnv names the environment variable holding the DSN
+	// (default DATABASE_URL).
+	DatabaseURLEnv string `yaml:"database_url_env,omitempty"`
+	// Database configures the connection to the database.
+	Database DatabaseConfig `yaml:"database,omitempty"`
+	// Interval is the daemon interval used when -interval is not given.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Align starts daemon cycles on wall-clock multiples of the interval.
+	Align bool `yaml:"align,omitempty"`
+	// Environments are overlays selected with -env.
+	Environments map[string]EnvironmentConfig `yaml:"environments,omitempty"`
+	// MetricPrefix is prepended to every metric name, e.g. "companyx.sql.".
+	MetricPrefix  string          `yaml:"metric_prefix,omitempty"`
+	Metrics       []MetricConfig  `yaml:"metrics"`
+	SensitiveTags []string        `yaml:"sensitive_tags,omitempty"`
+	Telemetry     TelemetryConfig `yaml:"telemetry,omitempty"`
+	Datadog       DatadogConfig   `yaml:"datadog,omitempty"`
+	Heartbeat     HeartbeatConfig `yaml:"heartbeat,omitempty"`
+	// CircuitBreaker skips the database after repeated connection failures.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+	// ServiceCheck reports database availability as a Datadog service check.
+	ServiceCheck ServiceCheckConfig `yaml:"service_check,omitempty"`
+	// Features toggles behaviors that are rolled out gradually.
+	Features Features `yaml:"features,omitempty"`
+	// Tracing exports spans of queries and submissions over OTLP.
+	Tracing TracingConfig `yaml:"tracing,omitempty"`
+	// OTLP configures the otlp sink.
+	OTLP OTLPConfig `yaml:"otlp,omitempty"`
+	// CloudWatch configures the cloudwatch sink.
+	CloudWatch CloudWatchConfig `yaml:"cloudwatch,omitempty"`
+	// InfluxDB and Graphite configure the influxdb and graphite sinks.
+	InfluxDB InfluxDBConfig `yaml:"influxdb,omitempty"`
+	Graphite GraphiteConfig `yaml:"graphite,omitempty"`
+	// Kafka configures the kafka sink.
+	Kafka KafkaConfig `yaml:"kafka,omitempty"`
+	// Webhook configures the webhook sink.
+	Webhook WebhookConfig `yaml:"webhook,omitempty"`
+	// StateFile persists the end of the last successful window of every
+	// templated query across runs.
+	StateFile string `yaml:"state_file,omitempty"`
+	// InitialWindow is the window of a templated query's first run (default:
+	// the daemon interval, or one hour).
+	InitialWindow time.Duration `yaml:"initial_window,omitempty"`
+	// Exec configures the exec sink.
+	Exec ExecConfig `yaml:"exec,omitempty"`
+	// Validation adds site-specific rules to the query validator.
+	Validation ValidationConfig `yaml:"validation,omitempty"`
+	// Guards rejects queries the planner expects to be expensive.
+	Guards GuardConfig `yaml:"guards,omitempty"`
+	// Audit records every query run, for compliance.
+	Audit AuditConfig `yaml:"audit,omitempty"`
+	// DatabaseTags tags every metric with the identity of the database.
+	DatabaseTags bool `yaml:"database_tags,omitempty"`
+	// TagNormalization normalizes tags to the rules of the Datadog intake.
+	TagNormalization TagNormalizationConfig `yaml:"tag_normalization,omitempty"`
+	// Host fills in the host of metrics without one.
+	Host HostConfig `yaml:"host,omitempty"`
+	// LeaderElection lets only one of several daemon replicas collect.
+	LeaderElection LeaderElectionConfig `yaml:"leader_election,omitempty"`
+	// Pipeline sends the points of daemon cycles from a worker pool.
+	Pipeline PipelineConfig `yaml:"pipeline,omitempty"`
+	// SinkBlocks holds the remaining top-level blocks, the configuration of
+	// sinks registered through pkg/sink.
+	SinkBlocks map[string]yaml.Node `yaml:",inline"`
+
+	// keyPositions and metricPositions locate top-level keys and metrics in
+	// the configuration files, for validation errors.
+	keyPositions    map[string]position
+	metricPositions []position
+	// checksum covers the content of every file read, to detect changes.
+	checksum string
+	// watchDirs are the directories of the files read and of the include
+	// patterns, watched for changes in daemon mode.
+	watchDirs []string
 }
 
 type MetricConfig struct {
-	Name  string   `yaml:"name"`
-	Tags  []string `yaml:"tags"`
-	Host  string   `yaml:"host"`
-	Query string   `yaml:"query,omitempty"`
+	// Extends names the template the metric inherits unset fields from.
+	Extends string   `yaml:"extends,omitempty"`
+	Name    string   `yaml:"name"`
+	Tags    []string `yaml:"tags"`
+	Host    string   `yaml:"host"`
+	Query   string   `yaml:"query,omitempty"`
+	// QueryRef uses the query of that name from the queries library.
+	QueryRef string `yaml:"query_ref,omitempty"`
+	// Params are bound to the query's placeholders ($1 or ?) instead of
+	// being interpolated into it.
+	Params []QueryParam `yaml:"params,omitempty"`
+	// Retries is the number of times a query failing with a transient error
+	// (deadlock, serialization failure, failover, connection reset) is retried.
+	Retries    int           `yaml:"retries,omitempty"`
+	RetryDelay time.Duration `yaml:"retry_delay,omitempty"`
+	// CacheTTL re-submits the last query result instead of running the query
+	// again until the TTL expires. It only takes effect in daemon mode.
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+	// OnNull and OnNoRows decide what is submitted when the query returns
+	// NULL or no rows instead of failing the metric.
+	OnNull   EmptyPolicy `yaml:"on_null,omitempty"`
+	OnNoRows EmptyPolicy `yaml:"on_no_rows,omitempty"`
+	// TimeValue selects how timestamp results are submitted: `epoch` (Unix
+	// seconds, the default) or `age` (seconds elapsed since the timestamp).
+	TimeValue TimeValue `yaml:"time_value,omitempty"`
+	// ValueMap translates textual results to numbers; ValueMapDefault is used
+	// for strings missing from the map.
+	ValueMap        ValueMap `yaml:"value_map,omitempty"`
+	ValueMapDefault *float64 `yaml:"value_map_default,omitempty"`
+	// TagColumns names result columns whose values become tags, e.g.
+	// `region:us-east-1`. Every row is submitted as its own point.
+	TagColumns []string `yaml:"tag_columns,omitempty"`
+	// HostColumn names the result column holding the host of each row, for
+	// a database reporting on a fleet. Rows where it is NULL use Host.
+	HostColumn string `yaml:"host_column,omitempty"`
+	// MaxSeries caps the distinct name and tag combinations submitted per
+	// run; the rows of further combinations are dropped.
+	MaxSeries int `yaml:"max_series,omitempty"`
+	// MaxRows fails a row mode, distribution or record mode query returning
+	// more rows, and stops reading its result there, so a runaway query
+	// cannot exhaust memory. Zero reads every row.
+	MaxRows int `yaml:"max_rows,omitempty"`
+	// EmitQueryStats sends <name>.query_time_ms and <name>.rows along with
+	// the metric whenever its query runs.
+	EmitQueryStats bool `yaml:"emit_query_stats,omitempty"`
+	// MaxAge and ExpectChange submit <name>.stale: MaxAge marks a series
+	// stale when its value, read as a timestamp, is older; ExpectChange when
+	// its value has not changed for that many runs in daemon mode.
+	MaxAge       time.Duration `yaml:"max_age,omitempty"`
+	ExpectChange int           `yaml:"expect_change,omitempty"`
+	// Mode is metrics (the default), logs, which forwards every row of the
+	// query as a Datadog log with the attributes set in Logs, or events,
+	// which posts every row as a Datadog event built from Events.
+	Mode   MetricMode   `yaml:"mode,omitempty"`
+	Logs   LogsConfig   `yaml:"logs,omitempty"`
+	Events EventsConfig `yaml:"events,omitempty"`
+	// Anomaly submits <name>.anomaly_score, the deviation of every value
+	// from the previous ones, in daemon mode.
+	Anomaly *AnomalyConfig `yaml:"anomaly,omitempty"`
+	// Type is gauge (the default) or distribution, which submits every row's
+	// value as one Datadog distribution point.
+	Type MetricType `yaml:"type,omitempty"`
+	// Aggregate reduces a multi-row result to one gauge (avg, min, max, sum,
+	// count, p50, p95 or p99), per tag set when combined with tag_columns.
+	Aggregate Aggregate `yaml:"aggregate,omitempty"`
+	// Unit, PerUnit, Description and ShortName are pushed to the Datadog
+	// metric metadata API on first submission, so graphs show correct units.
+	Unit        string `yaml:"unit,omitempty"`
+	PerUnit     string `yaml:"per_unit,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	ShortName   string `yaml:"short_name,omitempty"`
+	// Monitor describes a Datadog monitor applied with the monitors command.
+	Monitor *MonitorConfig `yaml:"monitor,omitempty"`
+	// Alert posts a Datadog event when the value crosses a threshold.
+	Alert *AlertConfig `yaml:"alert,omitempty"`
+	// Transform converts the fetched value before submission, e.g. bytes to GB.
+	Transform []Transform `yaml:"transform,omitempty"`
+	// Sink sends this metric to another sink than the one selected with -sink.
+	Sink string `yaml:"sink,omitempty"`
+	// Sinks sends every value of this metric to all of the listed sinks.
+	Sinks []string `yaml:"sinks,omitempty"`
+	// SinkOptions sets fields only one sink uses, e.g. the Datadog interval.
+	SinkOptions SinkOptions `yaml:"sink_options,omitempty"`
+	// Source is sql (the default) or exec, which runs Command and reads the
+	// samples it prints instead of querying the database.
+	Source  string   `yaml:"source,omitempty"`
+	Command []string `yaml:"command,omitempty"`
+	// Timeout bounds the query, including retries.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Interval collects the metric at most once per interval in daemon mode,
+	// for metrics that need not refresh every cycle.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Schedule is a cron expression, e.g. "0 6 * * 1-5"; in daemon mode the
+	// metric is only collected in the first cycle after each scheduled time.
+	Schedule string `yaml:"schedule,omitempty"`
+	// Jitter delays the query by a random duration up to Jitter, spreading
+	// the load of instances started at the same time.
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+	// Enabled is a boolean or an expression deciding whether the metric is
+	// collected, evaluated once the database is connected.
+	Enabled *Enabled `yaml:"enabled,omitempty"`
+	// AllowUnsafe skips the query validator, for queries calling stored
+	// functions or using constructs it rejects. Every execution is logged
+	// as an audit entry and reported in self-telemetry.
+	AllowUnsafe bool `yaml:"allow_unsafe,omitempty"`
 }
 
-type Metric struct {
-	Series []DataSeries `json:"series"`
-}
-
-type DataSeries struct {
-	Metric string      `json:"metric"`
-	Points [][]float64 `json:"points"`
-	Tags   []string    `json:"tags,omitempty"`
-	Host   string      `json:"host,omitempty"`
-	Type   string      `json:"type,omitempty"`
-}
-
-type LogEntry struct {
-	Timestamp string          `json:"timestamp"`
-	Level     string          `json:"level"`
-	Message   string          `json:"message"`
-	Data      interface{}     `json:"data,omitempty"`
-	Ctx       context.Context `json:"-"`
-}
-
-type DBClient interface {
-	QueryRow(ctx context.Context, query string) (float64, error)
-}
+// DBClient runs a query returning a single numeric value.
+type DBClient = source.DBClient
 
 type SQLDB struct {
-	DB *sql.DB
+	DB        *sql.DB
+	Errors    *ErrorAggregator
+	Telemetry *Telemetry
+	// Guard limits and explains queries before they run; nil disables it.
+	Guard *queryGuard
+	// Audit records every query; nil disables it.
+	Audit *auditLog
 }
 
-func logJSON(ctx context.Context, level, message string, data interface{}) {
-	entry := LogEntry{
-		Timestamp: time.Now().Format(time.RFC3339),
-		Level:     level,
-		Message:   message,
-		Data:      data,
-		Ctx:       ctx,
-	}
+func loadConfig(filename string) (*Config, error) {
+	return loadConfigFile(filename, "", formatAuto)
+}
 
-	jsonData, err := json.Marshal(entry)
+// loadConfigFor loads the configuration selected by the command line options.
+func loadConfigFor(opts *options) (*Config, error) {
+	config, err := loadConfigFile(opts.configFile, opts.env, opts.configFormat)
 	if err != nil {
-		log.Printf("Error marshaling log: %v", err)
-		return
+		return nil, err
 	}
-
-	fmt.Println(string(jsonData))
+	if err := opts.selection.apply(context.Background(), config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
-func (d *DatadogClient) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
-	timestamp := float64(time.Now().Unix())
-
-	metricData := Metric{
-		Series: []DataSeries{
-			{
-				Metric: metricName,
-				Points: [][]float64{{timestamp, value}},
-				Tags:   tags,
-				Host:   host,
-				Type:   "gauge",
-			},
-		},
+// loadConfigFile loads the configuration in the given format (auto detects
+// it from the extension) with the overlay of the named environment applied,
+// if any.
+func loadConfigFile(filename, env, format string) (*Config, error) {
+	format, err := configFormat(filename, format)
+	if err != nil {
+		return nil, err
 	}
-
-	payload, err := json.Marshal(metricData)
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("failed to encode JSON: %w", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
-
-	if d.Debug {
-		logJSON(ctx, "debug", "Sending metric to Datadog", map[string]interface{}{
-			"metric":  metricName,
-			"value":   value,
-			"tags":    tags,
-			"host":    host,
-			"url":     datadogAPI,
-			"payload": string(payload),
-		})
+	if data, err = configYAML(data, format); err != nil {
+		return nil, err
 	}
 
-	if d.DryRun {
-		logJSON(ctx, "info", "Dry run mode - skipping actual metric submission", map[string]interface{}{
-			"metric": metricName,
-			"value":  value,
-			"tags":   tags,
-			"host":   host,
-		})
-		return nil
+	var config Config
+	if err := decodeStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", datadogAPI, bytes.NewBuffer(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	config.keyPositions, config.metricPositions = configPositions(data, filename, format)
+	config.addSource(filename, data)
+	if err := resolveIncludes(&config, filename); err != nil {
+		return nil, err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("DD-API-KEY", d.APIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			logJSON(ctx, "warn", "Datadog request cancelled or timed out", map[string]interface{}{"error": err.Error()})
-			return fmt.Errorf("datadog request failed due to context: %w", err)
-		}
-		return fmt.Errorf("failed to send request: %w", err)
+	if err := resolvePresets(&config, databaseType()); err != nil {
+		return nil, err
 	}
-	defer func() {
-		closeErr := resp.Body.Close()
-		if closeErr != nil {
-			logJSON(ctx, "warn", "Failed to close response body", map[string]interface{}{"error": closeErr.Error()})
-		}
-	}()
-
-	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("unexpected response code: %d", resp.StatusCode)
+	if err := applyMetricTemplates(&config); err != nil {
+		return nil, err
 	}
-
-	logJSON(ctx, "info", "Metric sent successfully", map[string]interface{}{
-		"metric": metricName,
-		"status": resp.StatusCode,
-	})
-
-	return nil
-}
-
-func loadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	if err := resolveQueryRefs(&config); err != nil {
+		return nil, err
 	}
-
-	var config Config
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	if err := applyEnvironment(&config, env); err != nil {
+		return nil, err
+	}
+	if err := validateSchema(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Features.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateCompoundQueries(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Host.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Database.validate(&config); err != nil {
+		return nil, err
+	}
+	if err := validateDestinations(config.Datadog.Destinations); err != nil {
+		return nil, err
+	}
+	if err := validateMetricSinks(config.Metrics); err != nil {
+		return nil, err
+	}
+	if err := validateMetricSources(config.Metrics); err != nil {
+		return nil, err
+	}
+	if err := validateMetricParams(config.Metrics); err != nil {
+		return nil, err
+	}
+	if err := validateMetricSchedules(config.Metrics); err != nil {
+		return nil, err
+	}
+	if err := validateMetricRules(&config); err != nil {
+		return nil, err
+	}
+	if err := applyMetricPrefix(&config); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
 
-func fetchMetricFromDB(ctx context.Context, db *sql.DB, query string) (float64, error) {
+// fetchMetricFromDB runs the metric's query and converts the single resulting
+// value. Text results are translated with the metric's value map when it has one.
+func fetchMetricFromDB(ctx context.Context, db *sql.DB, metric MetricConfig) (float64, error) {
+	query := metric.Query
+	args, err := metric.queryArgs()
+	if err != nil {
+		return 0, err
+	}
 	var value interface{}
-	err := db.QueryRowContext(ctx, query).Scan(&value)
+	err = db.QueryRowContext(ctx, query, args...).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errNoRows
+	}
 	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			logJSON(ctx, "warn", "Database query cancelled or timed out", map[string]interface{}{"query": query, "error": err.Error()})
+			logEvent(ctx, "warn", "Database query cancelled or timed out", map[string]interface{}{"query": normalizeQuery(query), "error": err.Error()})
 			return 0, fmt.Errorf("database query failed due to context: %w", err)
 		}
 		return 0, fmt.Errorf("failed to execute query: %w", err)
 	}
 
-	switch v := value.(type) {
-	case int:
-		return float64(v), nil
-	case int64:
-		return float64(v), nil
-	case float64:
-		return v, nil
-	case []byte:
-		f, err := strconv.ParseFloat(string(v), 64)
-		if err != nil {
-			return 0, fmt.Errorf("could not convert byte slice to float64: %w", err)
-		}
-		return f, nil
-	default:
-		return 0, fmt.Errorf("unexpected data type: %T", v)
-	}
+	return convertValue(metric, value)
 }
 
 func (p *SQLDB) QueryRow(ctx context.Context, query string) (float64, error) {
+	return p.QueryMetric(ctx, MetricConfig{Query: query})
+}
+
+// QueryMetric runs the metric's query, applying its result conversion options.
+func (p *SQLDB) QueryMetric(ctx context.Context, metric MetricConfig) (float64, error) {
+	ctx, span := startQuerySpan(ctx, metric)
 	startTime := time.Now()
-	value, err := fetchMetricFromDB(ctx, p.DB, query)
-	duration := time.Since(startTime)
+	value, err := fetchMetricFromDB(ctx, p.DB, metric)
+	rows := 1
+	if err != nil {
+		rows = 0
+	}
+	p.observe(ctx, metric, rows, time.Since(startTime), err)
+	endSpan(span, 0, err)
+	return value, err
+}
+
+// observe records telemetry, audits and logs the execution of the metric's
+// query, which returned rows rows.
+func (p *SQLDB) observe(ctx context.Context, metric MetricConfig, rows int, duration time.Duration, err error) {
+	query := metric.Query
+	fingerprint := queryFingerprint(query)
+	p.Audit.Record(ctx, auditQuery, metric, rows, duration, err)
+	// NULL and no rows are not query errors; the metric's policy decides how
+	// they are reported.
+	queryErr := err
+	if isEmptyResult(err) {
+		queryErr = nil
+	}
+	p.Telemetry.RecordQuery(duration, queryErr)
+	p.Telemetry.RecordFingerprint(fingerprint, duration)
+	expvarQueriesExecuted.Add(1)
+	if queryErr != nil {
+		expvarQueryErrors.Add(1)
+	}
 
-	logJSON(ctx, "info", "Query execution completed", map[string]interface{}{
+	logEvent(ctx, "info", "Query execution completed", map[string]interface{}{
 		"query_time_ms": float64(duration.Microseconds()) / 1000.0,
-		"query":         query,
+		"query":         normalizeQuery(query),
+		"fingerprint":   fingerprint,
 		"error":         nil,
 	})
-	if err != nil {
-		logJSON(ctx, "error", "Query execution failed", map[string]interface{}{
+	if queryErr != nil {
+		p.Errors.Log(ctx, "error", "Query execution failed", fingerprint, err, map[string]interface{}{
 			"query_time_ms": float64(duration.Microseconds()) / 1000.0,
-			"query":         query,
-			"error":         err.Error(),
+			"query":         normalizeQuery(query),
+			"fingerprint":   fingerprint,
 		})
 	}
+}
 
-	return value, err
+// openDB opens and pings the database whose DSN is in the urlEnv environment
+// variable (usually DATABASE_URL), using the driver named by DATABASE_TYPE.
+func openDB(ctx context.Context, urlEnv string, cfg DatabaseConfig) (*sql.DB, error) {
+	db, _, err := openDatabase(ctx, urlEnv, cfg)
+	return db, err
 }
 
-func run(ctx context.Context) error {
-	yamlFile := flag.String("config", "config.yaml", "Path to the YAML configuration file")
-	versionFlag := flag.Bool("version", false, "Print the version information")
-	debugFlag := flag.Bool("debug", false, "Enable debug mode")
-	dryRunFlag := flag.Bool("dry-run", false, "Dry run mode - don't actually send metrics to Datadog")
-	timeout := flag.Duration("timeout", 30*time.Second, "Global timeout for operations like DB query and API call")
-	flag.Parse()
-
-	if *timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, *timeout)
-		defer cancel()
+// openDatabase is openDB that also returns the connector switching to the
+// fallback DSNs, or nil when none are configured.
+func openDatabase(ctx context.Context, urlEnv string, cfg DatabaseConfig) (*sql.DB, *fallbackConnector, error) {
+	dbType := databaseType()
+	urlEnvs := append([]string{urlEnv}, cfg.FallbackURLEnvs...)
+	dsns := make([]string, len(urlEnvs))
+	for i, env := range urlEnvs {
+		dsn, err := loadDSN(env, dbType, cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		dsns[i] = dsn
 	}
 
-	if *versionFlag {
-		_version()
-		return nil
+	logEvent(ctx, "debug", "Opening database connection", map[string]interface{}{
+		"database_url":  dsns[0],
+		"database_type": dbType,
+		"fallbacks":     cfg.FallbackURLEnvs,
+	})
+
+	var db *sql.DB
+	var fallback *fallbackConnector
+	if len(dsns) == 1 {
+		var err error
+		if db, err = sql.Open(dbType, dsns[0]); err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize DB connection: %w", err)
+		}
+	} else {
+		var err error
+		if fallback, err = newFallbackConnector(dbType, urlEnvs, dsns); err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize DB connection: %w", err)
+		}
+		db = sql.OpenDB(fallback)
 	}
 
-	apiKey := os.Getenv("DATADOG_API_KEY")
-	if apiKey == "" && !*dryRunFlag {
-		return fmt.Errorf("DATADOG_API_KEY is not set")
+	if err := pingDB(ctx, db, cfg); err != nil {
+		_ = db.Close()
+		return nil, nil, fmt.Errorf("failed to connect to DB: %w", err)
 	}
 
-	dbURL := os.Getenv("DATABASE_URL")
+	return db, fallback, nil
+}
+
+// loadDSN reads and validates the DSN in the urlEnv environment variable and
+// applies the connection options of cfg.
+func loadDSN(urlEnv, dbType string, cfg DatabaseConfig) (string, error) {
+	dbURL := os.Getenv(urlEnv)
 	if dbURL == "" {
-		return fmt.Errorf("DATABASE_URL is not set")
+		return "", fmt.Errorf("%s is not set", urlEnv)
 	}
 
-	if err := validateDBURL(dbURL); err != nil {
-		return fmt.Errorf("invalid DATABASE_URL: %w", err)
+	if err := validateDBURL(dbType, dbURL); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", urlEnv, err)
 	}
+	logRedactor.AddDSN(dbURL)
 
-	dbType := os.Getenv("DATABASE_TYPE")
-	if dbType == "" {
-		dbType = "postgres"
+	if cfg.PoolerCompat {
+		var err error
+		if dbURL, err = poolerDSN(dbType, dbURL); err != nil {
+			return "", fmt.Errorf("invalid %s: %w", urlEnv, err)
+		}
 	}
+	return dbURL, nil
+}
 
-	if *debugFlag {
-		logJSON(ctx, "debug", "Debug mode enabled", map[string]interface{}{
-			"config":        *yamlFile,
-			"database_url":  dbURL,
-			"database_type": dbType,
-			"dry_run":       *dryRunFlag,
-			"timeout":       timeout.String(),
+// databaseType returns DATABASE_TYPE, defaulting to postgres.
+func databaseType() string {
+	if dbType := os.Getenv("DATABASE_TYPE"); dbType != "" {
+		return dbType
+	}
+	return "postgres"
+}
+
+// runCollect executes every configured query and sends the results to Datadog.
+func runCollect(ctx context.Context, opts *options) error {
+	if err := resolveShardCount(ctx, opts); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if err := validateShard(opts.shardIndex, opts.shardCount); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if err := validateSummaryFormat(opts.summaryFormat); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if err := validateFailOn(opts.failOn); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if err := validateDryRunFormat(opts.dryRunFormat, opts.dryRun); err != nil {
+		return withExitCode(exitConfigInvalid, err)
+	}
+	if opts.record != "" && opts.replay != "" {
+		return withExitCode(exitConfigInvalid, errors.New("-record and -replay cannot be combined"))
+	}
+
+	logRedactor.AddSecret(os.Getenv("DATADOG_API_KEY"))
+	logRedactor.AddSecret(os.Getenv("DATADOG_APP_KEY"))
+
+	if opts.debug {
+		logEvent(ctx, "debug", "Debug mode enabled", map[string]interface{}{
+			"config":  opts.configFile,
+			"dry_run": opts.dryRun,
+			"timeout": opts.timeout.String(),
 		})
 	}
 
-	if *dryRunFlag {
-		logJSON(ctx, "info", "Dry run mode enabled - no metrics will be sent to Datadog", nil)
+	if opts.dryRun {
+		logEvent(ctx, "info", "Dry run mode enabled - no metrics will be sent", nil)
 	}
 
-	db, err := sql.Open(dbType, dbURL)
+	config, err := loadConfigFor(opts)
 	if err != nil {
-		return fmt.Errorf("failed to initialize DB connection: %w", err)
+		return configError("failed to load config: %w", err)
 	}
-	defer func() {
-		closeErr := db.Close()
-		if closeErr != nil {
-			logJSON(ctx, "warn", "Failed to close database connection", map[string]interface{}{"error": closeErr.Error()})
+	if opts.interval == 0 {
+		opts.interval = config.Interval
+	}
+
+	var replay *resultSnapshot
+	if opts.replay != "" {
+		if replay, err = loadResultSnapshot(opts.replay); err != nil {
+			return configError("%w", err)
 		}
-	}()
+		logEvent(ctx, "info", "Replaying recorded query results - the database is not queried", map[string]interface{}{"snapshot": opts.replay})
+	}
+
+	// Replays leave db nil: nothing is queried and no connection is needed.
+	var db *sql.DB
+	var fallback *fallbackConnector
+	if replay == nil {
+		db, fallback, err = openDatabase(ctx, config.databaseURLEnv(), config.Database)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			closeErr := db.Close()
+			if closeErr != nil {
+				logEvent(ctx, "warn", "Failed to close database connection", map[string]interface{}{"error": closeErr.Error()})
+			}
+		}()
+	}
 
-	pingCtx, pingCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer pingCancel()
-	if err = db.PingContext(pingCtx); err != nil {
-		return fmt.Errorf("failed to connect to DB: %w", err)
+	audit, err := openAuditLog(config.Audit, databaseType(), config.databaseURL())
+	if err != nil {
+		return err
 	}
+	defer audit.Close()
 
-	client := &DatadogClient{
-		APIKey: apiKey,
-		Debug:  *debugFlag,
-		DryRun: *dryRunFlag,
+	if opts.sink == "" {
+		opts.sink = sinkDatadog
 	}
+	sinks, err := newSinks(ctx, config, opts)
+	if err != nil {
+		return err
+	}
+	defer closeSinks(ctx, sinks)
+	logRedactor.SetSensitiveTags(config.SensitiveTags)
 
-	config, err := loadConfig(*yamlFile)
+	shutdownTracing, err := setupTracing(ctx, config.Tracing)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return configError("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logEvent(ctx, "warn", "Failed to flush traces", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	if enabled := config.Features.EnabledNames(); len(enabled) > 0 {
+		logEvent(ctx, "info", "Feature flags enabled", map[string]interface{}{"features": enabled})
 	}
 
-	if *debugFlag {
-		logJSON(ctx, "debug", "Configuration file loaded", map[string]interface{}{
+	if err := selectMetrics(ctx, config, opts, db); err != nil {
+		return err
+	}
+
+	if opts.debug {
+		logEvent(ctx, "debug", "Configuration file loaded", map[string]interface{}{
 			"metrics_count": len(config.Metrics),
 		})
 	}
 
-	dbClient := &SQLDB{DB: db}
+	errs := NewErrorAggregator(opts.errorWindow)
+	defer errs.Flush(ctx)
 
-	for _, metric := range config.Metrics {
-		if err := validateQuery(metric.Query); err != nil {
-			logJSON(ctx, "error", "Invalid query in config", map[string]interface{}{
-				"metric": metric.Name,
-				"query":  metric.Query,
-				"error":  err.Error(),
-			})
-			continue
+	hostname, _ := os.Hostname()
+	host, err := detectHost(ctx, config.Host)
+	if err != nil {
+		return err
+	}
+	if host != nil {
+		logEvent(ctx, "info", "Detected host", map[string]interface{}{"host": host.Name, "tags": host.Tags})
+	}
+	health := NewHealthState(opts.configFile, opts.interval)
+	health.SetConfig(nil)
+	if opts.healthAddr != "" {
+		if err := startHealthServer(ctx, opts.healthAddr, health, db); err != nil {
+			return err
 		}
+	}
+	if opts.debugAddr != "" {
+		if err := startDebugServer(ctx, opts.debugAddr); err != nil {
+			return err
+		}
+	}
 
-		var value float64
-		if metric.Query != "" {
-			if *debugFlag {
-				logJSON(ctx, "debug", "Executing SQL query", map[string]interface{}{
-					"metric": metric.Name,
-					"query":  metric.Query,
-				})
+	var metricTags []string
+	if config.DatabaseTags {
+		metricTags = identityTags(ctx, db, databaseType(), config.databaseURL())
+	}
+
+	col := &Collector{
+		Config:     config,
+		ConfigFile: opts.configFile,
+		DB:         db,
+		Sender:     sinks[opts.sink],
+		Sinks:      sinks,
+		Errors:     errs,
+		Health:     health,
+		Hostname:   hostname,
+		Host:       host,
+		MetricTags: metricTags,
+		Debug:      opts.debug,
+		FailFast:   opts.failFast,
+		Breaker:    NewCircuitBreaker(config.CircuitBreaker),
+		DBTags:     databaseTags(databaseType(), config.databaseURL()),
+		Audit:      audit,
+		Fallback:   fallback,
+	}
+	if opts.interval > 0 {
+		col.Stop = ctx.Done()
+		col.Daemon = true
+		// Runs before closeSinks, which flushes the points sent last.
+		col.Pipeline = newSendPipeline(config.Pipeline)
+		defer func() {
+			closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.shutdownWait)
+			defer cancel()
+			if err := col.Pipeline.Close(closeCtx); err != nil {
+				logEvent(ctx, "warn", "Failed to drain the send pipeline", map[string]interface{}{"error": err.Error()})
 			}
+		}()
+	}
+
+	state, err := loadRunState(config.StateFile)
+	if err != nil {
+		return configError("%w", err)
+	}
+	col.State = state
+	col.Window = initialWindow(config, opts.interval)
+	col.Replay = replay
+	if opts.record != "" {
+		col.Record = newResultSnapshot(opts.record)
+	}
+
+	if opts.interval > 0 {
+		logEvent(ctx, "info", "Starting daemon mode", map[string]interface{}{
+			"interval": opts.interval.String(),
+			"align":    config.Align,
+		})
+	}
 
-			fetchedValue, errDb := dbClient.QueryRow(ctx, metric.Query)
+	// Only daemon replicas elect a leader; a standby keeps its cycles alive
+	// for the health check without collecting.
+	var leader *leaderElector
+	if opts.interval > 0 {
+		leader = newLeaderElector(config.LeaderElection, db, databaseType())
+		defer leader.Release(context.WithoutCancel(ctx))
+	}
 
-			if errDb != nil {
-				logJSON(ctx, "error", "Error fetching metric from DB", map[string]interface{}{
-					"metric": metric.Name,
-					"error":  errDb.Error(),
-				})
-				continue
+	var monitor *connectionMonitor
+	if opts.interval > 0 {
+		monitor = newConnectionMonitor(db, config.Database, fallback)
+	}
+
+	reloader := newConfigReloader(opts, db, config)
+	watching := opts.interval > 0 && reloader.Watch(ctx, config)
+	defer reloader.Close()
+	scheduled := time.Now()
+	for {
+		monitor.Check(ctx)
+		if !leader.Acquire(ctx) {
+			health.RecordCycle(time.Now(), 0)
+		} else {
+			cycleCtx, cancel := cycleContext(ctx, opts)
+			summary := col.CollectOnce(cycleCtx)
+			cancel()
+
+			if err := writeSummary(os.Stdout, summary, opts.summaryFormat); err != nil {
+				logEvent(ctx, "warn", "Failed to write run summary", map[string]interface{}{"error": err.Error()})
 			}
-			value = fetchedValue
 
-			if *debugFlag {
-				logJSON(ctx, "debug", "SQL query result", map[string]interface{}{
-					"metric": metric.Name,
-					"value":  value,
-				})
+			if opts.interval <= 0 {
+				failOn := opts.failOn
+				if opts.failFast {
+					failOn = "any"
+				}
+				return checkFailPolicy(summary, failOn)
+			}
+			if opts.errorWindow <= 0 {
+				errs.Flush(ctx)
+			} else {
+				errs.FlushExpired(ctx)
 			}
 		}
 
-		errSend := client.SendMetric(ctx, metric.Name, value, metric.Tags, metric.Host)
-		if errSend != nil {
-			logJSON(ctx, "error", "Failed to send metric", map[string]interface{}{
-				"metric": metric.Name,
-				"error":  errSend.Error(),
-			})
+		scheduled = nextCycle(scheduled, time.Now(), opts.interval, config.Align)
+		timer := time.NewTimer(time.Until(scheduled))
+		for waiting := true; waiting; {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				logEvent(context.Background(), "info", "Stopping daemon mode", nil)
+				return nil
+			case <-reloader.Changed():
+				reloader.Reload(ctx, col, health)
+			case <-timer.C:
+				waiting = false
+			}
+		}
+		if !watching {
+			reloader.Reload(ctx, col, health)
 		}
 	}
+}
+
+// selectMetrics keeps the metrics of config that are enabled on db and
+// belong to this replica's shard.
+func selectMetrics(ctx context.Context, config *Config, opts *options, db *sql.DB) error {
+	var err error
+	config.Metrics, err = filterEnabled(ctx, config.Metrics, newCapabilities(db, databaseType()))
+	if err != nil {
+		return err
+	}
 
+	if opts.shardCount > 1 {
+		total := len(config.Metrics)
+		config.Metrics = shardMetrics(config.Metrics, opts.shardIndex, opts.shardCount)
+		logEvent(ctx, "info", "Metrics sharded across replicas", map[string]interface{}{
+			"shard_index":   opts.shardIndex,
+			"shard_count":   opts.shardCount,
+			"metrics_total": total,
+			"metrics_shard": len(config.Metrics),
+		})
+	}
 	return nil
 }
 
+// defaultShutdownTimeout bounds the wait for the running cycle on SIGTERM.
+const defaultShutdownTimeout = 30 * time.Second
+
+// cycleContext returns the context of one collection cycle. A single run
+// stops at once when interrupted. In daemon mode an interrupt lets the
+// running cycle finish its current metric and send its results, and only
+// cancels it after -shutdown-timeout.
+func cycleContext(ctx context.Context, opts *options) (context.Context, context.CancelFunc) {
+	if opts.interval <= 0 {
+		return withOptionalTimeout(ctx, opts.timeout)
+	}
+	cycleCtx, cancel := withOptionalTimeout(context.WithoutCancel(ctx), opts.timeout)
+	stopDrain := context.AfterFunc(ctx, func() {
+		logEvent(cycleCtx, "info", "Shutdown requested - waiting for the running cycle to finish", map[string]interface{}{
+			"shutdown_timeout": opts.shutdownWait.String(),
+		})
+		time.AfterFunc(opts.shutdownWait, cancel)
+	})
+	return cycleCtx, func() {
+		stopDrain()
+		cancel()
+	}
+}
+
+// withOptionalTimeout derives a context with the given timeout, or a plain
+// cancelable context when timeout is not positive.
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
 func main() {
 	ctx := context.Background()
 
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(ctx); err != nil {
-		logJSON(context.Background(), "fatal", "Execution error", map[string]interface{}{
-			"error": err.Error(),
-		})
-		os.Exit(1)
+	if err := run(ctx, os.Args[1:]); err != nil {
+		var logged *loggedError
+		if !errors.As(err, &logged) {
+			logFatal(err)
+		}
+		os.Exit(exitCode(err))
 	}
 }
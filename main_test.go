@@ -98,3 +98,109 @@ func TestMockMetricSender(t *testing.T) {
 		t.Errorf("Expected value %f, got points %v", value, sent.Points)
 	}
 }
+
+func TestCycleContextDaemonDrains(t *testing.T) {
+	parent, stop := context.WithCancel(context.Background())
+	cycleCtx, cancel := cycleContext(parent, &options{interval: time.Minute, shutdownWait: 50 * time.Millisecond})
+	defer cancel()
+
+	stop()
+	select {
+	case <-cycleCtx.Done():
+		t.Fatal("Expected the cycle to keep running right after the shutdown request")
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case <-cycleCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the cycle to be cancelled after the shutdown timeout")
+	}
+}
+
+func TestCycleContextSingleRun(t *testing.T) {
+	parent, stop := context.WithCancel(context.Background())
+	cycleCtx, cancel := cycleContext(parent, &options{shutdownWait: time.Minute})
+	defer cancel()
+
+	stop()
+	select {
+	case <-cycleCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected a single run to stop at once")
+	}
+}
+
+func TestCollectOnceStop(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+	sender := &MockMetricSender{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "a", Source: "exec", Command: []string{"echo", `{"samples":[{"value":1}]}`}},
+			{Name: "b", Source: "exec", Command: []string{"echo", `{"samples":[{"value":2}]}`}},
+		}},
+		Sender: sender,
+		Stop:   stop,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Skipped != 2 || len(sender.SentMetrics) != 0 {
+		t.Errorf("Expected every metric to be skipped after a shutdown request, got %+v", summary)
+	}
+}
+
+func TestCollectOnceFailFast(t *testing.T) {
+	sender := &MockMetricSender{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "a", Source: "exec", Command: []string{"echo", `{"samples":[{"value":1}]}`}},
+			{Name: "b", Source: "exec", Command: []string{"false"}},
+			{Name: "c", Source: "exec", Command: []string{"echo", `{"samples":[{"value":3}]}`}},
+		}},
+		Sender:   sender,
+		FailFast: true,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Succeeded != 1 || summary.Failed != 1 || summary.Skipped != 1 {
+		t.Fatalf("Expected 1 metric sent, 1 failed and 1 skipped, got %+v", summary)
+	}
+	want := []string{statusSent, statusQueryFailed, statusSkipped}
+	for i, result := range summary.Metrics {
+		if result.Status != want[i] {
+			t.Errorf("Expected %s to be %s, got %s", result.Metric, want[i], result.Status)
+		}
+	}
+	if len(sender.SentMetrics) != 1 {
+		t.Errorf("Expected only a to be sent, got %+v", sender.SentMetrics)
+	}
+}
+
+func TestCollectOnceQueryStats(t *testing.T) {
+	sender := &MockMetricSender{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "a", Source: "exec", Command: []string{"echo", `{"samples":[{"value":1,"tags":["k:x"]},{"value":2,"tags":["k:y"]}]}`}, EmitQueryStats: true},
+			{Name: "b", Source: "exec", Command: []string{"echo", `{"samples":[{"value":3}]}`}},
+		}},
+		Sender: sender,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Failed != 0 {
+		t.Fatalf("Expected no failures, got %+v", summary)
+	}
+	got := map[string]float64{}
+	for _, s := range sender.SentMetrics {
+		got[s.Metric] = s.Points[0][1]
+	}
+	if got["a.rows"] != 2 {
+		t.Errorf("Expected a.rows = 2, got %v", got["a.rows"])
+	}
+	if _, ok := got["a.query_time_ms"]; !ok {
+		t.Error("Expected a.query_time_ms to be sent")
+	}
+	if _, ok := got["b.rows"]; ok {
+		t.Error("Expected no query stats without emit_query_stats")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// MetricMetadata is the body of the Datadog metric metadata API.
+type MetricMetadata struct {
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	ShortName   string `json:"short_name,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	PerUnit     string `json:"per_unit,omitempty"`
+}
+
+// metadataFor returns the metadata configured for metric, or false when none is set.
+func metadataFor(metric MetricConfig) (MetricMetadata, bool) {
+	meta := MetricMetadata{
+		Description: metric.Description,
+		ShortName:   metric.ShortName,
+		Unit:        metric.Unit,
+		PerUnit:     metric.PerUnit,
+	}
+	if meta == (MetricMetadata{}) {
+		return meta, false
+	}
+	meta.Type = metricTypeGauge
+	if metric.Type == metricTypeDistribution {
+		meta.Type = metricTypeDistribution
+	}
+	return meta, true
+}
+
+// UpdateMetadata pushes metadata for a metric. It requires AppKey.
+func (d *DatadogClient) UpdateMetadata(ctx context.Context, metricName string, meta MetricMetadata) error {
+	if d.AppKey == "" {
+		return errors.New("DATADOG_APP_KEY is not set (required to update metric metadata)")
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping metric metadata update", map[string]interface{}{
+			"metric": metricName,
+			"unit":   meta.Unit,
+		})
+		return nil
+	}
+	if _, err := d.doAPI(ctx, http.MethodPut, "/api/v1/metrics/"+url.PathEscape(metricName), meta, nil); err != nil {
+		return fmt.Errorf("failed to update metadata of %s: %w", metricName, err)
+	}
+	return nil
+}
+
+// MetadataSender is implemented by senders that can update metric metadata.
+type MetadataSender interface {
+	UpdateMetadata(ctx context.Context, metricName string, meta MetricMetadata) error
+}
+
+// metadataSync pushes metadata once per metric name and process, after the
+// metric was first submitted successfully.
+type metadataSync struct {
+	mu     sync.Mutex
+	synced map[string]bool
+}
+
+// needsSync reports whether name still has to be synced and marks it as done,
+// so a failed update is not retried every cycle.
+func (m *metadataSync) needsSync(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.synced == nil {
+		m.synced = make(map[string]bool)
+	}
+	if m.synced[name] {
+		return false
+	}
+	m.synced[name] = true
+	return true
+}
+
+// runSyncMetadata pushes the metadata of every configured metric.
+func runSyncMetadata(ctx context.Context, opts *options, _ []string) error {
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+
+	apiKey := os.Getenv("DATADOG_API_KEY")
+	appKey := os.Getenv("DATADOG_APP_KEY")
+	logRedactor.AddSecret(apiKey)
+	logRedactor.AddSecret(appKey)
+	if apiKey == "" || appKey == "" {
+		return errors.New("DATADOG_API_KEY and DATADOG_APP_KEY must be set")
+	}
+	client := newDatadogClient(apiKey, config.Datadog)
+	client.AppKey = appKey
+	client.Debug = opts.debug
+	client.DryRun = opts.dryRun
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, metric := range config.Metrics {
+		meta, ok := metadataFor(metric)
+		switch {
+		case !ok:
+			continue
+		case isNameTemplate(metric.Name):
+			fmt.Fprintf(tw, "SKIP\t%s\ttemplated names are synced on first submission\n", metric.Name)
+			continue
+		}
+		if err := client.UpdateMetadata(ctx, metric.Name, meta); err != nil {
+			failed++
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", metric.Name, logRedactor.RedactString(err.Error()))
+			continue
+		}
+		fmt.Fprintf(tw, "OK\t%s\t%s\n", metric.Name, meta.Unit)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to update metadata of %d metrics", failed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric MetricConfig
+		want   MetricMetadata
+		wantOK bool
+	}{
+		{name: "No metadata", metric: MetricConfig{Name: "a"}},
+		{
+			name:   "Gauge with unit",
+			metric: MetricConfig{Name: "a", Unit: "byte", Description: "Database size"},
+			want:   MetricMetadata{Type: "gauge", Unit: "byte", Description: "Database size"},
+			wantOK: true,
+		},
+		{
+			name:   "Distribution",
+			metric: MetricConfig{Name: "a", Unit: "second", Type: metricTypeDistribution},
+			want:   MetricMetadata{Type: "distribution", Unit: "second"},
+			wantOK: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := metadataFor(tc.metric)
+			if ok != tc.wantOK || (tc.wantOK && got != tc.want) {
+				t.Errorf("Expected (%+v, %v), got (%+v, %v)", tc.want, tc.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestMetadataSyncOnce(t *testing.T) {
+	var m metadataSync
+	if !m.needsSync("db.size") {
+		t.Error("Expected first submission to need a sync")
+	}
+	if m.needsSync("db.size") {
+		t.Error("Expected metadata to be synced only once")
+	}
+}
+
+func TestDatadogClientUpdateMetadata(t *testing.T) {
+	var got MetricMetadata
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/v1/metrics/db.size" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("DD-APPLICATION-KEY") != "app-key" {
+			t.Errorf("Expected application key header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode metadata: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "api-key", BaseURL: server.URL}
+	meta := MetricMetadata{Type: "gauge", Unit: "byte"}
+	if err := client.UpdateMetadata(context.Background(), "db.size", meta); err == nil {
+		t.Error("Expected error without application key")
+	}
+
+	client.AppKey = "app-key"
+	if err := client.UpdateMetadata(context.Background(), "db.size", meta); err != nil {
+		t.Fatalf("UpdateMetadata failed: %v", err)
+	}
+	if got != meta {
+		t.Errorf("Expected %+v, got %+v", meta, got)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultMockServerAddr is the default listen address of mock-server.
+const defaultMockServerAddr = "localhost:8080"
+
+// mockSubmission is one accepted request, as recorded by mock-server.
+type mockSubmission struct {
+	Time    time.Time       `json:"time"`
+	Path    string          `json:"path"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// mockServer emulates the Datadog submission endpoints. It checks that a
+// DD-API-KEY header is present and that payloads have the shape of the
+// API, and records every accepted payload as one JSON line.
+type mockServer struct {
+	mu     sync.Mutex
+	record io.Writer
+	count  int
+}
+
+func newMockServer(record io.Writer) *mockServer {
+	return &mockServer{record: record}
+}
+
+// handler returns the routes of the emulated API.
+func (m *mockServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+datadogSeriesPath, m.submission(validateSeriesV1, map[string]string{"status": "ok"}))
+	mux.HandleFunc("POST "+datadogSeriesV2Path, m.submission(validateSeriesV2, map[string][]string{"errors": {}}))
+	mux.HandleFunc("POST "+datadogDistributionPath, m.submission(validateDistributionPoints, map[string]string{"status": "ok"}))
+	mux.HandleFunc("GET "+datadogValidatePath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DD-API-KEY") == "" {
+			writeJSON(w, http.StatusForbidden, map[string][]string{"errors": {"Forbidden"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+	})
+	return mux
+}
+
+// submission handles a submission endpoint whose payloads are checked by
+// validate and answered with accepted.
+func (m *mockServer) submission(validate func([]byte) error, accepted interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DD-API-KEY") == "" {
+			writeJSON(w, http.StatusForbidden, map[string][]string{"errors": {"Forbidden"}})
+			return
+		}
+		body, err := readBody(r)
+		if err == nil {
+			err = validate(body)
+		}
+		if err != nil {
+			logEvent(r.Context(), "warn", "Rejected submission", map[string]interface{}{"path": r.URL.Path, "error": err.Error()})
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+			return
+		}
+		if err := m.save(mockSubmission{Time: time.Now().UTC(), Path: r.URL.Path, Payload: body}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string][]string{"errors": {err.Error()}})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, accepted)
+	}
+}
+
+// save records an accepted submission.
+func (m *mockServer) save(s mockSubmission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count++
+	if m.record == nil {
+		return nil
+	}
+	line, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = m.record.Write(append(line, '\n'))
+	return err
+}
+
+// readBody reads a request body and checks that it is JSON.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("body is not valid JSON")
+	}
+	return body, nil
+}
+
+// validateSeriesV1 checks a payload of /api/v1/series.
+func validateSeriesV1(body []byte) error {
+	var payload Metric
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(payload.Series) == 0 {
+		return errors.New("series is empty")
+	}
+	for i, s := range payload.Series {
+		switch {
+		case s.Metric == "":
+			return fmt.Errorf("series %d: metric is required", i)
+		case len(s.Points) == 0:
+			return fmt.Errorf("series %d: points are required", i)
+		case s.Type != "" && seriesV2Type(s.Type) == seriesV2TypeUnspecified:
+			return fmt.Errorf("series %d: invalid type %q", i, s.Type)
+		}
+		for _, p := range s.Points {
+			if len(p) != 2 {
+				return fmt.Errorf("series %d: points must be [timestamp, value] pairs", i)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSeriesV2 checks a payload of /api/v2/series.
+func validateSeriesV2(body []byte) error {
+	var payload MetricV2
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(payload.Series) == 0 {
+		return errors.New("series is empty")
+	}
+	for i, s := range payload.Series {
+		switch {
+		case s.Metric == "":
+			return fmt.Errorf("series %d: metric is required", i)
+		case len(s.Points) == 0:
+			return fmt.Errorf("series %d: points are required", i)
+		case s.Type < seriesV2TypeUnspecified || s.Type > seriesV2TypeGauge:
+			return fmt.Errorf("series %d: invalid type %d", i, s.Type)
+		}
+		for _, p := range s.Points {
+			if p.Timestamp <= 0 {
+				return fmt.Errorf("series %d: timestamp is required", i)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDistributionPoints checks a payload of /api/v1/distribution_points.
+func validateDistributionPoints(body []byte) error {
+	var payload struct {
+		Series []struct {
+			Metric string              `json:"metric"`
+			Points [][]json.RawMessage `json:"points"`
+		} `json:"series"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if len(payload.Series) == 0 {
+		return errors.New("series is empty")
+	}
+	for i, s := range payload.Series {
+		if s.Metric == "" {
+			return fmt.Errorf("series %d: metric is required", i)
+		}
+		if len(s.Points) == 0 {
+			return fmt.Errorf("series %d: points are required", i)
+		}
+		for _, p := range s.Points {
+			var values []float64
+			if len(p) != 2 || json.Unmarshal(p[1], &values) != nil {
+				return fmt.Errorf("series %d: points must be [timestamp, [values...]] pairs", i)
+			}
+		}
+	}
+	return nil
+}
+
+// runMockServer serves the emulated API until interrupted.
+func runMockServer(ctx context.Context, opts *options, _ []string) error {
+	var record io.Writer
+	if opts.mockRecord != "" {
+		f, err := os.OpenFile(opts.mockRecord, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open record file: %w", err)
+		}
+		defer f.Close()
+		record = f
+	}
+	mock := newMockServer(record)
+
+	ln, err := net.Listen("tcp", opts.mockAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on mock server address: %w", err)
+	}
+	srv := &http.Server{Handler: mock.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logEvent(ctx, "info", "Mock Datadog API listening", map[string]interface{}{"addr": ln.Addr().String()})
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	logEvent(ctx, "info", "Mock Datadog API stopped", map[string]interface{}{"submissions": mock.count})
+	return nil
+}
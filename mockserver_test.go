@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMockServerAcceptsClient(t *testing.T) {
+	var record bytes.Buffer
+	srv := httptest.NewServer(newMockServer(&record).handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		v2   bool
+		send func(client *DatadogClient) error
+		path string
+	}{
+		{name: "SeriesV1", send: func(c *DatadogClient) error {
+			return c.SendMetric(context.Background(), "app.orders", 1, []string{"env:test"}, "db")
+		}, path: datadogSeriesPath},
+		{name: "SeriesV2", v2: true, send: func(c *DatadogClient) error {
+			return c.SendMetric(context.Background(), "app.orders", 1, nil, "db")
+		}, path: datadogSeriesV2Path},
+		{name: "Distribution", send: func(c *DatadogClient) error {
+			return c.SendDistribution(context.Background(), "app.latency", []float64{1, 2}, nil, "")
+		}, path: datadogDistributionPath},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			record.Reset()
+			client := &DatadogClient{APIKey: "test", BaseURL: srv.URL, V2: tc.v2}
+			if err := tc.send(client); err != nil {
+				t.Fatalf("Expected the submission to be accepted, got %v", err)
+			}
+			var got mockSubmission
+			if err := json.Unmarshal(record.Bytes(), &got); err != nil {
+				t.Fatalf("Expected a recorded submission, got %q: %v", record.String(), err)
+			}
+			if got.Path != tc.path {
+				t.Errorf("Expected path %s, got %s", tc.path, got.Path)
+			}
+		})
+	}
+}
+
+func TestMockServerRejects(t *testing.T) {
+	srv := httptest.NewServer(newMockServer(nil).handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		apiKey     string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "MissingKey", path: datadogSeriesPath, body: `{"series":[]}`, wantStatus: http.StatusForbidden},
+		{name: "NotJSON", path: datadogSeriesPath, apiKey: "k", body: `series`, wantStatus: http.StatusBadRequest, wantError: "not valid JSON"},
+		{name: "EmptySeries", path: datadogSeriesPath, apiKey: "k", body: `{"series":[]}`, wantStatus: http.StatusBadRequest, wantError: "series is empty"},
+		{name: "MissingMetric", path: datadogSeriesPath, apiKey: "k", body: `{"series":[{"points":[[1,2]]}]}`, wantStatus: http.StatusBadRequest, wantError: "metric is required"},
+		{name: "BadPoint", path: datadogSeriesPath, apiKey: "k", body: `{"series":[{"metric":"a","points":[[1]]}]}`, wantStatus: http.StatusBadRequest, wantError: "[timestamp, value]"},
+		{name: "BadV2Type", path: datadogSeriesV2Path, apiKey: "k", body: `{"series":[{"metric":"a","type":9,"points":[{"timestamp":1,"value":1}]}]}`, wantStatus: http.StatusBadRequest, wantError: "invalid type 9"},
+		{name: "BadDistribution", path: datadogDistributionPath, apiKey: "k", body: `{"series":[{"metric":"a","points":[[1,2]]}]}`, wantStatus: http.StatusBadRequest, wantError: "[values...]"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.apiKey != "" {
+				req.Header.Set("DD-API-KEY", tc.apiKey)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+			var body struct {
+				Errors []string `json:"errors"`
+			}
+			_ = json.NewDecoder(resp.Body).Decode(&body)
+			if tc.wantError != "" && (len(body.Errors) == 0 || !strings.Contains(body.Errors[0], tc.wantError)) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantError, body.Errors)
+			}
+		})
+	}
+}
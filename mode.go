@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metric modes.
+const (
+	modeMetrics = "metrics"
+	modeLogs    = "logs"
+	modeEvents  = "events"
+)
+
+// errRecordsUnsupported is returned when the sender of a metric cannot
+// forward its rows.
+var errRecordsUnsupported = errors.New("the configured sender does not support this mode")
+
+// MetricMode selects what a metric's query produces: metrics (the default),
+// or a Datadog log (logs) or event (events) per returned row.
+type MetricMode string
+
+// UnmarshalYAML accepts metrics, logs or events.
+func (m *MetricMode) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Value {
+	case "", modeMetrics, modeLogs, modeEvents:
+		*m = MetricMode(node.Value)
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid mode %q (must be metrics, logs or events)", node.Line, node.Value)
+}
+
+// recordMode reports whether the metric forwards the rows of its query as
+// they are instead of submitting values.
+func (m MetricConfig) recordMode() bool {
+	return m.Mode == modeLogs || m.Mode == modeEvents
+}
+
+// validateRecordMode checks that a metric in a record mode has a database
+// query, none of the settings that only apply to values and, in events
+// mode, a valid event. A host column sets the host of every row.
+func validateRecordMode(metric MetricConfig) error {
+	metric.HostColumn = ""
+	switch {
+	case metric.execSource():
+		return fmt.Errorf("mode %s cannot be used with source exec", metric.Mode)
+	case metric.Query == "":
+		return fmt.Errorf("mode %s requires a query", metric.Mode)
+	case metric.rowMode() || metric.Alert != nil || metric.Anomaly != nil || metric.MaxAge > 0 || metric.ExpectChange > 0 || metric.CacheTTL > 0:
+		return fmt.Errorf("mode %s cannot be combined with tag_columns, a templated name, aggregate, type, alert, anomaly, max_age, expect_change or cache_ttl", metric.Mode)
+	case metric.Mode == modeEvents:
+		return metric.Events.validate()
+	}
+	return nil
+}
+
+// recordHost returns the host of a row in a record mode: the value of the
+// metric's host column, matched case-insensitively, or the metric's host
+// when the row has none.
+func recordHost(metric MetricConfig, record map[string]interface{}) string {
+	if metric.HostColumn != "" {
+		if value, ok := recordColumn(record, metric.HostColumn); ok && value != nil {
+			return tagValue(value)
+		}
+	}
+	return metric.Host
+}
+
+// collectRecords runs the query of a metric in a record mode and forwards
+// its rows. An empty result forwards nothing and is not an error.
+func (c *Collector) collectRecords(ctx context.Context, dbClient *SQLDB, telemetry *Telemetry, metric MetricConfig, result MetricResult) MetricResult {
+	fail := func(status string, err error) MetricResult {
+		result.Status = status
+		result.Error = logRedactor.RedactString(err.Error())
+		return result
+	}
+
+	fetchCtx, cancel := withOptionalTimeout(ctx, metric.Timeout)
+	start := time.Now()
+	records, err := withRetry(fetchCtx, metric.Retries, metric.RetryDelay, func(attempt int, delay time.Duration, err error) {
+		logEvent(ctx, "warn", "Retrying query after transient error", map[string]interface{}{
+			"metric":  metric.Name,
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err.Error(),
+		})
+	}, func() ([]map[string]interface{}, error) {
+		return dbClient.Records(fetchCtx, metric)
+	})
+	cancel()
+	result.QueryTimeMs = float64(time.Since(start).Microseconds()) / 1000.0
+	c.recordBreaker(ctx, err)
+	if err != nil {
+		c.Errors.Log(ctx, "error", "Error fetching metric from DB", metric.Name, err, map[string]interface{}{
+			"metric": metric.Name,
+		})
+		return fail(statusQueryFailed, err)
+	}
+
+	forward := c.forwardLogs
+	if metric.Mode == modeEvents {
+		forward = c.forwardEvents
+	}
+	if len(records) > 0 {
+		if err := forward(ctx, telemetry, metric, records); err != nil {
+			c.Errors.Log(ctx, "error", "Failed to forward rows", metric.Name, err, map[string]interface{}{
+				"metric": metric.Name,
+				"mode":   string(metric.Mode),
+			})
+			return fail(statusSendFailed, err)
+		}
+	}
+	result.Series = len(records)
+	result.Status = statusSent
+	return result
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// monitorManagedTag marks monitors created by the monitors command, so they
+// can be found and updated on the next run.
+const monitorManagedTag = "managed_by:datadog-sql-metrics"
+
+const defaultMonitorWindow = 5 * time.Minute
+
+// MonitorConfig describes a Datadog metric monitor kept next to the metric
+// definition and applied with the monitors command.
+type MonitorConfig struct {
+	Name string `yaml:"name,omitempty"`
+	// Critical and Warning are the alert thresholds.
+	Critical *float64 `yaml:"critical"`
+	Warning  *float64 `yaml:"warning,omitempty"`
+	// Comparator is one of >, >=, < or <=. Defaults to >.
+	Comparator string `yaml:"comparator,omitempty"`
+	// Aggregation is the time aggregation: avg, min, max or sum. Defaults to avg.
+	Aggregation string        `yaml:"aggregation,omitempty"`
+	Window      time.Duration `yaml:"window,omitempty"`
+	Message     string        `yaml:"message,omitempty"`
+	// Notify lists notification handles such as @slack-sre or @pagerduty.
+	Notify       []string `yaml:"notify,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"`
+	NotifyNoData bool     `yaml:"notify_no_data,omitempty"`
+}
+
+// UnmarshalYAML decodes the block and validates it.
+func (m *MonitorConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain MonitorConfig
+	var cfg plain
+	if err := node.Decode(&cfg); err != nil {
+		return err
+	}
+	*m = MonitorConfig(cfg)
+	if err := m.validate(); err != nil {
+		return fmt.Errorf("line %d: invalid monitor: %w", node.Line, err)
+	}
+	return nil
+}
+
+func (m *MonitorConfig) validate() error {
+	switch {
+	case m.Critical == nil:
+		return errors.New("critical threshold is required")
+	case !slices.Contains([]string{"", ">", ">=", "<", "<="}, m.Comparator):
+		return fmt.Errorf("invalid comparator %q (must be >, >=, < or <=)", m.Comparator)
+	case !slices.Contains([]string{"", "avg", "min", "max", "sum"}, m.Aggregation):
+		return fmt.Errorf("invalid aggregation %q (must be avg, min, max or sum)", m.Aggregation)
+	case m.Window < 0 || m.Window%time.Minute != 0:
+		return fmt.Errorf("window %s must be a whole number of minutes", m.Window)
+	}
+	if m.Warning != nil {
+		above := !strings.HasPrefix(m.Comparator, "<")
+		if above && *m.Warning > *m.Critical || !above && *m.Warning < *m.Critical {
+			return errors.New("warning threshold must be crossed before the critical threshold")
+		}
+	}
+	return nil
+}
+
+// Monitor is a Datadog monitor as accepted by the monitors API.
+type Monitor struct {
+	ID      int64          `json:"id,omitempty"`
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	Query   string         `json:"query"`
+	Message string         `json:"message"`
+	Tags    []string       `json:"tags,omitempty"`
+	Options MonitorOptions `json:"options"`
+}
+
+// MonitorOptions holds the monitor thresholds and notification settings.
+type MonitorOptions struct {
+	Thresholds   map[string]float64 `json:"thresholds"`
+	NotifyNoData bool               `json:"notify_no_data,omitempty"`
+}
+
+// buildMonitor renders the Datadog monitor for a metric.
+func buildMonitor(metric MetricConfig, cfg *MonitorConfig) Monitor {
+	comparator := cfg.Comparator
+	if comparator == "" {
+		comparator = ">"
+	}
+	aggregation := cfg.Aggregation
+	if aggregation == "" {
+		aggregation = "avg"
+	}
+	window := cfg.Window
+	if window == 0 {
+		window = defaultMonitorWindow
+	}
+	scope := "*"
+	if len(metric.Tags) > 0 {
+		scope = strings.Join(metric.Tags, ",")
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("%s %s %s", metric.Name, comparator, formatValue(*cfg.Critical))
+	}
+	message := cfg.Message
+	if message == "" {
+		message = fmt.Sprintf("%s is %s %s.", metric.Name, comparator, formatValue(*cfg.Critical))
+	}
+	if len(cfg.Notify) > 0 {
+		message += "\n\n" + strings.Join(cfg.Notify, " ")
+	}
+
+	thresholds := map[string]float64{"critical": *cfg.Critical}
+	if cfg.Warning != nil {
+		thresholds["warning"] = *cfg.Warning
+	}
+
+	return Monitor{
+		Name:    name,
+		Type:    "metric alert",
+		Query:   fmt.Sprintf("%s(%s):%s:%s{%s} %s %s", aggregation, monitorWindow(window), aggregation, metric.Name, scope, comparator, formatValue(*cfg.Critical)),
+		Message: message,
+		Tags:    append(slices.Clone(cfg.Tags), monitorManagedTag, "metric:"+metric.Name),
+		Options: MonitorOptions{Thresholds: thresholds, NotifyNoData: cfg.NotifyNoData},
+	}
+}
+
+// monitorWindow formats a window as a Datadog timeframe such as last_5m or last_1h.
+func monitorWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("last_%dh", int(d/time.Hour))
+	}
+	return fmt.Sprintf("last_%dm", int(d/time.Minute))
+}
+
+// managedMonitors returns the monitors previously created by this tool, keyed by name.
+func (d *DatadogClient) managedMonitors(ctx context.Context) (map[string]Monitor, error) {
+	var monitors []Monitor
+	path := "/api/v1/monitor?monitor_tags=" + url.QueryEscape(monitorManagedTag)
+	if _, err := d.doAPI(ctx, http.MethodGet, path, nil, &monitors); err != nil {
+		return nil, fmt.Errorf("failed to list monitors: %w", err)
+	}
+	byName := make(map[string]Monitor, len(monitors))
+	for _, m := range monitors {
+		byName[m.Name] = m
+	}
+	return byName, nil
+}
+
+// upsertMonitor creates the monitor, or updates it when id is non-zero.
+func (d *DatadogClient) upsertMonitor(ctx context.Context, id int64, m Monitor) error {
+	if id == 0 {
+		_, err := d.doAPI(ctx, http.MethodPost, "/api/v1/monitor", m, nil)
+		return err
+	}
+	_, err := d.doAPI(ctx, http.MethodPut, fmt.Sprintf("/api/v1/monitor/%d", id), m, nil)
+	return err
+}
+
+// runMonitors creates or updates a Datadog monitor for every metric with a
+// monitor block. With -dry-run the monitors are printed as JSON instead.
+func runMonitors(ctx context.Context, opts *options, _ []string) error {
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		return configError("failed to load config: %w", err)
+	}
+
+	var monitors []Monitor
+	for _, metric := range config.Metrics {
+		if metric.Monitor != nil {
+			monitors = append(monitors, buildMonitor(metric, metric.Monitor))
+		}
+	}
+	if opts.dryRun {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(monitors)
+	}
+
+	apiKey := os.Getenv("DATADOG_API_KEY")
+	appKey := os.Getenv("DATADOG_APP_KEY")
+	logRedactor.AddSecret(apiKey)
+	logRedactor.AddSecret(appKey)
+	if apiKey == "" || appKey == "" {
+		return errors.New("DATADOG_API_KEY and DATADOG_APP_KEY must be set")
+	}
+	client := newDatadogClient(apiKey, config.Datadog)
+	client.AppKey = appKey
+	client.Debug = opts.debug
+
+	existing, err := client.managedMonitors(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, m := range monitors {
+		action := "CREATED"
+		id := existing[m.Name].ID
+		if id != 0 {
+			action = "UPDATED"
+		}
+		if err := client.upsertMonitor(ctx, id, m); err != nil {
+			failed++
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", m.Name, logRedactor.RedactString(err.Error()))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", action, m.Name, m.Query)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d monitors", failed, len(monitors))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildMonitor(t *testing.T) {
+	var metric MetricConfig
+	input := `
+name: custom.metric.queue_depth
+tags: ["env:prod", "team:sre"]
+monitor:
+  critical: 5000
+  warning: 1000
+  window: 1h
+  message: "Queue is backing up"
+  notify: ["@slack-sre"]
+`
+	if err := yaml.Unmarshal([]byte(input), &metric); err != nil {
+		t.Fatalf("Failed to parse metric: %v", err)
+	}
+
+	m := buildMonitor(metric, metric.Monitor)
+	wantQuery := "avg(last_1h):avg:custom.metric.queue_depth{env:prod,team:sre} > 5000"
+	if m.Query != wantQuery {
+		t.Errorf("Expected query %q, got %q", wantQuery, m.Query)
+	}
+	if m.Name != "custom.metric.queue_depth > 5000" {
+		t.Errorf("Unexpected default name %q", m.Name)
+	}
+	if m.Message != "Queue is backing up\n\n@slack-sre" {
+		t.Errorf("Unexpected message %q", m.Message)
+	}
+	if m.Options.Thresholds["warning"] != 1000 || m.Options.Thresholds["critical"] != 5000 {
+		t.Errorf("Unexpected thresholds %v", m.Options.Thresholds)
+	}
+	if !strings.Contains(strings.Join(m.Tags, ","), monitorManagedTag) {
+		t.Errorf("Expected managed tag, got %v", m.Tags)
+	}
+}
+
+func TestMonitorConfigValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Missing critical", input: "monitor: {warning: 1}"},
+		{name: "Invalid comparator", input: "monitor: {critical: 1, comparator: '=='}"},
+		{name: "Warning after critical", input: "monitor: {critical: 10, warning: 20}"},
+		{name: "Warning after critical below", input: "monitor: {critical: 10, warning: 5, comparator: '<'}"},
+		{name: "Sub-minute window", input: "monitor: {critical: 10, window: 30s}"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var metric MetricConfig
+			if err := yaml.Unmarshal([]byte(tc.input), &metric); err == nil {
+				t.Error("Expected error but got nil")
+			}
+		})
+	}
+}
+
+func TestUpsertMonitor(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			if r.URL.Query().Get("monitor_tags") != monitorManagedTag {
+				t.Errorf("Expected managed tag filter, got %q", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode([]Monitor{{ID: 42, Name: "existing"}})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "api", AppKey: "app", BaseURL: server.URL}
+	existing, err := client.managedMonitors(context.Background())
+	if err != nil {
+		t.Fatalf("managedMonitors failed: %v", err)
+	}
+	if err := client.upsertMonitor(context.Background(), existing["existing"].ID, Monitor{Name: "existing"}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := client.upsertMonitor(context.Background(), existing["new"].ID, Monitor{Name: "new"}); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	want := []string{"GET /api/v1/monitor", "PUT /api/v1/monitor/42", "POST /api/v1/monitor"}
+	if strings.Join(requests, ";") != strings.Join(want, ";") {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxMetricNameLength is the longest metric name Datadog accepts.
+const maxMetricNameLength = 200
+
+var invalidMetricChars = regexp.MustCompile(`[^A-Za-z0-9_.]+`)
+
+// isNameTemplate reports whether a metric name is a Go template rendered from
+// row columns, e.g. `db.table.rows.{{.table_name}}`.
+func isNameTemplate(name string) bool {
+	return strings.Contains(name, "{{")
+}
+
+// parseNameTemplate parses a templated metric name. Referencing a column the
+// query does not return is an error when the name is rendered.
+func parseNameTemplate(name string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric name template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateFields returns the column names referenced by a name template.
+func templateFields(tmpl *template.Template) []string {
+	seen := map[string]bool{}
+	var fields []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if name := n.Ident[0]; !seen[name] {
+				seen[name] = true
+				fields = append(fields, name)
+			}
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+	return fields
+}
+
+// renderMetricName renders a name template with the row's column values. The
+// values are sanitized first, then the whole name is made to follow Datadog's
+// naming rules.
+func renderMetricName(tmpl *template.Template, columns map[string]string) (string, error) {
+	data := make(map[string]string, len(columns))
+	for name, value := range columns {
+		data[name] = sanitizeMetricSegment(value)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render metric name: %w", err)
+	}
+	return sanitizeMetricName(b.String())
+}
+
+// sanitizeMetricSegment replaces runs of characters not allowed in metric
+// names with a single underscore.
+func sanitizeMetricSegment(s string) string {
+	return strings.Trim(invalidMetricChars.ReplaceAllString(s, "_"), "_")
+}
+
+// sanitizeMetricName enforces Datadog's metric naming rules: ASCII letters,
+// digits, underscores and periods, starting with a letter, at most 200
+// characters and without empty segments.
+func sanitizeMetricName(name string) (string, error) {
+	name = invalidMetricChars.ReplaceAllString(name, "_")
+	var segments []string
+	for _, segment := range strings.Split(name, ".") {
+		if segment = strings.Trim(segment, "_"); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	name = strings.Join(segments, ".")
+	name = strings.TrimLeft(name, "0123456789_.")
+	if name == "" {
+		return "", fmt.Errorf("metric name is empty after sanitizing")
+	}
+	if len(name) > maxMetricNameLength {
+		name = strings.TrimRight(name[:maxMetricNameLength], "_.")
+	}
+	return name, nil
+}
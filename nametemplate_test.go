@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderMetricName(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		columns  map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Simple column",
+			template: "db.table.rows.{{.table_name}}",
+			columns:  map[string]string{"table_name": "orders"},
+			want:     "db.table.rows.orders",
+		},
+		{
+			name:     "Invalid characters replaced",
+			template: "db.table.rows.{{.table_name}}",
+			columns:  map[string]string{"table_name": "Order Items (v2)"},
+			want:     "db.table.rows.Order_Items_v2",
+		},
+		{
+			name:     "Empty value collapses segment",
+			template: "db.{{.schema}}.rows",
+			columns:  map[string]string{"schema": "---"},
+			want:     "db.rows",
+		},
+		{
+			name:     "Leading digits removed",
+			template: "{{.table_name}}.rows",
+			columns:  map[string]string{"table_name": "2024_events"},
+			want:     "events.rows",
+		},
+		{
+			name:     "Missing column",
+			template: "db.{{.missing}}",
+			columns:  map[string]string{"table_name": "orders"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseNameTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			got, err := renderMetricName(tmpl, tc.columns)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	tmpl, err := parseNameTemplate("db.{{.schema}}.{{if .table_name}}{{.table_name}}{{end}}.rows")
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	want := []string{"schema", "table_name"}
+	if got := templateFields(tmpl); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestRowLayoutTemplatedName(t *testing.T) {
+	metric := MetricConfig{Name: "db.table.rows.{{.table_name}}", Query: "SELECT n_live_tup, relname AS table_name FROM pg_stat_user_tables"}
+	if err := validateMetricQuery(metric); err != nil {
+		t.Fatalf("Expected templated name columns to be allowed, got %v", err)
+	}
+
+	layout, err := newRowLayout([]string{"n_live_tup", "TABLE_NAME"}, metric)
+	if err != nil {
+		t.Fatalf("newRowLayout failed: %v", err)
+	}
+	got, _, err := layout.sample(metric, []interface{}{int64(10), []byte("users")})
+	if err != nil {
+		t.Fatalf("sample failed: %v", err)
+	}
+	if got.Name != "db.table.rows.users" || got.Value != 10 {
+		t.Errorf("Unexpected sample %+v", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+	"gopkg.in/yaml.v3"
+)
+
+// Errors returned by a query that produced no value to submit.
+var (
+	errNullResult = errors.New("query returned NULL")
+	errNoRows     = source.ErrNoRows
+)
+
+// Empty result actions for on_null and on_no_rows.
+const (
+	emptyError   = "error"
+	emptySkip    = "skip"
+	emptyZero    = "zero"
+	emptyDefault = "default"
+)
+
+// isEmptyResult reports whether err means the query returned NULL or no rows.
+func isEmptyResult(err error) bool {
+	return errors.Is(err, errNullResult) || errors.Is(err, errNoRows)
+}
+
+// EmptyPolicy decides what happens when a query returns NULL or no rows. In
+// YAML it is one of `error` (the default), `skip`, `zero` or `default: <value>`.
+type EmptyPolicy struct {
+	Action  string
+	Default float64
+}
+
+// UnmarshalYAML accepts a scalar action or a `default: <value>` mapping. The
+// inline form `"default: 5"` is accepted as well.
+func (p *EmptyPolicy) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		action := strings.TrimSpace(node.Value)
+		if rest, ok := strings.CutPrefix(action, emptyDefault+":"); ok {
+			var value float64
+			if err := yaml.Unmarshal([]byte(rest), &value); err != nil {
+				return fmt.Errorf("line %d: invalid default value %q", node.Line, strings.TrimSpace(rest))
+			}
+			*p = EmptyPolicy{Action: emptyDefault, Default: value}
+			return nil
+		}
+		switch action {
+		case "", emptyError, emptySkip, emptyZero:
+			*p = EmptyPolicy{Action: action}
+			return nil
+		}
+		return fmt.Errorf("line %d: invalid value %q (must be error, skip, zero or default: <value>)", node.Line, action)
+	case yaml.MappingNode:
+		var m struct {
+			Default *float64 `yaml:"default"`
+		}
+		if err := node.Decode(&m); err != nil {
+			return err
+		}
+		if m.Default == nil {
+			return fmt.Errorf("line %d: expected default: <value>", node.Line)
+		}
+		*p = EmptyPolicy{Action: emptyDefault, Default: *m.Default}
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid empty result policy", node.Line)
+}
+
+// apply resolves an empty result. It returns the value to submit, or skip when
+// nothing should be submitted. With the error action, err is returned unchanged.
+func (p EmptyPolicy) apply(err error) (value float64, skip bool, _ error) {
+	switch p.Action {
+	case emptySkip:
+		return 0, true, nil
+	case emptyZero:
+		return 0, false, nil
+	case emptyDefault:
+		return p.Default, false, nil
+	default:
+		return 0, false, err
+	}
+}
+
+// resolveEmptyResult applies the metric's on_null or on_no_rows policy to a
+// query error. Errors other than empty results are returned unchanged.
+func resolveEmptyResult(metric MetricConfig, err error) (value float64, skip bool, _ error) {
+	switch {
+	case errors.Is(err, errNullResult):
+		return metric.OnNull.apply(err)
+	case errors.Is(err, errNoRows):
+		return metric.OnNoRows.apply(err)
+	default:
+		return 0, false, err
+	}
+}
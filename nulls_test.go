@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEmptyPolicyUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    EmptyPolicy
+		wantErr bool
+	}{
+		{name: "Skip", input: "on_null: skip", want: EmptyPolicy{Action: emptySkip}},
+		{name: "Zero", input: "on_null: zero", want: EmptyPolicy{Action: emptyZero}},
+		{name: "Error", input: "on_null: error", want: EmptyPolicy{Action: emptyError}},
+		{name: "Default mapping", input: "on_null:\n  default: 1.5", want: EmptyPolicy{Action: emptyDefault, Default: 1.5}},
+		{name: "Default inline", input: `on_null: "default: -1"`, want: EmptyPolicy{Action: emptyDefault, Default: -1}},
+		{name: "Unknown action", input: "on_null: ignore", wantErr: true},
+		{name: "Invalid default", input: `on_null: "default: many"`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var metric MetricConfig
+			err := yaml.Unmarshal([]byte(tc.input), &metric)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if metric.OnNull != tc.want {
+				t.Errorf("Expected %+v, got %+v", tc.want, metric.OnNull)
+			}
+		})
+	}
+}
+
+func TestResolveEmptyResult(t *testing.T) {
+	metric := MetricConfig{
+		OnNull:   EmptyPolicy{Action: emptyDefault, Default: 7},
+		OnNoRows: EmptyPolicy{Action: emptySkip},
+	}
+	other := errors.New("syntax error")
+
+	tests := []struct {
+		name      string
+		metric    MetricConfig
+		err       error
+		wantValue float64
+		wantSkip  bool
+		wantErr   error
+	}{
+		{name: "NULL uses default", metric: metric, err: errNullResult, wantValue: 7},
+		{name: "No rows skipped", metric: metric, err: errNoRows, wantSkip: true},
+		{name: "No policy keeps error", metric: MetricConfig{}, err: errNoRows, wantErr: errNoRows},
+		{name: "Other errors unchanged", metric: metric, err: other, wantErr: other},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			value, skip, err := resolveEmptyResult(tc.metric, tc.err)
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if value != tc.wantValue || skip != tc.wantSkip {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tc.wantValue, tc.wantSkip, value, skip)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// OTLPConfig configures the otlp sink, which exports the collected values
+// through the OpenTelemetry metrics SDK over OTLP/HTTP.
+type OTLPConfig struct {
+	// Endpoint is the OTLP/HTTP collector, e.g. "http://otel-collector:4318".
+	// When empty the standard OTEL_EXPORTER_OTLP_* variables are used.
+	Endpoint    string            `yaml:"endpoint,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	ServiceName string            `yaml:"service_name,omitempty"`
+}
+
+// OTLPSender records gauges and histograms with the OpenTelemetry metrics
+// SDK. Points are exported when the collection cycle is flushed.
+type OTLPSender struct {
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+
+	mu         sync.Mutex
+	gauges     map[string]metric.Float64Gauge
+	histograms map[string]metric.Float64Histogram
+}
+
+// newOTLPSink creates the otlp sink from the `otlp:` configuration block.
+func newOTLPSink(ctx context.Context, config *Config, _ *options) (MetricSender, error) {
+	cfg := config.OTLP
+	var opts []otlpmetrichttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, configError("failed to create OTLP exporter: %w", err)
+	}
+	return newOTLPSender(sdkmetric.NewPeriodicReader(exporter), cfg.ServiceName), nil
+}
+
+// newOTLPSender creates a sender collecting through reader.
+func newOTLPSender(reader sdkmetric.Reader, serviceName string) *OTLPSender {
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.instance.id", runID),
+		)),
+	)
+	return &OTLPSender{
+		provider:   provider,
+		meter:      provider.Meter(tracerName),
+		gauges:     make(map[string]metric.Float64Gauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+// tagAttributes converts Datadog style "key:value" tags and the host into
+// OpenTelemetry attributes. Tags without a value become "key" = "".
+func tagAttributes(tags []string, host string) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(tags)+1)
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	if host != "" {
+		attrs = append(attrs, attribute.String("host.name", host))
+	}
+	return attrs
+}
+
+// SendMetric records value as the last value of a gauge.
+func (o *OTLPSender) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	o.mu.Lock()
+	gauge, ok := o.gauges[metricName]
+	if !ok {
+		var err error
+		gauge, err = o.meter.Float64Gauge(metricName)
+		if err != nil {
+			o.mu.Unlock()
+			return err
+		}
+		o.gauges[metricName] = gauge
+	}
+	o.mu.Unlock()
+
+	gauge.Record(ctx, value, metric.WithAttributes(tagAttributes(tags, host)...))
+	return nil
+}
+
+// SendDistribution implements DistributionSender with a histogram.
+func (o *OTLPSender) SendDistribution(ctx context.Context, metricName string, values []float64, tags []string, host string) error {
+	o.mu.Lock()
+	histogram, ok := o.histograms[metricName]
+	if !ok {
+		var err error
+		histogram, err = o.meter.Float64Histogram(metricName)
+		if err != nil {
+			o.mu.Unlock()
+			return err
+		}
+		o.histograms[metricName] = histogram
+	}
+	o.mu.Unlock()
+
+	opt := metric.WithAttributes(tagAttributes(tags, host)...)
+	for _, v := range values {
+		histogram.Record(ctx, v, opt)
+	}
+	return nil
+}
+
+// Flush exports the points recorded during the cycle.
+func (o *OTLPSender) Flush(ctx context.Context) error {
+	return o.provider.ForceFlush(ctx)
+}
+
+// Close exports any remaining points and stops the exporter.
+func (o *OTLPSender) Close(ctx context.Context) error {
+	return o.provider.Shutdown(ctx)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestOTLPSenderRecordsGauges(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	sender := newOTLPSender(reader, "")
+	ctx := context.Background()
+
+	if err := sender.SendMetric(ctx, "db.users", 41, []string{"env:test"}, "db-01"); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.SendMetric(ctx, "db.users", 42, []string{"env:test"}, "db-01"); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := sender.SendDistribution(ctx, "db.latency", []float64{1, 2, 3}, nil, ""); err != nil {
+		t.Fatalf("SendDistribution failed: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("Expected 1 scope, got %d", len(rm.ScopeMetrics))
+	}
+
+	got := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		got[m.Name] = m.Data
+	}
+	gauge, ok := got["db.users"].(metricdata.Gauge[float64])
+	if !ok || len(gauge.DataPoints) != 1 {
+		t.Fatalf("Expected one gauge point, got %#v", got["db.users"])
+	}
+	point := gauge.DataPoints[0]
+	if point.Value != 42 {
+		t.Errorf("Expected last value 42, got %v", point.Value)
+	}
+	if v, _ := point.Attributes.Value(attribute.Key("env")); v.AsString() != "test" {
+		t.Errorf("Expected env attribute, got %v", point.Attributes)
+	}
+	if v, _ := point.Attributes.Value(attribute.Key("host.name")); v.AsString() != "db-01" {
+		t.Errorf("Expected host.name attribute, got %v", point.Attributes)
+	}
+	histogram, ok := got["db.latency"].(metricdata.Histogram[float64])
+	if !ok || histogram.DataPoints[0].Count != 3 {
+		t.Errorf("Expected histogram with 3 values, got %#v", got["db.latency"])
+	}
+}
+
+func TestTagAttributes(t *testing.T) {
+	attrs := tagAttributes([]string{"env:prod", "region:us:east", "canary"}, "")
+	want := []attribute.KeyValue{
+		attribute.String("env", "prod"),
+		attribute.String("region", "us:east"),
+		attribute.String("canary", ""),
+	}
+	if len(attrs) != len(want) {
+		t.Fatalf("Expected %d attributes, got %v", len(want), attrs)
+	}
+	for i := range want {
+		if attrs[i] != want[i] {
+			t.Errorf("Attribute %d: expected %v, got %v", i, want[i], attrs[i])
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QueryParam is a bind variable of a query: a static value, or the value of
+// an environment variable read when the query runs. In YAML it is a scalar
+// or `env: NAME` with an optional `default`.
+type QueryParam struct {
+	Value   interface{}
+	Env     string
+	Default *string
+}
+
+// UnmarshalYAML accepts a scalar value or an `env:` mapping.
+func (p *QueryParam) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		*p = QueryParam{Value: value}
+		return nil
+	case yaml.MappingNode:
+		var m struct {
+			Env     string  `yaml:"env"`
+			Default *string `yaml:"default"`
+		}
+		if err := node.Decode(&m); err != nil {
+			return err
+		}
+		if m.Env == "" {
+			return fmt.Errorf("line %d: expected env: <variable>", node.Line)
+		}
+		*p = QueryParam{Env: m.Env, Default: m.Default}
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid query param (must be a value or env: <variable>)", node.Line)
+}
+
+// resolve returns the value bound to the query.
+func (p QueryParam) resolve() (interface{}, error) {
+	if p.Env == "" {
+		return p.Value, nil
+	}
+	if value, ok := os.LookupEnv(p.Env); ok {
+		return value, nil
+	}
+	if p.Default != nil {
+		return *p.Default, nil
+	}
+	return nil, fmt.Errorf("query param: environment variable %s is not set", p.Env)
+}
+
+// queryArgs resolves the metric's params in order.
+func (m MetricConfig) queryArgs() ([]interface{}, error) {
+	if len(m.Params) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(m.Params))
+	for i, param := range m.Params {
+		value, err := param.resolve()
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return args, nil
+}
+
+// positionalParam matches PostgreSQL style placeholders such as $1.
+var positionalParam = regexp.MustCompile(`\$(\d+)`)
+
+// validateMetricParams checks that every $n placeholder of a query has a
+// param. MySQL style ? placeholders are not counted, as ? is also a
+// PostgreSQL JSON operator.
+func validateMetricParams(metrics []MetricConfig) error {
+	for _, metric := range metrics {
+		if len(metric.Params) > 0 && metric.execSource() {
+			return fmt.Errorf("metric %q: params cannot be used with source exec", metric.Name)
+		}
+		for _, match := range positionalParam.FindAllStringSubmatch(metric.Query, -1) {
+			n, err := strconv.Atoi(match[1])
+			if err != nil || n < 1 || n > len(metric.Params) {
+				return fmt.Errorf("metric %q: query uses %s but %d params are configured", metric.Name, match[0], len(metric.Params))
+			}
+		}
+	}
+	return nil
+}
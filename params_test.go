@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestQueryParamUnmarshalYAML(t *testing.T) {
+	t.Setenv("ORDERS_REGION", "eu-west-1")
+
+	var metric MetricConfig
+	data := `
+name: orders.pending
+query: "SELECT count(*) FROM orders WHERE region = $1 AND priority > $2 AND tenant = $3"
+params:
+  - env: ORDERS_REGION
+  - 3
+  - env: ORDERS_TENANT
+    default: "acme"
+`
+	if err := yaml.Unmarshal([]byte(data), &metric); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	args, err := metric.queryArgs()
+	if err != nil {
+		t.Fatalf("queryArgs failed: %v", err)
+	}
+	want := []interface{}{"eu-west-1", 3, "acme"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected %v, got %v", want, args)
+	}
+}
+
+func TestQueryParamErrors(t *testing.T) {
+	var params []QueryParam
+	if err := yaml.Unmarshal([]byte("- default: x"), &params); err == nil {
+		t.Error("Expected error for a mapping without env")
+	}
+	if err := yaml.Unmarshal([]byte("- [1, 2]"), &params); err == nil {
+		t.Error("Expected error for a sequence")
+	}
+
+	metric := MetricConfig{Params: []QueryParam{{Env: "DDSM_TEST_UNSET_PARAM"}}}
+	if _, err := metric.queryArgs(); err == nil || !strings.Contains(err.Error(), "DDSM_TEST_UNSET_PARAM") {
+		t.Errorf("Expected error for an unset variable, got %v", err)
+	}
+}
+
+func TestValidateMetricParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  MetricConfig
+		wantErr bool
+	}{
+		{name: "NoParams", metric: MetricConfig{Query: "SELECT count(*) FROM orders"}},
+		{name: "Matching", metric: MetricConfig{Query: "SELECT count(*) FROM orders WHERE region = $1", Params: []QueryParam{{Value: "eu"}}}},
+		{name: "Missing", metric: MetricConfig{Query: "SELECT count(*) FROM orders WHERE region = $2", Params: []QueryParam{{Value: "eu"}}}, wantErr: true},
+		{name: "Zero", metric: MetricConfig{Query: "SELECT count(*) FROM orders WHERE region = $0", Params: []QueryParam{{Value: "eu"}}}, wantErr: true},
+		{name: "Question", metric: MetricConfig{Query: "SELECT count(*) FROM orders WHERE region = ?", Params: []QueryParam{{Value: "eu"}}}},
+		{name: "Exec", metric: MetricConfig{Source: "exec", Command: []string{"plugin"}, Params: []QueryParam{{Value: "eu"}}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.metric.Name = "orders.pending"
+			err := validateMetricParams([]MetricConfig{tc.metric})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults of PipelineConfig.
+const (
+	defaultPipelineWorkers   = 4
+	defaultPipelineQueueSize = 10000
+	// pipelineSendTimeout bounds the submission of one queued point.
+	pipelineSendTimeout = 30 * time.Second
+)
+
+// Counters of the send pipeline published on /debug/vars.
+var (
+	expvarPipelineErrors  = expvar.NewInt("pipeline_errors")
+	expvarPipelineDropped = expvar.NewInt("pipeline_dropped")
+)
+
+// errPipelineClosed is returned for points queued after shutdown started.
+var errPipelineClosed = errors.New("send pipeline is closed")
+
+// PipelineConfig decouples submission from collection in daemon mode: the
+// points of a metric are queued and sent by a pool of workers, so a slow
+// sink never holds up the next query.
+type PipelineConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Workers is the number of points sent concurrently (default 4).
+	Workers int `yaml:"workers,omitempty"`
+	// QueueSize is the number of points waiting to be sent above which new
+	// points fail instead of blocking collection (default 10000).
+	QueueSize int `yaml:"queue_size,omitempty"`
+}
+
+// sendJob is one queued submission.
+type sendJob struct {
+	ctx       context.Context
+	metric    string
+	telemetry *Telemetry
+	tracker   *sendTracker
+	send      func(context.Context) error
+}
+
+// sendTracker follows the points a collection cycle queued until the workers
+// have sent them, so their outcome is reported by the cycle. A nil
+// *sendTracker tracks nothing.
+type sendTracker struct {
+	pending sync.WaitGroup
+
+	mu     sync.Mutex
+	queued map[string]int
+	done   map[string]int
+	errs   map[string][]error
+}
+
+// sendOutcome is the outcome of the points queued for one metric.
+type sendOutcome struct {
+	Points int
+	Errors []error
+}
+
+func newSendTracker() *sendTracker {
+	return &sendTracker{queued: map[string]int{}, done: map[string]int{}, errs: map[string][]error{}}
+}
+
+// add tracks a point of metric about to be queued.
+func (t *sendTracker) add(metric string) {
+	if t == nil {
+		return
+	}
+	t.pending.Add(1)
+	t.mu.Lock()
+	t.queued[metric]++
+	t.mu.Unlock()
+}
+
+// remove stops tracking a point that could not be queued.
+func (t *sendTracker) remove(metric string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.queued[metric]--
+	t.mu.Unlock()
+	t.pending.Done()
+}
+
+// finish records the outcome of a sent point of metric.
+func (t *sendTracker) finish(metric string, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.done[metric]++
+	if err != nil {
+		t.errs[metric] = append(t.errs[metric], err)
+	}
+	t.mu.Unlock()
+	t.pending.Done()
+}
+
+// Wait waits until every tracked point has been sent, or ctx is done, and
+// returns the outcome of each metric. Points still queued when ctx is done
+// are reported failed.
+func (t *sendTracker) Wait(ctx context.Context) map[string]sendOutcome {
+	if t == nil {
+		return nil
+	}
+	sent := make(chan struct{})
+	go func() {
+		t.pending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	outcomes := make(map[string]sendOutcome, len(t.queued))
+	for metric, points := range t.queued {
+		errs := slices.Clone(t.errs[metric])
+		if unsent := points - t.done[metric]; unsent > 0 {
+			errs = append(errs, fmt.Errorf("%d queued points not sent before the cycle ended: %w", unsent, ctx.Err()))
+		}
+		outcomes[metric] = sendOutcome{Points: points, Errors: errs}
+	}
+	return outcomes
+}
+
+// sendPipeline is the queue and worker pool of PipelineConfig. A nil
+// *sendPipeline sends nothing; the collector then submits points itself.
+type sendPipeline struct {
+	queue   chan sendJob
+	workers sync.WaitGroup
+
+	mu        sync.Mutex
+	sent      *sync.Cond
+	queued    int
+	completed int
+	closed    bool
+	flushing  bool
+}
+
+// newSendPipeline starts the workers of config, or returns nil when the
+// pipeline is disabled.
+func newSendPipeline(config PipelineConfig) *sendPipeline {
+	if !config.Enabled {
+		return nil
+	}
+	workers, size := config.Workers, config.QueueSize
+	if workers <= 0 {
+		workers = defaultPipelineWorkers
+	}
+	if size <= 0 {
+		size = defaultPipelineQueueSize
+	}
+	p := &sendPipeline{queue: make(chan sendJob, size)}
+	p.sent = sync.NewCond(&p.mu)
+	for range workers {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Enqueue queues send for a worker. It never blocks: a full queue is an
+// error, so the point is reported failed rather than delaying collection.
+// The outcome of the submission is recorded in telemetry and tracker once
+// sent.
+func (p *sendPipeline) Enqueue(ctx context.Context, tracker *sendTracker, metric string, telemetry *Telemetry, send func(context.Context) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errPipelineClosed
+	}
+	// The point outlives the metric's context, but keeps its values such as
+	// the sink options and the trace span.
+	job := sendJob{ctx: context.WithoutCancel(ctx), metric: metric, telemetry: telemetry, tracker: tracker, send: send}
+	// Tracked before queueing, as a worker may send it right away.
+	tracker.add(metric)
+	select {
+	case p.queue <- job:
+		p.queued++
+		return nil
+	default:
+		tracker.remove(metric)
+		expvarPipelineDropped.Add(1)
+		return fmt.Errorf("send queue full (%d points)", cap(p.queue))
+	}
+}
+
+// work sends queued points until the queue is closed.
+func (p *sendPipeline) work() {
+	defer p.workers.Done()
+	for job := range p.queue {
+		ctx, cancel := context.WithTimeout(job.ctx, pipelineSendTimeout)
+		err := job.send(ctx)
+		cancel()
+		job.telemetry.RecordSend(err)
+		job.tracker.finish(job.metric, err)
+		if err != nil {
+			expvarPipelineErrors.Add(1)
+			logEvent(job.ctx, "error", "Failed to send queued metric", map[string]interface{}{
+				"metric": job.metric,
+				"error":  logRedactor.RedactString(err.Error()),
+			})
+		}
+
+		p.mu.Lock()
+		p.completed++
+		p.sent.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+// Flush calls flush in the background once as many points as are queued
+// now have been sent, so the senders export them without the cycle waiting.
+// A flush still waiting absorbs the next one.
+func (p *sendPipeline) Flush(flush func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.flushing {
+		return
+	}
+	p.flushing = true
+	target := p.queued
+	go func() {
+		p.mu.Lock()
+		for p.completed < target {
+			p.sent.Wait()
+		}
+		p.mu.Unlock()
+
+		flush()
+
+		p.mu.Lock()
+		p.flushing = false
+		p.mu.Unlock()
+	}()
+}
+
+// Close stops accepting points and waits for the queued ones to be sent, or
+// for ctx to be done. The senders are flushed by the caller afterwards.
+func (p *sendPipeline) Close(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d queued points not sent: %w", len(p.queue), ctx.Err())
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendPipelineDisabled(t *testing.T) {
+	if p := newSendPipeline(PipelineConfig{}); p != nil {
+		t.Fatalf("Expected a disabled pipeline, got %+v", p)
+	}
+	var p *sendPipeline
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestSendPipelineSendsAndFlushes(t *testing.T) {
+	p := newSendPipeline(PipelineConfig{Enabled: true, Workers: 2, QueueSize: 10})
+	telemetry := NewTelemetry()
+	var sent atomic.Int32
+	for i := 0; i < 5; i++ {
+		err := p.Enqueue(context.Background(), nil, "test.metric", telemetry, func(context.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			sent.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	flushed := make(chan int32, 1)
+	p.Flush(func() { flushed <- sent.Load() })
+	select {
+	case n := <-flushed:
+		if n != 5 {
+			t.Errorf("Expected the flush after 5 points, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the pipeline to flush")
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := telemetry.Snapshot()["payloads.sent"]; got != 5 {
+		t.Errorf("Expected 5 payloads sent, got %v", got)
+	}
+	if err := p.Enqueue(context.Background(), nil, "test.metric", nil, func(context.Context) error { return nil }); !errors.Is(err, errPipelineClosed) {
+		t.Errorf("Expected errPipelineClosed, got %v", err)
+	}
+}
+
+func TestSendPipelineQueueFull(t *testing.T) {
+	p := newSendPipeline(PipelineConfig{Enabled: true, Workers: 1, QueueSize: 1})
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	started.Add(1)
+	block := func(context.Context) error {
+		started.Done()
+		<-release
+		return nil
+	}
+	if err := p.Enqueue(context.Background(), nil, "test.metric", nil, block); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	started.Wait()
+	noop := func(context.Context) error { return nil }
+	if err := p.Enqueue(context.Background(), nil, "test.metric", nil, noop); err != nil {
+		t.Fatalf("Expected the queue to take one point, got %v", err)
+	}
+	if err := p.Enqueue(context.Background(), nil, "test.metric", nil, noop); err == nil {
+		t.Fatal("Expected a full queue error but got nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded while a point is stuck, got %v", err)
+	}
+	close(release)
+}
+
+func TestCollectorSubmitWithPipeline(t *testing.T) {
+	sender := &MockMetricSender{}
+	c := &Collector{Sender: sender, Pipeline: newSendPipeline(PipelineConfig{Enabled: true, Workers: 1})}
+	metric := MetricConfig{Name: "test.metric", Tags: []string{"env:test"}}
+	n, errs := c.sendGauges(context.Background(), nil, metric, []sample{{Value: 1}, {Value: 2}})
+	if n != 2 || len(errs) != 0 {
+		t.Fatalf("Expected 2 series without errors, got %d and %v", n, errs)
+	}
+	if err := c.Pipeline.Close(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(sender.SentMetrics) != 2 {
+		t.Fatalf("Expected 2 metrics sent, got %d", len(sender.SentMetrics))
+	}
+	if got := sender.SentMetrics[1].Points[0][1]; got != 2 {
+		t.Errorf("Expected value 2, got %v", got)
+	}
+}
+
+// rejectingSender fails the points of one metric and records the others.
+type rejectingSender struct {
+	reject string
+
+	mu   sync.Mutex
+	sent map[string]float64
+}
+
+func (s *rejectingSender) SendMetric(_ context.Context, name string, value float64, _ []string, _ string) error {
+	if name == s.reject {
+		return errors.New("rejected by the sink")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[name] = value
+	return nil
+}
+
+func TestCollectOnceReportsPipelineFailures(t *testing.T) {
+	sender := &rejectingSender{reject: "b", sent: map[string]float64{}}
+	pipeline := newSendPipeline(PipelineConfig{Enabled: true, Workers: 2})
+	defer pipeline.Close(context.Background())
+	collector := &Collector{
+		Config: &Config{
+			Metrics: []MetricConfig{
+				{Name: "a", Source: "exec", Command: []string{"echo", `{"samples":[{"value":1}]}`}},
+				{Name: "b", Source: "exec", Command: []string{"echo", `{"samples":[{"value":2}]}`}},
+			},
+			Heartbeat: HeartbeatConfig{Enabled: true, Metric: "heartbeat"},
+			Telemetry: TelemetryConfig{Enabled: true, Prefix: "tel"},
+		},
+		Sender:   sender,
+		Pipeline: pipeline,
+	}
+
+	summary := collector.CollectOnce(context.Background())
+	if summary.Succeeded != 1 || summary.Failed != 1 {
+		t.Fatalf("Expected 1 metric sent and 1 failed, got %+v", summary)
+	}
+	if got := summary.Metrics[1]; got.Status != statusSendFailed || got.Error != "rejected by the sink" {
+		t.Errorf("Expected b to fail with the sink error, got %+v", got)
+	}
+	if err := checkFailPolicy(summary, "any"); exitCode(err) != exitPartialFailure {
+		t.Errorf("Expected exit code %d, got %v", exitPartialFailure, err)
+	}
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if _, ok := sender.sent["heartbeat"]; ok {
+		t.Error("Expected no heartbeat after a failed submission")
+	}
+	if got := sender.sent["tel.payloads.sent"]; got != 1 {
+		t.Errorf("Expected 1 payload sent in telemetry, got %v", got)
+	}
+	if got := sender.sent["tel.payloads.failed"]; got != 1 {
+		t.Errorf("Expected 1 payload failed in telemetry, got %v", got)
+	}
+}
+
+func TestSendTrackerWaitTimeout(t *testing.T) {
+	p := newSendPipeline(PipelineConfig{Enabled: true, Workers: 1})
+	defer p.Close(context.Background())
+	tracker := newSendTracker()
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 2; i++ {
+		err := p.Enqueue(context.Background(), tracker, "slow.metric", nil, func(context.Context) error {
+			<-release
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	outcome := tracker.Wait(ctx)["slow.metric"]
+	if outcome.Points != 2 || len(outcome.Errors) != 1 || !errors.Is(outcome.Errors[0], context.DeadlineExceeded) {
+		t.Errorf("Expected the unsent points to be reported failed, got %+v", outcome)
+	}
+}
@@ -0,0 +1,187 @@
+// Package collector contains the reusable parts of the SQL metric collection
+// engine that library users can extend.
+package collector
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotHandled is returned by a Converter that does not recognize a value,
+// so the next converter (and finally the built-in conversion) is tried.
+var ErrNotHandled = errors.New("value not handled by converter")
+
+// ErrNull is returned when a value is SQL NULL, e.g. an invalid sql.NullFloat64.
+var ErrNull = errors.New("value is NULL")
+
+// timestampLayouts are the text formats tried for timestamps returned as
+// strings, e.g. MySQL DATETIME without parseTime.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// Converter converts a value scanned from a database column to float64.
+// It must return ErrNotHandled for values it does not support.
+type Converter func(v any) (float64, error)
+
+var (
+	convertersMu sync.RWMutex
+	converters   []Converter
+)
+
+// RegisterConverter registers a custom converter, e.g. for PostGIS, money or
+// custom domain types. Custom converters are consulted in registration order
+// before the built-in conversion.
+func RegisterConverter(fn Converter) {
+	if fn == nil {
+		return
+	}
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters = append(converters, fn)
+}
+
+// RegisterTypeConverter registers a converter for values of the exact Go type T
+// as returned by the database driver.
+func RegisterTypeConverter[T any](fn func(T) (float64, error)) {
+	RegisterConverter(func(v any) (float64, error) {
+		typed, ok := v.(T)
+		if !ok {
+			return 0, ErrNotHandled
+		}
+		return fn(typed)
+	})
+}
+
+// resetConverters removes all custom converters. It is used by tests.
+func resetConverters() {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters = nil
+}
+
+// ToFloat64 converts a scanned column value to float64 using the registered
+// custom converters first and the built-in conversion otherwise.
+func ToFloat64(v any) (float64, error) {
+	convertersMu.RLock()
+	custom := converters
+	convertersMu.RUnlock()
+
+	for _, convert := range custom {
+		f, err := convert(v)
+		if errors.Is(err, ErrNotHandled) {
+			continue
+		}
+		return f, err
+	}
+
+	return builtinToFloat64(v)
+}
+
+// builtinToFloat64 converts numbers, booleans (0/1), numeric, interval and
+// timestamp strings, time.Time (Unix epoch seconds) and sql.Null* values.
+func builtinToFloat64(v any) (float64, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, ErrNull
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case time.Time:
+		return epochSeconds(v), nil
+	case time.Duration:
+		return v.Seconds(), nil
+	case sql.NullFloat64:
+		if !v.Valid {
+			return 0, ErrNull
+		}
+		return v.Float64, nil
+	case []byte:
+		f, err := parseText(string(v))
+		if err != nil {
+			return 0, fmt.Errorf("could not convert byte slice to float64: %w", err)
+		}
+		return f, nil
+	case string:
+		f, err := parseText(v)
+		if err != nil {
+			return 0, fmt.Errorf("could not convert string to float64: %w", err)
+		}
+		return f, nil
+	case driver.Valuer:
+		// sql.NullInt64, sql.NullTime and similar wrappers.
+		inner, err := v.Value()
+		if err != nil {
+			return 0, err
+		}
+		return builtinToFloat64(inner)
+	default:
+		return 0, fmt.Errorf("unexpected data type: %T", v)
+	}
+}
+
+// parseText converts a textual column value: a number, a boolean literal, an
+// interval (in seconds) or a timestamp (in Unix epoch seconds).
+func parseText(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	f, numErr := strconv.ParseFloat(s, 64)
+	if numErr == nil {
+		return f, nil
+	}
+	switch strings.ToLower(s) {
+	case "t", "true":
+		return 1, nil
+	case "f", "false":
+		return 0, nil
+	}
+	if secs, err := parseInterval(s); err == nil {
+		return secs, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return epochSeconds(t), nil
+		}
+	}
+	return 0, numErr
+}
+
+// epochSeconds returns t as fractional Unix epoch seconds.
+func epochSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToFloat64Builtin(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   any
+		want    float64
+		wantErr bool
+	}{
+		{name: "int", input: 42, want: 42},
+		{name: "int64", input: int64(7), want: 7},
+		{name: "float64", input: 1.5, want: 1.5},
+		{name: "numeric bytes", input: []byte("3.25"), want: 3.25},
+		{name: "non-numeric bytes", input: []byte("abc"), wantErr: true},
+		{name: "bool true", input: true, want: 1},
+		{name: "bool false", input: false, want: 0},
+		{name: "uint32", input: uint32(9), want: 9},
+		{name: "float32", input: float32(0.5), want: 0.5},
+		{name: "time", input: time.Unix(1700000000, 500000000), want: 1700000000.5},
+		{name: "timestamp bytes", input: []byte("2023-11-14 22:13:20"), want: 1700000000},
+		{name: "interval bytes", input: []byte("1 day 01:00:00"), want: 90000},
+		{name: "boolean text", input: []byte("t"), want: 1},
+		{name: "numeric string", input: "12", want: 12},
+		{name: "valid NullFloat64", input: sql.NullFloat64{Float64: 2.5, Valid: true}, want: 2.5},
+		{name: "NULL NullFloat64", input: sql.NullFloat64{}, wantErr: true},
+		{name: "valid NullInt64", input: sql.NullInt64{Int64: 3, Valid: true}, want: 3},
+		{name: "nil", input: nil, wantErr: true},
+		{name: "unsupported type", input: struct{}{}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ToFloat64(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error for %v", tc.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+type money string
+
+func TestRegisterConverter(t *testing.T) {
+	defer resetConverters()
+
+	// Money values such as "$1,234.50" arrive as []byte from the driver
+	RegisterConverter(func(v any) (float64, error) {
+		b, ok := v.([]byte)
+		if !ok || !strings.HasPrefix(string(b), "$") {
+			return 0, ErrNotHandled
+		}
+		return strconv.ParseFloat(strings.ReplaceAll(string(b[1:]), ",", ""), 64)
+	})
+	RegisterTypeConverter(func(m money) (float64, error) {
+		if m == "" {
+			return 0, errors.New("empty money")
+		}
+		return 99, nil
+	})
+
+	if got, err := ToFloat64([]byte("$1,234.50")); err != nil || got != 1234.5 {
+		t.Errorf("Expected 1234.5, got %v (%v)", got, err)
+	}
+	if got, err := ToFloat64([]byte("12")); err != nil || got != 12 {
+		t.Errorf("Expected built-in conversion to still apply, got %v (%v)", got, err)
+	}
+	if got, err := ToFloat64(money("x")); err != nil || got != 99 {
+		t.Errorf("Expected typed converter result 99, got %v (%v)", got, err)
+	}
+	if _, err := ToFloat64(money("")); err == nil {
+		t.Error("Expected typed converter error to be returned")
+	}
+}
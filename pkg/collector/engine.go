@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+)
+
+// Errors of the metrics an Engine skips.
+var (
+	// ErrStopped is reported for the metrics skipped after Stop was closed.
+	// A CollectMetric hook returns it to skip the remaining metrics too.
+	ErrStopped = errors.New("collection stopped")
+	// ErrFailFast is reported for the metrics skipped after a failure when
+	// FailFast is set.
+	ErrFailFast = errors.New("skipped after a failed metric (fail-fast)")
+)
+
+// Metric is a metric collected by the Engine.
+type Metric struct {
+	Name       string   `yaml:"name" json:"name"`
+	Query      string   `yaml:"query" json:"query"`
+	Tags       []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Host       string   `yaml:"host,omitempty" json:"host,omitempty"`
+	TagColumns []string `yaml:"tag_columns,omitempty" json:"tag_columns,omitempty"`
+	// Spec carries the embedding program's own settings of the metric to its
+	// CollectMetric hook. The engine does not read it.
+	Spec any `yaml:"-" json:"-"`
+}
+
+// Result is the outcome of collecting one metric.
+type Result struct {
+	Metric string
+	// Series is the number of series sent.
+	Series int
+	Err    error
+	// Skipped is set when the metric was not collected, e.g. after Stop was
+	// closed.
+	Skipped bool
+}
+
+// Engine reads metrics from a source and sends them to a sink. It is the
+// collection loop of the CLI, which adds its retries, caching and reporting
+// with CollectMetric.
+type Engine struct {
+	Source source.Source
+	Sink   sink.Sender
+	// Stop is closed when a shutdown is requested. The running cycle then
+	// finishes its current metric and skips the rest with ErrStopped.
+	Stop <-chan struct{}
+	// FailFast skips the remaining metrics with ErrFailFast after the first
+	// one that failed or was skipped.
+	FailFast bool
+	// CollectMetric, when set, replaces the collection of a single metric.
+	// It returns false for a metric that is not due in this cycle, which is
+	// left out of the results.
+	CollectMetric func(ctx context.Context, metric Metric) (Result, bool)
+	// OnSkip, when set, is called for every metric skipped by the engine
+	// with ErrStopped or ErrFailFast.
+	OnSkip func(ctx context.Context, metric Metric, err error)
+}
+
+// NewSQLSource returns a source reading from db that converts values with
+// ToFloat64, so registered converters apply.
+func NewSQLSource(db *sql.DB) *source.SQL {
+	return &source.SQL{DB: db, Convert: ToFloat64}
+}
+
+// CollectOnce collects every metric once and returns one result per metric.
+// A sink implementing sink.Flusher is flushed at the end.
+func (e *Engine) CollectOnce(ctx context.Context, metrics []Metric) []Result {
+	results := make([]Result, 0, len(metrics))
+	var skip error
+	for _, metric := range metrics {
+		if skip == nil && e.stopping() {
+			skip = ErrStopped
+		}
+		if skip != nil {
+			if e.OnSkip != nil {
+				e.OnSkip(ctx, metric, skip)
+			}
+			results = append(results, Result{Metric: metric.Name, Err: skip, Skipped: true})
+			continue
+		}
+
+		result, ok := e.collectMetric(ctx, metric)
+		if !ok {
+			continue
+		}
+		results = append(results, result)
+		switch {
+		case errors.Is(result.Err, ErrStopped):
+			skip = ErrStopped
+		case e.FailFast && (result.Err != nil || result.Skipped):
+			skip = ErrFailFast
+		}
+	}
+	if flusher, ok := e.Sink.(sink.Flusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			for i := range results {
+				if results[i].Err == nil && !results[i].Skipped {
+					results[i].Err = fmt.Errorf("flush failed: %w", err)
+				}
+			}
+		}
+	}
+	return results
+}
+
+// stopping reports whether Stop was closed.
+func (e *Engine) stopping() bool {
+	select {
+	case <-e.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Engine) collectMetric(ctx context.Context, metric Metric) (Result, bool) {
+	if e.CollectMetric != nil {
+		return e.CollectMetric(ctx, metric)
+	}
+	return e.collect(ctx, metric), true
+}
+
+func (e *Engine) collect(ctx context.Context, metric Metric) Result {
+	result := Result{Metric: metric.Name}
+	samples, err := e.Source.Samples(ctx, source.Query{Metric: metric.Name, Text: metric.Query, TagColumns: metric.TagColumns})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for _, s := range samples {
+		name := metric.Name
+		if s.Name != "" {
+			name = s.Name
+		}
+		if err := e.Sink.SendMetric(ctx, name, s.Value, slices.Concat(metric.Tags, s.Tags), metric.Host); err != nil {
+			result.Err = err
+			return result
+		}
+		result.Series++
+	}
+	return result
+}
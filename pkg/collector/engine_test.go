@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+)
+
+type fakeSource map[string][]source.Sample
+
+func (f fakeSource) Samples(_ context.Context, query source.Query) ([]source.Sample, error) {
+	samples, ok := f[query.Text]
+	if !ok {
+		return nil, errors.New("relation does not exist")
+	}
+	return samples, nil
+}
+
+type point struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+type recordingSink struct {
+	points  []point
+	flushes int
+}
+
+func (r *recordingSink) SendMetric(_ context.Context, name string, value float64, tags []string, _ string) error {
+	r.points = append(r.points, point{name: name, value: value, tags: tags})
+	return nil
+}
+
+func (r *recordingSink) Flush(context.Context) error {
+	r.flushes++
+	return nil
+}
+
+func TestEngineCollectOnce(t *testing.T) {
+	src := fakeSource{
+		"SELECT count(*) FROM users": {{Value: 42}},
+		"SELECT count(*), state FROM orders GROUP BY state": {
+			{Value: 3, Tags: []string{"state:open"}},
+			{Name: "orders.closed", Value: 5},
+		},
+	}
+	sink := &recordingSink{}
+	engine := &Engine{Source: src, Sink: sink}
+
+	results := engine.CollectOnce(context.Background(), []Metric{
+		{Name: "users", Query: "SELECT count(*) FROM users", Tags: []string{"env:test"}},
+		{Name: "orders", Query: "SELECT count(*), state FROM orders GROUP BY state", TagColumns: []string{"state"}},
+		{Name: "broken", Query: "SELECT 1 FROM missing"},
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Series != 1 || results[1].Series != 2 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if results[2].Err == nil {
+		t.Error("Expected an error for the failing query")
+	}
+	if sink.flushes != 1 {
+		t.Errorf("Expected one flush, got %d", sink.flushes)
+	}
+
+	want := []point{
+		{name: "users", value: 42, tags: []string{"env:test"}},
+		{name: "orders", value: 3, tags: []string{"state:open"}},
+		{name: "orders.closed", value: 5},
+	}
+	if len(sink.points) != len(want) {
+		t.Fatalf("Expected %d points, got %+v", len(want), sink.points)
+	}
+	for i, w := range want {
+		got := sink.points[i]
+		if got.name != w.name || got.value != w.value || len(got.tags) != len(w.tags) {
+			t.Errorf("Point %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+}
+
+func TestEngineLoop(t *testing.T) {
+	stopped := make(chan struct{})
+	close(stopped)
+	metrics := []Metric{{Name: "a"}, {Name: "b", Spec: "not due"}, {Name: "c", Spec: "fail"}, {Name: "d"}}
+	collect := func(_ context.Context, metric Metric) (Result, bool) {
+		switch metric.Spec {
+		case "not due":
+			return Result{}, false
+		case "fail":
+			return Result{Metric: metric.Name, Err: errors.New("query failed")}, true
+		case "stop":
+			return Result{Metric: metric.Name, Err: ErrStopped, Skipped: true}, true
+		}
+		return Result{Metric: metric.Name, Series: 1}, true
+	}
+
+	tests := []struct {
+		name     string
+		engine   Engine
+		metrics  []Metric
+		want     []string
+		wantSkip map[string]error
+	}{
+		{name: "Every metric", engine: Engine{}, metrics: metrics, want: []string{"a", "c", "d"}},
+		{name: "Fail fast", engine: Engine{FailFast: true}, metrics: metrics, want: []string{"a", "c", "d"}, wantSkip: map[string]error{"d": ErrFailFast}},
+		{name: "Stopped", engine: Engine{Stop: stopped}, metrics: metrics, want: []string{"a", "b", "c", "d"}, wantSkip: map[string]error{"a": ErrStopped, "b": ErrStopped, "c": ErrStopped, "d": ErrStopped}},
+		{
+			name:     "Stopped by a metric",
+			engine:   Engine{},
+			metrics:  []Metric{{Name: "a"}, {Name: "b", Spec: "stop"}, {Name: "c"}},
+			want:     []string{"a", "b", "c"},
+			wantSkip: map[string]error{"c": ErrStopped},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			skipped := map[string]error{}
+			tc.engine.CollectMetric = collect
+			tc.engine.OnSkip = func(_ context.Context, metric Metric, err error) { skipped[metric.Name] = err }
+
+			results := tc.engine.CollectOnce(context.Background(), tc.metrics)
+			var got []string
+			for _, result := range results {
+				got = append(got, result.Metric)
+				if err, ok := tc.wantSkip[result.Metric]; ok && (!result.Skipped || !errors.Is(result.Err, err)) {
+					t.Errorf("Expected %s to be skipped with %v, got %+v", result.Metric, err, result)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Expected results for %v, got %v", tc.want, got)
+			}
+			if len(skipped) != len(tc.wantSkip) {
+				t.Errorf("Expected OnSkip for %v, got %v", tc.wantSkip, skipped)
+			}
+		})
+	}
+}
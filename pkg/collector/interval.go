@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lengths used for interval units, matching Postgres' EXTRACT(EPOCH FROM interval).
+const (
+	secondsPerDay   = 24 * 60 * 60
+	secondsPerMonth = 30 * secondsPerDay
+	secondsPerYear  = 365.25 * secondsPerDay
+)
+
+var intervalUnits = map[string]float64{
+	"year": secondsPerYear, "years": secondsPerYear,
+	"mon": secondsPerMonth, "mons": secondsPerMonth,
+	"month": secondsPerMonth, "months": secondsPerMonth,
+	"day": secondsPerDay, "days": secondsPerDay,
+}
+
+// parseInterval converts an interval string to seconds. It accepts Go
+// durations ("1h30m"), Postgres intervals ("1 day 02:03:04", "-00:00:05",
+// "2 mons") and MySQL TIME values ("838:59:59").
+func parseInterval(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty interval")
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), nil
+	}
+
+	fields := strings.Fields(s)
+	total := 0.0
+	for i := 0; i < len(fields); i++ {
+		if strings.Contains(fields[i], ":") {
+			if i != len(fields)-1 {
+				return 0, fmt.Errorf("invalid interval %q", s)
+			}
+			secs, err := parseClock(fields[i])
+			if err != nil {
+				return 0, fmt.Errorf("invalid interval %q: %w", s, err)
+			}
+			total += secs
+			continue
+		}
+		if i+1 >= len(fields) {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		n, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q: %w", s, err)
+		}
+		unit, ok := intervalUnits[fields[i+1]]
+		if !ok {
+			return 0, fmt.Errorf("invalid interval %q: unknown unit %q", s, fields[i+1])
+		}
+		total += n * unit
+		i++
+	}
+	return total, nil
+}
+
+// parseClock parses [-]HH:MM[:SS[.ffffff]], where hours may exceed 24.
+func parseClock(s string) (float64, error) {
+	sign := 1.0
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = -1, rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	multipliers := []float64{3600, 60, 1}
+	total := 0.0
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		total += n * multipliers[i]
+	}
+	return sign * total, nil
+}
@@ -0,0 +1,44 @@
+package collector
+
+import "testing"
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{name: "Go duration", input: "1h30m", want: 5400},
+		{name: "Postgres time only", input: "00:05:30", want: 330},
+		{name: "Postgres fractional seconds", input: "00:00:01.5", want: 1.5},
+		{name: "Postgres negative", input: "-00:00:05", want: -5},
+		{name: "Postgres days and time", input: "2 days 01:00:00", want: 2*86400 + 3600},
+		{name: "Postgres months", input: "1 mon", want: 30 * 86400},
+		{name: "Postgres years", input: "1 year", want: 365.25 * 86400},
+		{name: "MySQL TIME over 24h", input: "838:59:59", want: 838*3600 + 59*60 + 59},
+		{name: "Unknown unit", input: "3 weeks", wantErr: true},
+		{name: "Dangling number", input: "3", wantErr: true},
+		{name: "Garbage", input: "soon", wantErr: true},
+		{name: "Empty", input: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseInterval(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Expected error for %q, got %v", tc.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
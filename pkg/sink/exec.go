@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/internal/plugin"
+)
+
+// ExecPoint is one point handed to an exec plugin. Type is "gauge" with a
+// Value, or "distribution" with Values.
+type ExecPoint struct {
+	Metric    string    `json:"metric"`
+	Type      string    `json:"type"`
+	Value     float64   `json:"value,omitempty"`
+	Values    []float64 `json:"values,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+// ExecRequest is written as JSON to the standard input of an exec plugin.
+type ExecRequest struct {
+	Points []ExecPoint `json:"points"`
+}
+
+// ExecResponse may be printed by an exec plugin; a non-empty Error fails the
+// flush. Empty output means success.
+type ExecResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Exec buffers points and hands them to a plugin binary when flushed. The
+// binary is started once per flush, receives an ExecRequest on stdin and
+// must exit with status 0.
+type Exec struct {
+	// Command is the plugin binary followed by its arguments.
+	Command []string
+	// Env is added to the environment of the process, as "KEY=value".
+	Env []string
+
+	mu      sync.Mutex
+	pending []ExecPoint
+}
+
+func (e *Exec) add(point ExecPoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, point)
+}
+
+// SendMetric buffers one point until the next Flush.
+func (e *Exec) SendMetric(_ context.Context, metricName string, value float64, tags []string, host string) error {
+	e.add(ExecPoint{Metric: metricName, Type: "gauge", Value: value, Tags: tags, Host: host, Timestamp: time.Now().Unix()})
+	return nil
+}
+
+// SendDistribution buffers one distribution point until the next Flush.
+func (e *Exec) SendDistribution(_ context.Context, metricName string, values []float64, tags []string, host string) error {
+	e.add(ExecPoint{Metric: metricName, Type: "distribution", Values: values, Tags: tags, Host: host, Timestamp: time.Now().Unix()})
+	return nil
+}
+
+// Flush runs the plugin with the buffered points.
+func (e *Exec) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	if len(e.Command) == 0 {
+		return errors.New("exec sink requires a command")
+	}
+
+	request, err := json.Marshal(ExecRequest{Points: pending})
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	output, err := plugin.Run(ctx, e.Command, e.Env, request)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+	var response ExecResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", e.Command[0], err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("%s: %s", e.Command[0], response.Error)
+	}
+	return nil
+}
+
+// Close hands any points still buffered to the plugin.
+func (e *Exec) Close(ctx context.Context) error {
+	return e.Flush(ctx)
+}
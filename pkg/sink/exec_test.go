@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecFlush(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "request.json")
+	plugin := &Exec{Command: []string{"sh", "-c", `cat > "$OUT"`}, Env: []string{"OUT=" + out}}
+	ctx := context.Background()
+
+	if err := plugin.SendMetric(ctx, "queue.depth", 3, []string{"queue:mail"}, "db1"); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+	if err := plugin.SendDistribution(ctx, "query.latency", []float64{1, 2}, nil, ""); err != nil {
+		t.Fatalf("SendDistribution failed: %v", err)
+	}
+	if err := plugin.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Plugin did not receive the points: %v", err)
+	}
+	var request ExecRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("Invalid request %s: %v", data, err)
+	}
+	if len(request.Points) != 2 {
+		t.Fatalf("Expected 2 points, got %d", len(request.Points))
+	}
+	if p := request.Points[0]; p.Metric != "queue.depth" || p.Type != "gauge" || p.Value != 3 || p.Host != "db1" {
+		t.Errorf("Unexpected gauge point %+v", p)
+	}
+	if p := request.Points[1]; p.Type != "distribution" || len(p.Values) != 2 {
+		t.Errorf("Unexpected distribution point %+v", p)
+	}
+
+	// Nothing buffered: the plugin is not started again.
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	if err := plugin.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Expected no plugin run without points")
+	}
+}
+
+func TestExecFlushErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{name: "Success", script: `cat > /dev/null`},
+		{name: "Ok", script: `echo '{}'`},
+		{name: "PluginError", script: `echo '{"error":"quota exceeded"}'`, wantErr: "quota exceeded"},
+		{name: "ExitStatus", script: `echo denied >&2; exit 1`, wantErr: "exit status 1: denied"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			plugin := &Exec{Command: []string{"sh", "-c", tc.script}}
+			ctx := context.Background()
+			_ = plugin.SendMetric(ctx, "queue.depth", 1, nil, "")
+			err := plugin.Flush(ctx)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Flush failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
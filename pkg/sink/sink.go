@@ -0,0 +1,98 @@
+// Package sink defines the destinations collected metric values are sent to
+// and a registry of custom sinks, which the CLI makes selectable by name.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Sender submits a single metric value.
+type Sender interface {
+	SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error
+}
+
+// DistributionSender is implemented by senders that can submit raw sample
+// sets, aggregated by the destination into percentiles.
+type DistributionSender interface {
+	SendDistribution(ctx context.Context, metricName string, values []float64, tags []string, host string) error
+}
+
+// Flusher is implemented by senders that buffer points and export them
+// asynchronously. Flush is called at the end of every collection cycle.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Closer is implemented by senders holding connections or exporters that
+// must be released when the process exits.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Settings are passed to a Factory when the sink is created.
+type Settings struct {
+	// Name is the name the sink was registered under.
+	Name  string
+	Debug bool
+	// Decode decodes the sink's configuration block, the top-level key of
+	// the configuration file named after the sink, into out. Nothing is
+	// decoded when the block is absent.
+	Decode func(out any) error
+}
+
+// Factory creates a sink.
+type Factory func(ctx context.Context, settings Settings) (Sender, error)
+
+// ErrDuplicate is returned when a sink name is registered twice.
+var ErrDuplicate = errors.New("sink already registered")
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a custom sink available under name, e.g. for -sink and the
+// sinks of a metric. Built-in sink names take precedence in the CLI.
+func Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return errors.New("sink name and factory are required")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, name)
+	}
+	registry[name] = factory
+	return nil
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// Names returns the registered sink names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reset removes all registered sinks. It is used by tests.
+func reset() {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = map[string]Factory{}
+}
@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type nopSender struct{}
+
+func (nopSender) SendMetric(context.Context, string, float64, []string, string) error { return nil }
+
+func TestRegister(t *testing.T) {
+	defer reset()
+	factory := func(context.Context, Settings) (Sender, error) { return nopSender{}, nil }
+
+	if err := Register("statsd", factory); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := Register("statsd", factory); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+	if err := Register("", factory); err == nil {
+		t.Error("Expected error for empty name")
+	}
+	if err := Register("nil", nil); err == nil {
+		t.Error("Expected error for nil factory")
+	}
+
+	if _, ok := Lookup("statsd"); !ok {
+		t.Error("Expected registered sink to be found")
+	}
+	if _, ok := Lookup("missing"); ok {
+		t.Error("Expected unknown sink not to be found")
+	}
+	if names := Names(); len(names) != 1 || names[0] != "statsd" {
+		t.Errorf("Unexpected names %v", names)
+	}
+}
@@ -0,0 +1,72 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/internal/plugin"
+)
+
+// ExecRequest is written as JSON to the standard input of an exec plugin.
+type ExecRequest struct {
+	Metric string `json:"metric"`
+	Query  string `json:"query,omitempty"`
+}
+
+// ExecResponse is read as JSON from the standard output of an exec plugin.
+// A non-empty Error fails the metric.
+type ExecResponse struct {
+	Samples []ExecSample `json:"samples"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// ExecSample is one value returned by an exec plugin.
+type ExecSample struct {
+	Name  string   `json:"name,omitempty"`
+	Value float64  `json:"value"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// Exec reads samples from a plugin binary. For every query the binary is
+// started, receives an ExecRequest on stdin and must print an ExecResponse
+// on stdout before exiting with status 0. Anything written to stderr is
+// quoted in the error when the plugin fails.
+type Exec struct {
+	// Command is the plugin binary followed by its arguments.
+	Command []string
+	// Env is added to the environment of the process, as "KEY=value".
+	Env []string
+}
+
+// Samples runs the plugin and returns the samples it printed.
+func (e *Exec) Samples(ctx context.Context, query Query) ([]Sample, error) {
+	if len(e.Command) == 0 {
+		return nil, errors.New("exec source requires a command")
+	}
+	request, err := json.Marshal(ExecRequest{Metric: query.Metric, Query: query.Text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	output, err := plugin.Run(ctx, e.Command, e.Env, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var response ExecResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %w", e.Command[0], err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s: %s", e.Command[0], response.Error)
+	}
+	if len(response.Samples) == 0 {
+		return nil, ErrNoRows
+	}
+	samples := make([]Sample, len(response.Samples))
+	for i, s := range response.Samples {
+		samples[i] = Sample{Name: s.Name, Value: s.Value, Tags: s.Tags}
+	}
+	return samples, nil
+}
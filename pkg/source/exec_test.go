@@ -0,0 +1,60 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExecSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    []Sample
+		wantErr string
+	}{
+		{
+			name:   "Samples",
+			script: `echo '{"samples":[{"value":3,"tags":["queue:mail"]},{"name":"other","value":1.5}]}'`,
+			want:   []Sample{{Value: 3, Tags: []string{"queue:mail"}}, {Name: "other", Value: 1.5}},
+		},
+		{
+			name:   "RequestOnStdin",
+			script: `grep -q '"metric":"queue.depth"' && grep -q . ; echo '{"samples":[{"value":1}]}'`,
+			want:   []Sample{{Value: 1}},
+		},
+		{name: "NoSamples", script: `echo '{"samples":[]}'`, wantErr: ErrNoRows.Error()},
+		{name: "PluginError", script: `echo '{"error":"broker unreachable"}'`, wantErr: "broker unreachable"},
+		{name: "InvalidJSON", script: `echo nope`, wantErr: "invalid response"},
+		{name: "ExitStatus", script: `echo boom >&2; exit 3`, wantErr: "exit status 3: boom"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			plugin := &Exec{Command: []string{"sh", "-c", tc.script}}
+			got, err := plugin.Samples(context.Background(), Query{Metric: "queue.depth", Text: "SELECT 1"})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Samples failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExecSamplesNoRows(t *testing.T) {
+	plugin := &Exec{Command: []string{"sh", "-c", `echo '{}'`}}
+	if _, err := plugin.Samples(context.Background(), Query{}); !errors.Is(err, ErrNoRows) {
+		t.Errorf("Expected ErrNoRows, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Package source defines where metric values are read from and provides a
+// database/sql implementation and the exec plugin source.
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrNoRows is returned when a query produced no rows.
+var ErrNoRows = errors.New("query returned no rows")
+
+// Sample is one value read from a source. Name is empty unless the source
+// names the series itself; Tags are added to the metric's tags. Host, when
+// set, replaces the metric's host.
+type Sample struct {
+	Name  string
+	Value float64
+	Tags  []string
+	Host  string
+}
+
+// Query describes what to read for one metric.
+type Query struct {
+	// Metric is the name of the metric the query belongs to.
+	Metric string
+	// Text is the query, e.g. a SQL SELECT statement.
+	Text string
+	// TagColumns lists the result columns reported as "column:value" tags.
+	// Every other column after the first (the value) is rejected.
+	TagColumns []string
+}
+
+// Source reads the samples of a metric.
+type Source interface {
+	Samples(ctx context.Context, query Query) ([]Sample, error)
+}
+
+// DBClient runs a query returning a single numeric value.
+type DBClient interface {
+	QueryRow(ctx context.Context, query string) (float64, error)
+}
+
+// SQL reads samples with database/sql. The first column of every row is the
+// value and is converted with Convert; see collector.NewSQLSource.
+type SQL struct {
+	DB      *sql.DB
+	Convert func(v any) (float64, error)
+}
+
+// Samples runs the query and returns one sample per row.
+func (s *SQL) Samples(ctx context.Context, query Query) ([]Sample, error) {
+	rows, err := s.DB.QueryContext(ctx, query.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	for _, column := range columns[1:] {
+		if !slices.Contains(query.TagColumns, column) {
+			return nil, fmt.Errorf("column %q is neither the value nor a tag column", column)
+		}
+	}
+
+	var samples []Sample
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		value, err := s.Convert(values[0])
+		if err != nil {
+			return nil, err
+		}
+		sample := Sample{Value: value}
+		for i, column := range columns[1:] {
+			sample.Tags = append(sample.Tags, column+":"+tagText(values[i+1]))
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	if len(samples) == 0 {
+		return nil, ErrNoRows
+	}
+	return samples, nil
+}
+
+// tagText formats a scanned column as a tag value.
+func tagText(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case []byte:
+		return strings.TrimSpace(string(t))
+	default:
+		return strings.TrimSpace(fmt.Sprint(t))
+	}
+}
@@ -0,0 +1,25 @@
+package source
+
+import "testing"
+
+func TestTagText(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "Nil", value: nil, want: "null"},
+		{name: "Bytes", value: []byte(" eu-west-1 "), want: "eu-west-1"},
+		{name: "String", value: "primary", want: "primary"},
+		{name: "Integer", value: int64(3), want: "3"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tagText(tc.value); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// applyMetricPrefix prepends the configured metric_prefix to every metric
+// name. A missing trailing dot is added; prefixes and names that would
+// produce an empty segment such as "a..b" or ".a" are rejected.
+func applyMetricPrefix(config *Config) error {
+	prefix := config.MetricPrefix
+	if prefix == "" {
+		return nil
+	}
+	if !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	if strings.HasPrefix(prefix, ".") || strings.Contains(prefix, "..") {
+		return fmt.Errorf("invalid metric_prefix %q: empty name segment", config.MetricPrefix)
+	}
+	for i := range config.Metrics {
+		name := prefix + config.Metrics[i].Name
+		if strings.Contains(name, "..") {
+			return fmt.Errorf("metric %q: prefixed name %q contains an empty segment", config.Metrics[i].Name, name)
+		}
+		config.Metrics[i].Name = name
+	}
+	return nil
+}
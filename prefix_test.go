@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestApplyMetricPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		metric  string
+		want    string
+		wantErr bool
+	}{
+		{name: "No prefix", prefix: "", metric: "db.users", want: "db.users"},
+		{name: "Trailing dot", prefix: "companyx.sql.", metric: "db.users", want: "companyx.sql.db.users"},
+		{name: "Dot added", prefix: "companyx.sql", metric: "db.users", want: "companyx.sql.db.users"},
+		{name: "Templated name", prefix: "sql", metric: "db.{{.table}}.rows", want: "sql.db.{{.table}}.rows"},
+		{name: "Double dot in prefix", prefix: "companyx..sql", metric: "db.users", wantErr: true},
+		{name: "Leading dot in prefix", prefix: ".sql", metric: "db.users", wantErr: true},
+		{name: "Leading dot in name", prefix: "sql.", metric: ".db.users", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{MetricPrefix: tc.prefix, Metrics: []MetricConfig{{Name: tc.metric}}}
+			err := applyMetricPrefix(config)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("applyMetricPrefix() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && config.Metrics[0].Name != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, config.Metrics[0].Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolvePresets appends the metrics of the presets enabled under presets
+// to config, as the init command would write them. Presets are looked up
+// for dbType; an unknown name is an error listing the available ones, and a
+// preset with WITH clauses or UNION needs the query_parser feature.
+func resolvePresets(config *Config, dbType string) error {
+	for _, name := range config.Presets {
+		p, ok := findPreset(dbType, name)
+		if !ok {
+			return fmt.Errorf("unknown %s preset %q (available: %s)", dbType, name, strings.Join(presetNames(dbType), ", "))
+		}
+		for _, pm := range p.Metrics {
+			if compoundQuery(pm.Query) && !config.Features.Enabled(featureQueryParser) {
+				return fmt.Errorf("preset %s needs the %s feature (features: {%s: true})", name, featureQueryParser, featureQueryParser)
+			}
+		}
+		for _, pm := range p.Metrics {
+			metric, err := pm.metricConfig()
+			if err != nil {
+				return fmt.Errorf("preset %s: %w", name, err)
+			}
+			config.Metrics = append(config.Metrics, metric)
+		}
+	}
+	return nil
+}
+
+// findPreset returns the preset of dbType named name.
+func findPreset(dbType, name string) (preset, bool) {
+	for _, p := range presets[dbType] {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return preset{}, false
+}
+
+// presetNames returns the names of the presets of dbType.
+func presetNames(dbType string) []string {
+	var names []string
+	for _, p := range presets[dbType] {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// metricConfig converts the preset metric through its YAML form, so it is
+// configured exactly like the one written by the init command.
+func (m presetMetric) metricConfig() (MetricConfig, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return MetricConfig{}, err
+	}
+	var metric MetricConfig
+	if err := decodeStrict(data, &metric); err != nil {
+		return MetricConfig{}, fmt.Errorf("metric %q: %w", m.Name, err)
+	}
+	return metric, nil
+}
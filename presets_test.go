@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePresets(t *testing.T) {
+	tests := []struct {
+		name        string
+		dbType      string
+		presets     []string
+		features    Features
+		wantMetrics []string
+		wantErr     string
+	}{
+		{
+			name:        "Statements",
+			dbType:      "postgres",
+			presets:     []string{"statements"},
+			features:    Features{featureQueryParser: true},
+			wantMetrics: []string{"sql.statements.calls", "sql.statements.total_time", "sql.statements.rows"},
+		},
+		{
+			name:        "MySQL",
+			dbType:      "mysql",
+			presets:     []string{"connections"},
+			wantMetrics: []string{"sql.connections.total", "sql.connections.active"},
+		},
+		{name: "Without query parser", dbType: "postgres", presets: []string{"statements"}, wantErr: "needs the query_parser feature"},
+		{name: "Unknown", dbType: "postgres", presets: []string{"statments"}, wantErr: "available: connections"},
+		{name: "Other database", dbType: "mysql", presets: []string{"vacuum"}, wantErr: "unknown mysql preset"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{Presets: tc.presets, Features: tc.features}
+			err := resolvePresets(config, tc.dbType)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var got []string
+			for _, metric := range config.Metrics {
+				got = append(got, metric.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.wantMetrics, ",") {
+				t.Errorf("Expected metrics %v, got %v", tc.wantMetrics, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPresets(t *testing.T) {
+	t.Setenv("DATABASE_TYPE", "postgres")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "features:\n  query_parser: true\npresets: [statements, vacuum]\nmetric_defaults:\n  tags: [\"env:test\"]\nmetrics:\n  - name: custom\n    query: SELECT count(*) FROM users\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(config.Metrics) != 1+3+4 {
+		t.Fatalf("Expected the custom and preset metrics, got %d", len(config.Metrics))
+	}
+	calls := config.Metrics[1]
+	if calls.Name != "sql.statements.calls" || len(calls.TagColumns) != 1 || calls.TagColumns[0] != "queryid" {
+		t.Errorf("Unexpected preset metric %+v", calls)
+	}
+	if len(calls.Tags) != 1 || calls.Tags[0] != "env:test" {
+		t.Errorf("Expected metric_defaults to apply to presets, got %v", calls.Tags)
+	}
+	if age := config.Metrics[4]; age.OnNull.Action != emptySkip {
+		t.Errorf("Expected on_null skip for %s, got %+v", age.Name, age.OnNull)
+	}
+}
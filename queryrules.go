@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// ValidationConfig adds site-specific rules to the query validator, e.g. a
+// DBA forbidding pg_sleep or any table matching payments_*. Table patterns
+// are globs matched against both the table name and schema.table.
+type ValidationConfig struct {
+	// ForbiddenKeywords are rejected anywhere in a query, as whole words.
+	ForbiddenKeywords []string `yaml:"forbidden_keywords,omitempty"`
+	// ForbiddenTables may not be read.
+	ForbiddenTables []string `yaml:"forbidden_tables,omitempty"`
+	// AllowedSchemas, when set, are the only schemas a qualified table
+	// reference may name.
+	AllowedSchemas []string `yaml:"allowed_schemas,omitempty"`
+	// AllowedTables, when set, are the only tables that may be read.
+	AllowedTables []string `yaml:"allowed_tables,omitempty"`
+	// AllowedFunctions, when set, are the only functions that may be called,
+	// including aggregates such as count.
+	AllowedFunctions []string `yaml:"allowed_functions,omitempty"`
+}
+
+// tableRef is a table read by a query. Schema is empty for unqualified names.
+type tableRef struct {
+	Schema string
+	Name   string
+}
+
+// String returns the name as written, schema.table or table.
+func (t tableRef) String() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// validateMetricRules checks the query of every SQL metric against the
+// rules of the validation block.
+func validateMetricRules(config *Config) error {
+	var errs []error
+	for _, metric := range config.Metrics {
+		if metric.execSource() || metric.Query == "" {
+			continue
+		}
+		if err := validateQueryRules(metric.Query, config.Validation); err != nil {
+			errs = append(errs, fmt.Errorf("metric %q: %w", metric.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateQueryRules checks query against rules.
+func validateQueryRules(query string, rules ValidationConfig) error {
+	lower := strings.ToLower(query)
+	for _, keyword := range rules.ForbiddenKeywords {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(keyword)) + `\b`)
+		if re.MatchString(lower) {
+			return fmt.Errorf("invalid query: forbidden keyword %q", keyword)
+		}
+	}
+
+	tables, functions := queryReferences(query)
+	for _, table := range tables {
+		if matchesTable(rules.ForbiddenTables, table) {
+			return fmt.Errorf("invalid query: table %s is forbidden", table)
+		}
+		if len(rules.AllowedSchemas) > 0 && table.Schema != "" && !containsFold(rules.AllowedSchemas, table.Schema) {
+			return fmt.Errorf("invalid query: schema %s is not allowed", table.Schema)
+		}
+		if len(rules.AllowedTables) > 0 && !matchesTable(rules.AllowedTables, table) {
+			return fmt.Errorf("invalid query: table %s is not allowed", table)
+		}
+	}
+	if len(rules.AllowedFunctions) > 0 {
+		for _, fn := range functions {
+			if !containsFold(rules.AllowedFunctions, fn) {
+				return fmt.Errorf("invalid query: function %s is not allowed", fn)
+			}
+		}
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(item string) bool { return strings.EqualFold(item, s) })
+}
+
+// matchesTable reports whether table matches one of the glob patterns.
+func matchesTable(patterns []string, table tableRef) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, name := range []string{table.Name, table.String()} {
+			if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sqlNotFunctions are keywords that may be followed by a parenthesis
+// without being a function call.
+var sqlNotFunctions = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "between": true, "by": true, "case": true,
+	"else": true, "except": true, "exists": true, "filter": true, "from": true, "having": true,
+	"in": true, "intersect": true, "is": true, "join": true, "lateral": true, "like": true,
+	"ilike": true, "not": true, "on": true, "or": true, "over": true, "recursive": true,
+	"select": true, "some": true, "then": true, "union": true, "using": true, "values": true,
+	"when": true, "where": true, "with": true, "within": true,
+}
+
+// sqlClauseKeywords end a table reference, so they are never taken for an alias.
+var sqlClauseKeywords = map[string]bool{
+	"cross": true, "except": true, "fetch": true, "for": true, "full": true, "group": true,
+	"having": true, "inner": true, "intersect": true, "join": true, "left": true, "limit": true,
+	"natural": true, "offset": true, "on": true, "order": true, "outer": true, "right": true,
+	"union": true, "using": true, "where": true, "window": true,
+}
+
+// sqlToken is a token of a query. Quoted identifiers keep their case.
+type sqlToken struct {
+	text   string
+	ident  bool
+	quoted bool
+}
+
+// keyword returns the lower-cased text of an unquoted identifier.
+func (t sqlToken) keyword() string {
+	if !t.ident || t.quoted {
+		return ""
+	}
+	return strings.ToLower(t.text)
+}
+
+// tokenizeSQL splits query into identifiers and punctuation. String
+// literals, numbers and comments are dropped.
+func tokenizeSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && !(runes[i-1] == '*' && runes[i] == '/') {
+				i++
+			}
+			i++
+		case r == '\'':
+			i++
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case r == '"' || r == '`':
+			start := i + 1
+			i = start
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			tokens = append(tokens, sqlToken{text: string(runes[start:min(i, len(runes))]), ident: true, quoted: true})
+			i++
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '$' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{text: string(runes[start:i]), ident: true})
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+		default:
+			tokens = append(tokens, sqlToken{text: string(r)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// queryReferences returns the tables read by query and the functions it
+// calls, in order of appearance. Names defined by WITH are not tables.
+func queryReferences(query string) (tables []tableRef, functions []string) {
+	tokens := tokenizeSQL(query)
+	ctes := map[string]bool{}
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].ident && tokens[i+1].keyword() == "as" && tokens[i+2].text == "(" {
+			if i > 0 && (tokens[i-1].keyword() == "with" || tokens[i-1].keyword() == "recursive" || tokens[i-1].text == ",") {
+				ctes[strings.ToLower(tokens[i].text)] = true
+			}
+		}
+	}
+
+	// ref reads a possibly qualified name at i and returns it with the
+	// index after it.
+	ref := func(i int) (tableRef, int, bool) {
+		if i >= len(tokens) || !tokens[i].ident || tokens[i].keyword() == "lateral" {
+			return tableRef{}, i, false
+		}
+		if i+2 < len(tokens) && tokens[i+1].text == "." && tokens[i+2].ident {
+			return tableRef{Schema: tokens[i].text, Name: tokens[i+2].text}, i + 3, true
+		}
+		return tableRef{Name: tokens[i].text}, i + 1, true
+	}
+
+	// calls tracks open parentheses, true for those of a function call:
+	// FROM inside them is part of the call, as in EXTRACT(EPOCH FROM ts).
+	var calls []bool
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.text {
+		case "(":
+			calls = append(calls, i > 0 && tokens[i-1].ident && !tokens[i-1].quoted && !sqlNotFunctions[tokens[i-1].keyword()])
+			continue
+		case ")":
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+			continue
+		}
+		if t.ident && !t.quoted && i+1 < len(tokens) && tokens[i+1].text == "(" && !sqlNotFunctions[t.keyword()] {
+			name := t.text
+			if i >= 2 && tokens[i-1].text == "." && tokens[i-2].ident {
+				name = tokens[i-2].text + "." + name
+			}
+			functions = append(functions, name)
+			continue
+		}
+		kw := t.keyword()
+		if kw != "from" && kw != "join" || len(calls) > 0 && calls[len(calls)-1] || i > 0 && tokens[i-1].keyword() == "distinct" {
+			continue
+		}
+		for j := i + 1; ; {
+			table, next, ok := ref(j)
+			if !ok || next < len(tokens) && tokens[next].text == "(" {
+				break // subquery or table function
+			}
+			if table.Schema != "" || !ctes[strings.ToLower(table.Name)] {
+				tables = append(tables, table)
+			}
+			// Skip an alias, then continue with the next table of a
+			// comma separated FROM list.
+			if next < len(tokens) && tokens[next].keyword() == "as" {
+				next++
+			}
+			if next < len(tokens) && tokens[next].ident && !sqlClauseKeywords[tokens[next].keyword()] {
+				next++
+			}
+			if kw != "from" || next >= len(tokens) || tokens[next].text != "," {
+				break
+			}
+			j = next + 1
+		}
+	}
+	return tables, functions
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryReferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		tables    []string
+		functions []string
+	}{
+		{name: "Simple", query: "SELECT count(*) FROM users", tables: []string{"users"}, functions: []string{"count"}},
+		{name: "Qualified", query: "SELECT 1 FROM billing.payments_2024 p", tables: []string{"billing.payments_2024"}},
+		{name: "Join", query: "SELECT 1 FROM a JOIN b ON a.id = b.id LEFT JOIN c.d ON true", tables: []string{"a", "b", "c.d"}},
+		{name: "CommaList", query: "SELECT 1 FROM a AS x, b y, c WHERE x.id = y.id", tables: []string{"a", "b", "c"}},
+		{name: "Subquery", query: "SELECT 1 FROM (SELECT id FROM orders) o", tables: []string{"orders"}},
+		{name: "CTE", query: "WITH recent AS (SELECT * FROM orders) SELECT count(*) FROM recent", tables: []string{"orders"}, functions: []string{"count"}},
+		{name: "QuotedIdentifier", query: `SELECT 1 FROM "Audit"."Log"`, tables: []string{"Audit.Log"}},
+		{name: "ExtractFrom", query: "SELECT EXTRACT(EPOCH FROM max(ts)) FROM events", tables: []string{"events"}, functions: []string{"EXTRACT", "max"}},
+		{name: "QualifiedFunction", query: "SELECT pg_catalog.pg_sleep(1) FROM t", tables: []string{"t"}, functions: []string{"pg_catalog.pg_sleep"}},
+		{name: "StringsAndComments", query: "SELECT 'FROM secrets' FROM t -- JOIN hidden\n/* FROM other */", tables: []string{"t"}},
+		{name: "InIsNotAFunction", query: "SELECT 1 FROM t WHERE id IN (1, 2)", tables: []string{"t"}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tables, functions := queryReferences(tc.query)
+			var names []string
+			for _, table := range tables {
+				names = append(names, table.String())
+			}
+			if !reflect.DeepEqual(names, tc.tables) {
+				t.Errorf("Expected tables %v, got %v", tc.tables, names)
+			}
+			if !reflect.DeepEqual(functions, tc.functions) {
+				t.Errorf("Expected functions %v, got %v", tc.functions, functions)
+			}
+		})
+	}
+}
+
+func TestValidateQueryRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		rules   ValidationConfig
+		wantErr string
+	}{
+		{name: "NoRules", query: "SELECT pg_sleep(1) FROM payments_2024"},
+		{name: "ForbiddenKeyword", query: "SELECT PG_SLEEP(1) FROM t", rules: ValidationConfig{ForbiddenKeywords: []string{"pg_sleep"}}, wantErr: `forbidden keyword "pg_sleep"`},
+		{name: "KeywordWholeWord", query: "SELECT pg_sleep_count FROM t", rules: ValidationConfig{ForbiddenKeywords: []string{"pg_sleep"}}},
+		{name: "ForbiddenTable", query: "SELECT 1 FROM billing.payments_eu", rules: ValidationConfig{ForbiddenTables: []string{"payments_*"}}, wantErr: "table billing.payments_eu is forbidden"},
+		{name: "ForbiddenQualifiedTable", query: "SELECT 1 FROM billing.invoices", rules: ValidationConfig{ForbiddenTables: []string{"billing.*"}}, wantErr: "table billing.invoices is forbidden"},
+		{name: "ForbiddenTableElsewhere", query: "SELECT 1 FROM orders", rules: ValidationConfig{ForbiddenTables: []string{"payments_*"}}},
+		{name: "AllowedSchema", query: "SELECT 1 FROM public.orders JOIN users ON true", rules: ValidationConfig{AllowedSchemas: []string{"public"}}},
+		{name: "SchemaNotAllowed", query: "SELECT 1 FROM billing.orders", rules: ValidationConfig{AllowedSchemas: []string{"public"}}, wantErr: "schema billing is not allowed"},
+		{name: "AllowedTable", query: "SELECT 1 FROM pg_stat_activity", rules: ValidationConfig{AllowedTables: []string{"pg_stat_*"}}},
+		{name: "TableNotAllowed", query: "SELECT 1 FROM pg_stat_activity JOIN users ON true", rules: ValidationConfig{AllowedTables: []string{"pg_stat_*"}}, wantErr: "table users is not allowed"},
+		{name: "AllowedFunction", query: "SELECT COUNT(*) FROM t", rules: ValidationConfig{AllowedFunctions: []string{"count"}}},
+		{name: "FunctionNotAllowed", query: "SELECT count(*), pg_read_file('x') FROM t", rules: ValidationConfig{AllowedFunctions: []string{"count"}}, wantErr: "function pg_read_file is not allowed"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateQueryRules(tc.query, tc.rules)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigValidationRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `validation:
+  forbidden_keywords: [pg_sleep]
+  forbidden_tables: ["payments_*"]
+metrics:
+  - name: orders
+    query: SELECT count(*) FROM orders
+  - name: payments
+    query: SELECT count(*) FROM payments_eu
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `metric "payments": invalid query: table payments_eu is forbidden`) {
+		t.Errorf("Expected forbidden table error, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig caps the rate of requests a Datadog client sends, so large
+// configurations do not trip the API rate limits. Every destination has its
+// own limit.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained request rate; zero disables the
+	// limit.
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"`
+	// Burst is the number of requests sent without waiting after an idle
+	// period (default: the rate rounded up).
+	Burst int `yaml:"burst,omitempty"`
+}
+
+// rateLimiter is a token bucket. A nil *rateLimiter never waits.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for config, or nil when it is disabled.
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	if config.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(config.RequestsPerSecond)
+	}
+	return &rateLimiter{rate: config.RequestsPerSecond, burst: burst, tokens: burst}
+}
+
+// Wait blocks until a request may be sent, or returns the error of ctx when
+// it is done first.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	delay := l.reserve(time.Now())
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back for the requests still waiting.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token at now and returns how long to wait until it is
+// available. Tokens may go negative, which queues the callers in order.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		config RateLimitConfig
+		// at are the offsets of the requests from start.
+		at   []time.Duration
+		want []time.Duration
+	}{
+		{
+			name:   "Burst then rate",
+			config: RateLimitConfig{RequestsPerSecond: 2, Burst: 2},
+			at:     []time.Duration{0, 0, 0, 0},
+			want:   []time.Duration{0, 0, 500 * time.Millisecond, time.Second},
+		},
+		{
+			name:   "Refills over time",
+			config: RateLimitConfig{RequestsPerSecond: 1, Burst: 1},
+			at:     []time.Duration{0, time.Second, 1500 * time.Millisecond},
+			want:   []time.Duration{0, 0, 500 * time.Millisecond},
+		},
+		{
+			name:   "Refill capped at burst",
+			config: RateLimitConfig{RequestsPerSecond: 1, Burst: 1},
+			at:     []time.Duration{0, time.Minute, time.Minute},
+			want:   []time.Duration{0, 0, time.Second},
+		},
+		{
+			name:   "Default burst is the rate",
+			config: RateLimitConfig{RequestsPerSecond: 2.5},
+			at:     []time.Duration{0, 0, 0, 0},
+			want:   []time.Duration{0, 0, 0, 400 * time.Millisecond},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			limiter := newRateLimiter(tc.config)
+			for i, offset := range tc.at {
+				if got := limiter.reserve(start.Add(offset)); got != tc.want[i] {
+					t.Errorf("Request %d: expected wait %v, got %v", i, tc.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	if limiter := newRateLimiter(RateLimitConfig{}); limiter != nil {
+		t.Fatalf("Expected a disabled limiter, got %+v", limiter)
+	}
+	var disabled *rateLimiter
+	if err := disabled.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	limiter := newRateLimiter(RateLimitConfig{RequestsPerSecond: 0.1, Burst: 1})
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if limiter.tokens < -0.01 {
+		t.Errorf("Expected the token to be given back, got %v tokens", limiter.tokens)
+	}
+}
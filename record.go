@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Empty results kept in a snapshot, so on_null and on_no_rows apply on replay.
+const (
+	recordedNull   = "null"
+	recordedNoRows = "no_rows"
+)
+
+// recordedSample is a sample in a snapshot file.
+type recordedSample struct {
+	Name  string   `json:"name,omitempty"`
+	Value float64  `json:"value"`
+	Tags  []string `json:"tags,omitempty"`
+	Host  string   `json:"host,omitempty"`
+}
+
+// recordedResult is the query output of one metric. Empty is set when the
+// query returned NULL or no rows and Error when it failed.
+type recordedResult struct {
+	Samples    []recordedSample `json:"samples,omitempty"`
+	Empty      string           `json:"empty,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	RecordedAt time.Time        `json:"recorded_at"`
+}
+
+// resultSnapshot holds the query outputs of a run, keyed by metric name.
+// Recorded with -record, it is re-sent with -replay without touching the
+// database. It is safe for concurrent use.
+type resultSnapshot struct {
+	path string
+
+	mu      sync.Mutex
+	metrics map[string]recordedResult
+}
+
+// snapshotFile is the JSON layout of a snapshot file.
+type snapshotFile struct {
+	Metrics map[string]recordedResult `json:"metrics"`
+}
+
+// newResultSnapshot returns an empty snapshot saved to path.
+func newResultSnapshot(path string) *resultSnapshot {
+	return &resultSnapshot{path: path, metrics: make(map[string]recordedResult)}
+}
+
+// loadResultSnapshot reads the snapshot file at path.
+func loadResultSnapshot(path string) (*resultSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	snapshot := newResultSnapshot(path)
+	for name, result := range file.Metrics {
+		snapshot.metrics[name] = result
+	}
+	return snapshot, nil
+}
+
+// Record keeps the outcome of the metric's query, replacing the previous one.
+func (s *resultSnapshot) Record(metric string, samples []sample, err error) {
+	result := recordedResult{RecordedAt: time.Now().UTC()}
+	switch {
+	case errors.Is(err, errNullResult):
+		result.Empty = recordedNull
+	case errors.Is(err, errNoRows):
+		result.Empty = recordedNoRows
+	case err != nil:
+		result.Error = err.Error()
+	}
+	for _, smp := range samples {
+		result.Samples = append(result.Samples, recordedSample{Name: smp.Name, Value: smp.Value, Tags: smp.Tags, Host: smp.Host})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics[metric] = result
+}
+
+// Samples returns the recorded outcome of the metric's query.
+func (s *resultSnapshot) Samples(metric string) ([]sample, error) {
+	s.mu.Lock()
+	result, ok := s.metrics[metric]
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("no result recorded for metric %q in %s", metric, s.path)
+	case result.Empty == recordedNull:
+		return nil, errNullResult
+	case result.Empty == recordedNoRows:
+		return nil, errNoRows
+	case result.Error != "":
+		return nil, errors.New(result.Error)
+	}
+	samples := make([]sample, len(result.Samples))
+	for i, smp := range result.Samples {
+		samples[i] = sample{Name: smp.Name, Value: smp.Value, Tags: smp.Tags, Host: smp.Host}
+	}
+	return samples, nil
+}
+
+// Save writes the snapshot file.
+func (s *resultSnapshot) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(snapshotFile{Metrics: s.metrics}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
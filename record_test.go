@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	metric := MetricConfig{
+		Name:    "queue.depth",
+		Source:  "exec",
+		Command: []string{"sh", "-c", `echo '{"samples":[{"value":7,"tags":["queue:mail"]}]}'`},
+	}
+	empty := MetricConfig{
+		Name:     "queue.empty",
+		Source:   "exec",
+		Command:  []string{"sh", "-c", `echo '{"samples":[]}'`},
+		OnNoRows: EmptyPolicy{Action: emptyZero},
+	}
+
+	recorder := &Collector{Sender: &MockMetricSender{}, Record: newResultSnapshot(path)}
+	for _, m := range []MetricConfig{metric, empty} {
+		if result := recorder.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), m); result.Status != statusSent {
+			t.Fatalf("Expected %s to be sent while recording, got %+v", m.Name, result)
+		}
+	}
+	if err := recorder.Record.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := loadResultSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &MockMetricSender{}
+	replayer := &Collector{Sender: sender, Replay: replay}
+	for _, m := range []MetricConfig{metric, empty} {
+		// The source is broken now; the recorded result must be used.
+		m.Command = []string{"false"}
+		if result := replayer.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), m); result.Status != statusSent {
+			t.Fatalf("Expected %s to be sent on replay, got %+v", m.Name, result)
+		}
+	}
+	if len(sender.SentMetrics) != 2 {
+		t.Fatalf("Expected two points, got %+v", sender.SentMetrics)
+	}
+	if got := sender.SentMetrics[0]; got.Points[0][1] != 7 || !slices.Contains(got.Tags, "queue:mail") {
+		t.Errorf("Expected the recorded point, got %+v", got)
+	}
+	if got := sender.SentMetrics[1]; got.Points[0][1] != 0 {
+		t.Errorf("Expected on_no_rows to apply to the recorded empty result, got %+v", got)
+	}
+
+	missing := MetricConfig{Name: "not.recorded", Source: "exec", Command: []string{"false"}}
+	if result := replayer.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), missing); result.Status != statusQueryFailed {
+		t.Errorf("Expected a metric missing from the snapshot to fail, got %+v", result)
+	}
+}
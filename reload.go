@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce is how long the watcher waits for further changes before
+// signalling one, as editors and ConfigMap updates touch several files.
+const reloadDebounce = 200 * time.Millisecond
+
+// addSource records a file read while loading the configuration in its
+// checksum.
+func (c *Config) addSource(path string, data []byte) {
+	h := sha256.New()
+	h.Write([]byte(c.checksum))
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(data)
+	c.checksum = hex.EncodeToString(h.Sum(nil))
+	c.addWatchDir(filepath.Dir(path))
+}
+
+// addWatchDir records a directory to watch for configuration changes.
+func (c *Config) addWatchDir(dir string) {
+	if !slices.Contains(c.watchDirs, dir) {
+		c.watchDirs = append(c.watchDirs, dir)
+	}
+}
+
+// configReloader reloads the configuration of a daemon when its files
+// change. The directories of the files are watched, rather than the files,
+// which also follows the symlink swap Kubernetes uses to update a mounted
+// ConfigMap and sees files added to an include glob. When they cannot be
+// watched, the files are read again before every cycle instead. Only the
+// metrics and the settings read during cycles are reloaded; the database,
+// sinks, audit log, guards, tracing, send pipeline and the interval keep
+// their settings until a restart.
+type configReloader struct {
+	opts     *options
+	db       *sql.DB
+	checksum string
+	lastErr  string
+	watcher  *fsnotify.Watcher
+	changes  chan struct{}
+}
+
+// newConfigReloader returns a reloader for the configuration loaded as
+// config.
+func newConfigReloader(opts *options, db *sql.DB, config *Config) *configReloader {
+	return &configReloader{opts: opts, db: db, checksum: config.checksum}
+}
+
+// Watch starts watching the directories of config's files. It reports false
+// when they cannot be watched, in which case the caller reloads before
+// every cycle.
+func (r *configReloader) Watch(ctx context.Context, config *Config) bool {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		r.watcher = watcher
+		err = r.watchDirs(config)
+	}
+	if err != nil {
+		logEvent(ctx, "warn", "Failed to watch config files - reloading before every cycle", map[string]interface{}{
+			"error": err.Error(),
+		})
+		r.Close()
+		return false
+	}
+	r.changes = make(chan struct{}, 1)
+	go r.watch(ctx, watcher)
+	return true
+}
+
+// watchDirs adds the directories of config's files to the watcher.
+func (r *configReloader) watchDirs(config *Config) error {
+	for _, dir := range config.watchDirs {
+		if slices.Contains(r.watcher.WatchList(), dir) {
+			continue
+		}
+		if err := r.watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch forwards the events of watcher to Changed once they settle.
+func (r *configReloader) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	settle := time.NewTimer(0)
+	<-settle.C
+	for {
+		select {
+		case <-ctx.Done():
+			settle.Stop()
+			return
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			settle.Reset(reloadDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logEvent(ctx, "warn", "Error watching config files", map[string]interface{}{
+				"error": err.Error(),
+			})
+		case <-settle.C:
+			select {
+			case r.changes <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Changed returns a channel receiving a value when a watched file changed.
+// Without a watcher it is nil, which blocks forever.
+func (r *configReloader) Changed() <-chan struct{} {
+	return r.changes
+}
+
+// Close stops watching.
+func (r *configReloader) Close() {
+	if r.watcher != nil {
+		r.watcher.Close()
+		r.watcher = nil
+	}
+}
+
+// Reload loads the configuration again and, when it changed, applies it to
+// col. An invalid configuration is logged once and the previous one is kept.
+func (r *configReloader) Reload(ctx context.Context, col *Collector, health *HealthState) {
+	config, err := loadConfigFor(r.opts)
+	if err == nil && config.checksum == r.checksum {
+		r.lastErr = ""
+		health.SetConfig(nil)
+		return
+	}
+	if err == nil {
+		err = selectMetrics(ctx, config, r.opts, r.db)
+	}
+	if err != nil {
+		if err.Error() != r.lastErr {
+			logEvent(ctx, "error", "Failed to reload config - keeping the previous one", map[string]interface{}{
+				"error": logRedactor.RedactString(err.Error()),
+			})
+		}
+		r.lastErr = err.Error()
+		health.SetConfig(err)
+		return
+	}
+
+	added, removed, changed := metricDiff(col.Config.Metrics, config.Metrics)
+	logEvent(ctx, "info", "Configuration reloaded", map[string]interface{}{
+		"metrics_count": len(config.Metrics),
+		"added":         added,
+		"removed":       removed,
+		"changed":       changed,
+	})
+	r.checksum, r.lastErr = config.checksum, ""
+	if r.watcher != nil {
+		if err := r.watchDirs(config); err != nil {
+			logEvent(ctx, "warn", "Failed to watch new config directories", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	logRedactor.SetSensitiveTags(config.SensitiveTags)
+	col.Config = config
+	health.SetConfig(nil)
+}
+
+// metricDiff compares two metric lists by name.
+func metricDiff(before, after []MetricConfig) (added, removed, changed []string) {
+	old := make(map[string]MetricConfig, len(before))
+	for _, metric := range before {
+		old[metric.Name] = metric
+	}
+	for _, metric := range after {
+		previous, ok := old[metric.Name]
+		switch {
+		case !ok:
+			added = append(added, metric.Name)
+		case !sameMetric(previous, metric):
+			changed = append(changed, metric.Name)
+		}
+		delete(old, metric.Name)
+	}
+	removed = sortedKeys(old)
+	slices.Sort(added)
+	slices.Sort(changed)
+	return added, removed, changed
+}
+
+// sameMetric reports whether two metrics are configured alike. Enabled
+// expressions are compared by their text.
+func sameMetric(a, b MetricConfig) bool {
+	if (a.Enabled == nil) != (b.Enabled == nil) || a.Enabled != nil && a.Enabled.Expr != b.Enabled.Expr {
+		return false
+	}
+	a.Enabled, b.Enabled = nil, nil
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetricDiff(t *testing.T) {
+	before := []MetricConfig{
+		{Name: "a", Query: "SELECT 1"},
+		{Name: "b", Query: "SELECT 2"},
+		{Name: "c", Query: "SELECT 3", Enabled: &Enabled{Expr: "version >= 14"}},
+	}
+	after := []MetricConfig{
+		{Name: "d", Query: "SELECT 4"},
+		{Name: "c", Query: "SELECT 3", Enabled: &Enabled{Expr: "version >= 14"}},
+		{Name: "b", Query: "SELECT 20"},
+	}
+
+	added, removed, changed := metricDiff(before, after)
+	if !reflect.DeepEqual(added, []string{"d"}) || !reflect.DeepEqual(removed, []string{"a"}) || !reflect.DeepEqual(changed, []string{"b"}) {
+		t.Errorf("Expected added [d], removed [a], changed [b], got %v, %v, %v", added, removed, changed)
+	}
+}
+
+func TestConfigReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("metrics:\n  - name: a\n    query: SELECT 1\n")
+
+	opts := &options{configFile: path, shardCount: 1}
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := &Collector{Config: config}
+	health := NewHealthState(path, 0)
+	reloader := newConfigReloader(opts, nil, config)
+	ctx := context.Background()
+
+	reloader.Reload(ctx, col, health)
+	if col.Config != config {
+		t.Error("Expected an unchanged configuration to be kept")
+	}
+
+	write("metrics:\n  - name: a\n    query: SELECT 1\n  - name: b\n    query: SELECT 2\n")
+	reloader.Reload(ctx, col, health)
+	if len(col.Config.Metrics) != 2 {
+		t.Fatalf("Expected the reloaded metrics, got %+v", col.Config.Metrics)
+	}
+
+	reloaded := col.Config
+	write("metrics:\n  - name: a\n    querry: SELECT 1\n")
+	reloader.Reload(ctx, col, health)
+	if col.Config != reloaded {
+		t.Error("Expected an invalid configuration to be ignored")
+	}
+	if report := health.report(health.started); report.Config.OK {
+		t.Error("Expected the health report to show the invalid configuration")
+	}
+}
+
+func TestConfigReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("metrics:\n  - name: a\n    query: SELECT 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{configFile: path, shardCount: 1}
+	config, err := loadConfigFor(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := &Collector{Config: config}
+	health := NewHealthState(path, 0)
+	reloader := newConfigReloader(opts, nil, config)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !reloader.Watch(ctx, config) {
+		t.Fatal("Expected the config directory to be watched")
+	}
+	defer reloader.Close()
+
+	// A ConfigMap update writes the new file next to the old one and swaps
+	// it in with a rename.
+	next := filepath.Join(dir, ".config.yaml.tmp")
+	if err := os.WriteFile(next, []byte("metrics:\n  - name: a\n    query: SELECT 1\n  - name: b\n    query: SELECT 2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-reloader.Changed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be signalled")
+	}
+	reloader.Reload(ctx, col, health)
+	if len(col.Config.Metrics) != 2 {
+		t.Errorf("Expected the reloaded metrics, got %+v", col.Config.Metrics)
+	}
+}
+
+func TestConfigReloaderWatchFallback(t *testing.T) {
+	config := &Config{watchDirs: []string{filepath.Join(t.TempDir(), "missing")}}
+	reloader := newConfigReloader(&options{}, nil, config)
+	defer reloader.Close()
+	if reloader.Watch(context.Background(), config) {
+		t.Error("Expected watching a missing directory to fail")
+	}
+	if reloader.Changed() != nil {
+		t.Error("Expected no change channel without a watcher")
+	}
+}
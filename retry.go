@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+)
+
+// retryablePostgresCodes are SQLSTATE codes (or classes, when two characters
+// long) that indicate a transient condition worth retrying.
+var retryablePostgresCodes = []string{
+	"40001", // serialization_failure
+	"40P01", // deadlock_detected
+	"55P03", // lock_not_available
+	"57P01", // admin_shutdown (e.g. failover)
+	"57P02", // crash_shutdown
+	"57P03", // cannot_connect_now
+	"08",    // connection exceptions
+}
+
+// retryableMySQLErrors are MySQL error numbers that indicate a transient condition.
+var retryableMySQLErrors = map[uint16]bool{
+	1205: true, // ER_LOCK_WAIT_TIMEOUT
+	1213: true, // ER_LOCK_DEADLOCK
+	1290: true, // ER_OPTION_PREVENTS_STATEMENT (read-only during failover)
+	1927: true, // ER_CONNECTION_KILLED
+	2006: true, // CR_SERVER_GONE_ERROR
+	2013: true, // CR_SERVER_LOST
+}
+
+// isRetryableQueryError reports whether err is a transient database error:
+// serialization failures, deadlocks, failovers or a broken connection.
+func isRetryableQueryError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		for _, retryable := range retryablePostgresCodes {
+			if code == retryable || (len(retryable) == 2 && strings.HasPrefix(code, retryable)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return retryableMySQLErrors[myErr.Number]
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryBackoff returns the delay before retry attempt n (0-based), doubling
+// the base delay on every attempt up to maxRetryDelay.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultRetryDelay
+	}
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// withRetry calls fn and retries it up to retries times while it fails with a
+// retryable error. It never sleeps past the context deadline: when the next
+// delay would exceed it, the last error is returned immediately.
+func withRetry[T any](ctx context.Context, retries int, baseDelay time.Duration, onRetry func(attempt int, delay time.Duration, err error), fn func() (T, error)) (T, error) {
+	return withRetryIf(ctx, retries, baseDelay, isRetryableQueryError, onRetry, fn)
+}
+
+// withRetryIf is withRetry with a custom predicate deciding which errors are retried.
+func withRetryIf[T any](ctx context.Context, retries int, baseDelay time.Duration, retryable func(error) bool, onRetry func(attempt int, delay time.Duration, err error), fn func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= retries || !retryable(err) {
+			return result, err
+		}
+
+		delay := retryBackoff(baseDelay, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, err
+		}
+		if onRetry != nil {
+			onRetry(attempt+1, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+)
+
+func TestIsRetryableQueryError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "postgres serialization failure", err: &pq.Error{Code: "40001"}, want: true},
+		{name: "postgres deadlock", err: fmt.Errorf("query: %w", &pq.Error{Code: "40P01"}), want: true},
+		{name: "postgres connection exception class", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "postgres syntax error", err: &pq.Error{Code: "42601"}, want: false},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213}, want: true},
+		{name: "mysql unknown column", err: &mysql.MySQLError{Number: 1054}, want: false},
+		{name: "bad connection", err: driver.ErrBadConn, want: true},
+		{name: "context deadline", err: context.DeadlineExceeded, want: false},
+		{name: "generic error", err: errors.New("boom"), want: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableQueryError(tc.err); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	calls := 0
+	value, err := withRetry(context.Background(), 3, time.Millisecond, nil, func() (float64, error) {
+		calls++
+		if calls < 3 {
+			return 0, &pq.Error{Code: "40P01"}
+		}
+		return 42, nil
+	})
+	if err != nil || value != 42 {
+		t.Fatalf("Expected 42 after retries, got %v (%v)", value, err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	_, err = withRetry(context.Background(), 3, time.Millisecond, nil, func() (float64, error) {
+		calls++
+		return 0, errors.New("syntax error")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected non-retryable error to fail after 1 call, got %d calls (%v)", calls, err)
+	}
+}
+
+func TestWithRetryHonorsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+	_, err := withRetry(ctx, 5, time.Second, nil, func() (float64, error) {
+		calls++
+		return 0, driver.ErrBadConn
+	})
+	if err == nil {
+		t.Fatal("Expected error")
+	}
+	if calls != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected no retry beyond the deadline, got %d calls in %v", calls, time.Since(start))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	if got := retryBackoff(100*time.Millisecond, 0); got != 100*time.Millisecond {
+		t.Errorf("Expected 100ms, got %v", got)
+	}
+	if got := retryBackoff(100*time.Millisecond, 2); got != 400*time.Millisecond {
+		t.Errorf("Expected 400ms, got %v", got)
+	}
+	if got := retryBackoff(10*time.Second, 10); got != maxRetryDelay {
+		t.Errorf("Expected cap %v, got %v", maxRetryDelay, got)
+	}
+}
+
+func TestMetricConfigRetryYAML(t *testing.T) {
+	var metric MetricConfig
+	if err := yaml.Unmarshal([]byte("name: m\nretries: 2\nretry_delay: 250ms\n"), &metric); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if metric.Retries != 2 || metric.RetryDelay != 250*time.Millisecond {
+		t.Errorf("Unexpected retry settings: %d %v", metric.Retries, metric.RetryDelay)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/collector"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/source"
+)
+
+// sample is one point produced by a metric query. Tags are added to the
+// metric's configured tags; Name and Host, when set, replace the metric name
+// and host.
+type sample = source.Sample
+
+// rowMode reports whether the metric's query returns rows of a value plus
+// extra columns instead of a single value.
+func (m MetricConfig) rowMode() bool {
+	return len(m.TagColumns) > 0 || isNameTemplate(m.Name) || m.HostColumn != "" || m.Aggregate != "" || m.Type == metricTypeDistribution
+}
+
+// sampleHost returns the host a point is submitted with: the host read from
+// the row, or the metric's host.
+func (m MetricConfig) sampleHost(s sample) string {
+	if s.Host != "" {
+		return s.Host
+	}
+	return m.Host
+}
+
+// hostColumn reports whether the metric reads the host from a column that is
+// not also a tag or name column, and so adds a column to the result.
+func (m MetricConfig) hostColumn(nameColumns []string) bool {
+	isColumn := func(column string) bool { return strings.EqualFold(column, m.HostColumn) }
+	return m.HostColumn != "" && !slices.ContainsFunc(m.TagColumns, isColumn) && !slices.ContainsFunc(nameColumns, isColumn)
+}
+
+// nameColumns returns the columns referenced by a templated metric name that
+// are not also tag columns.
+func (m MetricConfig) nameColumns() ([]string, error) {
+	if !isNameTemplate(m.Name) {
+		return nil, nil
+	}
+	tmpl, err := parseNameTemplate(m.Name)
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, field := range templateFields(tmpl) {
+		if !slices.ContainsFunc(m.TagColumns, func(tag string) bool { return strings.EqualFold(tag, field) }) {
+			columns = append(columns, field)
+		}
+	}
+	return columns, nil
+}
+
+// validateMetricQuery validates the metric's query, allowing the extra
+// columns used by row mode.
+func validateMetricQuery(metric MetricConfig) error {
+	if metric.recordMode() {
+		if err := validateRecordMode(metric); err != nil {
+			return err
+		}
+	}
+	if metric.execSource() {
+		if metric.HostColumn != "" {
+			return errors.New("host_column cannot be used with source exec")
+		}
+		// The query, if any, is passed to the plugin as is.
+		return nil
+	}
+	// Time-window placeholders are checked by rendering a sample window.
+	metric, err := metric.withWindow(newQueryWindow(time.Now(), time.Time{}, defaultInitialWindow))
+	if err != nil {
+		return err
+	}
+	nameColumns, err := metric.nameColumns()
+	if err != nil {
+		return err
+	}
+	if len(nameColumns) > 0 && metric.Query == "" {
+		return errors.New("templated metric names require a query")
+	}
+	if metric.HostColumn != "" && metric.Query == "" && !metric.recordMode() {
+		return errors.New("host_column requires a query")
+	}
+	if metric.Type == metricTypeDistribution && metric.Query == "" {
+		return errors.New("distribution metrics require a query")
+	}
+	if metric.Type == metricTypeDistribution && metric.Aggregate != "" {
+		return errors.New("aggregate cannot be used with distribution metrics")
+	}
+	if metric.AllowUnsafe {
+		return nil
+	}
+	if metric.recordMode() {
+		return validateQueryColumns(metric.Query, math.MaxInt)
+	}
+	columns := 1 + len(metric.TagColumns) + len(nameColumns)
+	if metric.hostColumn(nameColumns) {
+		columns++
+	}
+	return validateQueryColumns(metric.Query, columns)
+}
+
+// Samples runs the metric's query and returns its points: a single point for
+// plain metrics, or one point per row in row mode.
+func (p *SQLDB) Samples(ctx context.Context, metric MetricConfig) ([]sample, error) {
+	metric, err := p.Guard.apply(ctx, p, metric)
+	if err != nil {
+		return nil, err
+	}
+	if !metric.rowMode() {
+		value, err := p.QueryMetric(ctx, metric)
+		if err != nil {
+			return nil, err
+		}
+		return []sample{{Value: value}}, nil
+	}
+
+	ctx, span := startQuerySpan(ctx, metric)
+	startTime := time.Now()
+	samples, rows, err := fetchSamplesFromDB(ctx, p.DB, metric)
+	p.observe(ctx, metric, rows, time.Since(startTime), err)
+	endSpan(span, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// fetchSamplesFromDB runs a row mode query and returns its samples with the
+// number of rows read. It returns errNoRows for an empty result. Rows with a
+// NULL value are handled by the metric's on_null policy.
+// Rows are converted one at a time as they are read and, with aggregate,
+// folded into their series right away, so only the aggregates are held. A
+// result over the metric's max_rows is an error, and the query is cancelled
+// instead of being read to the end.
+func fetchSamplesFromDB(ctx context.Context, db *sql.DB, metric MetricConfig) ([]sample, int, error) {
+	args, err := metric.queryArgs()
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, metric.Query, args...)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, 0, fmt.Errorf("database query failed due to context: %w", err)
+		}
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read columns: %w", err)
+	}
+	layout, err := newRowLayout(columns, metric)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var samples []sample
+	agg := newSampleAggregator(metric.Aggregate)
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	read, kept := 0, 0
+	for rows.Next() {
+		if read++; metric.MaxRows > 0 && read > metric.MaxRows {
+			// Closing the rows would read the rest of the result first.
+			cancel()
+			return nil, read, fmt.Errorf("query returned more than max_rows (%d) rows", metric.MaxRows)
+		}
+		clear(values)
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, read, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		s, skip, err := layout.sample(metric, values)
+		if err != nil {
+			return nil, read, err
+		}
+		switch {
+		case skip:
+			continue
+		case agg != nil:
+			agg.add(s)
+		default:
+			samples = append(samples, s)
+		}
+		kept++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, read, fmt.Errorf("failed to read rows: %w", err)
+	}
+	if kept == 0 {
+		return nil, read, errNoRows
+	}
+	if agg != nil {
+		return agg.samples(), read, nil
+	}
+	return samples, read, nil
+}
+
+// Records runs the query of a metric in a record mode and returns its rows
+// by column name.
+func (p *SQLDB) Records(ctx context.Context, metric MetricConfig) ([]map[string]interface{}, error) {
+	metric, err := p.Guard.apply(ctx, p, metric)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := startQuerySpan(ctx, metric)
+	startTime := time.Now()
+	records, err := fetchRecordsFromDB(ctx, p.DB, metric)
+	p.observe(ctx, metric, len(records), time.Since(startTime), err)
+	endSpan(span, 0, err)
+	return records, err
+}
+
+// fetchRecordsFromDB runs a record mode query and returns every row as a map
+// of column names to values. Text and timestamps are returned as strings;
+// max_rows applies as in row mode.
+func fetchRecordsFromDB(ctx context.Context, db *sql.DB, metric MetricConfig) ([]map[string]interface{}, error) {
+	args, err := metric.queryArgs()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, metric.Query, args...)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("database query failed due to context: %w", err)
+		}
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	var records []map[string]interface{}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if metric.MaxRows > 0 && len(records) >= metric.MaxRows {
+			cancel()
+			return nil, fmt.Errorf("query returned more than max_rows (%d) rows", metric.MaxRows)
+		}
+		clear(values)
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			switch v := values[i].(type) {
+			case []byte, time.Time:
+				record[column] = tagValue(v)
+			default:
+				record[column] = v
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+	return records, nil
+}
+
+// recordColumn returns the value of the column of record named by a column
+// option such as host_column or message_column. Column names are matched
+// case-insensitively, as drivers may return them in a different case; an
+// exact match wins.
+func recordColumn(record map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := record[name]; ok {
+		return value, true
+	}
+	for column, value := range record {
+		if strings.EqualFold(column, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// rowLayout maps result columns to the name, value, tags and host of a
+// sample. host is -1 without a host column.
+type rowLayout struct {
+	columns []string
+	value   int
+	tags    []tagColumn
+	name    *template.Template
+	host    int
+}
+
+// tagColumn is a result column whose value becomes a tag.
+type tagColumn struct {
+	index int
+	name  string
+}
+
+// newRowLayout locates the tag, name template and host columns by name. The
+// value is the first column that is none of them.
+func newRowLayout(columns []string, metric MetricConfig) (rowLayout, error) {
+	layout := rowLayout{columns: columns, value: -1, host: -1}
+	index := make(map[string]int, len(columns))
+	for i, name := range columns {
+		index[strings.ToLower(name)] = i
+	}
+	isTag := make(map[int]bool, len(metric.TagColumns))
+	for _, name := range metric.TagColumns {
+		i, ok := index[strings.ToLower(name)]
+		if !ok {
+			return layout, fmt.Errorf("tag column %q not found in query result (columns: %s)", name, strings.Join(columns, ", "))
+		}
+		layout.tags = append(layout.tags, tagColumn{index: i, name: name})
+		isTag[i] = true
+	}
+	if isNameTemplate(metric.Name) {
+		tmpl, err := parseNameTemplate(metric.Name)
+		if err != nil {
+			return layout, err
+		}
+		for _, name := range templateFields(tmpl) {
+			i, ok := index[strings.ToLower(name)]
+			if !ok {
+				return layout, fmt.Errorf("metric name column %q not found in query result (columns: %s)", name, strings.Join(columns, ", "))
+			}
+			isTag[i] = true
+		}
+		layout.name = tmpl
+	}
+	if metric.HostColumn != "" {
+		i, ok := index[strings.ToLower(metric.HostColumn)]
+		if !ok {
+			return layout, fmt.Errorf("host column %q not found in query result (columns: %s)", metric.HostColumn, strings.Join(columns, ", "))
+		}
+		layout.host = i
+		isTag[i] = true
+	}
+	for i := range columns {
+		if !isTag[i] {
+			layout.value = i
+			break
+		}
+	}
+	if layout.value < 0 {
+		return layout, errors.New("query result has no value column besides the tag, name and host columns")
+	}
+	return layout, nil
+}
+
+// sample converts one scanned row. Tag columns with a NULL value are omitted,
+// as is a NULL host.
+func (l rowLayout) sample(metric MetricConfig, values []interface{}) (sample, bool, error) {
+	var s sample
+	for _, tag := range l.tags {
+		if values[tag.index] != nil {
+			s.Tags = append(s.Tags, tag.name+":"+tagValue(values[tag.index]))
+		}
+	}
+	if l.host >= 0 && values[l.host] != nil {
+		s.Host = tagValue(values[l.host])
+	}
+	if l.name != nil {
+		row := make(map[string]string, 2*len(l.columns))
+		for i, column := range l.columns {
+			value := ""
+			if values[i] != nil {
+				value = tagValue(values[i])
+			}
+			row[column] = value
+			row[strings.ToLower(column)] = value
+		}
+		name, err := renderMetricName(l.name, row)
+		if err != nil {
+			return s, false, err
+		}
+		s.Name = name
+	}
+
+	value, err := convertValue(metric, values[l.value])
+	if errors.Is(err, errNullResult) {
+		var skip bool
+		value, skip, err = metric.OnNull.apply(err)
+		if skip {
+			return s, true, nil
+		}
+	}
+	if err != nil {
+		return s, false, err
+	}
+	s.Value = value
+	return s, false, nil
+}
+
+// convertValue converts a scanned value using the metric's value map and the
+// registered converters. NULL is reported as errNullResult.
+func convertValue(metric MetricConfig, v interface{}) (float64, error) {
+	if v == nil {
+		return 0, errNullResult
+	}
+	if mapped, ok, err := mapTextValue(metric, v); ok {
+		return mapped, err
+	}
+	f, err := collector.ToFloat64(v)
+	if errors.Is(err, collector.ErrNull) {
+		return 0, errNullResult
+	}
+	return f, err
+}
+
+// tagValue formats a scanned column value for use in a tag.
+func tagValue(v interface{}) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRowLayoutSample(t *testing.T) {
+	metric := MetricConfig{TagColumns: []string{"region", "plan"}}
+	layout, err := newRowLayout([]string{"region", "total", "PLAN"}, metric)
+	if err != nil {
+		t.Fatalf("newRowLayout failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		metric   MetricConfig
+		values   []interface{}
+		want     sample
+		wantSkip bool
+		wantErr  error
+	}{
+		{
+			name:   "Value and tags",
+			metric: metric,
+			values: []interface{}{[]byte("us-east-1"), int64(12), "pro"},
+			want:   sample{Value: 12, Tags: []string{"region:us-east-1", "plan:pro"}},
+		},
+		{
+			name:   "NULL tag omitted",
+			metric: metric,
+			values: []interface{}{[]byte("eu-west-1"), int64(3), nil},
+			want:   sample{Value: 3, Tags: []string{"region:eu-west-1"}},
+		},
+		{
+			name:    "NULL value fails by default",
+			metric:  metric,
+			values:  []interface{}{[]byte("eu-west-1"), nil, "free"},
+			wantErr: errNullResult,
+		},
+		{
+			name:     "NULL value skipped by policy",
+			metric:   MetricConfig{TagColumns: metric.TagColumns, OnNull: EmptyPolicy{Action: emptySkip}},
+			values:   []interface{}{[]byte("eu-west-1"), nil, "free"},
+			wantSkip: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, skip, err := layout.sample(tc.metric, tc.values)
+			if !errors.Is(err, tc.wantErr) || (tc.wantErr == nil && err != nil) {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if skip != tc.wantSkip {
+				t.Fatalf("Expected skip=%v, got %v", tc.wantSkip, skip)
+			}
+			if tc.wantErr == nil && !tc.wantSkip && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRowLayoutHostColumn(t *testing.T) {
+	metric := MetricConfig{Host: "db-main", HostColumn: "Server", TagColumns: []string{"server"}}
+	layout, err := newRowLayout([]string{"server", "lag"}, metric)
+	if err != nil {
+		t.Fatalf("newRowLayout failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		values   []interface{}
+		want     sample
+		wantHost string
+	}{
+		{
+			name:     "Host from row",
+			values:   []interface{}{[]byte("web-1"), int64(4)},
+			want:     sample{Value: 4, Tags: []string{"server:web-1"}, Host: "web-1"},
+			wantHost: "web-1",
+		},
+		{
+			name:     "NULL host falls back",
+			values:   []interface{}{nil, int64(2)},
+			want:     sample{Value: 2},
+			wantHost: "db-main",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := layout.sample(metric, tc.values)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+			if host := metric.sampleHost(got); host != tc.wantHost {
+				t.Errorf("Expected host %q, got %q", tc.wantHost, host)
+			}
+		})
+	}
+}
+
+func TestNewRowLayoutErrors(t *testing.T) {
+	metric := MetricConfig{TagColumns: []string{"region"}}
+	if _, err := newRowLayout([]string{"total", "zone"}, metric); err == nil {
+		t.Error("Expected error for missing tag column")
+	}
+	if _, err := newRowLayout([]string{"region"}, metric); err == nil {
+		t.Error("Expected error when only tag columns are returned")
+	}
+	if _, err := newRowLayout([]string{"total"}, MetricConfig{HostColumn: "host"}); err == nil {
+		t.Error("Expected error for missing host column")
+	}
+}
+
+// seriesDriver is a database driver whose queries return the number of rows
+// given as the query text, counting the rows read.
+type seriesDriver struct{ read atomic.Int64 }
+
+type seriesConn struct{ d *seriesDriver }
+
+type seriesStmt struct {
+	d    *seriesDriver
+	rows int
+}
+
+type seriesRows struct {
+	d          *seriesDriver
+	next, rows int
+}
+
+func (d *seriesDriver) Open(string) (driver.Conn, error) { return seriesConn{d}, nil }
+
+func (c seriesConn) Prepare(query string) (driver.Stmt, error) {
+	n, err := strconv.Atoi(query)
+	return seriesStmt{d: c.d, rows: n}, err
+}
+func (c seriesConn) Close() error              { return nil }
+func (c seriesConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s seriesStmt) Close() error  { return nil }
+func (s seriesStmt) NumInput() int { return -1 }
+func (s seriesStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s seriesStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &seriesRows{d: s.d, rows: s.rows}, nil
+}
+
+func (r *seriesRows) Columns() []string { return []string{"value"} }
+func (r *seriesRows) Close() error      { return nil }
+func (r *seriesRows) Next(dest []driver.Value) error {
+	if r.next >= r.rows {
+		return io.EOF
+	}
+	r.next++
+	r.d.read.Add(1)
+	dest[0] = int64(r.next)
+	return nil
+}
+
+var rowsDriver = &seriesDriver{}
+
+func init() {
+	sql.Register("series", rowsDriver)
+}
+
+func TestFetchSamplesMaxRows(t *testing.T) {
+	db, err := sql.Open("series", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name     string
+		rows     int
+		maxRows  int
+		wantErr  bool
+		wantRead int64
+	}{
+		{name: "No limit", rows: 50, wantRead: 50},
+		{name: "Within the limit", rows: 10, maxRows: 10, wantRead: 10},
+		{name: "Over the limit", rows: 1000, maxRows: 10, wantErr: true, wantRead: 11},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rowsDriver.read.Store(0)
+			metric := MetricConfig{Query: strconv.Itoa(tc.rows), MaxRows: tc.maxRows}
+			samples, _, err := fetchSamplesFromDB(context.Background(), db, metric)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+			} else if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			} else if len(samples) != tc.rows || samples[len(samples)-1].Value != float64(tc.rows) {
+				t.Errorf("Expected %d samples, got %d", tc.rows, len(samples))
+			}
+			if got := rowsDriver.read.Load(); got != tc.wantRead {
+				t.Errorf("Expected %d rows read, got %d", tc.wantRead, got)
+			}
+		})
+	}
+}
+
+func TestFetchSamplesAggregatesWhileReading(t *testing.T) {
+	db, err := sql.Open("series", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const rows = 200000
+	tests := []struct {
+		agg  Aggregate
+		want float64
+	}{
+		{agg: "count", want: rows},
+		{agg: "sum", want: rows * (rows + 1) / 2},
+		{agg: "max", want: rows},
+		{agg: "avg", want: (rows + 1) / 2.0},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(string(tc.agg), func(t *testing.T) {
+			metric := MetricConfig{Query: strconv.Itoa(rows), Aggregate: tc.agg}
+			samples, read, err := fetchSamplesFromDB(context.Background(), db, metric)
+			if err != nil {
+				t.Fatalf("Expected no error without max_rows, got %v", err)
+			}
+			if read != rows {
+				t.Errorf("Expected %d rows read, got %d", rows, read)
+			}
+			if len(samples) != 1 || samples[0].Value != tc.want {
+				t.Errorf("Expected one sample of %v, got %+v", tc.want, samples)
+			}
+		})
+	}
+}
+
+func TestRecordColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+		column string
+		want   interface{}
+		wantOK bool
+	}{
+		{name: "Exact", record: map[string]interface{}{"host": "web-1"}, column: "host", want: "web-1", wantOK: true},
+		{name: "UpperCase", record: map[string]interface{}{"HOST": "web-1"}, column: "host", want: "web-1", wantOK: true},
+		{name: "MixedCase", record: map[string]interface{}{"Message": "timeout"}, column: "MESSAGE", want: "timeout", wantOK: true},
+		{name: "ExactWins", record: map[string]interface{}{"Host": "web-1", "host": "web-2"}, column: "host", want: "web-2", wantOK: true},
+		{name: "Null", record: map[string]interface{}{"Host": nil}, column: "host", want: nil, wantOK: true},
+		{name: "Missing", record: map[string]interface{}{"hostname": "web-1"}, column: "host", want: nil, wantOK: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := recordColumn(tc.record, tc.column)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("Expected %v, %t, got %v, %t", tc.want, tc.wantOK, got, ok)
+			}
+		})
+	}
+}
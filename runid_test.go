@@ -0,0 +1,17 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewRunID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := newRunID(), newRunID()
+	if !uuid.MatchString(first) {
+		t.Errorf("Expected a version 4 UUID, got %q", first)
+	}
+	if first == second {
+		t.Errorf("Expected distinct run IDs, got %q twice", first)
+	}
+}
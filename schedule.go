@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// nextCycle returns when the daemon cycle following the one scheduled at
+// prev starts. Cycles that would already have started by now are skipped,
+// like the ticks of a time.Ticker. With align, cycles start on multiples of
+// the interval since the Unix epoch (e.g. :00 and :30 for 30m), so every
+// instance queries at the same predictable times.
+func nextCycle(prev, now time.Time, interval time.Duration, align bool) time.Time {
+	if align {
+		return now.Truncate(interval).Add(interval)
+	}
+	next := prev.Add(interval)
+	if !next.After(now) {
+		next = next.Add(now.Sub(next).Truncate(interval) + interval)
+	}
+	return next
+}
+
+// jitterDelay returns a random delay in [0, limit).
+func jitterDelay(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// waitJitter delays the metric's query by a random part of its jitter, so
+// instances started at the same time do not query the database at once. It
+// returns false when the cycle is cancelled or a shutdown is requested
+// during the wait.
+func (c *Collector) waitJitter(ctx context.Context, metric MetricConfig) bool {
+	delay := jitterDelay(metric.Jitter)
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-c.Stop:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNextCycle(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		prev     time.Time
+		now      time.Time
+		interval time.Duration
+		align    bool
+		want     time.Time
+	}{
+		{
+			name:     "Interval",
+			prev:     base.Add(7 * time.Second),
+			now:      base.Add(20 * time.Second),
+			interval: time.Minute,
+			want:     base.Add(67 * time.Second),
+		},
+		{
+			name:     "SkipsMissedCycles",
+			prev:     base.Add(7 * time.Second),
+			now:      base.Add(150 * time.Second),
+			interval: time.Minute,
+			want:     base.Add(187 * time.Second),
+		},
+		{
+			name:     "Aligned",
+			prev:     base.Add(7 * time.Second),
+			now:      base.Add(20 * time.Second),
+			interval: time.Minute,
+			align:    true,
+			want:     base.Add(time.Minute),
+		},
+		{
+			name:     "AlignedHalfHour",
+			prev:     base.Add(31 * time.Minute),
+			now:      base.Add(42 * time.Minute),
+			interval: 30 * time.Minute,
+			align:    true,
+			want:     base.Add(time.Hour),
+		},
+		{
+			name:     "AlignedOnBoundary",
+			now:      base,
+			interval: 30 * time.Minute,
+			align:    true,
+			want:     base.Add(30 * time.Minute),
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := nextCycle(tc.prev, tc.now, tc.interval, tc.align)
+			if !got.Equal(tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestJitterDelay(t *testing.T) {
+	if got := jitterDelay(0); got != 0 {
+		t.Errorf("Expected no delay, got %v", got)
+	}
+	for i := 0; i < 100; i++ {
+		if got := jitterDelay(time.Second); got < 0 || got >= time.Second {
+			t.Fatalf("Expected a delay in [0, 1s), got %v", got)
+		}
+	}
+}
+
+func TestWaitJitterStop(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+	collector := &Collector{Stop: stop}
+	if collector.waitJitter(context.Background(), MetricConfig{Jitter: time.Hour}) {
+		t.Error("Expected the wait to be interrupted by the shutdown")
+	}
+	if !collector.waitJitter(context.Background(), MetricConfig{}) {
+		t.Error("Expected no wait without jitter")
+	}
+}
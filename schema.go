@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+	"gopkg.in/yaml.v3"
+)
+
+// position locates a value in a configuration file. Line and Column are
+// zero for files converted from JSON or TOML.
+type position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String formats the position as file:line:column.
+func (p position) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// decodeStrict decodes YAML into out, rejecting fields out does not have.
+// An empty document leaves out unchanged.
+func decodeStrict(data []byte, out interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// configPositions returns the positions of the top-level keys and of every
+// entry of the metrics list in the YAML data of file.
+func configPositions(data []byte, file, format string) (keys map[string]position, metrics []position) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil, nil
+	}
+	at := func(node *yaml.Node) position {
+		if format != formatYAML {
+			return position{File: file}
+		}
+		return position{File: file, Line: node.Line, Column: node.Column}
+	}
+
+	keys = make(map[string]position)
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		keys[key.Value] = at(key)
+		if key.Value == "metrics" && value.Kind == yaml.SequenceNode {
+			for _, item := range value.Content {
+				metrics = append(metrics, at(item))
+			}
+		}
+	}
+	return keys, metrics
+}
+
+// validateSchema checks what decoding alone does not: that top-level blocks
+// belong to a registered sink, that every metric has a unique name and that
+// counts and durations are not negative. All violations are reported, each
+// with its position.
+func validateSchema(config *Config) error {
+	var errs []error
+	for name := range config.SinkBlocks {
+		if _, ok := sink.Lookup(name); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown field %q", config.keyPositions[name], name))
+		}
+	}
+
+	seen := make(map[string]position)
+	for i, metric := range config.Metrics {
+		pos := position{File: fmt.Sprintf("metrics[%d]", i)}
+		if i < len(config.metricPositions) {
+			pos = config.metricPositions[i]
+		}
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...)))
+		}
+
+		if metric.Name == "" {
+			fail("metric name is required")
+		} else if first, ok := seen[metric.Name]; ok {
+			fail("metric %q: duplicate name (first defined at %s)", metric.Name, first)
+		} else {
+			seen[metric.Name] = pos
+		}
+		if metric.Retries < 0 {
+			fail("metric %q: retries must not be negative", metric.Name)
+		}
+		if metric.MaxSeries < 0 {
+			fail("metric %q: max_series must not be negative", metric.Name)
+		}
+		if metric.MaxRows < 0 {
+			fail("metric %q: max_rows must not be negative", metric.Name)
+		}
+		if metric.EmitQueryStats && isNameTemplate(metric.Name) {
+			fail("metric %q: emit_query_stats cannot be used with a templated name", metric.Name)
+		}
+		if metric.ExpectChange < 0 {
+			fail("metric %q: expect_change must not be negative", metric.Name)
+		}
+		if (metric.MaxAge > 0 || metric.ExpectChange > 0) && metric.Type == metricTypeDistribution {
+			fail("metric %q: max_age and expect_change cannot be used with type distribution", metric.Name)
+		}
+		if metric.Anomaly != nil {
+			if err := metric.Anomaly.validate(); err != nil {
+				fail("metric %q: %v", metric.Name, err)
+			}
+			if metric.Type == metricTypeDistribution {
+				fail("metric %q: anomaly cannot be used with type distribution", metric.Name)
+			}
+		}
+		for _, d := range []struct {
+			key   string
+			value time.Duration
+		}{
+			{"retry_delay", metric.RetryDelay},
+			{"cache_ttl", metric.CacheTTL},
+			{"timeout", metric.Timeout},
+			{"interval", metric.Interval},
+			{"jitter", metric.Jitter},
+			{"max_age", metric.MaxAge},
+		} {
+			if d.value < 0 {
+				fail("metric %q: %s must not be negative", metric.Name, d.key)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantErrs []string
+	}{
+		{
+			name:     "UnknownMetricField",
+			files:    map[string]string{"config.yaml": "metrics:\n  - name: a\n    qurey: \"SELECT 1 FROM t\"\n"},
+			wantErrs: []string{"line 3: field qurey not found"},
+		},
+		{
+			name:     "UnknownTopLevelField",
+			files:    map[string]string{"config.yaml": "metrics: []\ndatadgo:\n  site: datadoghq.eu\n"},
+			wantErrs: []string{"config.yaml:2:1: unknown field \"datadgo\""},
+		},
+		{
+			name:     "MissingName",
+			files:    map[string]string{"config.yaml": "metrics:\n  - query: \"SELECT 1 FROM t\"\n"},
+			wantErrs: []string{"config.yaml:2:5: metric name is required"},
+		},
+		{
+			name: "DuplicateName",
+			files: map[string]string{"config.yaml": `metrics:
+  - name: a
+    query: "SELECT 1 FROM t"
+  - name: a
+    query: "SELECT 2 FROM t"
+`},
+			wantErrs: []string{"config.yaml:4:5: metric \"a\": duplicate name (first defined at ", "config.yaml:2:5)"},
+		},
+		{
+			name: "DuplicateNameInInclude",
+			files: map[string]string{
+				"config.yaml": "include: [\"more.yaml\"]\nmetrics:\n  - name: a\n",
+				"more.yaml":   "metrics:\n  - name: b\n  - name: a\n",
+			},
+			wantErrs: []string{"more.yaml:3:5: metric \"a\": duplicate name"},
+		},
+		{
+			name: "NegativeValues",
+			files: map[string]string{"config.yaml": `metrics:
+  - name: a
+    retries: -1
+    timeout: -5s
+    jitter: -1s
+    max_rows: -1
+    expect_change: -1
+    anomaly:
+      window: -1
+`},
+			wantErrs: []string{"anomaly window, min_samples and threshold must not be negative", "retries must not be negative", "timeout must not be negative", "jitter must not be negative", "max_rows must not be negative", "expect_change must not be negative"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			_, err := loadConfig(filepath.Join(dir, "config.yaml"))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigPositionsConverted(t *testing.T) {
+	data, err := configYAML([]byte(`{"metrics": [{"name": "a"}]}`), formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, metrics := configPositions(data, "config.json", formatJSON)
+	if len(metrics) != 1 || metrics[0].String() != "config.json" {
+		t.Errorf("Expected a file-only position, got %v", metrics)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// stringList is a repeatable flag. Every occurrence may also hold several
+// comma separated values, as when it is set from its environment variable.
+type stringList []string
+
+// String implements flag.Value.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value.
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// metricSelection narrows the configured metrics to the ones named with
+// -metric and carrying every tag given with -filter, e.g. to debug a single
+// metric of a large configuration.
+type metricSelection struct {
+	names   []string
+	filters []string
+}
+
+func (s metricSelection) empty() bool {
+	return len(s.names) == 0 && len(s.filters) == 0
+}
+
+// tags returns the filters in the tag:value form of metric tags.
+func (s metricSelection) tags() ([]string, error) {
+	tags := make([]string, len(s.filters))
+	for i, filter := range s.filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid filter %q (must be tag=value)", filter)
+		}
+		tags[i] = key + ":" + value
+	}
+	return tags, nil
+}
+
+// nameMatches reports whether a metric called name was selected as want,
+// which may be given with or without the metric prefix.
+func nameMatches(config *Config, want, name string) bool {
+	if want == name {
+		return true
+	}
+	prefix := config.MetricPrefix
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return prefix != "" && prefix+want == name
+}
+
+// apply removes the metrics that are not selected and logs their names.
+// Naming a metric that does not exist is an error, so a typo does not
+// silently select nothing.
+func (s metricSelection) apply(ctx context.Context, config *Config) error {
+	if s.empty() {
+		return nil
+	}
+	tags, err := s.tags()
+	if err != nil {
+		return err
+	}
+
+	var selected []MetricConfig
+	var skipped []string
+	found := make(map[string]bool)
+	for _, metric := range config.Metrics {
+		ok := len(s.names) == 0
+		for _, want := range s.names {
+			if nameMatches(config, want, metric.Name) {
+				found[want] = true
+				ok = true
+			}
+		}
+		for _, tag := range tags {
+			ok = ok && slices.Contains(metric.Tags, tag)
+		}
+		if ok {
+			selected = append(selected, metric)
+		} else {
+			skipped = append(skipped, metric.Name)
+		}
+	}
+	for _, name := range s.names {
+		if !found[name] {
+			return fmt.Errorf("no metric named %q", name)
+		}
+	}
+
+	config.Metrics = selected
+	if len(skipped) > 0 {
+		logEvent(ctx, "info", "Skipping metrics not selected", map[string]interface{}{
+			"selected": len(selected),
+			"skipped":  skipped,
+		})
+	}
+	return nil
+}
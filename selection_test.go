@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMetricSelection(t *testing.T) {
+	metrics := []MetricConfig{
+		{Name: "app.orders", Tags: []string{"team:sales", "env:prod"}},
+		{Name: "app.users", Tags: []string{"team:growth", "env:prod"}},
+		{Name: "app.refunds", Tags: []string{"team:sales", "env:staging"}},
+	}
+	tests := []struct {
+		name      string
+		selection metricSelection
+		want      []string
+		wantErr   string
+	}{
+		{name: "Empty", want: []string{"app.orders", "app.users", "app.refunds"}},
+		{name: "Name", selection: metricSelection{names: []string{"app.users"}}, want: []string{"app.users"}},
+		{name: "NameWithoutPrefix", selection: metricSelection{names: []string{"orders", "refunds"}}, want: []string{"app.orders", "app.refunds"}},
+		{name: "Filter", selection: metricSelection{filters: []string{"team=sales"}}, want: []string{"app.orders", "app.refunds"}},
+		{name: "Filters", selection: metricSelection{filters: []string{"team=sales", "env=prod"}}, want: []string{"app.orders"}},
+		{name: "NameAndFilter", selection: metricSelection{names: []string{"app.users"}, filters: []string{"team=sales"}}, want: nil},
+		{name: "UnknownName", selection: metricSelection{names: []string{"app.order"}}, wantErr: `no metric named "app.order"`},
+		{name: "InvalidFilter", selection: metricSelection{filters: []string{"team"}}, wantErr: `invalid filter "team"`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{MetricPrefix: "app", Metrics: append([]MetricConfig(nil), metrics...)}
+			err := tc.selection.apply(context.Background(), config)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, metric := range config.Metrics {
+				got = append(got, metric.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStringListSet(t *testing.T) {
+	var l stringList
+	for _, value := range []string{"a", "b, c", ""} {
+		if err := l.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := l.String(); got != "a,b,c" {
+		t.Errorf("Expected a,b,c, got %s", got)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	datadogCheckRunPath     = "/api/v1/check_run"
+	defaultServiceCheckName = "sqlmetrics.database.can_connect"
+)
+
+// Service check statuses as defined by the Datadog API.
+const (
+	serviceCheckOK       = 0
+	serviceCheckWarning  = 1
+	serviceCheckCritical = 2
+	serviceCheckUnknown  = 3
+)
+
+// ServiceCheckConfig enables an agent-style availability check for the
+// database, reported at the end of every run.
+type ServiceCheckConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Name    string   `yaml:"name,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+}
+
+// ServiceCheck is a check run as accepted by the Datadog API.
+type ServiceCheck struct {
+	Check     string   `json:"check"`
+	HostName  string   `json:"host_name"`
+	Status    int      `json:"status"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// ServiceCheckSender is implemented by senders that can submit service checks.
+type ServiceCheckSender interface {
+	SendServiceCheck(ctx context.Context, check ServiceCheck) error
+}
+
+// SendServiceCheck submits a check run to the Datadog API.
+func (d *DatadogClient) SendServiceCheck(ctx context.Context, check ServiceCheck) error {
+	if d.Debug {
+		logEvent(ctx, "debug", "Sending service check to Datadog", map[string]interface{}{
+			"check":  check.Check,
+			"status": check.Status,
+			"tags":   check.Tags,
+			"url":    d.apiURL(datadogCheckRunPath),
+		})
+	}
+	if d.DryRun {
+		logEvent(ctx, "info", "Dry run mode - skipping actual service check submission", map[string]interface{}{
+			"check":  check.Check,
+			"status": check.Status,
+		})
+		return nil
+	}
+	if _, err := d.doAPI(ctx, http.MethodPost, datadogCheckRunPath, check, nil); err != nil {
+		return fmt.Errorf("failed to submit service check: %w", err)
+	}
+	return nil
+}
+
+// databaseTags describes a database connection URL, or MySQL DSN, as tags,
+// e.g. db_type:postgres, db_host:db-01 and db_name:orders. Credentials are
+// never included.
+func databaseTags(dbType, dbURL string) []string {
+	tags := []string{"db_type:" + dbType}
+	host, name, _ := databaseLocation(dbType, dbURL)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host != "" {
+		tags = append(tags, "db_host:"+host)
+	}
+	if name != "" {
+		tags = append(tags, "db_name:"+name)
+	}
+	return tags
+}
+
+// databaseLocation returns the host, database name and user of a connection
+// URL, or of a MySQL DSN, whose host includes the port.
+func databaseLocation(dbType, dbURL string) (host, name, user string) {
+	if dbType == "mysql" {
+		if cfg, err := mysql.ParseDSN(dbURL); err == nil {
+			return cfg.Addr, cfg.DBName, cfg.User
+		}
+		return "", "", ""
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "", "", ""
+	}
+	return u.Hostname(), strings.TrimPrefix(u.Path, "/"), u.User.Username()
+}
+
+// databaseServiceCheck pings db and builds the resulting service check. The
+// database is CRITICAL when it can't be reached or the circuit breaker is open.
+func databaseServiceCheck(ctx context.Context, db *sql.DB, breaker *CircuitBreaker, cfg ServiceCheckConfig, tags []string, host string) ServiceCheck {
+	name := cfg.Name
+	if name == "" {
+		name = defaultServiceCheckName
+	}
+	check := ServiceCheck{
+		Check:     name,
+		HostName:  host,
+		Status:    serviceCheckOK,
+		Timestamp: time.Now().Unix(),
+		Tags:      append(append([]string{}, cfg.Tags...), tags...),
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	switch err := db.PingContext(pingCtx); {
+	case err != nil:
+		check.Status = serviceCheckCritical
+		check.Message = logRedactor.RedactString(err.Error())
+	case breaker.State() == breakerOpen:
+		check.Status = serviceCheckCritical
+		check.Message = errCircuitOpen.Error()
+	}
+	return check
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+)
+
+// resolveShardCount applies the deprecated -shard-total flag to
+// opts.shardCount. It is rejected when -shard-count sets a different count.
+func resolveShardCount(ctx context.Context, opts *options) error {
+	if opts.shardTotal == 0 {
+		return nil
+	}
+	logEvent(ctx, "warn", "-shard-total is deprecated - use -shard-count", map[string]interface{}{"shard_total": opts.shardTotal})
+	if opts.shardCount != 1 && opts.shardCount != opts.shardTotal {
+		return fmt.Errorf("-shard-total %d conflicts with -shard-count %d", opts.shardTotal, opts.shardCount)
+	}
+	opts.shardCount = opts.shardTotal
+	return nil
+}
+
+// validateShard checks the -shard-index/-shard-count combination.
+func validateShard(index, count int) error {
+	if count < 1 {
+		return fmt.Errorf("shard count must be at least 1, got %d", count)
+	}
+	if index < 0 || index >= count {
+		return fmt.Errorf("shard index must be between 0 and %d, got %d", count-1, index)
+	}
+	return nil
+}
+
+// metricShard returns the shard (0..total-1) a metric belongs to, using
+// rendezvous hashing: every shard scores the metric name and the highest
+// score wins. The assignment only depends on the metric name, so every
+// replica computes the same split without coordination, and changing the
+// number of shards only moves the metrics that the added or removed shards
+// win instead of reshuffling all of them.
+func metricShard(name string, total int) int {
+	best, bestScore := 0, uint64(0)
+	for shard := 0; shard < total; shard++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(name))
+		_, _ = fmt.Fprintf(h, "#%d", shard)
+		if score := mixHash(h.Sum64()); shard == 0 || score > bestScore {
+			best, bestScore = shard, score
+		}
+	}
+	return best
+}
+
+// mixHash spreads the bits of h (the splitmix64 finalizer), as FNV hashes of
+// names differing only in their last bytes are close to each other.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// shardMetrics returns the metrics assigned to shard index out of total.
+func shardMetrics(metrics []MetricConfig, index, total int) []MetricConfig {
+	if total <= 1 {
+		return metrics
+	}
+	selected := make([]MetricConfig, 0, len(metrics)/total+1)
+	for _, metric := range metrics {
+		if metricShard(metric.Name, total) == index {
+			selected = append(selected, metric)
+		}
+	}
+	return selected
+}
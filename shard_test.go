@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestShardMetrics(t *testing.T) {
+	metrics := make([]MetricConfig, 100)
+	for i := range metrics {
+		metrics[i] = MetricConfig{Name: fmt.Sprintf("custom.metric.%d", i)}
+	}
+
+	const total = 3
+	seen := map[string]int{}
+	for index := 0; index < total; index++ {
+		shard := shardMetrics(metrics, index, total)
+		if len(shard) == 0 {
+			t.Errorf("Expected shard %d to receive metrics", index)
+		}
+		for _, m := range shard {
+			seen[m.Name]++
+		}
+	}
+
+	if len(seen) != len(metrics) {
+		t.Errorf("Expected all %d metrics to be assigned, got %d", len(metrics), len(seen))
+	}
+	for name, count := range seen {
+		if count != 1 {
+			t.Errorf("Expected %s to be assigned exactly once, got %d", name, count)
+		}
+	}
+
+	// Assignment must be deterministic across calls (and replicas)
+	if metricShard("custom.metric.1", total) != metricShard("custom.metric.1", total) {
+		t.Error("Expected deterministic shard assignment")
+	}
+}
+
+func TestShardMetricsResize(t *testing.T) {
+	metrics := make([]MetricConfig, 1000)
+	for i := range metrics {
+		metrics[i] = MetricConfig{Name: fmt.Sprintf("custom.metric.%d", i)}
+	}
+
+	moved := 0
+	for _, m := range metrics {
+		before, after := metricShard(m.Name, 3), metricShard(m.Name, 4)
+		if before != after {
+			if after != 3 {
+				t.Errorf("Expected %s to stay on shard %d or move to the new shard, got %d", m.Name, before, after)
+			}
+			moved++
+		}
+	}
+	// About a quarter of the metrics move to the new shard.
+	if moved < 150 || moved > 350 {
+		t.Errorf("Expected about 250 metrics to move, got %d", moved)
+	}
+}
+
+func TestShardCountReplicas(t *testing.T) {
+	metrics := make([]MetricConfig, 50)
+	for i := range metrics {
+		metrics[i] = MetricConfig{Name: fmt.Sprintf("custom.metric.%d", i)}
+	}
+
+	replicas := []struct {
+		name string
+		args []string
+		env  map[string]string
+	}{
+		{name: "Flags", args: []string{"-shard-count", "3", "-shard-index", "0"}},
+		{name: "Environment", env: map[string]string{"DDSM_SHARD_COUNT": "3", "DDSM_SHARD_INDEX": "1"}},
+		{name: "Deprecated alias", args: []string{"-shard-total", "3", "-shard-index", "2"}},
+	}
+
+	seen := map[string]string{}
+	for _, replica := range replicas {
+		replica := replica
+		t.Run(replica.name, func(t *testing.T) {
+			for name, value := range replica.env {
+				t.Setenv(name, value)
+			}
+			opts := &options{}
+			fs := newFlagSet(findCommand("run"), opts)
+			if err := fs.Parse(replica.args); err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if err := applyEnv(fs); err != nil {
+				t.Fatalf("applyEnv failed: %v", err)
+			}
+			if err := resolveShardCount(context.Background(), opts); err != nil {
+				t.Fatalf("resolveShardCount failed: %v", err)
+			}
+			if err := validateShard(opts.shardIndex, opts.shardCount); err != nil {
+				t.Fatalf("validateShard failed: %v", err)
+			}
+
+			config := &Config{Metrics: append([]MetricConfig(nil), metrics...)}
+			if err := selectMetrics(context.Background(), config, opts, nil); err != nil {
+				t.Fatalf("selectMetrics failed: %v", err)
+			}
+			if len(config.Metrics) == 0 {
+				t.Errorf("Expected shard %d to receive metrics", opts.shardIndex)
+			}
+			for _, m := range config.Metrics {
+				if other, ok := seen[m.Name]; ok {
+					t.Errorf("Expected %s on one replica, got %s and %s", m.Name, other, replica.name)
+				}
+				seen[m.Name] = replica.name
+			}
+		})
+	}
+
+	if len(seen) != len(metrics) {
+		t.Errorf("Expected the replicas to cover all %d metrics, got %d", len(metrics), len(seen))
+	}
+}
+
+func TestResolveShardCount(t *testing.T) {
+	tests := []struct {
+		name              string
+		shardCount, total int
+		want              int
+		wantErr           bool
+	}{
+		{name: "Count only", shardCount: 4, want: 4},
+		{name: "Deprecated total", shardCount: 1, total: 3, want: 3},
+		{name: "Same values", shardCount: 3, total: 3, want: 3},
+		{name: "Conflict", shardCount: 2, total: 3, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &options{shardCount: tc.shardCount, shardTotal: tc.total}
+			err := resolveShardCount(context.Background(), opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && opts.shardCount != tc.want {
+				t.Errorf("Expected shard count %d, got %d", tc.want, opts.shardCount)
+			}
+		})
+	}
+}
+
+func TestValidateShard(t *testing.T) {
+	tests := []struct {
+		index, total int
+		wantErr      bool
+	}{
+		{index: 0, total: 1},
+		{index: 2, total: 3},
+		{index: 3, total: 3, wantErr: true},
+		{index: -1, total: 3, wantErr: true},
+		{index: 0, total: 0, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		err := validateShard(tc.index, tc.total)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("validateShard(%d, %d) error = %v, wantErr %v", tc.index, tc.total, err, tc.wantErr)
+		}
+	}
+}
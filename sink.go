@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+)
+
+// Sink names accepted by -sink.
+const (
+	sinkDatadog    = "datadog"
+	sinkOTLP       = "otlp"
+	sinkCloudWatch = "cloudwatch"
+	sinkInfluxDB   = "influxdb"
+	sinkGraphite   = "graphite"
+	sinkKafka      = "kafka"
+	sinkWebhook    = "webhook"
+	sinkExec       = "exec"
+)
+
+// sinkFactories creates the sender of every supported sink from the
+// configuration and command line options.
+var sinkFactories = map[string]func(ctx context.Context, config *Config, opts *options) (MetricSender, error){
+	sinkDatadog:    newDatadogSink,
+	sinkOTLP:       newOTLPSink,
+	sinkCloudWatch: newCloudWatchSink,
+	sinkInfluxDB:   newInfluxDBSink,
+	sinkGraphite:   newGraphiteSink,
+	sinkKafka:      newKafkaSink,
+	sinkWebhook:    newWebhookSink,
+	sinkExec:       newExecSink,
+}
+
+// FlushSender is implemented by senders that buffer points and export them
+// asynchronously. Flush is called at the end of every collection cycle.
+type FlushSender = sink.Flusher
+
+// CloseSender is implemented by senders holding connections or exporters
+// that must be released when the process exits.
+type CloseSender = sink.Closer
+
+// sinkNames returns the built-in and registered sink names in sorted order.
+func sinkNames() []string {
+	names := sink.Names()
+	for name := range sinkFactories {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownSink reports whether name is a built-in or registered sink.
+func knownSink(name string) bool {
+	if _, ok := sinkFactories[name]; ok {
+		return true
+	}
+	_, ok := sink.Lookup(name)
+	return ok
+}
+
+// newRegisteredSink creates a sink registered through pkg/sink, decoding its
+// configuration from the top-level block named after it.
+func newRegisteredSink(ctx context.Context, name string, config *Config, opts *options) (MetricSender, error) {
+	factory, _ := sink.Lookup(name)
+	sender, err := factory(ctx, sink.Settings{
+		Name:  name,
+		Debug: opts.debug,
+		Decode: func(out any) error {
+			node, ok := config.SinkBlocks[name]
+			if !ok {
+				return nil
+			}
+			return node.Decode(out)
+		},
+	})
+	if err != nil {
+		return nil, configError("failed to create sink %s: %w", name, err)
+	}
+	return sender, nil
+}
+
+// newSink creates the sender for the sink selected with -sink.
+func newSink(ctx context.Context, name string, config *Config, opts *options) (MetricSender, error) {
+	if name == "" {
+		name = sinkDatadog
+	}
+	if !knownSink(name) {
+		return nil, configError("unknown sink %q (must be one of %v)", name, sinkNames())
+	}
+	if opts.dryRun && name != sinkDatadog {
+		return &dryRunSender{sink: name}, nil
+	}
+	if factory, ok := sinkFactories[name]; ok {
+		return factory(ctx, config, opts)
+	}
+	return newRegisteredSink(ctx, name, config, opts)
+}
+
+// newSinks creates the sender of the -sink selected for the run and of every
+// other sink a metric is routed to, keyed by sink name.
+func newSinks(ctx context.Context, config *Config, opts *options) (map[string]MetricSender, error) {
+	names := []string{opts.sink}
+	for _, metric := range config.Metrics {
+		names = append(names, metric.routedSinks()...)
+	}
+
+	sinks := make(map[string]MetricSender, len(names))
+	for _, name := range names {
+		if name == "" {
+			name = sinkDatadog
+		}
+		if _, ok := sinks[name]; ok {
+			continue
+		}
+		sender, err := newSink(ctx, name, config, opts)
+		if err != nil {
+			return nil, err
+		}
+		sinks[name] = sender
+	}
+	return sinks, nil
+}
+
+// closeSinks releases the senders that hold connections or exporters.
+func closeSinks(ctx context.Context, sinks map[string]MetricSender) {
+	closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	for name, sender := range sinks {
+		closer, ok := sender.(CloseSender)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(closeCtx); err != nil {
+			logEvent(ctx, "warn", "Failed to close sink", map[string]interface{}{"sink": name, "error": err.Error()})
+		}
+	}
+}
+
+// routedSinks returns the sinks the metric is routed to, or nil for the sink
+// selected with -sink.
+func (m MetricConfig) routedSinks() []string {
+	if m.Sink != "" {
+		return []string{m.Sink}
+	}
+	return m.Sinks
+}
+
+// validateMetricSinks checks that every metric routed to sinks names known
+// ones, each at most once.
+func validateMetricSinks(metrics []MetricConfig) error {
+	for _, metric := range metrics {
+		if metric.Sink != "" && len(metric.Sinks) > 0 {
+			return fmt.Errorf("metric %q: sink and sinks cannot be used together", metric.Name)
+		}
+		seen := make(map[string]bool)
+		for _, name := range metric.routedSinks() {
+			if !knownSink(name) {
+				return fmt.Errorf("metric %q: unknown sink %q (must be one of %v)", metric.Name, name, sinkNames())
+			}
+			if seen[name] {
+				return fmt.Errorf("metric %q: sink %q is listed more than once", metric.Name, name)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+// multiSink sends every value to several sinks. A failing sink does not
+// prevent delivery to the others; the errors of all failed sinks are joined.
+type multiSink struct {
+	names   []string
+	senders []MetricSender
+}
+
+// each calls send for every sink, labelling errors with the sink name.
+func (m *multiSink) each(send func(sender MetricSender) error) error {
+	var errs []error
+	for i, sender := range m.senders {
+		if err := send(sender); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", m.names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SendMetric implements MetricSender.
+func (m *multiSink) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	return m.each(func(sender MetricSender) error {
+		return sender.SendMetric(ctx, metricName, value, tags, host)
+	})
+}
+
+// SendDistribution implements DistributionSender. Sinks without
+// distribution support fail.
+func (m *multiSink) SendDistribution(ctx context.Context, metricName string, values []float64, tags []string, host string) error {
+	return m.each(func(sender MetricSender) error {
+		dist, ok := sender.(DistributionSender)
+		if !ok {
+			return errors.New("distribution metrics are not supported")
+		}
+		return dist.SendDistribution(ctx, metricName, values, tags, host)
+	})
+}
+
+// SendEvent implements EventSender for the sinks supporting events.
+func (m *multiSink) SendEvent(ctx context.Context, event Event) error {
+	return m.each(func(sender MetricSender) error {
+		if events, ok := sender.(EventSender); ok {
+			return events.SendEvent(ctx, event)
+		}
+		return nil
+	})
+}
+
+// SendLogs implements LogSender for the sinks supporting logs.
+func (m *multiSink) SendLogs(ctx context.Context, logs []LogEntry) error {
+	return m.each(func(sender MetricSender) error {
+		if logSender, ok := sender.(LogSender); ok {
+			return logSender.SendLogs(ctx, logs)
+		}
+		return nil
+	})
+}
+
+// UpdateMetadata implements MetadataSender for the sinks supporting metadata.
+func (m *multiSink) UpdateMetadata(ctx context.Context, metricName string, meta MetricMetadata) error {
+	return m.each(func(sender MetricSender) error {
+		if metadata, ok := sender.(MetadataSender); ok {
+			return metadata.UpdateMetadata(ctx, metricName, meta)
+		}
+		return nil
+	})
+}
+
+// newDatadogSink creates the Datadog client, or a fan-out sender when
+// several destinations are configured.
+func newDatadogSink(_ context.Context, config *Config, opts *options) (MetricSender, error) {
+	v2 := config.Features.Enabled(featureV2API)
+	ddConfig := config.Datadog
+	if !config.Features.Enabled(featureBatching) {
+		ddConfig.Batch = false
+	}
+	if len(ddConfig.Destinations) > 0 {
+		fanout, err := newFanoutSender(ddConfig, opts.debug, opts.dryRun, v2)
+		if err != nil {
+			return nil, configError("%w", err)
+		}
+		for _, dest := range fanout.destinations {
+			dest.client.DryRunPrinter = opts.dryRunPrinter()
+		}
+		return fanout, nil
+	}
+
+	apiKey := os.Getenv("DATADOG_API_KEY")
+	if apiKey == "" && !opts.dryRun {
+		return nil, fmt.Errorf("DATADOG_API_KEY is not set")
+	}
+	client := newDatadogClient(apiKey, ddConfig)
+	client.Debug = opts.debug
+	client.DryRun = opts.dryRun
+	client.AppKey = os.Getenv("DATADOG_APP_KEY")
+	client.V2 = v2
+	client.DryRunPrinter = opts.dryRunPrinter()
+	return client, nil
+}
+
+// dryRunSender logs the points a sink would receive instead of sending them.
+type dryRunSender struct {
+	sink string
+}
+
+func (d *dryRunSender) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	logEvent(ctx, "info", "Dry run mode - skipping actual metric submission", map[string]interface{}{
+		"sink":   d.sink,
+		"metric": metricName,
+		"value":  value,
+		"tags":   tags,
+		"host":   host,
+	})
+	return nil
+}
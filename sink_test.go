@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/sink"
+)
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		sink    string
+		dryRun  bool
+		wantErr bool
+		want    string
+	}{
+		{name: "Default is Datadog", sink: "", dryRun: true, want: "*main.DatadogClient"},
+		{name: "Dry run of another sink", sink: sinkOTLP, dryRun: true, want: "*main.dryRunSender"},
+		{name: "Unknown sink", sink: "carrier-pigeon", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sender, err := newSink(context.Background(), tc.sink, &Config{}, &options{dryRun: tc.dryRun})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newSink() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				if exitCode(err) != exitConfigInvalid {
+					t.Errorf("Expected config exit code, got %d", exitCode(err))
+				}
+				return
+			}
+			if got := fmt.Sprintf("%T", sender); got != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCollectorSenderFor(t *testing.T) {
+	defaultSender := &MockMetricSender{}
+	graphite := &MockMetricSender{}
+	c := &Collector{Sender: defaultSender, Sinks: map[string]MetricSender{sinkDatadog: defaultSender, sinkGraphite: graphite}}
+
+	if got := c.senderFor(MetricConfig{Name: "a"}); got != defaultSender {
+		t.Error("Expected metrics without a sink to use the default sender")
+	}
+	if got := c.senderFor(MetricConfig{Name: "b", Sink: sinkGraphite}); got != graphite {
+		t.Error("Expected the metric to be routed to its sink")
+	}
+}
+
+func TestValidateMetricSinks(t *testing.T) {
+	if err := validateMetricSinks([]MetricConfig{{Name: "a"}, {Name: "b", Sink: sinkInfluxDB}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateMetricSinks([]MetricConfig{{Name: "a", Sinks: []string{sinkDatadog, sinkKafka}}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	invalid := []MetricConfig{
+		{Name: "a", Sink: "statsd"},
+		{Name: "a", Sinks: []string{sinkDatadog, "statsd"}},
+		{Name: "a", Sinks: []string{sinkDatadog, sinkDatadog}},
+		{Name: "a", Sink: sinkKafka, Sinks: []string{sinkDatadog}},
+	}
+	for _, metric := range invalid {
+		if err := validateMetricSinks([]MetricConfig{metric}); err == nil {
+			t.Errorf("Expected error for sink %q, sinks %v", metric.Sink, metric.Sinks)
+		}
+	}
+}
+
+type failingSender struct{}
+
+func (failingSender) SendMetric(context.Context, string, float64, []string, string) error {
+	return errors.New("connection refused")
+}
+
+func TestCollectorMultiSink(t *testing.T) {
+	datadog := &MockMetricSender{}
+	kafka := &MockMetricSender{}
+	c := &Collector{Sinks: map[string]MetricSender{sinkDatadog: datadog, sinkKafka: kafka, sinkGraphite: failingSender{}}}
+
+	sender := c.senderFor(MetricConfig{Name: "db.users", Sinks: []string{sinkDatadog, sinkGraphite, sinkKafka}})
+	err := sender.SendMetric(context.Background(), "db.users", 1, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "sink graphite") {
+		t.Fatalf("Expected graphite error, got %v", err)
+	}
+	if len(datadog.SentMetrics) != 1 || len(kafka.SentMetrics) != 1 {
+		t.Errorf("Expected the other sinks to receive the value, got %d and %d", len(datadog.SentMetrics), len(kafka.SentMetrics))
+	}
+
+	dist, ok := sender.(DistributionSender)
+	if !ok {
+		t.Fatal("Expected multi-sink sender to implement DistributionSender")
+	}
+	if err := dist.SendDistribution(context.Background(), "db.latency", []float64{1}, nil, ""); err == nil {
+		t.Error("Expected error for sinks without distribution support")
+	}
+}
+
+type statsdConfig struct {
+	Address string `yaml:"address"`
+}
+
+type statsdSender struct {
+	MockMetricSender
+	address string
+}
+
+func TestNewSinkRegistered(t *testing.T) {
+	err := sink.Register("statsd-test", func(_ context.Context, settings sink.Settings) (sink.Sender, error) {
+		var cfg statsdConfig
+		if err := settings.Decode(&cfg); err != nil {
+			return nil, err
+		}
+		return &statsdSender{address: cfg.Address}, nil
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := "statsd-test:\n  address: \"localhost:8125\"\nmetrics:\n  - name: a\n    query: \"SELECT 1 FROM t\"\n    sinks: [datadog, statsd-test]\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	sender, err := newSink(context.Background(), "statsd-test", config, &options{})
+	if err != nil {
+		t.Fatalf("newSink failed: %v", err)
+	}
+	if got := sender.(*statsdSender).address; got != "localhost:8125" {
+		t.Errorf("Expected the sink block to be decoded, got %q", got)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "context"
+
+// SinkOptions holds the settings of a metric that only one sink uses, so
+// they stay out of the metric's top-level fields.
+type SinkOptions struct {
+	Datadog DatadogSinkOptions `yaml:"datadog,omitempty"`
+}
+
+// DatadogSinkOptions are series fields of the Datadog API.
+type DatadogSinkOptions struct {
+	// Interval is the number of seconds a point covers, which Datadog uses to
+	// convert rates and counts and to roll up graphs.
+	Interval int64 `yaml:"interval,omitempty"`
+	// Resources are attached to every series next to the host, e.g. a
+	// database resource. They are only sent with the v2 series API.
+	Resources []SeriesResource `yaml:"resources,omitempty"`
+}
+
+// SeriesResource is a resource a series is attached to.
+type SeriesResource struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+type sinkOptionsKey struct{}
+
+// withSinkOptions returns ctx carrying the sink options of the metric being
+// sent, for the senders that support them.
+func withSinkOptions(ctx context.Context, options SinkOptions) context.Context {
+	return context.WithValue(ctx, sinkOptionsKey{}, options)
+}
+
+// sinkOptionsFrom returns the sink options carried by ctx, if any.
+func sinkOptionsFrom(ctx context.Context) SinkOptions {
+	options, _ := ctx.Value(sinkOptionsKey{}).(SinkOptions)
+	return options
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// staleSuffix is appended to the series name of the staleness metric.
+const staleSuffix = ".stale"
+
+// staleTracker remembers, per series, the last value and for how many runs
+// it has not changed, and whether the series was stale, so events are only
+// posted when that changes.
+type staleTracker struct {
+	mu     sync.Mutex
+	values map[string]float64
+	same   map[string]int
+	stale  map[string]bool
+}
+
+// unchanged returns the number of consecutive runs key has kept value. With
+// record unset, e.g. for a cached result, the count is only read.
+func (t *staleTracker) unchanged(key string, value float64, record bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.values == nil {
+		t.values = make(map[string]float64)
+		t.same = make(map[string]int)
+	}
+	if !record {
+		return t.same[key]
+	}
+	if prev, ok := t.values[key]; ok && prev == value {
+		t.same[key]++
+	} else {
+		t.same[key] = 0
+	}
+	t.values[key] = value
+	return t.same[key]
+}
+
+// transition records whether key is stale and reports whether that
+// changed. A series seen for the first time counts as previously fresh.
+func (t *staleTracker) transition(key string, stale bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stale == nil {
+		t.stale = make(map[string]bool)
+	}
+	prev := t.stale[key]
+	t.stale[key] = stale
+	return prev != stale
+}
+
+// staleness reports whether a raw query value is stale and why. With
+// max_age the value is read as a Unix timestamp, as returned for timestamp
+// columns; with expect_change, runs is the number of runs it kept its value.
+func staleness(metric MetricConfig, value float64, runs int, now time.Time) (bool, string) {
+	if metric.MaxAge > 0 {
+		age := time.Duration((float64(now.UnixNano())/float64(time.Second) - value) * float64(time.Second))
+		if age > metric.MaxAge {
+			return true, fmt.Sprintf("last updated %s ago, more than max_age %s", age.Truncate(time.Second), metric.MaxAge)
+		}
+	}
+	if metric.ExpectChange > 0 && runs >= metric.ExpectChange {
+		return true, fmt.Sprintf("unchanged for %d runs", runs)
+	}
+	return false, ""
+}
+
+// checkStale submits <series>.stale, 1 when a series of metric is stale and
+// 0 otherwise, for every point of samples, the query result before
+// transforms. A series turning stale or fresh again also posts an event when
+// the sender supports them. Failures are only logged; they do not fail the
+// metric.
+func (c *Collector) checkStale(ctx context.Context, telemetry *Telemetry, metric MetricConfig, samples []sample, cached bool) {
+	if metric.MaxAge <= 0 && metric.ExpectChange <= 0 {
+		return
+	}
+	sender := c.senderFor(metric)
+	events, _ := sender.(EventSender)
+	samples, _ = limitSeries(samples, metric.MaxSeries)
+	now := time.Now()
+	for _, s := range samples {
+		key := sampleKey(s)
+		stale, reason := staleness(metric, s.Value, c.stale.unchanged(key, s.Value, !cached), now)
+		name, tags := seriesName(metric, s.Name), c.seriesTags(ctx, metric, s.Tags)
+		value := 0.0
+		if stale {
+			value = 1
+		}
+		err := c.submit(ctx, telemetry, metric.Name, func(ctx context.Context) error {
+			return sender.SendMetric(ctx, name+staleSuffix, value, tags, metric.sampleHost(s))
+		})
+		if err != nil {
+			logEvent(ctx, "warn", "Failed to send staleness metric", map[string]interface{}{
+				"metric": name + staleSuffix,
+				"error":  err.Error(),
+			})
+		}
+		if !c.stale.transition(key, stale) || events == nil {
+			continue
+		}
+		if err := events.SendEvent(ctx, staleEvent(name, stale, reason, tags, metric.sampleHost(s))); err != nil {
+			logEvent(ctx, "warn", "Failed to post staleness event", map[string]interface{}{
+				"metric": name,
+				"error":  err.Error(),
+			})
+		}
+	}
+}
+
+// staleEvent builds the event posted when a series turns stale or fresh.
+func staleEvent(name string, stale bool, reason string, tags []string, host string) Event {
+	event := Event{
+		Title:          fmt.Sprintf("[Stale] %s %s", name, reason),
+		Text:           fmt.Sprintf("%s is stale (%s). The data it is read from may no longer be updated.", name, reason),
+		AlertType:      alertWarning,
+		Tags:           slices.Clone(tags),
+		Host:           host,
+		AggregationKey: name + staleSuffix,
+		SourceTypeName: "sqlmetrics",
+	}
+	if !stale {
+		event.Title = fmt.Sprintf("[Recovered] %s is updated again", name)
+		event.Text = fmt.Sprintf("%s is no longer stale.", name)
+		event.AlertType = "success"
+	}
+	return event
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleness(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name       string
+		metric     MetricConfig
+		value      float64
+		runs       int
+		wantStale  bool
+		wantReason string
+	}{
+		{name: "Disabled", metric: MetricConfig{}, value: 0, runs: 100},
+		{name: "MaxAgeFresh", metric: MetricConfig{MaxAge: time.Hour}, value: float64(now.Add(-30 * time.Minute).Unix())},
+		{name: "MaxAgeStale", metric: MetricConfig{MaxAge: time.Hour}, value: float64(now.Add(-2 * time.Hour).Unix()), wantStale: true, wantReason: "last updated 2h0m0s ago"},
+		{name: "ExpectChangeBelow", metric: MetricConfig{ExpectChange: 3}, value: 5, runs: 2},
+		{name: "ExpectChangeReached", metric: MetricConfig{ExpectChange: 3}, value: 5, runs: 3, wantStale: true, wantReason: "unchanged for 3 runs"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			stale, reason := staleness(tc.metric, tc.value, tc.runs, now)
+			if stale != tc.wantStale {
+				t.Errorf("Expected stale %v, got %v (%s)", tc.wantStale, stale, reason)
+			}
+			if !strings.Contains(reason, tc.wantReason) {
+				t.Errorf("Expected reason containing %q, got %q", tc.wantReason, reason)
+			}
+		})
+	}
+}
+
+func TestStaleTrackerUnchanged(t *testing.T) {
+	var tracker staleTracker
+	steps := []struct {
+		value  float64
+		record bool
+		want   int
+	}{
+		{value: 1, record: true, want: 0},
+		{value: 1, record: true, want: 1},
+		{value: 1, record: false, want: 1},
+		{value: 1, record: true, want: 2},
+		{value: 2, record: true, want: 0},
+	}
+	for i, step := range steps {
+		if got := tracker.unchanged("k", step.value, step.record); got != step.want {
+			t.Errorf("Step %d: expected %d unchanged runs, got %d", i, step.want, got)
+		}
+	}
+}
+
+func TestCollectOnceStale(t *testing.T) {
+	sender := &eventRecorder{}
+	collector := &Collector{
+		Config: &Config{Metrics: []MetricConfig{
+			{Name: "a", Source: "exec", Command: []string{"echo", `{"samples":[{"value":7}]}`}, ExpectChange: 2},
+		}},
+		Sender: sender,
+	}
+
+	var stale []float64
+	for i := 0; i < 4; i++ {
+		sender.SentMetrics = nil
+		if summary := collector.CollectOnce(context.Background()); summary.Failed != 0 {
+			t.Fatalf("Expected no failures, got %+v", summary)
+		}
+		for _, s := range sender.SentMetrics {
+			if s.Metric == "a.stale" {
+				stale = append(stale, s.Points[0][1])
+			}
+		}
+	}
+	if want := []float64{0, 0, 1, 1}; !slices.Equal(stale, want) {
+		t.Errorf("Expected a.stale %v, got %v", want, stale)
+	}
+	if len(sender.Events) != 1 || !strings.HasPrefix(sender.Events[0].Title, "[Stale] a") {
+		t.Errorf("Expected one stale event, got %+v", sender.Events)
+	}
+}
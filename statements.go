@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// statementStatsQueries read the statement statistics the database keeps for
+// the current database, busiest statements first: pg_stat_statements on
+// PostgreSQL (13 or later) and the digest summary of performance_schema on
+// MySQL. Each returns the statement id, its normalized text, the number of
+// calls and the total execution time in milliseconds.
+var statementStatsQueries = map[string]string{
+	"postgres": `SELECT queryid::text, query, calls, total_exec_time
+FROM pg_stat_statements
+WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database()) AND queryid IS NOT NULL
+ORDER BY calls DESC`,
+	"mysql": `SELECT DIGEST, DIGEST_TEXT, COUNT_STAR, SUM_TIMER_WAIT / 1000000000
+FROM performance_schema.events_statements_summary_by_digest
+WHERE SCHEMA_NAME = DATABASE() AND DIGEST IS NOT NULL
+ORDER BY COUNT_STAR DESC`,
+}
+
+// statementStat is the database's own statistics of a statement.
+type statementStat struct {
+	// ID is the pg_stat_statements queryid or the performance_schema digest.
+	ID          string
+	Calls       int64
+	TotalTimeMs float64
+}
+
+// statementKey returns the form under which a query and the text stored by
+// the database are compared: the normalized query without whitespace, since
+// the database spaces tokens differently (MySQL stores "COUNT ( * )"), and
+// with MySQL's "(...)" for a collapsed list written as normalizeQuery does.
+func statementKey(query string) string {
+	key := strings.Join(strings.Fields(normalizeQuery(query)), "")
+	return strings.ReplaceAll(key, "(...)", "(?)")
+}
+
+// loadStatementStats reads the statement statistics of dbType's database,
+// keyed by statementKey. Entries sharing a key, e.g. the same statement run
+// by several users, are added up under the id of the busiest one.
+func loadStatementStats(ctx context.Context, db *sql.DB, dbType string) (map[string]statementStat, error) {
+	query, ok := statementStatsQueries[dbType]
+	if !ok {
+		return nil, fmt.Errorf("statement statistics are not supported for %s", dbType)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statement statistics: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]statementStat)
+	for rows.Next() {
+		var (
+			id, text  sql.NullString
+			calls     sql.NullInt64
+			totalTime sql.NullFloat64
+		)
+		if err := rows.Scan(&id, &text, &calls, &totalTime); err != nil {
+			return nil, fmt.Errorf("failed to read statement statistics: %w", err)
+		}
+		if !id.Valid || !text.Valid {
+			continue
+		}
+		key := statementKey(text.String)
+		stat, seen := stats[key]
+		if !seen {
+			stat.ID = id.String
+		}
+		stat.Calls += calls.Int64
+		stat.TotalTimeMs += totalTime.Float64
+		stats[key] = stat
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read statement statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// correlateStatements matches the queries of the cycle with the statement
+// statistics of the database, setting the statement id on their results and
+// recording the statistics in telemetry.
+func (c *Collector) correlateStatements(ctx context.Context, telemetry *Telemetry, summary *RunSummary) {
+	if !c.Config.Telemetry.StatementStats || c.DB == nil || c.Replay != nil {
+		return
+	}
+	stats, err := loadStatementStats(ctx, c.DB, databaseType())
+	if err != nil {
+		logEvent(ctx, "warn", "Failed to correlate queries with statement statistics", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for i, result := range summary.Metrics {
+		if result.query == "" {
+			continue
+		}
+		stat, ok := stats[statementKey(result.query)]
+		if !ok {
+			continue
+		}
+		summary.Metrics[i].QueryID = stat.ID
+		telemetry.RecordStatement(result.Fingerprint, stat)
+		logEvent(ctx, "info", "Query matched statement statistics", map[string]interface{}{
+			"metric":        result.Metric,
+			"fingerprint":   result.Fingerprint,
+			"query_id":      stat.ID,
+			"calls":         stat.Calls,
+			"total_time_ms": stat.TotalTimeMs,
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStatementKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		stored string
+	}{
+		{
+			name:   "pg_stat_statements parameters",
+			query:  "SELECT count(*) FROM orders WHERE status = 'paid' AND total > 100",
+			stored: "SELECT count(*) FROM orders WHERE status = $1 AND total > $2",
+		},
+		{
+			name:   "pg_stat_statements IN list",
+			query:  "SELECT count(*) FROM jobs WHERE state IN ('failed', 'dead')",
+			stored: "SELECT count(*) FROM jobs WHERE state IN ($1, $2, $3)",
+		},
+		{
+			name:   "performance_schema digest text",
+			query:  "SELECT COUNT(*) FROM orders WHERE status = 'paid'",
+			stored: "SELECT COUNT ( * ) FROM `orders` WHERE `status` = ?",
+		},
+		{
+			name:   "performance_schema collapsed list",
+			query:  "SELECT COUNT(*) FROM jobs WHERE state IN ('failed', 'dead')",
+			stored: "SELECT COUNT ( * ) FROM `jobs` WHERE `state` IN (...)",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got, want := statementKey(tc.query), statementKey(tc.stored); got != want {
+				t.Errorf("Expected %q to match %q, got %q and %q", tc.query, tc.stored, got, want)
+			}
+		})
+	}
+
+	if statementKey("SELECT count(*) FROM orders") == statementKey("SELECT count(*) FROM jobs") {
+		t.Error("Expected different statements to have different keys")
+	}
+}
+
+// statementsDriver is a database driver answering the statement statistics
+// query with rows and any other query with the value 1.
+type statementsDriver struct{ rows [][]driver.Value }
+
+type statementsConn struct{ d *statementsDriver }
+
+type statementsStmt struct {
+	d     *statementsDriver
+	query string
+}
+
+type statementsRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (d *statementsDriver) Open(string) (driver.Conn, error) { return statementsConn{d}, nil }
+
+func (c statementsConn) Prepare(query string) (driver.Stmt, error) {
+	return statementsStmt{d: c.d, query: query}, nil
+}
+func (c statementsConn) Close() error              { return nil }
+func (c statementsConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s statementsStmt) Close() error  { return nil }
+func (s statementsStmt) NumInput() int { return -1 }
+func (s statementsStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s statementsStmt) Query([]driver.Value) (driver.Rows, error) {
+	if strings.Contains(s.query, "pg_stat_statements") {
+		return &statementsRows{columns: []string{"queryid", "query", "calls", "total_exec_time"}, rows: s.d.rows}, nil
+	}
+	return &statementsRows{columns: []string{"value"}, rows: [][]driver.Value{{int64(1)}}}, nil
+}
+
+func (r *statementsRows) Columns() []string { return r.columns }
+func (r *statementsRows) Close() error      { return nil }
+func (r *statementsRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var pgStatements = &statementsDriver{rows: [][]driver.Value{
+	{"101", "SELECT count(*) FROM orders WHERE status = $1", int64(40), 12.5},
+	{"101", "SELECT count(*) FROM orders WHERE status = $1", int64(2), 0.5},
+	{"202", "SELECT count(*) FROM jobs", int64(7), 3.0},
+	{nil, "<insufficient privilege>", int64(1), 1.0},
+}}
+
+func init() {
+	sql.Register("statements", pgStatements)
+}
+
+func TestLoadStatementStats(t *testing.T) {
+	db, err := sql.Open("statements", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stats, err := loadStatementStats(context.Background(), db, "postgres")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := map[string]statementStat{
+		statementKey("SELECT count(*) FROM orders WHERE status = 'paid'"): {ID: "101", Calls: 42, TotalTimeMs: 13},
+		statementKey("SELECT count(*) FROM jobs"):                         {ID: "202", Calls: 7, TotalTimeMs: 3},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+
+	if _, err := loadStatementStats(context.Background(), db, "sqlite"); err == nil {
+		t.Error("Expected error for an unsupported database type")
+	}
+}
+
+func TestCollectOnceStatementStats(t *testing.T) {
+	db, err := sql.Open("statements", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	query := "SELECT count(*) FROM orders WHERE status = 'paid'"
+	for _, enabled := range []bool{false, true} {
+		sender := &MockMetricSender{}
+		collector := &Collector{
+			Config: &Config{
+				Metrics: []MetricConfig{
+					{Name: "orders.paid", Query: query},
+					{Name: "orders.unmatched", Query: "SELECT count(*) FROM orders"},
+				},
+				Telemetry: TelemetryConfig{Enabled: true, Prefix: "tel", FingerprintTags: true, StatementStats: enabled},
+			},
+			DB:     db,
+			Sender: sender,
+		}
+
+		summary := collector.CollectOnce(context.Background())
+		if summary.Failed != 0 {
+			t.Fatalf("Expected no failures, got %+v", summary)
+		}
+		wantID := ""
+		if enabled {
+			wantID = "101"
+		}
+		if got := summary.Metrics[0].QueryID; got != wantID {
+			t.Errorf("Expected query id %q with statement_stats %v, got %q", wantID, enabled, got)
+		}
+		if got := summary.Metrics[1].QueryID; got != "" {
+			t.Errorf("Expected no query id for an unmatched query, got %q", got)
+		}
+
+		got := map[string]string{}
+		for _, s := range sender.SentMetrics {
+			if strings.HasPrefix(s.Metric, "tel.statement.") || s.Metric == "tel.query.duration" {
+				got[s.Metric+" "+strings.Join(s.Tags, ",")] = ""
+			}
+		}
+		fingerprint := queryFingerprint(query)
+		for _, series := range []string{
+			"tel.query.duration fingerprint:" + fingerprint + ",query_id:101",
+			"tel.statement.calls fingerprint:" + fingerprint + ",query_id:101",
+			"tel.statement.total_time fingerprint:" + fingerprint + ",query_id:101",
+		} {
+			if _, ok := got[series]; ok != enabled {
+				t.Errorf("Expected series %q sent %v, got %v", series, enabled, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ryuichi1208/datadog-sql-metrics/pkg/collector"
+)
+
+// Metric result statuses reported in the run summary.
+const (
+	statusSent        = "sent"
+	statusInvalid     = "invalid"
+	statusQueryFailed = "query_failed"
+	statusSendFailed  = "send_failed"
+	statusSkipped     = "skipped"
+	statusCircuitOpen = "circuit_open"
+)
+
+// MetricResult is the outcome of collecting one metric.
+type MetricResult struct {
+	Metric      string   `json:"metric"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	QueryID     string   `json:"query_id,omitempty"`
+	Value       *float64 `json:"value,omitempty"`
+	QueryTimeMs float64  `json:"query_time_ms"`
+	Series      int      `json:"series,omitempty"`
+	Cached      bool     `json:"cached,omitempty"`
+	Status      string   `json:"status"`
+	Error       string   `json:"error,omitempty"`
+
+	// query is the query that ran, matched against the statement statistics.
+	query string
+}
+
+// engineResult returns the result as reported to the collection engine.
+func (r MetricResult) engineResult() collector.Result {
+	result := collector.Result{Metric: r.Metric, Series: r.Series, Skipped: r.Status == statusSkipped}
+	if r.Value != nil {
+		result.Series = 1
+	}
+	if r.Status != statusSent && r.Status != statusSkipped {
+		result.Err = errors.New(r.Error)
+	}
+	return result
+}
+
+// RunSummary is the outcome of one collection cycle.
+type RunSummary struct {
+	Started    time.Time      `json:"started"`
+	DurationMs float64        `json:"duration_ms"`
+	Total      int            `json:"total"`
+	Succeeded  int            `json:"succeeded"`
+	Failed     int            `json:"failed"`
+	Skipped    int            `json:"skipped,omitempty"`
+	Metrics    []MetricResult `json:"metrics"`
+}
+
+// add appends a metric result and updates the counters.
+func (s *RunSummary) add(result MetricResult) {
+	s.Metrics = append(s.Metrics, result)
+	s.Total++
+	switch result.Status {
+	case statusSent:
+		s.Succeeded++
+	case statusSkipped:
+		s.Skipped++
+	default:
+		s.Failed++
+	}
+}
+
+// errMetricsFailed is returned when the -fail-on policy is violated.
+var errMetricsFailed = errors.New("metric collection failed")
+
+// validateFailOn checks the -fail-on value.
+func validateFailOn(policy string) error {
+	switch policy {
+	case "", "none", "any", "all":
+		return nil
+	default:
+		return fmt.Errorf("unknown fail-on policy %q (must be any, all or none)", policy)
+	}
+}
+
+// checkFailPolicy applies the -fail-on policy (any, all or none) to a summary.
+// An empty policy is the default, all. The returned error carries exit code 4
+// when every metric failed and 3 when only some did.
+func checkFailPolicy(summary *RunSummary, policy string) error {
+	allFailed := summary.Total > 0 && summary.Failed == summary.Total
+	switch {
+	case policy == "any" && summary.Failed > 0 && !allFailed:
+		return withExitCode(exitPartialFailure, fmt.Errorf("%w: %d of %d metrics failed", errMetricsFailed, summary.Failed, summary.Total))
+	case policy != "none" && allFailed:
+		return withExitCode(exitAllFailed, fmt.Errorf("%w: all %d metrics failed", errMetricsFailed, summary.Total))
+	}
+	return nil
+}
+
+// validateSummaryFormat checks the -summary-format value.
+func validateSummaryFormat(format string) error {
+	switch format {
+	case "", "none", "table", "json":
+		return nil
+	default:
+		return fmt.Errorf("unknown summary format %q (must be table, json or none)", format)
+	}
+}
+
+// writeSummary prints the summary in the given format ("table" or "json").
+// Nothing is written for "none" or an empty format.
+func writeSummary(w io.Writer, summary *RunSummary, format string) error {
+	switch format {
+	case "", "none":
+		return nil
+	case "json":
+		return json.NewEncoder(w).Encode(summary)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tVALUE\tQUERY_MS\tFINGERPRINT\tSTATUS\tERROR")
+	for _, m := range summary.Metrics {
+		value := "-"
+		if m.Value != nil {
+			value = strconv.FormatFloat(*m.Value, 'g', -1, 64)
+		} else if m.Series > 0 {
+			value = fmt.Sprintf("%d series", m.Series)
+		}
+		status := m.Status
+		if m.Cached {
+			status += " (cached)"
+		}
+		fingerprint := m.Fingerprint
+		if fingerprint == "" {
+			fingerprint = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\t%s\n", m.Metric, value, m.QueryTimeMs, fingerprint, status, m.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d metrics, %d succeeded, %d failed, %d skipped in %.0fms\n", summary.Total, summary.Succeeded, summary.Failed, summary.Skipped, summary.DurationMs)
+	return err
+}
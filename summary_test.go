@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestSummary(statuses ...string) *RunSummary {
+	summary := &RunSummary{}
+	for i, status := range statuses {
+		value := float64(i)
+		result := MetricResult{Metric: "metric." + status, Fingerprint: "fp" + status, Status: status}
+		if status == statusSent {
+			result.Value = &value
+		} else {
+			result.Error = "boom"
+		}
+		summary.add(result)
+	}
+	return summary
+}
+
+func TestCheckFailPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		summary  *RunSummary
+		policy   string
+		wantFail bool
+	}{
+		{name: "none ignores failures", summary: newTestSummary(statusQueryFailed), policy: "none"},
+		{name: "any with one failure", summary: newTestSummary(statusSent, statusSendFailed), policy: "any", wantFail: true},
+		{name: "any without failures", summary: newTestSummary(statusSent), policy: "any"},
+		{name: "all with partial failure", summary: newTestSummary(statusSent, statusQueryFailed), policy: "all"},
+		{name: "all with total failure", summary: newTestSummary(statusInvalid, statusQueryFailed), policy: "all", wantFail: true},
+		{name: "empty policy is all", summary: newTestSummary(statusQueryFailed), wantFail: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkFailPolicy(tc.summary, tc.policy)
+			if tc.wantFail {
+				if !errors.Is(err, errMetricsFailed) {
+					t.Errorf("Expected errMetricsFailed, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+
+	if err := validateFailOn("some"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestFailPolicyDefault(t *testing.T) {
+	opts := &options{}
+	fs := newFlagSet(findCommand("run"), opts)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		summary *RunSummary
+		want    int
+	}{
+		{name: "All failed", summary: newTestSummary(statusQueryFailed, statusSendFailed), want: exitAllFailed},
+		{name: "Some failed", summary: newTestSummary(statusSent, statusQueryFailed), want: exitOK},
+		{name: "None failed", summary: newTestSummary(statusSent), want: exitOK},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(checkFailPolicy(tc.summary, opts.failOn)); got != tc.want {
+				t.Errorf("Expected exit code %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	summary := newTestSummary(statusSent, statusQueryFailed)
+
+	var table bytes.Buffer
+	if err := writeSummary(&table, summary, "table"); err != nil {
+		t.Fatalf("writeSummary(table) failed: %v", err)
+	}
+	for _, want := range []string{"METRIC", "FINGERPRINT", "metric.sent", "fpsent", "query_failed", "2 metrics, 1 succeeded, 1 failed, 0 skipped"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("Expected table to contain %q, got:\n%s", want, table.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := writeSummary(&js, summary, "json"); err != nil {
+		t.Fatalf("writeSummary(json) failed: %v", err)
+	}
+	var decoded RunSummary
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON summary: %v", err)
+	}
+	if decoded.Failed != 1 || len(decoded.Metrics) != 2 || decoded.Metrics[0].Fingerprint != "fpsent" {
+		t.Errorf("Unexpected decoded summary: %+v", decoded)
+	}
+
+	var none bytes.Buffer
+	if err := writeSummary(&none, summary, "none"); err != nil || none.Len() != 0 {
+		t.Errorf("Expected no output for format none, got %q (%v)", none.String(), err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Datadog tag limits.
+const (
+	maxTagLength       = 200
+	defaultMaxTagCount = 100
+)
+
+// TagNormalizationConfig normalizes tags before submission the way the
+// Datadog intake would, so the tags sent are the tags stored and none are
+// dropped silently.
+type TagNormalizationConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// MaxTags is the number of tags of a series above which a warning is
+	// logged (default 100).
+	MaxTags int `yaml:"max_tags,omitempty"`
+}
+
+// maxTags returns the configured tag count limit.
+func (t TagNormalizationConfig) maxTags() int {
+	if t.MaxTags > 0 {
+		return t.MaxTags
+	}
+	return defaultMaxTagCount
+}
+
+// normalizeTag lowercases tag, replaces the characters Datadog does not
+// accept with underscores, drops the leading characters that are not
+// letters and truncates it to 200 characters. It returns "" for a tag left
+// empty.
+func normalizeTag(tag string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(tag) {
+		switch {
+		case b.Len() == 0 && !unicode.IsLetter(r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-:./", r):
+		default:
+			r = '_'
+		}
+		if r == '_' && strings.HasSuffix(b.String(), "_") {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	normalized := []rune(strings.TrimRight(b.String(), "_"))
+	if len(normalized) > maxTagLength {
+		normalized = normalized[:maxTagLength]
+	}
+	return string(normalized)
+}
+
+// normalizeTags normalizes every tag and removes empty and duplicate ones,
+// keeping the order.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// seriesTags returns the tags of a series of metric, normalized when
+// enabled. A series with more tags than the limit is reported once per
+// metric.
+func (c *Collector) seriesTags(ctx context.Context, metric MetricConfig, extra []string) []string {
+	tags := slices.Concat(metric.Tags, extra)
+	if c.Config == nil || !c.Config.TagNormalization.Enabled {
+		return tags
+	}
+	config := c.Config.TagNormalization
+	tags = normalizeTags(tags)
+	if len(tags) > config.maxTags() && !c.tagWarned[metric.Name] {
+		if c.tagWarned == nil {
+			c.tagWarned = make(map[string]bool)
+		}
+		c.tagWarned[metric.Name] = true
+		logEvent(ctx, "warn", "Series exceeds the tag limit", map[string]interface{}{
+			"metric":   metric.Name,
+			"tags":     len(tags),
+			"max_tags": config.maxTags(),
+		})
+	}
+	return tags
+}
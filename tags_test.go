@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{name: "Valid", tag: "env:prod", want: "env:prod"},
+		{name: "Lowercase", tag: "Region:EU-West", want: "region:eu-west"},
+		{name: "InvalidCharacters", tag: "team:data & ml", want: "team:data_ml"},
+		{name: "TrailingUnderscore", tag: "queue:jobs!", want: "queue:jobs"},
+		{name: "LeadingNonLetter", tag: "1st:value", want: "st:value"},
+		{name: "Unicode", tag: "city:Zürich", want: "city:zürich"},
+		{name: "Path", tag: "path:/var/lib/db.sock", want: "path:/var/lib/db.sock"},
+		{name: "Empty", tag: "!!!", want: ""},
+		{name: "Truncated", tag: "k:" + strings.Repeat("a", 300), want: "k:" + strings.Repeat("a", 198)},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeTag(tc.tag); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := normalizeTags([]string{"env:prod", "ENV:prod", "", "team:db", "##"})
+	want := []string{"env:prod", "team:db"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestSeriesTags(t *testing.T) {
+	metric := MetricConfig{Name: "a", Tags: []string{"Env:Prod", "x:1", "x:2"}}
+
+	plain := &Collector{Config: &Config{}}
+	if got := plain.seriesTags(context.Background(), metric, []string{"Env:Prod"}); len(got) != 4 {
+		t.Errorf("Expected tags unchanged without normalization, got %v", got)
+	}
+
+	normalized := &Collector{Config: &Config{TagNormalization: TagNormalizationConfig{Enabled: true, MaxTags: 2}}}
+	got := normalized.seriesTags(context.Background(), metric, []string{"Env:Prod"})
+	if !reflect.DeepEqual(got, []string{"env:prod", "x:1", "x:2"}) {
+		t.Errorf("Expected normalized tags, got %v", got)
+	}
+	if !normalized.tagWarned["a"] {
+		t.Error("Expected the tag limit to be reported")
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultTelemetryPrefix is used for self-telemetry metric names when no prefix is configured.
+const defaultTelemetryPrefix = "sqlmetrics.collector"
+
+// TelemetryConfig controls metrics the collector emits about itself.
+type TelemetryConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Prefix  string   `yaml:"prefix,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+	// RunIDTag adds a run_id tag identifying the process. Every process
+	// creates a new tag value, so only enable it where cardinality allows.
+	RunIDTag bool `yaml:"run_id_tag,omitempty"`
+	// FingerprintTags sends the duration of every query, tagged with its
+	// fingerprint. This adds one series per distinct query.
+	FingerprintTags bool `yaml:"fingerprint_tags,omitempty"`
+	// StatementStats matches every query with its pg_stat_statements or
+	// performance_schema entry after each run, sending the database's calls
+	// and total time of the statement tagged with its fingerprint and id.
+	StatementStats bool `yaml:"statement_stats,omitempty"`
+}
+
+// Telemetry accumulates counters and timings about a collection run.
+// It is safe for concurrent use; a nil *Telemetry records nothing.
+type Telemetry struct {
+	mu            sync.Mutex
+	start         time.Time
+	queries       int
+	queryErrors   int
+	queryDuration []float64
+	sent          int
+	sendFailures  int
+	droppedSeries int
+	gauges        map[string]float64
+	unsafe        []string
+	fingerprints  map[string]float64
+	statements    map[string]statementStat
+}
+
+// NewTelemetry starts measuring a new run.
+func NewTelemetry() *Telemetry {
+	return &Telemetry{start: time.Now()}
+}
+
+// RecordQuery records the execution of one query.
+func (t *Telemetry) RecordQuery(duration time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queries++
+	t.queryDuration = append(t.queryDuration, duration.Seconds())
+	if err != nil {
+		t.queryErrors++
+	}
+}
+
+// RecordFingerprint records the duration of the query with fingerprint,
+// keeping the last one when a query runs several times.
+func (t *Telemetry) RecordFingerprint(fingerprint string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fingerprints == nil {
+		t.fingerprints = make(map[string]float64)
+	}
+	t.fingerprints[fingerprint] = duration.Seconds()
+}
+
+// RecordStatement records the database's statistics of the query with
+// fingerprint.
+func (t *Telemetry) RecordStatement(fingerprint string, stat statementStat) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.statements == nil {
+		t.statements = make(map[string]statementStat)
+	}
+	t.statements[fingerprint] = stat
+}
+
+// RecordSend records the submission of one payload.
+func (t *Telemetry) RecordSend(err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.sendFailures++
+		return
+	}
+	t.sent++
+}
+
+// SetGauge records a point-in-time value, such as the circuit breaker state,
+// that is submitted along with the run counters.
+func (t *Telemetry) SetGauge(name string, value float64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.gauges == nil {
+		t.gauges = make(map[string]float64)
+	}
+	t.gauges[name] = value
+}
+
+// poolSampleInterval is how often the connection pool is sampled during a
+// cycle.
+const poolSampleInterval = 50 * time.Millisecond
+
+// poolSampler samples the connection pool of a database during a cycle and
+// keeps the peak open and in-use connections, which a single sample at the
+// end of the cycle, after every query returned its connection, cannot show.
+// A nil *poolSampler samples nothing.
+type poolSampler struct {
+	db   *sql.DB
+	mu   sync.Mutex
+	peak sql.DBStats
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startPoolSampler samples the pool of db every interval until Stop.
+func startPoolSampler(db *sql.DB, interval time.Duration) *poolSampler {
+	if db == nil {
+		return nil
+	}
+	p := &poolSampler{db: db, stop: make(chan struct{}), done: make(chan struct{})}
+	p.sample()
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.sample()
+			}
+		}
+	}()
+	return p
+}
+
+// sample records the current stats, keeping the peak open and in-use
+// connections.
+func (p *poolSampler) sample() {
+	stats := p.db.Stats()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats.OpenConnections = max(stats.OpenConnections, p.peak.OpenConnections)
+	stats.InUse = max(stats.InUse, p.peak.InUse)
+	p.peak = stats
+}
+
+// Stop ends sampling and returns the stats at the end of the cycle, with
+// the peak open and in-use connections.
+func (p *poolSampler) Stop() (sql.DBStats, bool) {
+	if p == nil {
+		return sql.DBStats{}, false
+	}
+	close(p.stop)
+	<-p.done
+	p.sample()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peak, true
+}
+
+// RecordPoolStats records the connection pool of the database over a cycle,
+// as returned by poolSampler.Stop: the peak open and in-use connections and
+// the idle ones at its end. Waits for a connection are counted since
+// previous, the stats of the cycle before.
+func (t *Telemetry) RecordPoolStats(stats, previous sql.DBStats) {
+	t.SetGauge("db.pool.open", float64(stats.OpenConnections))
+	t.SetGauge("db.pool.in_use", float64(stats.InUse))
+	t.SetGauge("db.pool.idle", float64(stats.Idle))
+	t.SetGauge("db.pool.max_open", float64(stats.MaxOpenConnections))
+	t.SetGauge("db.pool.wait_count", float64(stats.WaitCount-previous.WaitCount))
+	t.SetGauge("db.pool.wait_duration", (stats.WaitDuration - previous.WaitDuration).Seconds())
+}
+
+// RecordDroppedSeries records series dropped by a metric's max_series.
+func (t *Telemetry) RecordDroppedSeries(n int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.droppedSeries += n
+}
+
+// RecordUnsafe records the execution of an unvalidated allow_unsafe query.
+func (t *Telemetry) RecordUnsafe(metric string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !slices.Contains(t.unsafe, metric) {
+		t.unsafe = append(t.unsafe, metric)
+	}
+}
+
+// Snapshot returns the current telemetry values keyed by metric name suffix.
+func (t *Telemetry) Snapshot() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := map[string]float64{
+		"queries.executed":   float64(t.queries),
+		"queries.errors":     float64(t.queryErrors),
+		"query.duration.p95": percentile(t.queryDuration, 95),
+		"payloads.sent":      float64(t.sent),
+		"payloads.failed":    float64(t.sendFailures),
+		"series.dropped":     float64(t.droppedSeries),
+		"run.duration":       time.Since(t.start).Seconds(),
+	}
+	for name, value := range t.gauges {
+		snapshot[name] = value
+	}
+	return snapshot
+}
+
+// Submit sends the telemetry snapshot through sender. It uses a context detached
+// from ctx's cancellation so telemetry is still delivered after a run timed out.
+func (t *Telemetry) Submit(ctx context.Context, sender MetricSender, cfg TelemetryConfig, host string) error {
+	if t == nil || !cfg.Enabled {
+		return nil
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultTelemetryPrefix
+	}
+
+	tags := cfg.Tags
+	if cfg.RunIDTag {
+		tags = append(slices.Clone(tags), "run_id:"+runID)
+	}
+
+	submitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	snapshot := t.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := sender.SendMetric(submitCtx, prefix+"."+name, snapshot[name], tags, host); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	t.mu.Lock()
+	unsafe := slices.Clone(t.unsafe)
+	fingerprints := maps.Clone(t.fingerprints)
+	statements := maps.Clone(t.statements)
+	t.mu.Unlock()
+
+	// Unvalidated queries are reported one series per metric, so they stand
+	// out on dashboards.
+	for _, metric := range unsafe {
+		unsafeTags := append(slices.Clone(tags), "unsafe:true", "metric:"+metric)
+		if err := sender.SendMetric(submitCtx, prefix+".queries.unsafe", 1, unsafeTags, host); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.FingerprintTags {
+		for _, fingerprint := range sortedKeys(fingerprints) {
+			fingerprintTags := append(slices.Clone(tags), "fingerprint:"+fingerprint)
+			if stat, ok := statements[fingerprint]; ok {
+				fingerprintTags = append(fingerprintTags, "query_id:"+stat.ID)
+			}
+			if err := sender.SendMetric(submitCtx, prefix+".query.duration", fingerprints[fingerprint], fingerprintTags, host); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	// The database's statistics of each matched query, as reported by
+	// pg_stat_statements or performance_schema.
+	for _, fingerprint := range sortedKeys(statements) {
+		stat := statements[fingerprint]
+		statementTags := append(slices.Clone(tags), "fingerprint:"+fingerprint, "query_id:"+stat.ID)
+		if err := sender.SendMetric(submitCtx, prefix+".statement.calls", float64(stat.Calls), statementTags, host); err != nil {
+			errs = append(errs, err)
+		}
+		if err := sender.SendMetric(submitCtx, prefix+".statement.total_time", stat.TotalTimeMs/1000, statementTags, host); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// percentile returns the p-th percentile (0-100) of values using linear
+// interpolation between closest ranks. It returns 0 for an empty slice.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{name: "Empty", values: nil, p: 95, want: 0},
+		{name: "Single value", values: []float64{3}, p: 95, want: 3},
+		{name: "Median", values: []float64{4, 1, 3, 2, 5}, p: 50, want: 3},
+		{name: "Interpolated", values: []float64{1, 2, 3, 4}, p: 50, want: 2.5},
+		{name: "Max", values: []float64{1, 2, 3, 4}, p: 100, want: 4},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := percentile(tc.values, tc.p); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTelemetrySubmit(t *testing.T) {
+	telemetry := NewTelemetry()
+	telemetry.RecordQuery(100*time.Millisecond, nil)
+	telemetry.RecordQuery(200*time.Millisecond, errors.New("timeout"))
+	telemetry.RecordSend(nil)
+	telemetry.RecordSend(errors.New("403"))
+	telemetry.RecordDroppedSeries(3)
+
+	sender := &MockMetricSender{}
+	cfg := TelemetryConfig{Enabled: true, Prefix: "test.collector", Tags: []string{"env:test"}}
+	if err := telemetry.Submit(context.Background(), sender, cfg, "host-a"); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, s := range sender.SentMetrics {
+		got[s.Metric] = s.Points[0][1]
+		if s.Host != "host-a" || len(s.Tags) != 1 {
+			t.Errorf("Unexpected host/tags for %s: %s %v", s.Metric, s.Host, s.Tags)
+		}
+	}
+
+	want := map[string]float64{
+		"test.collector.queries.executed": 2,
+		"test.collector.queries.errors":   1,
+		"test.collector.payloads.sent":    1,
+		"test.collector.payloads.failed":  1,
+		"test.collector.series.dropped":   3,
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, got[name])
+		}
+	}
+	if _, ok := got["test.collector.run.duration"]; !ok {
+		t.Error("Expected run duration metric to be sent")
+	}
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	sender := &MockMetricSender{}
+	if err := NewTelemetry().Submit(context.Background(), sender, TelemetryConfig{}, ""); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if len(sender.SentMetrics) != 0 {
+		t.Errorf("Expected no metrics when telemetry is disabled, got %d", len(sender.SentMetrics))
+	}
+}
+
+func TestTelemetryRunIDTag(t *testing.T) {
+	sender := &MockMetricSender{}
+	cfg := TelemetryConfig{Enabled: true, Tags: []string{"env:test"}, RunIDTag: true}
+	if err := NewTelemetry().Submit(context.Background(), sender, cfg, ""); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	for _, s := range sender.SentMetrics {
+		if len(s.Tags) != 2 || s.Tags[1] != "run_id:"+runID {
+			t.Errorf("Expected run_id tag on %s, got %v", s.Metric, s.Tags)
+		}
+	}
+	if len(cfg.Tags) != 1 {
+		t.Errorf("Configured tags must not be modified, got %v", cfg.Tags)
+	}
+}
+
+func TestTelemetryUnsafe(t *testing.T) {
+	telemetry := NewTelemetry()
+	telemetry.RecordUnsafe("app.jobs")
+	telemetry.RecordUnsafe("app.jobs")
+
+	sender := &MockMetricSender{}
+	cfg := TelemetryConfig{Enabled: true, Prefix: "test.collector", Tags: []string{"env:test"}}
+	if err := telemetry.Submit(context.Background(), sender, cfg, ""); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	var unsafe [][]string
+	for _, s := range sender.SentMetrics {
+		if s.Metric == "test.collector.queries.unsafe" {
+			unsafe = append(unsafe, s.Tags)
+		}
+	}
+	if len(unsafe) != 1 {
+		t.Fatalf("Expected 1 unsafe series, got %d", len(unsafe))
+	}
+	if want := "env:test,unsafe:true,metric:app.jobs"; strings.Join(unsafe[0], ",") != want {
+		t.Errorf("Expected tags %s, got %v", want, unsafe[0])
+	}
+}
+
+func TestTelemetryFingerprintTags(t *testing.T) {
+	telemetry := NewTelemetry()
+	telemetry.RecordFingerprint("abc", 2*time.Second)
+	telemetry.RecordFingerprint("abc", 500*time.Millisecond)
+	telemetry.RecordFingerprint("def", time.Second)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		want    map[string]float64
+	}{
+		{name: "Disabled", want: map[string]float64{}},
+		{name: "Enabled", enabled: true, want: map[string]float64{"fingerprint:abc": 0.5, "fingerprint:def": 1}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &MockMetricSender{}
+			cfg := TelemetryConfig{Enabled: true, Prefix: "test.collector", FingerprintTags: tc.enabled}
+			if err := telemetry.Submit(context.Background(), sender, cfg, ""); err != nil {
+				t.Fatalf("Submit failed: %v", err)
+			}
+			got := map[string]float64{}
+			for _, s := range sender.SentMetrics {
+				if s.Metric == "test.collector.query.duration" {
+					got[strings.Join(s.Tags, ",")] = s.Points[0][1]
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTelemetryPoolStats(t *testing.T) {
+	telemetry := NewTelemetry()
+	previous := sql.DBStats{WaitCount: 4, WaitDuration: time.Second}
+	stats := sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    3,
+		InUse:              1,
+		Idle:               2,
+		WaitCount:          7,
+		WaitDuration:       2500 * time.Millisecond,
+	}
+	telemetry.RecordPoolStats(stats, previous)
+
+	snapshot := telemetry.Snapshot()
+	want := map[string]float64{
+		"db.pool.open":          3,
+		"db.pool.in_use":        1,
+		"db.pool.idle":          2,
+		"db.pool.max_open":      10,
+		"db.pool.wait_count":    3,
+		"db.pool.wait_duration": 1.5,
+	}
+	for name, value := range want {
+		if snapshot[name] != value {
+			t.Errorf("Expected %s = %v, got %v", name, value, snapshot[name])
+		}
+	}
+}
+
+func TestPoolSamplerKeepsPeak(t *testing.T) {
+	db, err := sql.Open("series", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sampler := startPoolSampler(db, time.Hour)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler.sample()
+	conn.Close()
+
+	stats, ok := sampler.Stop()
+	if !ok {
+		t.Fatal("Expected pool stats")
+	}
+	if stats.InUse != 1 || stats.OpenConnections != 1 {
+		t.Errorf("Expected a peak of 1 open and in-use connection, got %d and %d", stats.OpenConnections, stats.InUse)
+	}
+	if stats.Idle != 1 {
+		t.Errorf("Expected 1 idle connection at the end, got %d", stats.Idle)
+	}
+	if _, ok := (*poolSampler)(nil).Stop(); ok {
+		t.Error("Expected no stats without a database")
+	}
+}
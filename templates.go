@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// applyMetricTemplates fills in every metric from metric_defaults and the
+// template it extends. A template may extend another template. Fields set
+// on the metric win over the template's, which win over the defaults; tags
+// are combined instead, in that order.
+func applyMetricTemplates(config *Config) error {
+	resolved := make(map[string]MetricConfig, len(config.Templates))
+	var resolve func(name string, chain []string) (MetricConfig, error)
+	resolve = func(name string, chain []string) (MetricConfig, error) {
+		if base, ok := resolved[name]; ok {
+			return base, nil
+		}
+		if slices.Contains(chain, name) {
+			return MetricConfig{}, fmt.Errorf("template cycle: %v", append(chain, name))
+		}
+		tmpl, ok := config.Templates[name]
+		if !ok {
+			return MetricConfig{}, fmt.Errorf("unknown template %q", name)
+		}
+		base := config.MetricDefaults
+		if tmpl.Extends != "" {
+			var err error
+			if base, err = resolve(tmpl.Extends, append(chain, name)); err != nil {
+				return MetricConfig{}, err
+			}
+		}
+		merged := mergeMetric(base, tmpl)
+		resolved[name] = merged
+		return merged, nil
+	}
+
+	for i, metric := range config.Metrics {
+		base := config.MetricDefaults
+		if metric.Extends != "" {
+			var err error
+			if base, err = resolve(metric.Extends, nil); err != nil {
+				return fmt.Errorf("metric %q: %w", metric.Name, err)
+			}
+		}
+		config.Metrics[i] = mergeMetric(base, metric)
+	}
+	return nil
+}
+
+// mergeMetric returns metric with its unset fields taken from base. Tags of
+// both are kept, base tags first.
+func mergeMetric(base, metric MetricConfig) MetricConfig {
+	merged := metric
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(base)
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	merged.Tags = nil
+	for _, tag := range slices.Concat(base.Tags, metric.Tags) {
+		if !slices.Contains(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+	merged.Extends = ""
+	return merged
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigTemplates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `metric_defaults:
+  tags: ["service:billing"]
+  timeout: 10s
+templates:
+  base_db_metric:
+    host: "db-01"
+    tags: ["team:dba"]
+    interval: 5m
+  slow_db_metric:
+    extends: base_db_metric
+    timeout: 1m
+metrics:
+  - name: db.size
+    extends: slow_db_metric
+    query: "SELECT pg_database_size(current_database()) FROM pg_database"
+    tags: ["env:prod"]
+  - name: db.connections
+    extends: base_db_metric
+    host: "db-02"
+    query: "SELECT count(*) FROM pg_stat_activity"
+  - name: db.locks
+    query: "SELECT count(*) FROM pg_locks"
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	size := config.Metrics[0]
+	if want := []string{"service:billing", "team:dba", "env:prod"}; !reflect.DeepEqual(size.Tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, size.Tags)
+	}
+	if size.Host != "db-01" || size.Timeout != time.Minute || size.Interval != 5*time.Minute {
+		t.Errorf("Expected inherited host, timeout and interval, got %+v", size)
+	}
+	if size.Extends != "" {
+		t.Errorf("Expected extends to be resolved, got %q", size.Extends)
+	}
+
+	connections := config.Metrics[1]
+	if connections.Host != "db-02" || connections.Timeout != 10*time.Second {
+		t.Errorf("Expected overridden host and default timeout, got %+v", connections)
+	}
+
+	locks := config.Metrics[2]
+	if !reflect.DeepEqual(locks.Tags, []string{"service:billing"}) || locks.Interval != 0 {
+		t.Errorf("Expected only the defaults, got %+v", locks)
+	}
+}
+
+func TestApplyMetricTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]MetricConfig
+		wantErr   string
+	}{
+		{name: "Unknown", wantErr: "unknown template"},
+		{
+			name:      "Cycle",
+			templates: map[string]MetricConfig{"a": {Extends: "b"}, "b": {Extends: "a"}},
+			wantErr:   "template cycle",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := &Config{Templates: tc.templates, Metrics: []MetricConfig{{Name: "m", Extends: "a"}}}
+			err := applyMetricTemplates(config)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCollectorDue(t *testing.T) {
+	c := &Collector{}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	metric := MetricConfig{Name: "db.size", Interval: 2 * time.Minute}
+
+	steps := []struct {
+		at   time.Duration
+		want bool
+	}{
+		{at: 0, want: true},
+		{at: time.Minute, want: false},
+		// A cycle starting slightly early is not postponed to the next one.
+		{at: 2*time.Minute - 50*time.Millisecond, want: true},
+		{at: 3 * time.Minute, want: false},
+	}
+	for _, step := range steps {
+		if got := c.due(metric, start.Add(step.at)); got != step.want {
+			t.Errorf("At %v: expected due %v, got %v", step.at, step.want, got)
+		}
+	}
+	if !c.due(MetricConfig{Name: "db.locks"}, start) {
+		t.Error("Expected metrics without interval to be due every cycle")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/ryuichi1208/datadog-sql-metrics"
+	defaultServiceName = "datadog-sql-metrics"
+)
+
+// tracer creates the spans of collection cycles, queries and submissions.
+// It is a no-op until setupTracing installs an exporting provider.
+var tracer = otel.Tracer(tracerName)
+
+// TracingConfig enables OpenTelemetry tracing exported over OTLP/HTTP.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the OTLP/HTTP collector, e.g. "http://otel-collector:4318".
+	// When empty the standard OTEL_EXPORTER_OTLP_* variables are used.
+	Endpoint    string `yaml:"endpoint,omitempty"`
+	ServiceName string `yaml:"service_name,omitempty"`
+	// SampleRatio is the fraction of collection cycles traced (default 1).
+	SampleRatio *float64 `yaml:"sample_ratio,omitempty"`
+}
+
+// setupTracing installs a tracer provider exporting spans over OTLP. The
+// returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", version),
+		attribute.String("service.instance.id", runID),
+	)
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*cfg.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startQuerySpan starts the span of one database query. Only the query
+// fingerprint is recorded, as literals may contain sensitive values.
+func startQuerySpan(ctx context.Context, metric MetricConfig) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", databaseType()),
+		attribute.String("db.query.fingerprint", queryFingerprint(metric.Query)),
+		attribute.String("metric.name", metric.Name),
+	))
+}
+
+// startHTTPSpan starts the span of one request to the Datadog API.
+func startHTTPSpan(ctx context.Context, method, rawURL string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("http.request.method", method)}
+	if u, err := url.Parse(rawURL); err == nil {
+		attrs = append(attrs, attribute.String("server.address", u.Hostname()), attribute.String("url.path", u.Path))
+	}
+	return tracer.Start(ctx, method+" "+datadogPathTemplate(rawURL), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// datadogPathTemplate returns the API path of rawURL without metric names
+// or IDs, keeping span names low-cardinality.
+func datadogPathTemplate(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "request"
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// endSpan records err and the HTTP status, when known, and ends span.
+func endSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, logRedactor.RedactString(err.Error()))
+	}
+	span.End()
+}
+
+// endMetricSpan records the outcome of a metric collection and ends span.
+func endMetricSpan(span trace.Span, result MetricResult) {
+	span.SetAttributes(attribute.String("metric.status", result.Status))
+	if result.Series > 0 {
+		span.SetAttributes(attribute.Int("metric.series", result.Series))
+	}
+	if result.Status != statusSent && result.Status != statusSkipped && result.Error != "" {
+		span.SetStatus(codes.Error, result.Error)
+	}
+	span.End()
+}
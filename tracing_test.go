@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDatadogPathTemplate(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://api.datadoghq.com/api/v1/series", want: "/api/v1/series"},
+		{url: "https://api.datadoghq.com/api/v1/metrics/db.users", want: "/api/v1/metrics"},
+		{url: "https://api.datadoghq.com/api/v1/monitor/123?force=true", want: "/api/v1/monitor"},
+		{url: "http://gateway.internal/ingest", want: "/ingest"},
+	}
+
+	for _, tc := range tests {
+		if got := datadogPathTemplate(tc.url); got != tc.want {
+			t.Errorf("datadogPathTemplate(%q) = %q, want %q", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestSubmitSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	orig := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(orig)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client := &DatadogClient{APIKey: "test-key", URL: server.URL + "/api/v1/series"}
+	if err := client.SendMetric(context.Background(), "test.metric", 1, nil, ""); err == nil {
+		t.Fatal("Expected error for 403 response")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "POST /api/v1/series" {
+		t.Errorf("Unexpected span name %q", span.Name())
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("Expected error status, got %v", span.Status())
+	}
+	found := false
+	for _, attr := range span.Attributes() {
+		if attr == attribute.Int("http.response.status_code", http.StatusForbidden) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected response code attribute, got %v", span.Attributes())
+	}
+}
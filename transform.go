@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Transform is one step of a metric's value transformation pipeline, e.g.
+// converting bytes to gigabytes. Exactly one operation is set per step:
+//
+//	transform:
+//	  - divide: 1073741824
+//	  - round: 2
+//	  - clamp: {min: 0, max: 100}
+type Transform struct {
+	Multiply *float64    `yaml:"multiply,omitempty"`
+	Divide   *float64    `yaml:"divide,omitempty"`
+	Add      *float64    `yaml:"add,omitempty"`
+	Round    *int        `yaml:"round,omitempty"`
+	Clamp    *ClampRange `yaml:"clamp,omitempty"`
+}
+
+// ClampRange bounds a value. Either bound may be omitted.
+type ClampRange struct {
+	Min *float64 `yaml:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty"`
+}
+
+// UnmarshalYAML decodes a step and checks that it has exactly one valid operation.
+func (t *Transform) UnmarshalYAML(node *yaml.Node) error {
+	type plain Transform
+	var step plain
+	if err := node.Decode(&step); err != nil {
+		return err
+	}
+	*t = Transform(step)
+	if err := t.validate(); err != nil {
+		return fmt.Errorf("line %d: invalid transform: %w", node.Line, err)
+	}
+	return nil
+}
+
+func (t Transform) validate() error {
+	ops := 0
+	for _, set := range []bool{t.Multiply != nil, t.Divide != nil, t.Add != nil, t.Round != nil, t.Clamp != nil} {
+		if set {
+			ops++
+		}
+	}
+	switch {
+	case ops != 1:
+		return fmt.Errorf("expected exactly one of multiply, divide, add, round or clamp, got %d", ops)
+	case t.Divide != nil && *t.Divide == 0:
+		return fmt.Errorf("divide by zero")
+	case t.Round != nil && *t.Round < 0:
+		return fmt.Errorf("round must not be negative")
+	case t.Clamp != nil && t.Clamp.Min == nil && t.Clamp.Max == nil:
+		return fmt.Errorf("clamp requires min or max")
+	case t.Clamp != nil && t.Clamp.Min != nil && t.Clamp.Max != nil && *t.Clamp.Min > *t.Clamp.Max:
+		return fmt.Errorf("clamp min %v is greater than max %v", *t.Clamp.Min, *t.Clamp.Max)
+	}
+	return nil
+}
+
+// apply runs a single step on value.
+func (t Transform) apply(value float64) float64 {
+	switch {
+	case t.Multiply != nil:
+		return value * *t.Multiply
+	case t.Divide != nil:
+		return value / *t.Divide
+	case t.Add != nil:
+		return value + *t.Add
+	case t.Round != nil:
+		scale := math.Pow(10, float64(*t.Round))
+		return math.Round(value*scale) / scale
+	case t.Clamp != nil:
+		if t.Clamp.Min != nil {
+			value = math.Max(value, *t.Clamp.Min)
+		}
+		if t.Clamp.Max != nil {
+			value = math.Min(value, *t.Clamp.Max)
+		}
+	}
+	return value
+}
+
+// applyTransforms runs the pipeline in order.
+func applyTransforms(value float64, steps []Transform) float64 {
+	for _, step := range steps {
+		value = step.apply(value)
+	}
+	return value
+}
+
+// Timestamp result modes for time_value.
+const (
+	timeValueEpoch = "epoch"
+	timeValueAge   = "age"
+)
+
+// TimeValue selects how a timestamp result is submitted. Timestamps are
+// converted to Unix epoch seconds; with `age` the submitted value is the number
+// of seconds elapsed since then, e.g. time since the last successful backup.
+type TimeValue string
+
+// UnmarshalYAML accepts epoch or age.
+func (v *TimeValue) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Value {
+	case "", timeValueEpoch, timeValueAge:
+		*v = TimeValue(node.Value)
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid time_value %q (must be epoch or age)", node.Line, node.Value)
+}
+
+// apply converts an epoch-seconds value according to the mode.
+func (v TimeValue) apply(value float64, now time.Time) float64 {
+	if v == timeValueAge {
+		return float64(now.UnixNano())/float64(time.Second) - value
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyTransforms(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		value float64
+		want  float64
+	}{
+		{name: "Bytes to GB", input: "- divide: 1073741824\n- round: 2", value: 5368709120, want: 5},
+		{name: "Milliseconds to seconds", input: "- multiply: 0.001", value: 1500, want: 1.5},
+		{name: "Offset", input: "- add: -10", value: 15, want: 5},
+		{name: "Round", input: "- round: 1", value: 3.14159, want: 3.1},
+		{name: "Clamp max", input: "- clamp: {min: 0, max: 100}", value: 120, want: 100},
+		{name: "Clamp min only", input: "- clamp: {min: 0}", value: -3, want: 0},
+		{name: "Empty pipeline", input: "[]", value: 42, want: 42},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var steps []Transform
+			if err := yaml.Unmarshal([]byte(tc.input), &steps); err != nil {
+				t.Fatalf("Failed to parse transforms: %v", err)
+			}
+			if got := applyTransforms(tc.value, steps); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTransformValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "Divide by zero", input: "- divide: 0"},
+		{name: "Two operations", input: "- {multiply: 2, add: 1}"},
+		{name: "No operation", input: "- {}"},
+		{name: "Negative round", input: "- round: -1"},
+		{name: "Empty clamp", input: "- clamp: {}"},
+		{name: "Inverted clamp", input: "- clamp: {min: 10, max: 1}"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var steps []Transform
+			if err := yaml.Unmarshal([]byte(tc.input), &steps); err == nil {
+				t.Error("Expected error but got nil")
+			}
+		})
+	}
+}
+
+func TestTimeValue(t *testing.T) {
+	now := time.Unix(1700000600, 0)
+	tests := []struct {
+		name  string
+		input string
+		want  float64
+	}{
+		{name: "Default is epoch", input: "", want: 1700000000},
+		{name: "Epoch", input: "time_value: epoch", want: 1700000000},
+		{name: "Age", input: "time_value: age", want: 600},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var metric MetricConfig
+			if err := yaml.Unmarshal([]byte(tc.input), &metric); err != nil {
+				t.Fatalf("Failed to parse metric: %v", err)
+			}
+			if got := metric.TimeValue.apply(1700000000, now); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	var metric MetricConfig
+	if err := yaml.Unmarshal([]byte("time_value: iso"), &metric); err == nil {
+		t.Error("Expected error for invalid time_value")
+	}
+}
@@ -6,16 +6,27 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
-// validateDBURL checks if the provided database connection URL is in a valid format.
-// It verifies:
+// validateDBURL checks if the provided database connection URL is in a valid
+// format for the driver named by dbType. A MySQL DSN, e.g.
+// user:pass@tcp(host:3306)/db, must be accepted by the MySQL driver. For
+// PostgreSQL it verifies:
 // - If the URL can be parsed successfully
 // - If the scheme is "postgres" or "postgresql"
 // - If the host part is not empty
 // - If the path part (database name) is specified (not just "/" or empty string)
 // If these conditions are not met, it returns an error.
-func validateDBURL(dbURL string) error {
+func validateDBURL(dbType, dbURL string) error {
+	if dbType == "mysql" {
+		if _, err := mysql.ParseDSN(dbURL); err != nil {
+			return fmt.Errorf("invalid database URL: %w", err)
+		}
+		return nil
+	}
+
 	u, err := url.Parse(dbURL)
 	if err != nil {
 		return fmt.Errorf("invalid database URL: %w", err)
@@ -44,38 +55,65 @@ func validateDBURL(dbURL string) error {
 // validateQuery verifies that the given SQL query is a valid SELECT statement,
 // doesn't contain forbidden commands, and doesn't specify multiple columns in the SELECT clause.
 func validateQuery(query string) error {
+	return validateQueryColumns(query, 1)
+}
+
+// validateQueryColumns is validateQuery allowing up to maxColumns columns in
+// the SELECT clause, as used by metrics with tag columns or templated names.
+// A leading WITH clause and a top-level UNION or UNION ALL of selects are
+// accepted; every select of a union is held to the same column limit.
+func validateQueryColumns(query string, maxColumns int) error {
 	// Remove leading and trailing whitespace, and preserve the original query string
 	cleanQuery := strings.TrimSpace(query)
 	// Lowercase string is used for checking forbidden words and FROM clause
 	lowerQuery := strings.ToLower(cleanQuery)
 
-	// Check if it's a SELECT statement
-	if !strings.HasPrefix(lowerQuery, "select") {
-		return errors.New("invalid query: only SELECT statements are allowed")
+	selects, err := splitSelects(cleanQuery)
+	if err != nil {
+		return err
 	}
+	for _, sel := range selects {
+		lowerSelect := strings.ToLower(sel)
 
-	// Check if FROM clause exists
-	if !strings.Contains(lowerQuery, " from ") {
-		return errors.New("invalid query: missing FROM clause")
+		// Check if it's a SELECT statement
+		if !strings.HasPrefix(lowerSelect, "select") {
+			return errors.New("invalid query: only SELECT statements are allowed")
+		}
+
+		// Check if FROM clause exists
+		if !strings.Contains(lowerSelect, " from ") {
+			return errors.New("invalid query: missing FROM clause")
+		}
 	}
 
-	// Check for forbidden words
+	// Check for forbidden words, including in WITH clauses
 	blacklist := []string{"insert", "update", "delete", "drop", "alter", "truncate", "create", "replace"}
 	reBlack := regexp.MustCompile(`\b(` + strings.Join(blacklist, "|") + `)\b`)
 	if reBlack.MatchString(lowerQuery) {
 		return errors.New("invalid query: detected a forbidden SQL command")
 	}
 
+	for _, sel := range selects {
+		if err := validateSelectColumns(sel, maxColumns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSelectColumns counts the columns of a single SELECT.
+func validateSelectColumns(query string, maxColumns int) error {
 	// Extract the column list (between SELECT and FROM)
 	reSelect := regexp.MustCompile(`(?i)^select\s+(.*?)\s+from\s+`)
-	matches := reSelect.FindStringSubmatch(cleanQuery)
+	matches := reSelect.FindStringSubmatch(query)
 	if len(matches) < 2 {
 		return errors.New("invalid query: unable to parse selected columns")
 	}
 	columns := matches[1]
 
-	// If there's a comma at the top level (outside of parentheses), consider it as multiple column specification
+	// Count the commas at the top level (outside of parentheses) to get the number of columns
 	depth := 0
+	count := 1
 	for _, r := range columns {
 		switch r {
 		case '(':
@@ -86,10 +124,117 @@ func validateQuery(query string) error {
 			}
 		case ',':
 			if depth == 0 {
-				return errors.New("invalid query: multiple columns are not allowed")
+				count++
 			}
 		}
 	}
+	if count > maxColumns {
+		if maxColumns == 1 {
+			return errors.New("invalid query: multiple columns are not allowed")
+		}
+		return fmt.Errorf("invalid query: %d columns selected, at most %d allowed (value, tag and name columns)", count, maxColumns)
+	}
 
 	return nil
 }
+
+var (
+	// reWithClause matches the common table expressions of a masked WITH
+	// clause, up to the main statement.
+	reWithClause = regexp.MustCompile(`^with\s+(?:recursive\s+)?(?:(?:"\s*"|[\w$]+)\s*(?:\(\s*\)\s*)?as\s+(?:(?:not\s+)?materialized\s+)?\(\s*\)\s*(?:,\s*)?)+`)
+	reUnion      = regexp.MustCompile(`\bunion(?:\s+all)?\b`)
+)
+
+// validateCompoundQueries rejects SQL queries with a WITH clause or a UNION
+// when the query_parser feature is disabled, restoring the validator that
+// only accepted a single SELECT.
+func validateCompoundQueries(config *Config) error {
+	if config.Features.Enabled(featureQueryParser) {
+		return nil
+	}
+	var errs []error
+	for _, metric := range config.Metrics {
+		if metric.execSource() || metric.Query == "" || metric.AllowUnsafe {
+			continue
+		}
+		if compoundQuery(metric.Query) {
+			errs = append(errs, fmt.Errorf("metric %q: WITH clauses and UNION require the %s feature", metric.Name, featureQueryParser))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compoundQuery reports whether query has a leading WITH clause or a
+// top-level UNION, which only the query_parser feature accepts.
+func compoundQuery(query string) bool {
+	masked := maskNested(strings.ToLower(strings.TrimSpace(query)))
+	with := strings.HasPrefix(masked, "with") && (len(masked) == 4 || !isWordByte(masked[4]))
+	return with || reUnion.MatchString(masked)
+}
+
+// splitSelects strips a leading WITH clause from query and splits the rest
+// at top-level UNION and UNION ALL, returning the trimmed statements.
+func splitSelects(query string) ([]string, error) {
+	masked := maskNested(strings.ToLower(query))
+	if strings.HasPrefix(masked, "with") && (len(masked) == 4 || !isWordByte(masked[4])) {
+		loc := reWithClause.FindStringIndex(masked)
+		if loc == nil {
+			return nil, errors.New("invalid query: unable to parse WITH clause")
+		}
+		query, masked = query[loc[1]:], masked[loc[1]:]
+	}
+
+	var selects []string
+	start := 0
+	for _, loc := range reUnion.FindAllStringIndex(masked, -1) {
+		selects = append(selects, strings.TrimSpace(query[start:loc[0]]))
+		start = loc[1]
+	}
+	return append(selects, strings.TrimSpace(query[start:])), nil
+}
+
+// maskNested returns s with the contents of parentheses and quotes blanked
+// out, keeping the offsets, so top-level keywords can be searched in it.
+func maskNested(s string) string {
+	masked := []byte(s)
+	depth := 0
+	var quote byte
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case quote != 0:
+			closing := c == quote
+			if closing {
+				quote = 0
+			}
+			if !closing || depth > 0 {
+				masked[i] = ' '
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			if depth > 0 {
+				masked[i] = ' '
+			}
+		case c == '(':
+			if depth > 0 {
+				masked[i] = ' '
+			}
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+			if depth > 0 {
+				masked[i] = ' '
+			}
+		case depth > 0:
+			masked[i] = ' '
+		}
+	}
+	return string(masked)
+}
+
+// isWordByte reports whether c can be part of an unquoted identifier.
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
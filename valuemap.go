@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValueMap translates textual query results such as 'primary'/'replica' to
+// numbers, so state queries can be graphed as gauges.
+type ValueMap map[string]float64
+
+// lookup maps a textual result. Surrounding whitespace (e.g. CHAR padding) is
+// ignored. Unknown strings use def when set and are an error otherwise.
+func (m ValueMap) lookup(text string, def *float64) (float64, error) {
+	if value, ok := m[strings.TrimSpace(text)]; ok {
+		return value, nil
+	}
+	if def != nil {
+		return *def, nil
+	}
+	return 0, fmt.Errorf("unmapped value %q (add it to value_map or set value_map_default)", text)
+}
+
+// mapTextValue applies the metric's value map to a scanned column value. It
+// reports false when the value is not text or no value map is configured.
+func mapTextValue(metric MetricConfig, v interface{}) (float64, bool, error) {
+	if len(metric.ValueMap) == 0 {
+		return 0, false, nil
+	}
+	var text string
+	switch v := v.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return 0, false, nil
+	}
+	value, err := metric.ValueMap.lookup(text, metric.ValueMapDefault)
+	return value, true, err
+}
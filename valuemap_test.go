@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMapTextValue(t *testing.T) {
+	var metric MetricConfig
+	input := "value_map:\n  primary: 1\n  replica: 0\n"
+	if err := yaml.Unmarshal([]byte(input), &metric); err != nil {
+		t.Fatalf("Failed to parse metric: %v", err)
+	}
+	unknown := -1.0
+	withDefault := metric
+	withDefault.ValueMapDefault = &unknown
+
+	tests := []struct {
+		name       string
+		metric     MetricConfig
+		value      interface{}
+		want       float64
+		wantMapped bool
+		wantErr    bool
+	}{
+		{name: "Mapped string", metric: metric, value: "primary", want: 1, wantMapped: true},
+		{name: "Mapped bytes with padding", metric: metric, value: []byte("replica  "), want: 0, wantMapped: true},
+		{name: "Unknown without default", metric: metric, value: "standby", wantMapped: true, wantErr: true},
+		{name: "Unknown with default", metric: withDefault, value: "standby", want: -1, wantMapped: true},
+		{name: "Numeric value not mapped", metric: metric, value: int64(3)},
+		{name: "No value map", metric: MetricConfig{}, value: "primary"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, mapped, err := mapTextValue(tc.metric, tc.value)
+			if mapped != tc.wantMapped {
+				t.Fatalf("Expected mapped=%v, got %v", tc.wantMapped, mapped)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Default payloads of the webhook sink: the point, or the batch of points,
+// encoded as JSON.
+const (
+	defaultWebhookTemplate      = "{{ json . }}"
+	defaultWebhookBatchTemplate = "{{ json .Points }}"
+)
+
+// WebhookConfig configures the webhook sink, which posts every point (or
+// the points of a cycle) to an HTTP endpoint with a templated body.
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Method string `yaml:"method,omitempty"`
+	// Template is a Go template rendering the request body. A point exposes
+	// .Metric, .Value, .Tags, .Host and .Timestamp; in batch mode the
+	// template receives .Points. The json function encodes a value as JSON.
+	Template    string            `yaml:"template,omitempty"`
+	ContentType string            `yaml:"content_type,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	Auth        WebhookAuth       `yaml:"auth,omitempty"`
+	// Batch sends the points of a cycle in one request instead of one each.
+	Batch bool `yaml:"batch,omitempty"`
+	// AcceptedStatusCodes lists the successful response codes (default any 2xx).
+	AcceptedStatusCodes []int `yaml:"accepted_status_codes,omitempty"`
+}
+
+// WebhookAuth authenticates webhook requests with a bearer token or basic
+// auth. Secrets are read from environment variables.
+type WebhookAuth struct {
+	Type        string `yaml:"type,omitempty"`
+	TokenEnv    string `yaml:"token_env,omitempty"`
+	Username    string `yaml:"username,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+}
+
+// WebhookPoint is the template data of one point.
+type WebhookPoint struct {
+	Metric    string   `json:"metric"`
+	Value     float64  `json:"value"`
+	Tags      []string `json:"tags,omitempty"`
+	Host      string   `json:"host,omitempty"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// WebhookSender posts points rendered through a template.
+type WebhookSender struct {
+	cfg      WebhookConfig
+	tmpl     *template.Template
+	setAuth  func(req *http.Request)
+	accepted func(status int) bool
+
+	mu      sync.Mutex
+	pending []WebhookPoint
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// newWebhookSink creates the webhook sink from the `webhook:` block.
+func newWebhookSink(_ context.Context, config *Config, _ *options) (MetricSender, error) {
+	sender, err := newWebhookSender(config.Webhook)
+	if err != nil {
+		return nil, configError("%w", err)
+	}
+	return sender, nil
+}
+
+// newWebhookSender validates cfg and parses its template.
+func newWebhookSender(cfg WebhookConfig) (*WebhookSender, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook sink requires a url")
+	}
+	text := cfg.Template
+	if text == "" {
+		text = defaultWebhookTemplate
+		if cfg.Batch {
+			text = defaultWebhookBatchTemplate
+		}
+	}
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+
+	sender := &WebhookSender{cfg: cfg, tmpl: tmpl, setAuth: func(*http.Request) {}}
+	switch cfg.Auth.Type {
+	case "":
+	case "bearer":
+		token := os.Getenv(cfg.Auth.TokenEnv)
+		logRedactor.AddSecret(token)
+		sender.setAuth = func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	case "basic":
+		password := os.Getenv(cfg.Auth.PasswordEnv)
+		logRedactor.AddSecret(password)
+		sender.setAuth = func(req *http.Request) { req.SetBasicAuth(cfg.Auth.Username, password) }
+	default:
+		return nil, fmt.Errorf("unknown webhook auth type %q (must be bearer or basic)", cfg.Auth.Type)
+	}
+
+	sender.accepted = func(status int) bool { return status >= 200 && status < 300 }
+	if len(cfg.AcceptedStatusCodes) > 0 {
+		sender.accepted = func(status int) bool {
+			for _, code := range cfg.AcceptedStatusCodes {
+				if code == status {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return sender, nil
+}
+
+// SendMetric posts the point, or buffers it until Flush in batch mode.
+func (w *WebhookSender) SendMetric(ctx context.Context, metricName string, value float64, tags []string, host string) error {
+	point := WebhookPoint{Metric: metricName, Value: value, Tags: tags, Host: host, Timestamp: time.Now().Unix()}
+	if w.cfg.Batch {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.pending = append(w.pending, point)
+		return nil
+	}
+	return w.post(ctx, point)
+}
+
+// Flush posts the buffered points of a batch mode webhook.
+func (w *WebhookSender) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	return w.post(ctx, struct{ Points []WebhookPoint }{Points: pending})
+}
+
+// post renders data through the template and sends it.
+func (w *WebhookSender) post(ctx context.Context, data interface{}) error {
+	var body bytes.Buffer
+	if err := w.tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render webhook payload: %w", err)
+	}
+
+	method := w.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, w.cfg.URL, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range w.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	contentType := w.cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	w.setAuth(req)
+
+	size := body.Len()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if !w.accepted(resp.StatusCode) {
+		return statusError(resp.StatusCode, resp.Body)
+	}
+	expvarPayloadsSent.Add(1)
+	expvarBytesSent.Add(int64(size))
+	return nil
+}
+
+// Close posts any points still buffered.
+func (w *WebhookSender) Close(ctx context.Context) error {
+	return w.Flush(ctx)
+}
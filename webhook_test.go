@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookSenderTemplate(t *testing.T) {
+	var body, auth, header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		auth = r.Header.Get("Authorization")
+		header = r.Header.Get("X-Team")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("WEBHOOK_TOKEN", "s3cret")
+	sender, err := newWebhookSender(WebhookConfig{
+		URL:      server.URL,
+		Template: `{"name":"{{ .Metric }}","v":{{ .Value }},"tags":{{ json .Tags }}}`,
+		Headers:  map[string]string{"X-Team": "sre"},
+		Auth:     WebhookAuth{Type: "bearer", TokenEnv: "WEBHOOK_TOKEN"},
+	})
+	if err != nil {
+		t.Fatalf("newWebhookSender failed: %v", err)
+	}
+	if err := sender.SendMetric(context.Background(), "db.users", 42, []string{"env:prod"}, ""); err != nil {
+		t.Fatalf("SendMetric failed: %v", err)
+	}
+
+	if body != `{"name":"db.users","v":42,"tags":["env:prod"]}` {
+		t.Errorf("Unexpected body %s", body)
+	}
+	if auth != "Bearer s3cret" || header != "sre" {
+		t.Errorf("Unexpected headers: Authorization %q, X-Team %q", auth, header)
+	}
+}
+
+func TestWebhookSenderBatch(t *testing.T) {
+	var requests int
+	var points []WebhookPoint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		user, pass, _ := r.BasicAuth()
+		if user != "collector" || pass != "pw" {
+			t.Errorf("Unexpected basic auth %q:%q", user, pass)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&points); err != nil {
+			t.Errorf("Failed to decode batch: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	t.Setenv("WEBHOOK_PASSWORD", "pw")
+	sender, err := newWebhookSender(WebhookConfig{
+		URL:   server.URL,
+		Batch: true,
+		Auth:  WebhookAuth{Type: "basic", Username: "collector", PasswordEnv: "WEBHOOK_PASSWORD"},
+	})
+	if err != nil {
+		t.Fatalf("newWebhookSender failed: %v", err)
+	}
+	ctx := context.Background()
+	for _, name := range []string{"db.users", "db.orders"} {
+		if err := sender.SendMetric(ctx, name, 1, nil, "db-01"); err != nil {
+			t.Fatalf("SendMetric failed: %v", err)
+		}
+	}
+	if requests != 0 {
+		t.Fatal("Expected batch mode to wait for Flush")
+	}
+	if err := sender.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if requests != 1 || len(points) != 2 || points[1].Metric != "db.orders" || points[0].Host != "db-01" {
+		t.Errorf("Unexpected batch: %d requests, points %+v", requests, points)
+	}
+}
+
+func TestNewWebhookSenderInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  WebhookConfig
+	}{
+		{name: "Missing URL", cfg: WebhookConfig{}},
+		{name: "Bad template", cfg: WebhookConfig{URL: "http://x", Template: "{{ .Metric "}},
+		{name: "Unknown auth", cfg: WebhookConfig{URL: "http://x", Auth: WebhookAuth{Type: "digest"}}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newWebhookSender(tc.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestWebhookSenderRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sender, err := newWebhookSender(WebhookConfig{URL: server.URL, AcceptedStatusCodes: []int{202}})
+	if err != nil {
+		t.Fatalf("newWebhookSender failed: %v", err)
+	}
+	if err := sender.SendMetric(context.Background(), "db.users", 1, nil, ""); err == nil {
+		t.Error("Expected error for a status code that is not accepted")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// defaultInitialWindow is the window of a templated query's first run in a
+// single run without previous state.
+const defaultInitialWindow = time.Hour
+
+// windowTime is a window bound. It renders as a quoted UTC timestamp literal,
+// e.g. '2024-05-01 12:00:00', accepted by PostgreSQL, MySQL and SQLite.
+// Methods of time.Time such as .Unix remain available in templates.
+type windowTime struct{ time.Time }
+
+// String implements fmt.Stringer.
+func (t windowTime) String() string {
+	return "'" + t.UTC().Format(time.DateTime) + "'"
+}
+
+// windowInterval is the length of a window. It renders as whole seconds.
+type windowInterval time.Duration
+
+// String implements fmt.Stringer.
+func (d windowInterval) String() string {
+	return strconv.FormatInt(int64(time.Duration(d)/time.Second), 10)
+}
+
+// Seconds returns the length in seconds.
+func (d windowInterval) Seconds() float64 {
+	return time.Duration(d).Seconds()
+}
+
+// queryWindow is the template data of a query: the collection window ending
+// now and starting at the previous successful run.
+type queryWindow struct {
+	Now      windowTime
+	LastRun  windowTime
+	Interval windowInterval
+}
+
+// initialWindow returns the window of a templated query's first run:
+// initial_window, the daemon interval or one hour.
+func initialWindow(config *Config, interval time.Duration) time.Duration {
+	switch {
+	case config.InitialWindow > 0:
+		return config.InitialWindow
+	case interval > 0:
+		return interval
+	default:
+		return defaultInitialWindow
+	}
+}
+
+// newQueryWindow returns the window ending at now. Without a previous run,
+// the window starts one interval ago.
+func newQueryWindow(now, lastRun time.Time, interval time.Duration) queryWindow {
+	if lastRun.IsZero() {
+		lastRun = now.Add(-interval)
+	}
+	return queryWindow{
+		Now:      windowTime{now},
+		LastRun:  windowTime{lastRun},
+		Interval: windowInterval(now.Sub(lastRun)),
+	}
+}
+
+// isQueryTemplate reports whether query uses time-window placeholders.
+func isQueryTemplate(query string) bool {
+	return strings.Contains(query, "{{")
+}
+
+// renderQuery renders the placeholders of query for window.
+func renderQuery(query string, window queryWindow) (string, error) {
+	tmpl, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, window); err != nil {
+		return "", fmt.Errorf("failed to render query template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// withWindow returns the metric with its query rendered for window. Metrics
+// without placeholders are returned unchanged.
+func (m MetricConfig) withWindow(window queryWindow) (MetricConfig, error) {
+	if !isQueryTemplate(m.Query) {
+		return m, nil
+	}
+	query, err := renderQuery(m.Query, window)
+	if err != nil {
+		return m, err
+	}
+	m.Query = query
+	return m, nil
+}
+
+// runState is the state kept across runs: the end of the last successful
+// window of every templated metric. It is persisted to the state file, if
+// one is configured, so single runs scheduled by cron continue where the
+// previous run stopped. It is safe for concurrent use.
+type runState struct {
+	path string
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time
+	dirty   bool
+}
+
+// stateFile is the JSON layout of the state file.
+type stateFile struct {
+	LastRun map[string]time.Time `json:"last_run"`
+}
+
+// loadRunState reads the state file at path. A missing file yields an empty
+// state; an empty path keeps the state in memory only.
+func loadRunState(path string) (*runState, error) {
+	state := &runState{path: path, lastRun: make(map[string]time.Time)}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	for name, t := range file.LastRun {
+		state.lastRun[name] = t
+	}
+	return state, nil
+}
+
+// LastRun returns the end of the metric's last successful window.
+func (s *runState) LastRun(metric string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun[metric]
+}
+
+// SetLastRun records the end of the metric's last successful window.
+func (s *runState) SetLastRun(metric string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun[metric] = t
+	s.dirty = true
+}
+
+// Save writes the state file if the state changed. The file is replaced
+// atomically so a crash never leaves a truncated state behind.
+func (s *runState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path == "" || !s.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(stateFile{LastRun: s.lastRun}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
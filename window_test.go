@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderQuery(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	window := newQueryWindow(now, time.Time{}, 5*time.Minute)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "Bounds",
+			query: "SELECT count(*) FROM orders WHERE created_at >= {{.LastRun}} AND created_at < {{.Now}}",
+			want:  "SELECT count(*) FROM orders WHERE created_at >= '2024-05-01 11:55:00' AND created_at < '2024-05-01 12:00:00'",
+		},
+		{
+			name:  "Interval",
+			query: "SELECT count(*) / {{.Interval}} FROM orders",
+			want:  "SELECT count(*) / 300 FROM orders",
+		},
+		{
+			name:  "Epoch",
+			query: "SELECT count(*) FROM events WHERE ts >= {{.LastRun.Unix}}",
+			want:  "SELECT count(*) FROM events WHERE ts >= 1714564500",
+		},
+		{name: "UnknownField", query: "SELECT {{.Yesterday}}", wantErr: true},
+		{name: "Malformed", query: "SELECT {{.Now", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := renderQuery(tc.query, window)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renderQuery failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestNewQueryWindowLastRun(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	window := newQueryWindow(now, now.Add(-90*time.Second), time.Hour)
+	if window.LastRun.Time != now.Add(-90*time.Second) {
+		t.Errorf("Expected the window to start at the last run, got %v", window.LastRun)
+	}
+	if window.Interval.String() != "90" {
+		t.Errorf("Expected an interval of 90 seconds, got %s", window.Interval)
+	}
+}
+
+func TestRunStateSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := loadRunState(path)
+	if err != nil {
+		t.Fatalf("loadRunState failed: %v", err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no state file without changes")
+	}
+
+	lastRun := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state.SetLastRun("orders.created", lastRun)
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := loadRunState(path)
+	if err != nil {
+		t.Fatalf("loadRunState failed: %v", err)
+	}
+	if got := reloaded.LastRun("orders.created"); !got.Equal(lastRun) {
+		t.Errorf("Expected last run %v, got %v", lastRun, got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRunState(path); err == nil {
+		t.Error("Expected error for a corrupt state file")
+	}
+}
+
+func TestCollectTemplatedQueryInvalid(t *testing.T) {
+	collector := &Collector{Sender: &MockMetricSender{}}
+	metric := MetricConfig{Name: "orders.created", Query: "SELECT count(*) FROM orders WHERE created_at >= {{.Since}}"}
+
+	result := collector.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), metric)
+	if result.Status != statusInvalid || !strings.Contains(result.Error, "Since") {
+		t.Errorf("Expected an invalid template error, got %+v", result)
+	}
+	if !collector.runState().LastRun(metric.Name).IsZero() {
+		t.Error("Expected no last run after a failed window")
+	}
+}
+
+func TestValidateMetricQueryTemplate(t *testing.T) {
+	metric := MetricConfig{Name: "orders.created", Query: "SELECT count(*) FROM orders WHERE created_at >= {{.LastRun}} AND created_at < {{.Now}}"}
+	if err := validateMetricQuery(metric); err != nil {
+		t.Errorf("Expected a valid templated query, got %v", err)
+	}
+}
+
+func TestCollectTemplatedQueryRecordsLastRun(t *testing.T) {
+	collector := &Collector{Sender: &MockMetricSender{}, Window: time.Minute}
+	metric := MetricConfig{
+		Name:    "orders.created",
+		Query:   "created_at >= {{.LastRun}}",
+		Source:  "exec",
+		Command: []string{"sh", "-c", `grep -q "created_at .* '20" && echo '{"samples":[{"value":1}]}'`},
+	}
+
+	before := time.Now()
+	result := collector.collectMetric(context.Background(), &SQLDB{}, NewTelemetry(), metric)
+	if result.Status != statusSent {
+		t.Fatalf("Expected the metric to be sent, got %+v", result)
+	}
+	if lastRun := collector.runState().LastRun(metric.Name); lastRun.Before(before) {
+		t.Errorf("Expected the last run to be recorded, got %v", lastRun)
+	}
+}